@@ -3,6 +3,17 @@ CREATE TABLE IF NOT EXISTS patterns (
 	-- Enterprise policy overrides (optional)
 	block_threshold DOUBLE PRECISION,
 	allow_threshold DOUBLE PRECISION,
+	-- Optional post-match verifier (LUHN, TCKN, VKN, IBAN, UK_NINO, US_SSN)
+	verifier TEXT,
+	verifier_policy TEXT DEFAULT 'DROP',
+	-- Optional context keywords (JSON arrays) and window size in characters
+	context_keywords TEXT,
+	negative_context_keywords TEXT,
+	context_window INTEGER,
+	-- Optional redaction strategy (RANDOM, PARTIAL, LABEL, HMAC, FORMAT_PRESERVING, PSEUDONYM)
+	redaction_strategy TEXT,
+	redaction_label TEXT,
+	redaction_keep_last INTEGER,
     id SERIAL PRIMARY KEY,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
@@ -47,6 +58,18 @@ INSERT INTO patterns (name, regex, description, category, is_active) VALUES
 ('JAILBREAK_DAN', '(?i)(DAN mode|do anything now)', 'DAN Jailbreak Attempt', 'INJECTION', true)
 ON CONFLICT (name) DO NOTHING;
 
+-- Attach checksum verifiers to structured identifiers (keeps operator overrides)
+UPDATE patterns SET verifier = 'LUHN' WHERE name = 'CREDIT_CARD' AND verifier IS NULL;
+UPDATE patterns SET verifier = 'TCKN' WHERE name = 'TCKN' AND verifier IS NULL;
+UPDATE patterns SET verifier = 'VKN' WHERE name = 'VKN' AND verifier IS NULL;
+UPDATE patterns SET verifier = 'IBAN' WHERE name = 'IBAN_TR' AND verifier IS NULL;
+UPDATE patterns SET verifier = 'UK_NINO' WHERE name = 'UK_NINO' AND verifier IS NULL;
+UPDATE patterns SET verifier = 'US_SSN' WHERE name = 'US_SSN' AND verifier IS NULL;
+
+-- Context keywords for identifiers that are ambiguous without surrounding words
+UPDATE patterns SET context_keywords = '["vergi", "vkn", "tax id", "tax number", "vergi no"]' WHERE name = 'VKN' AND context_keywords IS NULL;
+UPDATE patterns SET context_keywords = '["mersis"]' WHERE name = 'MERSIS' AND context_keywords IS NULL;
+
 -- Create allowlist table
 CREATE TABLE IF NOT EXISTS allowlist (
     id SERIAL PRIMARY KEY,
@@ -67,7 +90,11 @@ CREATE TABLE IF NOT EXISTS blocklist (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP WITH TIME ZONE,
     value TEXT NOT NULL,
-    description TEXT
+    description TEXT,
+    match_type TEXT DEFAULT 'LITERAL',
+    case_insensitive BOOLEAN DEFAULT FALSE,
+    whole_word BOOLEAN DEFAULT FALSE,
+    normalize BOOLEAN DEFAULT FALSE
 );
 
 CREATE INDEX IF NOT EXISTS idx_blocklist_deleted_at ON blocklist (deleted_at);
@@ -0,0 +1,148 @@
+package ai
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"thyris-sz/internal/config"
+)
+
+// ErrCircuitOpen is returned instead of calling the judge while its circuit breaker is open.
+var ErrCircuitOpen = errors.New("AI judge circuit breaker is open")
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// Breaker defaults, used when no configuration is loaded
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerCooldown         = 30 * time.Second
+)
+
+// BreakerStatus reports the judge's circuit breaker.
+type BreakerStatus struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenUntil           time.Time `json:"open_until,omitempty"`
+}
+
+// breakerOutcome is how a judge call counts towards the breaker.
+type breakerOutcome int
+
+const (
+	outcomeSuccess breakerOutcome = iota
+	outcomeFailure
+	// outcomeIgnored: the caller gave up before the judge answered, which says nothing
+	// about the judge's health
+	outcomeIgnored
+)
+
+// circuitBreaker stops judge calls after consecutive failures. Once the cooldown has
+// passed, a single trial call decides whether it closes again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openUntil time.Time
+	trial     bool // a half-open trial call is in flight
+}
+
+var judgeBreaker = &circuitBreaker{state: BreakerClosed}
+
+// breakerSettings returns the failure threshold (0: breaker disabled) and cooldown.
+func breakerSettings() (int, time.Duration) {
+	cfg := config.AppConfig
+	if cfg == nil {
+		return defaultBreakerFailureThreshold, defaultBreakerCooldown
+	}
+	cooldown := defaultBreakerCooldown
+	if cfg.AIBreakerCooldownSeconds > 0 {
+		cooldown = time.Duration(cfg.AIBreakerCooldownSeconds) * time.Second
+	}
+	return cfg.AIBreakerFailureThreshold, cooldown
+}
+
+// allow reports whether a judge call may proceed.
+func (b *circuitBreaker) allow() bool {
+	if threshold, _ := breakerSettings(); threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Now().Before(b.openUntil) {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		log.Printf("[ai] Judge circuit breaker half-open, sending a trial call")
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+// record counts the outcome of a judge call allowed by allow.
+func (b *circuitBreaker) record(outcome breakerOutcome) {
+	threshold, cooldown := breakerSettings()
+	if threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch outcome {
+	case outcomeIgnored:
+		b.trial = false
+	case outcomeSuccess:
+		if b.state != BreakerClosed {
+			log.Printf("[ai] Judge circuit breaker closed")
+		}
+		b.state, b.failures, b.trial = BreakerClosed, 0, false
+	case outcomeFailure:
+		b.failures++
+		b.trial = false
+		if b.state == BreakerHalfOpen || b.failures >= threshold {
+			b.state = BreakerOpen
+			b.openUntil = time.Now().Add(cooldown)
+			log.Printf("[ai] Judge circuit breaker open for %s after %d consecutive failure(s)", cooldown, b.failures)
+		}
+	}
+}
+
+func (b *circuitBreaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := BreakerStatus{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state == BreakerOpen {
+		s.OpenUntil = b.openUntil
+	}
+	return s
+}
+
+// JudgeBreaker returns the state of the judge's circuit breaker.
+func JudgeBreaker() BreakerStatus {
+	return judgeBreaker.status()
+}
+
+// ResetJudgeBreaker closes the judge's circuit breaker.
+// This is primarily useful for testing.
+func ResetJudgeBreaker() {
+	judgeBreaker.mu.Lock()
+	defer judgeBreaker.mu.Unlock()
+	judgeBreaker.state, judgeBreaker.failures, judgeBreaker.trial = BreakerClosed, 0, false
+	judgeBreaker.openUntil = time.Time{}
+}
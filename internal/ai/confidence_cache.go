@@ -1,25 +1,34 @@
 package ai
 
 import (
+	"container/list"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"thyris-sz/internal/cache"
+	"thyris-sz/internal/config"
 )
 
-// cache key: ai_conf:{label}:{sha256(text)}
+// Cache kinds, used in keys and stats
+const (
+	cacheKindConfidence = "confidence"
+	cacheKindVerdict    = "verdict"
+)
+
+// cache key: ai_conf:{label}:{sha256(model, text)}
 func aiConfidenceCacheKey(label, text string) string {
-	h := sha256.Sum256([]byte(text))
+	h := sha256.Sum256([]byte(judgeModel() + "\x00" + text))
 	return "ai_conf:" + label + ":" + hex.EncodeToString(h[:])
 }
 
 func GetCachedConfidence(label, text string) (float64, bool) {
-	key := aiConfidenceCacheKey(label, text)
-	val, err := cache.RDB.Get(context.Background(), key).Result()
-	if err != nil {
+	val, ok := getCached(aiConfidenceCacheKey(label, text))
+	if !ok {
 		return 0, false
 	}
 
@@ -31,6 +40,351 @@ func GetCachedConfidence(label, text string) (float64, bool) {
 }
 
 func SetCachedConfidence(label, text string, score float64, ttl time.Duration) {
-	key := aiConfidenceCacheKey(label, text)
-	_ = cache.RDB.Set(context.Background(), key, strconv.FormatFloat(score, 'f', 4, 64), ttl).Err()
+	setCached(aiConfidenceCacheKey(label, text), strconv.FormatFloat(score, 'f', 4, 64), ttl)
+}
+
+// getCached looks a key up in the in-process LRU, then in Redis; Redis hits are
+// copied into the LRU.
+func getCached(key string) (string, bool) {
+	val, ok, _ := lookupCached(key)
+	return val, ok
+}
+
+// lookupCached is getCached, also reporting whether the hit was local.
+func lookupCached(key string) (val string, ok bool, local bool) {
+	if lru := localCache(); lru != nil {
+		if val, ok := lru.get(key); ok {
+			return val, true, true
+		}
+	}
+	if cache.RDB == nil {
+		return "", false, false
+	}
+
+	val, err := cache.RDB.Get(context.Background(), key).Result()
+	if err != nil {
+		return "", false, false
+	}
+	if lru := localCache(); lru != nil {
+		ttl, err := cache.RDB.TTL(context.Background(), key).Result()
+		if err != nil || ttl < 0 {
+			ttl = 0
+		}
+		lru.set(key, val, ttl)
+	}
+	return val, true, false
+}
+
+// setCached stores a value in the LRU and Redis. A ttl of zero never expires.
+func setCached(key, val string, ttl time.Duration) {
+	if lru := localCache(); lru != nil {
+		lru.set(key, val, ttl)
+	}
+	if cache.RDB == nil {
+		return
+	}
+	_ = cache.RDB.Set(context.Background(), key, val, ttl).Err()
+}
+
+// cachedLookup is a read-through lookup: a cached value is returned as is, otherwise
+// fetch runs and a successful result is cached for ttl. Concurrent lookups of the same
+// missing key share a single fetch; errors are not cached. The shared fetch does not end
+// with any one caller's ctx, so a caller whose budget runs out gives up on its own without
+// failing the others.
+func cachedLookup(ctx context.Context, kind, key string, ttl time.Duration, fetch func(context.Context) (string, error)) (string, error) {
+	stats := cacheStatsFor(kind)
+	stats.lookups.Add(1)
+
+	if val, ok, local := lookupCached(key); ok {
+		if local {
+			stats.localHits.Add(1)
+		} else {
+			stats.redisHits.Add(1)
+		}
+		return val, nil
+	}
+	// A spent budget skips the call; cached results above are still served
+	if err := ctx.Err(); err != nil {
+		stats.errors.Add(1)
+		return "", err
+	}
+
+	val, err, shared := inflight.do(ctx, key, func(ctx context.Context) (string, error) {
+		stats.calls.Add(1)
+		val, err := fetch(ctx)
+		if err != nil {
+			return "", err
+		}
+		setCached(key, val, ttl)
+		return val, nil
+	})
+	if shared {
+		stats.deduplicated.Add(1)
+	}
+	if err != nil {
+		stats.errors.Add(1)
+	}
+	return val, err
+}
+
+// confidenceCacheTTL returns how long AI confidence scores are cached.
+func confidenceCacheTTL() time.Duration {
+	if cfg := config.AppConfig; cfg != nil && cfg.AIConfidenceCacheTTLSeconds > 0 {
+		return time.Duration(cfg.AIConfidenceCacheTTLSeconds) * time.Second
+	}
+	return 24 * time.Hour
+}
+
+// verdictCacheTTL returns how long AI_PROMPT verdicts are cached.
+func verdictCacheTTL() time.Duration {
+	if cfg := config.AppConfig; cfg != nil && cfg.AIVerdictCacheTTLSeconds > 0 {
+		return time.Duration(cfg.AIVerdictCacheTTLSeconds) * time.Second
+	}
+	return time.Hour
+}
+
+// --- singleflight ---
+
+// flightCall is an in-flight fetch that later lookups of the same key wait for.
+type flightCall struct {
+	done    chan struct{}
+	val     string
+	err     error
+	waiters int                // callers still waiting for the result
+	cancel  context.CancelFunc // ends the fetch once no caller waits for it
+}
+
+// flightGroup collapses concurrent fetches of the same key into one.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+var inflight = &flightGroup{calls: make(map[string]*flightCall)}
+
+// do starts fn for key unless a call for key is already in flight, in which case it joins
+// that call and reports shared. fn runs in its own goroutine on a context detached from
+// ctx, which keeps its values but not its deadline; the judge calls fn makes are each
+// bounded by the judge timeout. Every caller waits for the result or for its own ctx to
+// end; the last caller to give up cancels fn and waits for it to return, so a fetch never
+// outlives all of its callers.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (string, error)) (val string, err error, shared bool) {
+	g.mu.Lock()
+	c, shared := g.calls[key]
+	if !shared {
+		fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go g.run(fetchCtx, key, c, fn)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err, shared
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	c.waiters--
+	last := c.waiters == 0
+	if last && g.calls[key] == c {
+		// Later lookups start a fresh fetch rather than joining a canceled one
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	if last {
+		c.cancel()
+		<-c.done
+	}
+	return "", ctx.Err(), shared
+}
+
+// run executes the fetch of c and releases its waiters.
+func (g *flightGroup) run(ctx context.Context, key string, c *flightCall, fn func(context.Context) (string, error)) {
+	defer c.cancel()
+	c.val, c.err = fn(ctx)
+
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	close(c.done)
+}
+
+// --- in-process LRU ---
+
+// lruEntry is a cached value and its expiry (zero: never).
+type lruEntry struct {
+	key       string
+	val       string
+	expiresAt time.Time
+}
+
+// lruCache is a bounded, TTL-aware LRU of cached AI results.
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{capacity: capacity, items: make(map[string]*list.Element), order: list.New()}
+}
+
+func (c *lruCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := el.Value.(*lruEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return "", false
+	}
+	c.order.MoveToFront(el)
+	return entry.val, true
+}
+
+func (c *lruCache) set(key, val string, ttl time.Duration) {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.val, entry.expiresAt = val, expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, val: val, expiresAt: expiresAt})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+var (
+	localCacheMu sync.Mutex
+	localLRU     *lruCache
+)
+
+// localCache returns the in-process LRU, sized by AI_CACHE_LRU_SIZE on first use.
+// Returns nil when the LRU is disabled.
+func localCache() *lruCache {
+	localCacheMu.Lock()
+	defer localCacheMu.Unlock()
+	if localLRU == nil {
+		size := 10000
+		if cfg := config.AppConfig; cfg != nil {
+			size = cfg.AICacheLRUSize
+		}
+		if size <= 0 {
+			return nil
+		}
+		localLRU = newLRUCache(size)
+	}
+	return localLRU
+}
+
+// --- stats ---
+
+// cacheCounters counts the lookups of one cache kind.
+type cacheCounters struct {
+	lookups      atomic.Int64
+	localHits    atomic.Int64
+	redisHits    atomic.Int64
+	calls        atomic.Int64
+	deduplicated atomic.Int64
+	errors       atomic.Int64
+}
+
+var (
+	confidenceStats = &cacheCounters{}
+	verdictStats    = &cacheCounters{}
+)
+
+func cacheStatsFor(kind string) *cacheCounters {
+	if kind == cacheKindVerdict {
+		return verdictStats
+	}
+	return confidenceStats
+}
+
+// CacheKindStats reports the read-through cache of one kind of AI result.
+type CacheKindStats struct {
+	Lookups   int64 `json:"lookups"`
+	LocalHits int64 `json:"local_hits"`
+	RedisHits int64 `json:"redis_hits"`
+	Misses    int64 `json:"misses"`
+	// Calls is the number of judge calls made; Deduplicated counts misses that waited
+	// for an identical call in flight instead of making their own.
+	Calls        int64   `json:"calls"`
+	Deduplicated int64   `json:"deduplicated"`
+	Errors       int64   `json:"errors"`
+	HitRatio     float64 `json:"hit_ratio"`
+}
+
+// CacheStats reports the AI result caches since startup.
+type CacheStats struct {
+	Confidence    CacheKindStats `json:"confidence"`
+	Verdict       CacheKindStats `json:"verdict"`
+	LocalEntries  int            `json:"local_entries"`
+	LocalCapacity int            `json:"local_capacity"`
+}
+
+func (c *cacheCounters) snapshot() CacheKindStats {
+	s := CacheKindStats{
+		Lookups:      c.lookups.Load(),
+		LocalHits:    c.localHits.Load(),
+		RedisHits:    c.redisHits.Load(),
+		Calls:        c.calls.Load(),
+		Deduplicated: c.deduplicated.Load(),
+		Errors:       c.errors.Load(),
+	}
+	s.Misses = s.Lookups - s.LocalHits - s.RedisHits
+	if s.Lookups > 0 {
+		s.HitRatio = float64(s.LocalHits+s.RedisHits) / float64(s.Lookups)
+	}
+	return s
+}
+
+// AICacheStats returns hit ratios and call counts of the AI confidence and verdict
+// caches, for tuning their TTLs.
+func AICacheStats() CacheStats {
+	stats := CacheStats{
+		Confidence: confidenceStats.snapshot(),
+		Verdict:    verdictStats.snapshot(),
+	}
+	if lru := localCache(); lru != nil {
+		stats.LocalEntries = lru.len()
+		stats.LocalCapacity = lru.capacity
+	}
+	return stats
+}
+
+// ResetAICache drops the in-process LRU and zeroes the stats; the LRU is rebuilt from
+// config on next use. This is primarily useful for testing.
+func ResetAICache() {
+	localCacheMu.Lock()
+	localLRU = nil
+	localCacheMu.Unlock()
+	confidenceStats = &cacheCounters{}
+	verdictStats = &cacheCounters{}
 }
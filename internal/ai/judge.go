@@ -0,0 +1,140 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"thyris-sz/internal/config"
+)
+
+// defaultJudgeTimeout bounds a judge call when AI_JUDGE_TIMEOUT_MS is not set.
+const defaultJudgeTimeout = 10 * time.Second
+
+// judgeProvider scores AI_PROMPT validators and hybrid confidence when configured
+// separately from the gateway's upstream (AI_JUDGE_PROVIDER).
+var judgeProvider ChatProvider
+
+// initJudge builds the judge provider from AI_JUDGE_* settings. Without
+// AI_JUDGE_PROVIDER, the gateway provider judges.
+func initJudge(cfg *config.Config) error {
+	judgeProvider = nil
+	if cfg.AIJudgeProvider == "" {
+		return nil
+	}
+
+	spec := ProviderSpec{
+		Name:             "judge",
+		Type:             cfg.AIJudgeProvider,
+		Model:            cfg.AIJudgeModel,
+		BaseURL:          cfg.AIJudgeURL,
+		APIKey:           cfg.AIJudgeAPIKey,
+		Region:           cfg.BedrockRegion,
+		EndpointOverride: cfg.BedrockEndpointOverride,
+		ConverseModels:   cfg.BedrockConverseModels,
+	}
+	if ProviderType(strings.ToUpper(spec.Type)) == ProviderAnthropic && spec.BaseURL == "" {
+		spec.BaseURL = cfg.AnthropicBaseURL
+	}
+	provider, err := newProviderFromSpec(spec)
+	if err != nil {
+		return fmt.Errorf("failed to initialize judge provider: %w", err)
+	}
+	judgeProvider = provider
+	log.Printf("[ai] Judge provider initialized: type=%s model=%s", cfg.AIJudgeProvider, cfg.AIJudgeModel)
+	return nil
+}
+
+// GetJudge returns the provider that scores AI_PROMPT validators and hybrid confidence:
+// the judge provider when configured, otherwise the gateway provider. Without either,
+// an OpenAI-compatible provider is built from AI_MODEL_URL. Returns nil if config is
+// not loaded.
+func GetJudge() ChatProvider {
+	if judgeProvider != nil {
+		return judgeProvider
+	}
+	if globalProvider != nil {
+		return globalProvider
+	}
+	cfg := config.AppConfig
+	if cfg == nil || cfg.AIModelURL == "" {
+		return nil
+	}
+	return NewOpenAIProvider(OpenAIConfig{
+		BaseURL: cfg.AIModelURL,
+		APIKey:  cfg.AIAPIKey,
+		Model:   cfg.AIModelName,
+	})
+}
+
+// SetJudge sets the judge provider; nil makes the gateway provider judge again.
+// This is primarily useful for testing.
+func SetJudge(p ChatProvider) {
+	judgeProvider = p
+}
+
+// judgeTimeout returns the deadline of one judge call.
+func judgeTimeout() time.Duration {
+	if cfg := config.AppConfig; cfg != nil && cfg.AIJudgeTimeoutMs > 0 {
+		return time.Duration(cfg.AIJudgeTimeoutMs) * time.Millisecond
+	}
+	return defaultJudgeTimeout
+}
+
+// judgeModel returns the model requested from the judge; empty lets the provider use
+// its default.
+func judgeModel() string {
+	if cfg := config.AppConfig; cfg != nil {
+		return cfg.AIJudgeModel
+	}
+	return ""
+}
+
+// askJudge sends a single-turn prompt to the judge and returns the reply text.
+func askJudge(ctx context.Context, prompt string) (string, error) {
+	return askJudgeMessages(ctx, []ChatMessage{{Role: "user", Content: prompt}}, nil)
+}
+
+// askJudgeMessages sends a conversation to the judge, with provider-specific extra
+// request fields, and returns the reply text. The call is bounded by AI_JUDGE_TIMEOUT_MS
+// on top of any deadline ctx already carries, and refused with ErrCircuitOpen while the
+// judge's circuit breaker is open.
+func askJudgeMessages(ctx context.Context, messages []ChatMessage, extra map[string]interface{}) (string, error) {
+	provider := GetJudge()
+	if provider == nil {
+		return "", ErrProviderNotConfigured
+	}
+	if !judgeBreaker.allow() {
+		return "", ErrCircuitOpen
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, judgeTimeout())
+	defer cancel()
+
+	resp, err := provider.Chat(callCtx, ChatRequest{
+		Model:    judgeModel(),
+		Messages: messages,
+		Extra:    extra,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			// The caller gave up (e.g. its latency budget ran out)
+			judgeBreaker.record(outcomeIgnored)
+			return "", err
+		}
+		judgeBreaker.record(outcomeFailure)
+		if errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("AI judge timed out: %w", context.DeadlineExceeded)
+		}
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		judgeBreaker.record(outcomeFailure)
+		return "", errors.New("no response from AI")
+	}
+	judgeBreaker.record(outcomeSuccess)
+	return resp.Choices[0].Message.Content, nil
+}
@@ -1,5 +1,5 @@
 // Package ai provides AI provider abstractions for the TSZ gateway.
-// It supports multiple backends (OpenAI-compatible, AWS Bedrock) through a unified interface.
+// It supports multiple backends (OpenAI-compatible, AWS Bedrock, Anthropic) through a unified interface.
 package ai
 
 import (
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"thyris-sz/internal/config"
 )
@@ -69,6 +70,25 @@ type StreamEvent struct {
 	} `json:"choices"`
 }
 
+// newStreamEvent returns a chat.completion.chunk with a single choice. finishReason
+// is left nil unless set.
+func newStreamEvent(id, model, content, finishReason string) StreamEvent {
+	event := StreamEvent{ID: id, Object: "chat.completion.chunk", Created: time.Now().Unix(), Model: model}
+	event.Choices = make([]struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role    string `json:"role,omitempty"`
+			Content string `json:"content,omitempty"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	}, 1)
+	event.Choices[0].Delta.Content = content
+	if finishReason != "" {
+		event.Choices[0].FinishReason = &finishReason
+	}
+	return event
+}
+
 // ChatProvider defines the interface for AI chat providers.
 // Implementations must handle both streaming and non-streaming requests.
 type ChatProvider interface {
@@ -95,6 +115,8 @@ const (
 	ProviderOpenAICompatible ProviderType = "OPENAI_COMPATIBLE"
 	// ProviderBedrock represents AWS Bedrock native integration.
 	ProviderBedrock ProviderType = "BEDROCK"
+	// ProviderAnthropic represents the Anthropic Messages API (or a compatible endpoint).
+	ProviderAnthropic ProviderType = "ANTHROPIC"
 )
 
 // ErrProviderNotConfigured is returned when the requested provider is not properly configured.
@@ -109,7 +131,13 @@ var ErrInvalidRequest = errors.New("invalid chat request")
 // globalProvider holds the singleton provider instance.
 var globalProvider ChatProvider
 
-// InitProvider initializes the global ChatProvider based on configuration.
+// messagesProvider serves the /v1/messages gateway when the global provider does not
+// speak the Messages API itself.
+var messagesProvider MessagesForwarder
+
+// InitProvider initializes the global ChatProvider based on configuration: a Router
+// when AI_ROUTING_FILE is set, otherwise the single provider selected by AI_PROVIDER.
+// The judge provider (AI_JUDGE_*) is initialized alongside.
 // This should be called once during application startup after config is loaded.
 func InitProvider() error {
 	cfg := config.AppConfig
@@ -117,6 +145,29 @@ func InitProvider() error {
 		return errors.New("config not loaded")
 	}
 
+	if err := initGatewayProvider(cfg); err != nil {
+		return err
+	}
+	return initJudge(cfg)
+}
+
+// initGatewayProvider initializes the global ChatProvider and the /v1/messages provider.
+func initGatewayProvider(cfg *config.Config) error {
+	if cfg.AIRoutingFile != "" {
+		routing, err := LoadRoutingConfig(cfg.AIRoutingFile)
+		if err != nil {
+			return err
+		}
+		router, err := NewRouter(routing)
+		if err != nil {
+			return fmt.Errorf("failed to initialize provider router: %w", err)
+		}
+		globalProvider = router
+		messagesProvider = newAnthropicProviderFromConfig(cfg)
+		log.Printf("[ai] Provider router initialized from %s: providers=%d routes=%d", cfg.AIRoutingFile, len(routing.Providers), len(routing.Routes))
+		return nil
+	}
+
 	providerType := ProviderType(cfg.AIProvider)
 	log.Printf("[ai] Initializing AI provider: %s", providerType)
 
@@ -126,12 +177,17 @@ func InitProvider() error {
 			Region:           cfg.BedrockRegion,
 			EndpointOverride: cfg.BedrockEndpointOverride,
 			ModelID:          cfg.BedrockModelID,
+			ConverseModels:   cfg.BedrockConverseModels,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to initialize Bedrock provider: %w", err)
 		}
 		globalProvider = provider
-		log.Printf("[ai] Bedrock provider initialized: region=%s model=%s", cfg.BedrockRegion, cfg.BedrockModelID)
+		log.Printf("[ai] Bedrock provider initialized: region=%s model=%s converse=%v", cfg.BedrockRegion, cfg.BedrockModelID, cfg.BedrockConverseModels)
+
+	case ProviderAnthropic:
+		globalProvider = newAnthropicProviderFromConfig(cfg)
+		log.Printf("[ai] Anthropic provider initialized: url=%s model=%s", cfg.AnthropicBaseURL, cfg.AnthropicModel)
 
 	case ProviderOpenAICompatible:
 		fallthrough
@@ -146,9 +202,23 @@ func InitProvider() error {
 		log.Printf("[ai] OpenAI-compatible provider initialized: url=%s model=%s", cfg.AIModelURL, cfg.AIModelName)
 	}
 
+	if AsMessagesForwarder(globalProvider) == nil {
+		messagesProvider = newAnthropicProviderFromConfig(cfg)
+	}
+
 	return nil
 }
 
+// newAnthropicProviderFromConfig builds the Anthropic provider from ANTHROPIC_* settings.
+func newAnthropicProviderFromConfig(cfg *config.Config) *AnthropicProvider {
+	return NewAnthropicProvider(AnthropicConfig{
+		BaseURL: cfg.AnthropicBaseURL,
+		APIKey:  cfg.AnthropicAPIKey,
+		Model:   cfg.AnthropicModel,
+		Version: cfg.AnthropicVersion,
+	})
+}
+
 // GetProvider returns the global ChatProvider instance.
 // Returns nil if InitProvider has not been called.
 func GetProvider() ChatProvider {
@@ -160,3 +230,19 @@ func GetProvider() ChatProvider {
 func SetProvider(p ChatProvider) {
 	globalProvider = p
 }
+
+// GetMessagesForwarder returns the provider that serves /v1/messages: the global provider
+// when it speaks the Messages API, otherwise the Anthropic provider configured through
+// ANTHROPIC_* settings. Returns nil if InitProvider has not been called.
+func GetMessagesForwarder() MessagesForwarder {
+	if f := AsMessagesForwarder(globalProvider); f != nil {
+		return f
+	}
+	return messagesProvider
+}
+
+// SetMessagesForwarder sets the provider used for /v1/messages when the global provider
+// does not speak the Messages API. This is primarily useful for testing.
+func SetMessagesForwarder(f MessagesForwarder) {
+	messagesProvider = f
+}
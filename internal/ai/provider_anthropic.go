@@ -0,0 +1,366 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAnthropicVersion is sent as anthropic-version when none is configured.
+const DefaultAnthropicVersion = "2023-06-01"
+
+// defaultAnthropicMaxTokens is used by Chat when the request does not set max_tokens,
+// which the Messages API requires.
+const defaultAnthropicMaxTokens = 1024
+
+// AnthropicConfig holds configuration for the Anthropic Messages API provider.
+type AnthropicConfig struct {
+	// BaseURL is the API root, e.g. "https://api.anthropic.com"; "/v1/messages" is appended.
+	BaseURL string
+	APIKey  string
+	Model   string
+	// Version is the anthropic-version header (default: DefaultAnthropicVersion).
+	Version string
+	Timeout time.Duration
+}
+
+// AnthropicProvider implements ChatProvider and MessagesForwarder for the Anthropic
+// Messages API, or any endpoint that speaks it (including local mocks).
+type AnthropicProvider struct {
+	config AnthropicConfig
+	client *http.Client
+}
+
+// NewAnthropicProvider creates a new Anthropic Messages API provider.
+func NewAnthropicProvider(cfg AnthropicConfig) *AnthropicProvider {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 60 * time.Second
+	}
+	if cfg.Version == "" {
+		cfg.Version = DefaultAnthropicVersion
+	}
+
+	return &AnthropicProvider{
+		config: cfg,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Name returns the provider name.
+func (p *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+// SupportsStreaming returns true as the Messages API supports streaming.
+func (p *AnthropicProvider) SupportsStreaming() bool {
+	return true
+}
+
+// anthropicResponse is the subset of a Messages API response used by Chat.
+type anthropicResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// Chat sends a non-streaming request and converts the reply to a ChatResponse.
+func (p *AnthropicProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	httpReq, err := p.createHTTPRequest(ctx, p.buildRequestBody(req, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		log.Printf("[anthropic] Request failed: %v", err)
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		log.Printf("[anthropic] Non-200 response: %d - %s", resp.StatusCode, string(bodyBytes))
+		return nil, fmt.Errorf("upstream returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var msgResp anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&msgResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	var text strings.Builder
+	for _, block := range msgResp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+
+	return &ChatResponse{
+		ID:      msgResp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   msgResp.Model,
+		Choices: []ChatChoice{{
+			Index:        0,
+			Message:      ChatMessage{Role: "assistant", Content: text.String()},
+			FinishReason: anthropicFinishReason(msgResp.StopReason),
+		}},
+		Usage: ChatUsage{
+			PromptTokens:     msgResp.Usage.InputTokens,
+			CompletionTokens: msgResp.Usage.OutputTokens,
+			TotalTokens:      msgResp.Usage.InputTokens + msgResp.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+// ChatStream sends a streaming request and converts text deltas to StreamEvents.
+func (p *AnthropicProvider) ChatStream(ctx context.Context, req ChatRequest) (<-chan StreamEvent, <-chan error) {
+	eventCh := make(chan StreamEvent, 100)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(eventCh)
+		defer close(errCh)
+
+		httpReq, err := p.createHTTPRequest(ctx, p.buildRequestBody(req, true))
+		if err != nil {
+			errCh <- fmt.Errorf("failed to create request: %w", err)
+			return
+		}
+
+		resp, err := p.client.Do(httpReq)
+		if err != nil {
+			errCh <- fmt.Errorf("request failed: %w", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			errCh <- fmt.Errorf("upstream returned status %d: %s", resp.StatusCode, string(bodyBytes))
+			return
+		}
+
+		var id, model string
+		reader := bufio.NewReader(resp.Body)
+		for {
+			select {
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			default:
+			}
+
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if err != io.EOF {
+					errCh <- fmt.Errorf("error reading stream: %w", err)
+				}
+				return
+			}
+
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+
+			var event struct {
+				Type    string `json:"type"`
+				Message struct {
+					ID    string `json:"id"`
+					Model string `json:"model"`
+				} `json:"message"`
+				Delta struct {
+					Type       string `json:"type"`
+					Text       string `json:"text"`
+					StopReason string `json:"stop_reason"`
+				} `json:"delta"`
+			}
+			if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+				log.Printf("[anthropic] Failed to parse SSE event: %v", err)
+				continue
+			}
+
+			var out StreamEvent
+			switch event.Type {
+			case "message_start":
+				id, model = event.Message.ID, event.Message.Model
+				continue
+			case "content_block_delta":
+				if event.Delta.Type != "text_delta" {
+					continue
+				}
+				out = newStreamEvent(id, model, event.Delta.Text, "")
+			case "message_delta":
+				if event.Delta.StopReason == "" {
+					continue
+				}
+				out = newStreamEvent(id, model, "", anthropicFinishReason(event.Delta.StopReason))
+			case "message_stop":
+				return
+			default:
+				continue
+			}
+
+			eventCh <- out
+		}
+	}()
+
+	return eventCh, errCh
+}
+
+// anthropicFinishReason maps a Messages API stop_reason to an OpenAI finish_reason.
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// buildRequestBody converts a ChatRequest to a Messages API body. System messages
+// move to the top-level "system" field.
+func (p *AnthropicProvider) buildRequestBody(req ChatRequest, stream bool) map[string]interface{} {
+	var system []string
+	messages := make([]map[string]string, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if msg.Role == "system" {
+			system = append(system, msg.Content)
+			continue
+		}
+		messages = append(messages, map[string]string{
+			"role":    msg.Role,
+			"content": msg.Content,
+		})
+	}
+
+	model := req.Model
+	if model == "" {
+		model = p.config.Model
+	}
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultAnthropicMaxTokens
+	}
+
+	body := map[string]interface{}{
+		"model":      model,
+		"messages":   messages,
+		"max_tokens": maxTokens,
+		"stream":     stream,
+	}
+	if len(system) > 0 {
+		body["system"] = strings.Join(system, "\n\n")
+	}
+	if req.Temperature > 0 {
+		body["temperature"] = req.Temperature
+	}
+	if req.TopP > 0 {
+		body["top_p"] = req.TopP
+	}
+
+	// Merge extra fields
+	for k, v := range req.Extra {
+		if _, exists := body[k]; !exists {
+			body[k] = v
+		}
+	}
+
+	return body
+}
+
+// createHTTPRequest creates an HTTP request for the Messages API.
+func (p *AnthropicProvider) createHTTPRequest(ctx context.Context, body map[string]interface{}) (*http.Request, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimRight(p.config.BaseURL, "/") + "/v1/messages"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("anthropic-version", p.config.Version)
+	if p.config.APIKey != "" {
+		req.Header.Set("x-api-key", p.config.APIKey)
+	}
+
+	return req, nil
+}
+
+// ForwardMessages forwards a raw Messages API request to the upstream endpoint.
+// The response is returned as-is, including SSE bodies for streaming requests.
+func (p *AnthropicProvider) ForwardMessages(ctx context.Context, payload map[string]interface{}) (*http.Response, error) {
+	req, err := p.createHTTPRequest(ctx, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// As in OpenAIProvider.ForwardRequest: bound the wait for response headers,
+	// but not the body, so long streams are not cut off.
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+	}
+	return client.Do(req)
+}
+
+// Ensure AnthropicProvider implements ChatProvider and MessagesForwarder
+var (
+	_ ChatProvider      = (*AnthropicProvider)(nil)
+	_ MessagesForwarder = (*AnthropicProvider)(nil)
+)
+
+// MessagesForwarder is an interface for providers that speak the Anthropic Messages API
+// natively and can forward raw /v1/messages requests.
+type MessagesForwarder interface {
+	ForwardMessages(ctx context.Context, payload map[string]interface{}) (*http.Response, error)
+}
+
+// AsMessagesForwarder attempts to cast a ChatProvider to MessagesForwarder.
+// Returns nil if the provider does not speak the Messages API.
+func AsMessagesForwarder(p ChatProvider) MessagesForwarder {
+	if f, ok := p.(MessagesForwarder); ok {
+		return f
+	}
+	return nil
+}
@@ -26,6 +26,9 @@ type BedrockConfig struct {
 	ModelID string
 	// Timeout for HTTP requests (default: 60 seconds).
 	Timeout time.Duration
+	// ConverseModels lists model IDs served through the Converse API instead of
+	// InvokeModel; an entry ending in "*" matches by prefix.
+	ConverseModels []string
 }
 
 // BedrockProvider implements ChatProvider for AWS Bedrock.
@@ -73,11 +76,9 @@ func (p *BedrockProvider) Name() string {
 	return "bedrock"
 }
 
-// SupportsStreaming returns false for now (streaming will be added in phase 2).
+// SupportsStreaming returns true; streaming uses InvokeModelWithResponseStream.
 func (p *BedrockProvider) SupportsStreaming() bool {
-	// Bedrock supports streaming via InvokeModelWithResponseStream,
-	// but we're implementing non-streaming first.
-	return false
+	return true
 }
 
 // Chat sends a non-streaming chat completion request to Bedrock.
@@ -87,6 +88,9 @@ func (p *BedrockProvider) Chat(ctx context.Context, req ChatRequest) (*ChatRespo
 	if modelID == "" {
 		modelID = p.config.ModelID
 	}
+	if p.usesConverse(modelID) {
+		return p.chatConverse(ctx, modelID, req)
+	}
 
 	// Build the request body based on the model family
 	body, err := p.buildRequestBody(modelID, req)
@@ -112,22 +116,6 @@ func (p *BedrockProvider) Chat(ctx context.Context, req ChatRequest) (*ChatRespo
 	return p.parseResponse(modelID, output.Body)
 }
 
-// ChatStream sends a streaming chat completion request to Bedrock.
-// Currently returns an error as streaming is not yet implemented.
-func (p *BedrockProvider) ChatStream(ctx context.Context, req ChatRequest) (<-chan StreamEvent, <-chan error) {
-	eventCh := make(chan StreamEvent)
-	errCh := make(chan error, 1)
-
-	// Close channels immediately and return error
-	go func() {
-		defer close(eventCh)
-		defer close(errCh)
-		errCh <- ErrStreamingNotSupported
-	}()
-
-	return eventCh, errCh
-}
-
 // buildRequestBody constructs the request body for the specific Bedrock model.
 func (p *BedrockProvider) buildRequestBody(modelID string, req ChatRequest) ([]byte, error) {
 	// Detect model family from model ID
@@ -570,8 +558,16 @@ func (p *BedrockProvider) parseOpenAIResponse(body []byte) (string, error) {
 }
 
 // ForwardRequest forwards a raw OpenAI-compatible request to Bedrock.
-// This converts the OpenAI format to Bedrock format and back.
+// This converts the OpenAI format to Bedrock format and back. Requests with
+// "stream": true get an OpenAI-compatible SSE response. Models listed in
+// ConverseModels go through the Converse API, which also maps tools and tool calls.
 func (p *BedrockProvider) ForwardRequest(ctx context.Context, payload map[string]interface{}) (*http.Response, error) {
+	if model, _ := payload["model"].(string); model == "" && p.usesConverse(p.config.ModelID) {
+		return p.forwardConverse(ctx, p.config.ModelID, payload)
+	} else if p.usesConverse(model) {
+		return p.forwardConverse(ctx, model, payload)
+	}
+
 	// Extract messages from payload
 	messagesRaw, ok := payload["messages"].([]interface{})
 	if !ok {
@@ -611,32 +607,28 @@ func (p *BedrockProvider) ForwardRequest(ctx context.Context, payload map[string
 	if topP, ok := payload["top_p"].(float64); ok {
 		req.TopP = topP
 	}
+	if stream, ok := payload["stream"].(bool); ok {
+		req.Stream = stream
+	}
 
 	// Copy extra fields from payload (consistent with OpenAI provider)
 	for k, v := range payload {
 		switch k {
-		case "model", "messages", "max_tokens", "temperature", "top_p":
+		case "model", "messages", "max_tokens", "temperature", "top_p", "stream":
 			// Skip standard fields
 		default:
 			req.Extra[k] = v
 		}
 	}
 
+	if req.Stream {
+		return p.forwardStream(ctx, req), nil
+	}
+
 	// Call Chat
 	chatResp, err := p.Chat(ctx, req)
 	if err != nil {
-		// Return an error response
-		errBody, _ := json.Marshal(map[string]interface{}{
-			"error": map[string]interface{}{
-				"message": err.Error(),
-				"type":    "bedrock_error",
-			},
-		})
-		return &http.Response{
-			StatusCode: http.StatusBadGateway,
-			Body:       io.NopCloser(bytes.NewReader(errBody)),
-			Header:     http.Header{"Content-Type": []string{"application/json"}},
-		}, nil
+		return bedrockErrorResponse(err), nil
 	}
 
 	// Convert to OpenAI format response
@@ -645,11 +637,40 @@ func (p *BedrockProvider) ForwardRequest(ctx context.Context, payload map[string
 		return nil, fmt.Errorf("failed to marshal response: %w", err)
 	}
 
+	return jsonResponse(respBody), nil
+}
+
+// jsonResponse wraps an OpenAI-style JSON body in a 200 response.
+func jsonResponse(body []byte) *http.Response {
 	return &http.Response{
 		StatusCode: http.StatusOK,
-		Body:       io.NopCloser(bytes.NewReader(respBody)),
+		Body:       io.NopCloser(bytes.NewReader(body)),
 		Header:     http.Header{"Content-Type": []string{"application/json"}},
-	}, nil
+	}
+}
+
+// bedrockErrorResponse wraps a Bedrock error in an OpenAI-style 502 response.
+func bedrockErrorResponse(err error) *http.Response {
+	errBody, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": err.Error(),
+			"type":    "bedrock_error",
+		},
+	})
+	return &http.Response{
+		StatusCode: http.StatusBadGateway,
+		Body:       io.NopCloser(bytes.NewReader(errBody)),
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+	}
+}
+
+// ForwardEndpoint forwards a raw OpenAI-compatible request to Bedrock. Only chat
+// completions are translated; other endpoints are not supported.
+func (p *BedrockProvider) ForwardEndpoint(ctx context.Context, endpoint string, payload map[string]interface{}) (*http.Response, error) {
+	if endpoint != EndpointChatCompletions {
+		return nil, fmt.Errorf("%w: %s", ErrForwardingNotSupported, endpoint)
+	}
+	return p.ForwardRequest(ctx, payload)
 }
 
 // Ensure BedrockProvider implements ChatProvider
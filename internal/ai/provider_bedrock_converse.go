@@ -0,0 +1,583 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// usesConverse reports whether modelID is served through the Converse API. Entries of
+// ConverseModels match a model ID exactly, or as a prefix when they end with "*".
+func (p *BedrockProvider) usesConverse(modelID string) bool {
+	for _, entry := range p.config.ConverseModels {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			if strings.HasPrefix(modelID, prefix) {
+				return true
+			}
+		} else if entry == modelID {
+			return true
+		}
+	}
+	return false
+}
+
+// converseResult is a Converse response in OpenAI terms.
+type converseResult struct {
+	text         string
+	toolCalls    []interface{}
+	finishReason string
+	usage        ChatUsage
+}
+
+// chatConverse serves Chat through the Converse API.
+func (p *BedrockProvider) chatConverse(ctx context.Context, modelID string, req ChatRequest) (*ChatResponse, error) {
+	input, err := converseInputFromPayload(modelID, chatRequestPayload(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request body: %w", err)
+	}
+	result, err := p.converse(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatResponse{
+		ID:      fmt.Sprintf("bedrock-%d", time.Now().UnixNano()),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   modelID,
+		Choices: []ChatChoice{{
+			Index:        0,
+			Message:      ChatMessage{Role: "assistant", Content: result.text},
+			FinishReason: result.finishReason,
+		}},
+		Usage: result.usage,
+	}, nil
+}
+
+// converse invokes the Converse API and maps the reply back to OpenAI terms.
+func (p *BedrockProvider) converse(ctx context.Context, input *bedrockruntime.ConverseInput) (*converseResult, error) {
+	log.Printf("[bedrock] Invoking model %s via Converse", aws.ToString(input.ModelId))
+
+	output, err := p.client.Converse(ctx, input)
+	if err != nil {
+		log.Printf("[bedrock] Converse failed: %v", err)
+		return nil, fmt.Errorf("bedrock converse failed: %w", err)
+	}
+
+	result := &converseResult{
+		finishReason: converseFinishReason(output.StopReason),
+		usage:        converseUsage(output.Usage),
+	}
+	msg, ok := output.Output.(*types.ConverseOutputMemberMessage)
+	if !ok {
+		return nil, fmt.Errorf("no message in Converse response")
+	}
+	for _, block := range msg.Value.Content {
+		switch b := block.(type) {
+		case *types.ContentBlockMemberText:
+			result.text += b.Value
+		case *types.ContentBlockMemberToolUse:
+			arguments, err := documentJSON(b.Value.Input)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode tool input: %w", err)
+			}
+			result.toolCalls = append(result.toolCalls, map[string]interface{}{
+				"id":   aws.ToString(b.Value.ToolUseId),
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      aws.ToString(b.Value.Name),
+					"arguments": arguments,
+				},
+			})
+		}
+	}
+	return result, nil
+}
+
+// forwardConverse serves ForwardRequest through Converse, or ConverseStream when the
+// payload asks for a stream, keeping tools and tool calls intact.
+func (p *BedrockProvider) forwardConverse(ctx context.Context, modelID string, payload map[string]interface{}) (*http.Response, error) {
+	input, err := converseInputFromPayload(modelID, payload)
+	if err != nil {
+		return bedrockErrorResponse(fmt.Errorf("failed to build request body: %w", err)), nil
+	}
+
+	if stream, _ := payload["stream"].(bool); stream {
+		includeUsage := false
+		if opts, ok := payload["stream_options"].(map[string]interface{}); ok {
+			includeUsage, _ = opts["include_usage"].(bool)
+		}
+		return p.forwardConverseStream(ctx, input, includeUsage), nil
+	}
+
+	result, err := p.converse(ctx, input)
+	if err != nil {
+		return bedrockErrorResponse(err), nil
+	}
+
+	message := map[string]interface{}{"role": "assistant", "content": result.text}
+	if len(result.toolCalls) > 0 {
+		message["tool_calls"] = result.toolCalls
+		if result.text == "" {
+			message["content"] = nil
+		}
+	}
+	respBody, err := json.Marshal(map[string]interface{}{
+		"id":      fmt.Sprintf("bedrock-%d", time.Now().UnixNano()),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   modelID,
+		"choices": []interface{}{map[string]interface{}{
+			"index":         0,
+			"message":       message,
+			"finish_reason": result.finishReason,
+		}},
+		"usage": result.usage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return jsonResponse(respBody), nil
+}
+
+// forwardConverseStream translates a ConverseStream into chat.completion.chunk events.
+// Tool use blocks become streamed tool_calls, indexed in order of appearance; usage is
+// sent as a final chunk without choices when includeUsage is set.
+func (p *BedrockProvider) forwardConverseStream(ctx context.Context, input *bedrockruntime.ConverseInput, includeUsage bool) *http.Response {
+	chunkCh := make(chan interface{}, 100)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(chunkCh)
+		defer close(errCh)
+
+		modelID := aws.ToString(input.ModelId)
+		log.Printf("[bedrock] Invoking model %s via ConverseStream", modelID)
+
+		output, err := p.client.ConverseStream(ctx, &bedrockruntime.ConverseStreamInput{
+			ModelId:         input.ModelId,
+			Messages:        input.Messages,
+			System:          input.System,
+			InferenceConfig: input.InferenceConfig,
+			ToolConfig:      input.ToolConfig,
+		})
+		if err != nil {
+			log.Printf("[bedrock] ConverseStream failed: %v", err)
+			errCh <- fmt.Errorf("bedrock converse failed: %w", err)
+			return
+		}
+
+		stream := output.GetStream()
+		defer stream.Close()
+
+		id := fmt.Sprintf("bedrock-%d", time.Now().UnixNano())
+		created := time.Now().Unix()
+		chunk := func(choices []interface{}) map[string]interface{} {
+			return map[string]interface{}{
+				"id":      id,
+				"object":  "chat.completion.chunk",
+				"created": created,
+				"model":   modelID,
+				"choices": choices,
+			}
+		}
+		choice := func(delta map[string]interface{}, finishReason interface{}) []interface{} {
+			return []interface{}{map[string]interface{}{"index": 0, "delta": delta, "finish_reason": finishReason}}
+		}
+
+		// toolIndex maps a content block index to its tool_calls index
+		toolIndex := make(map[int32]int)
+		for event := range stream.Events() {
+			var out map[string]interface{}
+			switch e := event.(type) {
+			case *types.ConverseStreamOutputMemberMessageStart:
+				out = chunk(choice(map[string]interface{}{"role": "assistant"}, nil))
+			case *types.ConverseStreamOutputMemberContentBlockStart:
+				start, ok := e.Value.Start.(*types.ContentBlockStartMemberToolUse)
+				if !ok {
+					continue
+				}
+				idx := len(toolIndex)
+				toolIndex[aws.ToInt32(e.Value.ContentBlockIndex)] = idx
+				out = chunk(choice(map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+					"index": idx,
+					"id":    aws.ToString(start.Value.ToolUseId),
+					"type":  "function",
+					"function": map[string]interface{}{
+						"name":      aws.ToString(start.Value.Name),
+						"arguments": "",
+					},
+				}}}, nil))
+			case *types.ConverseStreamOutputMemberContentBlockDelta:
+				switch d := e.Value.Delta.(type) {
+				case *types.ContentBlockDeltaMemberText:
+					if d.Value == "" {
+						continue
+					}
+					out = chunk(choice(map[string]interface{}{"content": d.Value}, nil))
+				case *types.ContentBlockDeltaMemberToolUse:
+					out = chunk(choice(map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+						"index":    toolIndex[aws.ToInt32(e.Value.ContentBlockIndex)],
+						"function": map[string]interface{}{"arguments": aws.ToString(d.Value.Input)},
+					}}}, nil))
+				default:
+					continue
+				}
+			case *types.ConverseStreamOutputMemberMessageStop:
+				out = chunk(choice(map[string]interface{}{}, converseFinishReason(e.Value.StopReason)))
+			case *types.ConverseStreamOutputMemberMetadata:
+				if !includeUsage {
+					continue
+				}
+				out = chunk([]interface{}{})
+				out["usage"] = converseUsage(e.Value.Usage)
+			default:
+				continue
+			}
+
+			select {
+			case chunkCh <- out:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+
+		if err := stream.Err(); err != nil {
+			errCh <- fmt.Errorf("error reading stream: %w", err)
+		}
+	}()
+
+	return sseResponse(ctx, chunkCh, errCh)
+}
+
+// chatStreamConverse serves ChatStream through ConverseStream; only text is streamed.
+func (p *BedrockProvider) chatStreamConverse(ctx context.Context, modelID string, req ChatRequest) (<-chan StreamEvent, <-chan error) {
+	eventCh := make(chan StreamEvent, 100)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(eventCh)
+		defer close(errCh)
+
+		input, err := converseInputFromPayload(modelID, chatRequestPayload(req))
+		if err != nil {
+			errCh <- fmt.Errorf("failed to build request body: %w", err)
+			return
+		}
+
+		log.Printf("[bedrock] Invoking model %s via ConverseStream", modelID)
+
+		output, err := p.client.ConverseStream(ctx, &bedrockruntime.ConverseStreamInput{
+			ModelId:         input.ModelId,
+			Messages:        input.Messages,
+			System:          input.System,
+			InferenceConfig: input.InferenceConfig,
+		})
+		if err != nil {
+			log.Printf("[bedrock] ConverseStream failed: %v", err)
+			errCh <- fmt.Errorf("bedrock converse failed: %w", err)
+			return
+		}
+
+		stream := output.GetStream()
+		defer stream.Close()
+
+		id := fmt.Sprintf("bedrock-%d", time.Now().UnixNano())
+		first := true
+		for event := range stream.Events() {
+			var text, finishReason string
+			switch e := event.(type) {
+			case *types.ConverseStreamOutputMemberContentBlockDelta:
+				d, ok := e.Value.Delta.(*types.ContentBlockDeltaMemberText)
+				if !ok || d.Value == "" {
+					continue
+				}
+				text = d.Value
+			case *types.ConverseStreamOutputMemberMessageStop:
+				finishReason = converseFinishReason(e.Value.StopReason)
+			default:
+				continue
+			}
+
+			out := newStreamEvent(id, modelID, text, finishReason)
+			if first {
+				out.Choices[0].Delta.Role = "assistant"
+				first = false
+			}
+
+			select {
+			case eventCh <- out:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+
+		if err := stream.Err(); err != nil {
+			errCh <- fmt.Errorf("error reading stream: %w", err)
+		}
+	}()
+
+	return eventCh, errCh
+}
+
+// chatRequestPayload returns req as an OpenAI chat completion payload.
+func chatRequestPayload(req ChatRequest) map[string]interface{} {
+	payload := make(map[string]interface{}, len(req.Extra)+4)
+	for k, v := range req.Extra {
+		payload[k] = v
+	}
+	messages := make([]interface{}, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		messages = append(messages, map[string]interface{}{"role": m.Role, "content": m.Content})
+	}
+	payload["messages"] = messages
+	if req.MaxTokens > 0 {
+		payload["max_tokens"] = float64(req.MaxTokens)
+	}
+	if req.Temperature > 0 {
+		payload["temperature"] = req.Temperature
+	}
+	if req.TopP > 0 {
+		payload["top_p"] = req.TopP
+	}
+	return payload
+}
+
+// converseInputFromPayload maps an OpenAI chat completion payload onto a Converse
+// request. System and developer messages become system blocks, assistant tool_calls
+// become toolUse blocks and tool messages become toolResult blocks of a user turn.
+// Consecutive messages of the same role are merged, as Converse requires alternating
+// turns.
+func converseInputFromPayload(modelID string, payload map[string]interface{}) (*bedrockruntime.ConverseInput, error) {
+	messagesRaw, ok := payload["messages"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid messages in payload")
+	}
+
+	input := &bedrockruntime.ConverseInput{ModelId: aws.String(modelID)}
+	for _, m := range messagesRaw {
+		msgMap, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		role, _ := msgMap["role"].(string)
+		text := payloadMessageText(msgMap["content"])
+
+		var msgRole types.ConversationRole
+		var blocks []types.ContentBlock
+		switch role {
+		case "system", "developer":
+			if text != "" {
+				input.System = append(input.System, &types.SystemContentBlockMemberText{Value: text})
+			}
+			continue
+		case "assistant":
+			msgRole = types.ConversationRoleAssistant
+			if text != "" {
+				blocks = append(blocks, &types.ContentBlockMemberText{Value: text})
+			}
+			calls, _ := msgMap["tool_calls"].([]interface{})
+			for _, c := range calls {
+				call, _ := c.(map[string]interface{})
+				fn, _ := call["function"].(map[string]interface{})
+				id, _ := call["id"].(string)
+				name, _ := fn["name"].(string)
+				arguments, _ := fn["arguments"].(string)
+
+				var args interface{} = map[string]interface{}{}
+				if strings.TrimSpace(arguments) != "" {
+					if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+						return nil, fmt.Errorf("invalid arguments for tool call %s: %w", id, err)
+					}
+				}
+				blocks = append(blocks, &types.ContentBlockMemberToolUse{Value: types.ToolUseBlock{
+					ToolUseId: aws.String(id),
+					Name:      aws.String(name),
+					Input:     document.NewLazyDocument(args),
+				}})
+			}
+		case "tool":
+			msgRole = types.ConversationRoleUser
+			id, _ := msgMap["tool_call_id"].(string)
+			blocks = append(blocks, &types.ContentBlockMemberToolResult{Value: types.ToolResultBlock{
+				ToolUseId: aws.String(id),
+				Content:   []types.ToolResultContentBlock{&types.ToolResultContentBlockMemberText{Value: text}},
+			}})
+		default:
+			msgRole = types.ConversationRoleUser
+			if text != "" {
+				blocks = append(blocks, &types.ContentBlockMemberText{Value: text})
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+		if n := len(input.Messages); n > 0 && input.Messages[n-1].Role == msgRole {
+			input.Messages[n-1].Content = append(input.Messages[n-1].Content, blocks...)
+			continue
+		}
+		input.Messages = append(input.Messages, types.Message{Role: msgRole, Content: blocks})
+	}
+
+	inference := &types.InferenceConfiguration{}
+	hasInference := false
+	if maxTokens, ok := payload["max_tokens"].(float64); ok {
+		inference.MaxTokens = aws.Int32(int32(maxTokens))
+		hasInference = true
+	} else if maxTokens, ok := payload["max_completion_tokens"].(float64); ok {
+		inference.MaxTokens = aws.Int32(int32(maxTokens))
+		hasInference = true
+	}
+	if temp, ok := payload["temperature"].(float64); ok {
+		inference.Temperature = aws.Float32(float32(temp))
+		hasInference = true
+	}
+	if topP, ok := payload["top_p"].(float64); ok {
+		inference.TopP = aws.Float32(float32(topP))
+		hasInference = true
+	}
+	switch stop := payload["stop"].(type) {
+	case string:
+		inference.StopSequences = []string{stop}
+		hasInference = true
+	case []interface{}:
+		for _, s := range stop {
+			if s, ok := s.(string); ok {
+				inference.StopSequences = append(inference.StopSequences, s)
+			}
+		}
+		hasInference = len(inference.StopSequences) > 0 || hasInference
+	}
+	if hasInference {
+		input.InferenceConfig = inference
+	}
+
+	toolConfig, err := converseToolConfig(payload)
+	if err != nil {
+		return nil, err
+	}
+	input.ToolConfig = toolConfig
+
+	return input, nil
+}
+
+// converseToolConfig maps OpenAI tools and tool_choice onto a Converse tool
+// configuration. tool_choice "none" leaves the choice to the model, as Converse cannot
+// forbid tool use once tools are declared.
+func converseToolConfig(payload map[string]interface{}) (*types.ToolConfiguration, error) {
+	toolsRaw, _ := payload["tools"].([]interface{})
+	if len(toolsRaw) == 0 {
+		return nil, nil
+	}
+
+	cfg := &types.ToolConfiguration{}
+	for _, t := range toolsRaw {
+		tool, _ := t.(map[string]interface{})
+		if kind, _ := tool["type"].(string); kind != "" && kind != "function" {
+			return nil, fmt.Errorf("unsupported tool type %q", kind)
+		}
+		fn, _ := tool["function"].(map[string]interface{})
+		name, _ := fn["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("tool without a function name")
+		}
+
+		spec := types.ToolSpecification{Name: aws.String(name)}
+		if description, _ := fn["description"].(string); description != "" {
+			spec.Description = aws.String(description)
+		}
+		var schema interface{} = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		if params, ok := fn["parameters"].(map[string]interface{}); ok {
+			schema = params
+		}
+		spec.InputSchema = &types.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(schema)}
+		cfg.Tools = append(cfg.Tools, &types.ToolMemberToolSpec{Value: spec})
+	}
+
+	switch choice := payload["tool_choice"].(type) {
+	case string:
+		switch choice {
+		case "auto":
+			cfg.ToolChoice = &types.ToolChoiceMemberAuto{}
+		case "required":
+			cfg.ToolChoice = &types.ToolChoiceMemberAny{}
+		}
+	case map[string]interface{}:
+		fn, _ := choice["function"].(map[string]interface{})
+		if name, _ := fn["name"].(string); name != "" {
+			cfg.ToolChoice = &types.ToolChoiceMemberTool{Value: types.SpecificToolChoice{Name: aws.String(name)}}
+		}
+	}
+	return cfg, nil
+}
+
+// payloadMessageText returns the text of an OpenAI message content, which is either a
+// string or an array of content parts; non-text parts are skipped.
+func payloadMessageText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []interface{}:
+		var parts []string
+		for _, p := range c {
+			part, _ := p.(map[string]interface{})
+			if kind, _ := part["type"].(string); kind == "text" {
+				if text, _ := part["text"].(string); text != "" {
+					parts = append(parts, text)
+				}
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+	return ""
+}
+
+// converseFinishReason maps a Converse stop reason to an OpenAI finish_reason.
+func converseFinishReason(reason types.StopReason) string {
+	switch reason {
+	case types.StopReasonToolUse:
+		return "tool_calls"
+	case types.StopReasonMaxTokens:
+		return "length"
+	case types.StopReasonGuardrailIntervened, types.StopReasonContentFiltered:
+		return "content_filter"
+	default: // end_turn, stop_sequence
+		return "stop"
+	}
+}
+
+// converseUsage maps Converse token usage to OpenAI usage.
+func converseUsage(usage *types.TokenUsage) ChatUsage {
+	if usage == nil {
+		return ChatUsage{}
+	}
+	return ChatUsage{
+		PromptTokens:     int(aws.ToInt32(usage.InputTokens)),
+		CompletionTokens: int(aws.ToInt32(usage.OutputTokens)),
+		TotalTokens:      int(aws.ToInt32(usage.TotalTokens)),
+	}
+}
+
+// documentJSON returns a Smithy document as a JSON string.
+func documentJSON(doc document.Interface) (string, error) {
+	if doc == nil {
+		return "{}", nil
+	}
+	b, err := doc.MarshalSmithyDocument()
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
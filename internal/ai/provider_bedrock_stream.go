@@ -0,0 +1,334 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// bedrockChunkDecoder decodes one InvokeModelWithResponseStream chunk of a model family
+// into a text delta and, on the last chunk, an OpenAI finish_reason.
+type bedrockChunkDecoder func(chunk []byte) (text string, finishReason string, err error)
+
+// bedrockChunkDecoders holds the chunk decoder of every model family that can stream.
+var bedrockChunkDecoders = map[string]bedrockChunkDecoder{
+	"anthropic": decodeAnthropicChunk,
+	"amazon":    decodeTitanChunk,
+	"meta":      decodeLlamaChunk,
+	"mistral":   decodeMistralChunk,
+	"cohere":    decodeCohereChunk,
+	"openai":    decodeOpenAIChunk,
+}
+
+// ChatStream sends a streaming chat completion request to Bedrock via
+// InvokeModelWithResponseStream. Chunks are decoded per model family into
+// chat.completion.chunk events; the first event carries the assistant role. Models
+// listed in ConverseModels stream through ConverseStream instead.
+func (p *BedrockProvider) ChatStream(ctx context.Context, req ChatRequest) (<-chan StreamEvent, <-chan error) {
+	modelID := req.Model
+	if modelID == "" {
+		modelID = p.config.ModelID
+	}
+	if p.usesConverse(modelID) {
+		return p.chatStreamConverse(ctx, modelID, req)
+	}
+
+	eventCh := make(chan StreamEvent, 100)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(eventCh)
+		defer close(errCh)
+
+		decode, ok := bedrockChunkDecoders[detectModelFamily(modelID)]
+		if !ok {
+			errCh <- fmt.Errorf("unsupported model family for streaming. Model ID: %s. Supported families: anthropic, amazon, meta, mistral, cohere, openai", modelID)
+			return
+		}
+
+		body, err := p.buildRequestBody(modelID, req)
+		if err != nil {
+			errCh <- fmt.Errorf("failed to build request body: %w", err)
+			return
+		}
+
+		log.Printf("[bedrock] Invoking model %s with response stream", modelID)
+
+		output, err := p.client.InvokeModelWithResponseStream(ctx, &bedrockruntime.InvokeModelWithResponseStreamInput{
+			ModelId:     aws.String(modelID),
+			ContentType: aws.String("application/json"),
+			Accept:      aws.String("application/json"),
+			Body:        body,
+		})
+		if err != nil {
+			log.Printf("[bedrock] InvokeModelWithResponseStream failed: %v", err)
+			errCh <- fmt.Errorf("bedrock invoke failed: %w", err)
+			return
+		}
+
+		stream := output.GetStream()
+		defer stream.Close()
+
+		id := fmt.Sprintf("bedrock-%d", time.Now().UnixNano())
+		first := true
+		for event := range stream.Events() {
+			chunk, ok := event.(*types.ResponseStreamMemberChunk)
+			if !ok {
+				continue
+			}
+
+			text, finishReason, err := decode(chunk.Value.Bytes)
+			if err != nil {
+				log.Printf("[bedrock] Failed to decode stream chunk: %v", err)
+				continue
+			}
+			if text == "" && finishReason == "" {
+				continue
+			}
+
+			out := newStreamEvent(id, modelID, text, finishReason)
+			if first {
+				out.Choices[0].Delta.Role = "assistant"
+				first = false
+			}
+
+			select {
+			case eventCh <- out:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+		}
+
+		if err := stream.Err(); err != nil {
+			errCh <- fmt.Errorf("error reading stream: %w", err)
+		}
+	}()
+
+	return eventCh, errCh
+}
+
+// forwardStream serves a streaming ForwardRequest through ChatStream.
+func (p *BedrockProvider) forwardStream(ctx context.Context, req ChatRequest) *http.Response {
+	eventCh, errCh := p.ChatStream(ctx, req)
+
+	chunks := make(chan interface{})
+	go func() {
+		defer close(chunks)
+		for event := range eventCh {
+			select {
+			case chunks <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return sseResponse(ctx, chunks, errCh)
+}
+
+// sseResponse returns an OpenAI-compatible SSE response that sends every chunk and ends
+// with [DONE]. An error before the first chunk is returned as a 502 JSON response, as for
+// non-streaming requests; a later error is sent as an error event. The response carries a
+// Request bound to ctx, as a real upstream response does, so handlers can watch for cancellation.
+func sseResponse(ctx context.Context, chunkCh <-chan interface{}, errCh <-chan error) *http.Response {
+	// Wait for the first chunk so that invoke errors still get a proper status
+	first, ok := <-chunkCh
+	if !ok {
+		if err := <-errCh; err != nil {
+			return bedrockErrorResponse(err)
+		}
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		writeEvent := func(v interface{}) error {
+			payload, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(pw, "data: %s\n\n", payload)
+			return err
+		}
+
+		if ok {
+			if err := writeEvent(first); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		for chunk := range chunkCh {
+			if err := writeEvent(chunk); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		if err := <-errCh; err != nil {
+			log.Printf("[bedrock] Stream failed: %v", err)
+			_ = writeEvent(map[string]interface{}{
+				"error": map[string]interface{}{
+					"message": err.Error(),
+					"type":    "bedrock_error",
+				},
+			})
+		}
+		_, _ = io.WriteString(pw, "data: [DONE]\n\n")
+		pw.Close()
+	}()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       pr,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Request:    (&http.Request{}).WithContext(ctx),
+	}
+}
+
+// decodeAnthropicChunk decodes a Claude chunk, which is a Messages API stream event.
+func decodeAnthropicChunk(chunk []byte) (string, string, error) {
+	var event struct {
+		Type  string `json:"type"`
+		Delta struct {
+			Type       string `json:"type"`
+			Text       string `json:"text"`
+			StopReason string `json:"stop_reason"`
+		} `json:"delta"`
+	}
+	if err := json.Unmarshal(chunk, &event); err != nil {
+		return "", "", fmt.Errorf("failed to parse Anthropic chunk: %w", err)
+	}
+
+	switch event.Type {
+	case "content_block_delta":
+		if event.Delta.Type == "text_delta" {
+			return event.Delta.Text, "", nil
+		}
+	case "message_delta":
+		if event.Delta.StopReason != "" {
+			return "", anthropicFinishReason(event.Delta.StopReason), nil
+		}
+	}
+	return "", "", nil
+}
+
+// decodeTitanChunk decodes an Amazon Titan chunk.
+func decodeTitanChunk(chunk []byte) (string, string, error) {
+	var event struct {
+		OutputText       string `json:"outputText"`
+		CompletionReason string `json:"completionReason"`
+	}
+	if err := json.Unmarshal(chunk, &event); err != nil {
+		return "", "", fmt.Errorf("failed to parse Titan chunk: %w", err)
+	}
+
+	finishReason := ""
+	switch event.CompletionReason {
+	case "":
+	case "LENGTH":
+		finishReason = "length"
+	case "CONTENT_FILTERED":
+		finishReason = "content_filter"
+	default: // FINISH, STOP_CRITERIA_MET
+		finishReason = "stop"
+	}
+	return event.OutputText, finishReason, nil
+}
+
+// decodeLlamaChunk decodes a Meta Llama chunk.
+func decodeLlamaChunk(chunk []byte) (string, string, error) {
+	var event struct {
+		Generation string `json:"generation"`
+		StopReason string `json:"stop_reason"`
+	}
+	if err := json.Unmarshal(chunk, &event); err != nil {
+		return "", "", fmt.Errorf("failed to parse Llama chunk: %w", err)
+	}
+	return event.Generation, bedrockStopReason(event.StopReason), nil
+}
+
+// decodeMistralChunk decodes a Mistral chunk.
+func decodeMistralChunk(chunk []byte) (string, string, error) {
+	var event struct {
+		Outputs []struct {
+			Text       string `json:"text"`
+			StopReason string `json:"stop_reason"`
+		} `json:"outputs"`
+	}
+	if err := json.Unmarshal(chunk, &event); err != nil {
+		return "", "", fmt.Errorf("failed to parse Mistral chunk: %w", err)
+	}
+	if len(event.Outputs) == 0 {
+		return "", "", nil
+	}
+	return event.Outputs[0].Text, bedrockStopReason(event.Outputs[0].StopReason), nil
+}
+
+// decodeCohereChunk decodes a Cohere Command chunk. Text comes with text-generation
+// events; the stream-end event carries the finish reason.
+func decodeCohereChunk(chunk []byte) (string, string, error) {
+	var event struct {
+		EventType    string `json:"event_type"`
+		Text         string `json:"text"`
+		IsFinished   bool   `json:"is_finished"`
+		FinishReason string `json:"finish_reason"`
+	}
+	if err := json.Unmarshal(chunk, &event); err != nil {
+		return "", "", fmt.Errorf("failed to parse Cohere chunk: %w", err)
+	}
+
+	if !event.IsFinished {
+		if event.EventType == "" || event.EventType == "text-generation" {
+			return event.Text, "", nil
+		}
+		return "", "", nil
+	}
+
+	switch event.FinishReason {
+	case "MAX_TOKENS":
+		return "", "length", nil
+	case "ERROR_TOXIC":
+		return "", "content_filter", nil
+	default: // COMPLETE
+		return "", "stop", nil
+	}
+}
+
+// decodeOpenAIChunk decodes a chunk of an OpenAI model on Bedrock, which is already a
+// chat.completion.chunk.
+func decodeOpenAIChunk(chunk []byte) (string, string, error) {
+	var event struct {
+		Choices []struct {
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(chunk, &event); err != nil {
+		return "", "", fmt.Errorf("failed to parse OpenAI chunk: %w", err)
+	}
+	if len(event.Choices) == 0 {
+		return "", "", nil
+	}
+	return event.Choices[0].Delta.Content, event.Choices[0].FinishReason, nil
+}
+
+// bedrockStopReason maps a Llama or Mistral stop_reason to an OpenAI finish_reason.
+func bedrockStopReason(stopReason string) string {
+	switch strings.ToLower(stopReason) {
+	case "":
+		return ""
+	case "length", "model_length":
+		return "length"
+	default: // stop
+		return "stop"
+	}
+}
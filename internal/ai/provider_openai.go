@@ -221,15 +221,21 @@ func (p *OpenAIProvider) createHTTPRequest(ctx context.Context, body map[string]
 	return req, nil
 }
 
-// ForwardRequest forwards a raw OpenAI-compatible request to the upstream endpoint.
+// ForwardRequest forwards a raw OpenAI-compatible chat completions request to the upstream endpoint.
 // This is used by the gateway to proxy requests with minimal transformation.
 func (p *OpenAIProvider) ForwardRequest(ctx context.Context, payload map[string]interface{}) (*http.Response, error) {
+	return p.ForwardEndpoint(ctx, EndpointChatCompletions, payload)
+}
+
+// ForwardEndpoint forwards a raw OpenAI-compatible request to the given endpoint
+// (e.g. EndpointEmbeddings) below the configured base URL.
+func (p *OpenAIProvider) ForwardEndpoint(ctx context.Context, endpoint string, payload map[string]interface{}) (*http.Response, error) {
 	jsonBody, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	url := strings.TrimRight(p.config.BaseURL, "/") + "/chat/completions"
+	url := strings.TrimRight(p.config.BaseURL, "/") + endpoint
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonBody))
 	if err != nil {
@@ -266,9 +272,19 @@ func (p *OpenAIProvider) ForwardRequest(ctx context.Context, payload map[string]
 // Ensure OpenAIProvider implements ChatProvider
 var _ ChatProvider = (*OpenAIProvider)(nil)
 
+// OpenAI-compatible endpoints the gateway forwards to, relative to the base URL.
+const (
+	EndpointChatCompletions = "/chat/completions"
+	EndpointCompletions     = "/completions"
+	EndpointEmbeddings      = "/embeddings"
+)
+
 // OpenAIForwarder is an interface for providers that can forward raw requests.
+// ForwardRequest forwards to EndpointChatCompletions; ForwardEndpoint returns an error
+// wrapping ErrForwardingNotSupported for endpoints the provider cannot serve.
 type OpenAIForwarder interface {
 	ForwardRequest(ctx context.Context, payload map[string]interface{}) (*http.Response, error)
+	ForwardEndpoint(ctx context.Context, endpoint string, payload map[string]interface{}) (*http.Response, error)
 }
 
 // Ensure OpenAIProvider implements OpenAIForwarder
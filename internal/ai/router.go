@@ -0,0 +1,509 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RoutingConfig describes several named providers and the routes that dispatch requests
+// to them by model. It is loaded from the JSON file named by AI_ROUTING_FILE.
+type RoutingConfig struct {
+	Providers []ProviderSpec `json:"providers"`
+	Routes    []RouteSpec    `json:"routes"`
+	Health    HealthSpec     `json:"health"`
+}
+
+// ProviderSpec configures one named provider of the registry.
+type ProviderSpec struct {
+	Name string `json:"name"`
+	// Type is OPENAI_COMPATIBLE (default), BEDROCK or ANTHROPIC.
+	Type string `json:"type"`
+	// Model is the default model (model ID for Bedrock).
+	Model string `json:"model"`
+
+	// OpenAI-compatible and Anthropic settings. APIKeyEnv names an environment
+	// variable holding the key, so secrets can stay out of the file.
+	BaseURL   string `json:"base_url"`
+	APIKey    string `json:"api_key"`
+	APIKeyEnv string `json:"api_key_env"`
+	Version   string `json:"version"`
+
+	// Bedrock settings.
+	Region           string   `json:"region"`
+	EndpointOverride string   `json:"endpoint_override"`
+	ConverseModels   []string `json:"converse_models"`
+
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// RouteSpec maps request models matching Model (a glob where * matches any run of
+// characters) to a provider, with an ordered list of fallbacks used on 5xx responses,
+// transport errors and timeouts.
+type RouteSpec struct {
+	Model    string `json:"model"`
+	Provider string `json:"provider"`
+	// TargetModel, when set, replaces the request model for the primary provider.
+	TargetModel string        `json:"target_model"`
+	Fallbacks   []RouteTarget `json:"fallbacks"`
+	// TimeoutSeconds bounds how long a provider may take to respond (to the response
+	// headers, or the first event when streaming) before the next one is tried.
+	TimeoutSeconds float64 `json:"timeout_seconds"`
+}
+
+// RouteTarget is a fallback provider, optionally with the model to request from it.
+type RouteTarget struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+}
+
+// HealthSpec configures health-based ejection: a provider failing FailureThreshold
+// times in a row is skipped for EjectSeconds.
+type HealthSpec struct {
+	FailureThreshold int `json:"failure_threshold"`
+	EjectSeconds     int `json:"eject_seconds"`
+}
+
+// ProviderHealth is the health of one registry provider.
+type ProviderHealth struct {
+	Name                string    `json:"name"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Ejected             bool      `json:"ejected"`
+	EjectedUntil        time.Time `json:"ejected_until,omitempty"`
+}
+
+// routerProvider is a registry provider and its health.
+type routerProvider struct {
+	name     string
+	provider ChatProvider
+
+	mu           sync.Mutex
+	failures     int
+	ejectedUntil time.Time
+}
+
+// route is a compiled RouteSpec.
+type route struct {
+	match   *regexp.Regexp
+	targets []RouteTarget
+	timeout time.Duration
+}
+
+// Router is a ChatProvider and OpenAIForwarder that dispatches each request to the
+// provider of the first route matching its model, failing over along the route.
+type Router struct {
+	providers        map[string]*routerProvider
+	order            []string
+	routes           []route
+	failureThreshold int
+	ejectFor         time.Duration
+}
+
+// ErrNoRoute is returned when no registry provider can serve a request.
+var ErrNoRoute = errors.New("no provider available for this request")
+
+// LoadRoutingConfig reads a RoutingConfig from a JSON file.
+func LoadRoutingConfig(path string) (RoutingConfig, error) {
+	var cfg RoutingConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read routing file: %w", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid routing file: %w", err)
+	}
+	return cfg, nil
+}
+
+// NewRouter builds the providers of cfg and compiles its routes. Requests whose model
+// matches no route go to the first provider.
+func NewRouter(cfg RoutingConfig) (*Router, error) {
+	if len(cfg.Providers) == 0 {
+		return nil, fmt.Errorf("routing config has no providers")
+	}
+
+	r := &Router{
+		providers:        make(map[string]*routerProvider, len(cfg.Providers)),
+		failureThreshold: cfg.Health.FailureThreshold,
+		ejectFor:         time.Duration(cfg.Health.EjectSeconds) * time.Second,
+	}
+	if r.failureThreshold <= 0 {
+		r.failureThreshold = 3
+	}
+	if r.ejectFor <= 0 {
+		r.ejectFor = 30 * time.Second
+	}
+
+	for _, spec := range cfg.Providers {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("routing provider without a name")
+		}
+		if _, dup := r.providers[spec.Name]; dup {
+			return nil, fmt.Errorf("duplicate routing provider %q", spec.Name)
+		}
+		provider, err := newProviderFromSpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("routing provider %q: %w", spec.Name, err)
+		}
+		r.providers[spec.Name] = &routerProvider{name: spec.Name, provider: provider}
+		r.order = append(r.order, spec.Name)
+	}
+
+	for _, spec := range cfg.Routes {
+		targets := append([]RouteTarget{{Provider: spec.Provider, Model: spec.TargetModel}}, spec.Fallbacks...)
+		for _, t := range targets {
+			if _, ok := r.providers[t.Provider]; !ok {
+				return nil, fmt.Errorf("route %q refers to unknown provider %q", spec.Model, t.Provider)
+			}
+		}
+		r.routes = append(r.routes, route{
+			match:   globPattern(spec.Model),
+			targets: targets,
+			timeout: time.Duration(spec.TimeoutSeconds * float64(time.Second)),
+		})
+	}
+
+	return r, nil
+}
+
+// newProviderFromSpec builds the ChatProvider of a registry entry.
+func newProviderFromSpec(spec ProviderSpec) (ChatProvider, error) {
+	apiKey := spec.APIKey
+	if spec.APIKeyEnv != "" {
+		apiKey = os.Getenv(spec.APIKeyEnv)
+	}
+	timeout := time.Duration(spec.TimeoutSeconds) * time.Second
+
+	switch ProviderType(strings.ToUpper(spec.Type)) {
+	case ProviderBedrock:
+		return NewBedrockProvider(BedrockConfig{
+			Region:           spec.Region,
+			EndpointOverride: spec.EndpointOverride,
+			ModelID:          spec.Model,
+			Timeout:          timeout,
+			ConverseModels:   spec.ConverseModels,
+		})
+	case ProviderAnthropic:
+		return NewAnthropicProvider(AnthropicConfig{
+			BaseURL: spec.BaseURL,
+			APIKey:  apiKey,
+			Model:   spec.Model,
+			Version: spec.Version,
+			Timeout: timeout,
+		}), nil
+	case ProviderOpenAICompatible, "":
+		if spec.BaseURL == "" {
+			return nil, fmt.Errorf("base_url is required")
+		}
+		return NewOpenAIProvider(OpenAIConfig{
+			BaseURL: spec.BaseURL,
+			APIKey:  apiKey,
+			Model:   spec.Model,
+			Timeout: timeout,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", spec.Type)
+	}
+}
+
+// globPattern compiles a model glob; * matches any run of characters (including "/"
+// and ":", which model IDs often contain) and ? a single character.
+func globPattern(glob string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(glob)
+	quoted = strings.ReplaceAll(quoted, `\*`, `.*`)
+	quoted = strings.ReplaceAll(quoted, `\?`, `.`)
+	return regexp.MustCompile("^" + quoted + "$")
+}
+
+// Name returns the provider name.
+func (r *Router) Name() string {
+	return "router"
+}
+
+// SupportsStreaming returns true as every registry provider type can stream.
+func (r *Router) SupportsStreaming() bool {
+	return true
+}
+
+// Health returns the health of every provider, in configuration order.
+func (r *Router) Health() []ProviderHealth {
+	now := time.Now()
+	out := make([]ProviderHealth, 0, len(r.order))
+	for _, name := range r.order {
+		p := r.providers[name]
+		p.mu.Lock()
+		h := ProviderHealth{Name: name, ConsecutiveFailures: p.failures}
+		if now.Before(p.ejectedUntil) {
+			h.Ejected = true
+			h.EjectedUntil = p.ejectedUntil
+		}
+		p.mu.Unlock()
+		out = append(out, h)
+	}
+	return out
+}
+
+// candidate is one provider to try for a request.
+type candidate struct {
+	provider *routerProvider
+	model    string
+}
+
+// candidates returns the providers to try for model, in order, with the timeout of
+// the matching route. Ejected providers are skipped unless all of them are ejected.
+func (r *Router) candidates(model string) ([]candidate, time.Duration) {
+	targets := []RouteTarget{{Provider: r.order[0]}}
+	var timeout time.Duration
+	for _, rt := range r.routes {
+		if rt.match.MatchString(model) {
+			targets, timeout = rt.targets, rt.timeout
+			break
+		}
+	}
+
+	var all, healthy []candidate
+	now := time.Now()
+	for _, t := range targets {
+		c := candidate{provider: r.providers[t.Provider], model: t.Model}
+		all = append(all, c)
+		if !c.provider.ejected(now) {
+			healthy = append(healthy, c)
+		}
+	}
+	if len(healthy) == 0 {
+		return all, timeout
+	}
+	return healthy, timeout
+}
+
+// ejected reports whether the provider is ejected at now.
+func (p *routerProvider) ejected(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return now.Before(p.ejectedUntil)
+}
+
+// record updates the health of the provider after an attempt.
+func (r *Router) record(p *routerProvider, failed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !failed {
+		p.failures = 0
+		return
+	}
+	p.failures++
+	if p.failures >= r.failureThreshold {
+		p.ejectedUntil = time.Now().Add(r.ejectFor)
+		p.failures = 0
+		log.Printf("[router] Provider %s ejected for %s", p.name, r.ejectFor)
+	}
+}
+
+// attemptContext derives the context of one attempt. With a timeout, the context is
+// cancelled unless stop is called first; release frees it once the attempt is over.
+func attemptContext(ctx context.Context, timeout time.Duration) (attemptCtx context.Context, stop func() bool, release func()) {
+	attemptCtx, cancel := context.WithCancel(ctx)
+	if timeout <= 0 {
+		return attemptCtx, func() bool { return true }, cancel
+	}
+	timer := time.AfterFunc(timeout, cancel)
+	return attemptCtx, timer.Stop, cancel
+}
+
+// cancelOnClose releases the attempt context when the response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// ForwardRequest forwards a chat completion request along its route.
+func (r *Router) ForwardRequest(ctx context.Context, payload map[string]interface{}) (*http.Response, error) {
+	return r.ForwardEndpoint(ctx, EndpointChatCompletions, payload)
+}
+
+// ForwardEndpoint forwards a request along the route of its model. A provider that
+// answers 5xx, fails in transport or exceeds the route timeout counts as failed and the
+// next one is tried; the last provider's response is returned as is. Providers that
+// cannot serve the endpoint are skipped; when all of them are, the error wraps
+// ErrForwardingNotSupported.
+func (r *Router) ForwardEndpoint(ctx context.Context, endpoint string, payload map[string]interface{}) (*http.Response, error) {
+	model, _ := payload["model"].(string)
+	candidates, timeout := r.candidates(model)
+
+	lastErr := fmt.Errorf("%w: %s", ErrNoRoute, model)
+	attempted := false
+	for i, c := range candidates {
+		forwarder := AsOpenAIForwarder(c.provider.provider)
+		if forwarder == nil {
+			if !attempted {
+				lastErr = fmt.Errorf("%w: %s", ErrForwardingNotSupported, c.provider.name)
+			}
+			continue
+		}
+		body := payload
+		if c.model != "" {
+			body = make(map[string]interface{}, len(payload))
+			for k, v := range payload {
+				body[k] = v
+			}
+			body["model"] = c.model
+		}
+
+		attemptCtx, stop, release := attemptContext(ctx, timeout)
+		resp, err := forwarder.ForwardEndpoint(attemptCtx, endpoint, body)
+		inTime := stop()
+		if errors.Is(err, ErrForwardingNotSupported) {
+			release()
+			if !attempted {
+				lastErr = err
+			}
+			continue
+		}
+		attempted = true
+		if ctx.Err() != nil {
+			release()
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+
+		failed := err != nil || !inTime || resp.StatusCode >= http.StatusInternalServerError
+		r.record(c.provider, failed)
+		if !failed || i == len(candidates)-1 {
+			if resp != nil {
+				resp.Body = &cancelOnClose{ReadCloser: resp.Body, release: release}
+			} else {
+				release()
+			}
+			if failed && err == nil && !inTime {
+				err = fmt.Errorf("provider %s timed out after %s", c.provider.name, timeout)
+			}
+			return resp, err
+		}
+
+		if err == nil {
+			resp.Body.Close()
+			if inTime {
+				err = fmt.Errorf("provider %s answered %d", c.provider.name, resp.StatusCode)
+			} else {
+				err = fmt.Errorf("provider %s timed out after %s", c.provider.name, timeout)
+			}
+		}
+		log.Printf("[router] Provider %s failed for model %q: %v; trying next", c.provider.name, model, err)
+		lastErr = err
+		release()
+	}
+	return nil, lastErr
+}
+
+// Chat sends a chat request along the route of its model, failing over on errors.
+func (r *Router) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	candidates, timeout := r.candidates(req.Model)
+
+	var lastErr error
+	for _, c := range candidates {
+		attempt := req
+		if c.model != "" {
+			attempt.Model = c.model
+		}
+
+		attemptCtx, stop, release := attemptContext(ctx, timeout)
+		resp, err := c.provider.provider.Chat(attemptCtx, attempt)
+		stop()
+		release()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		r.record(c.provider, err != nil)
+		if err == nil {
+			return resp, nil
+		}
+		log.Printf("[router] Provider %s failed for model %q: %v; trying next", c.provider.name, req.Model, err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// ChatStream streams a chat request along the route of its model. Failover happens
+// until the first event arrives; later errors are passed to the caller.
+func (r *Router) ChatStream(ctx context.Context, req ChatRequest) (<-chan StreamEvent, <-chan error) {
+	eventCh := make(chan StreamEvent, 100)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(eventCh)
+		defer close(errCh)
+
+		candidates, timeout := r.candidates(req.Model)
+		var lastErr error
+		for _, c := range candidates {
+			attempt := req
+			if c.model != "" {
+				attempt.Model = c.model
+			}
+
+			attemptCtx, stop, release := attemptContext(ctx, timeout)
+			events, errs := c.provider.provider.ChatStream(attemptCtx, attempt)
+
+			first, ok := <-events
+			inTime := stop()
+			if !ok {
+				err := <-errs
+				release()
+				if ctx.Err() != nil {
+					errCh <- ctx.Err()
+					return
+				}
+				if err == nil && inTime {
+					// An empty stream is a successful answer
+					r.record(c.provider, false)
+					return
+				}
+				if err == nil {
+					err = fmt.Errorf("provider %s timed out after %s", c.provider.name, timeout)
+				}
+				r.record(c.provider, true)
+				log.Printf("[router] Provider %s failed for model %q: %v; trying next", c.provider.name, req.Model, err)
+				lastErr = err
+				continue
+			}
+
+			r.record(c.provider, false)
+			eventCh <- first
+			for event := range events {
+				eventCh <- event
+			}
+			if err := <-errs; err != nil {
+				errCh <- err
+			}
+			release()
+			return
+		}
+		if lastErr != nil {
+			errCh <- lastErr
+		}
+	}()
+
+	return eventCh, errCh
+}
+
+// Ensure Router implements ChatProvider and OpenAIForwarder
+var _ ChatProvider = (*Router)(nil)
+var _ OpenAIForwarder = (*Router)(nil)
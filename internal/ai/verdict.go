@@ -0,0 +1,214 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"thyris-sz/internal/config"
+)
+
+// ErrMalformedVerdict is returned when the judge keeps answering with something that
+// is not a verdict.
+var ErrMalformedVerdict = errors.New("malformed AI verdict")
+
+// defaultVerdictRetries is how often a malformed reply is retried when no
+// configuration is loaded.
+const defaultVerdictRetries = 2
+
+// Verdict is the structured answer of the judge to an AI_PROMPT validator.
+type Verdict struct {
+	Label      string   `json:"label"`           // answer to the validator prompt, upper-cased (e.g. "YES", "SAFE")
+	Score      *float64 `json:"score,omitempty"` // the judge's confidence in Label, between 0 and 1
+	Rationale  string   `json:"rationale,omitempty"`
+	Categories []string `json:"categories,omitempty"` // risk categories the judge found
+}
+
+// Matches reports whether the verdict's label is the expected response (default "YES").
+// Labels are compared whole, so "YESTERDAY" does not match "YES".
+func (v *Verdict) Matches(expectedResponse string) bool {
+	target := strings.ToUpper(strings.TrimSpace(expectedResponse))
+	if target == "" {
+		target = "YES"
+	}
+	return v.Label == target
+}
+
+// verdictSchema constrains the judge's reply on providers supporting JSON-schema output.
+var verdictSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"label":      map[string]interface{}{"type": "string"},
+		"score":      map[string]interface{}{"type": "number", "minimum": 0, "maximum": 1},
+		"rationale":  map[string]interface{}{"type": "string"},
+		"categories": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+	},
+	"required":             []string{"label", "score", "rationale", "categories"},
+	"additionalProperties": false,
+}
+
+// verdictInstructions is appended to the validator prompt; the prompt itself names the
+// expected answers.
+const verdictInstructions = "\n\nRespond ONLY with a JSON object of the form " +
+	`{"label": "<your answer as requested above>", "score": <confidence in the label between 0 and 1>, ` +
+	`"rationale": "<one short sentence>", "categories": [<applicable risk categories, may be empty>]}`
+
+// bareLabelRe matches a reply consisting of a single word, accepted as a label
+var bareLabelRe = regexp.MustCompile(`^[A-Za-z0-9_-]+[.!]?$`)
+
+// cache key: ai_verdict_json:{sha256(model, prompt)}
+func aiStructuredVerdictCacheKey(model, prompt string) string {
+	h := sha256.Sum256([]byte(model + "\x00" + prompt))
+	return "ai_verdict_json:" + hex.EncodeToString(h[:])
+}
+
+// JudgeVerdict asks the judge for a structured verdict on text under an AI_PROMPT
+// validator prompt. Malformed replies are retried up to AI_VERDICT_MAX_RETRIES times.
+// Verdicts are read through the AI cache.
+func JudgeVerdict(ctx context.Context, text string, promptTemplate string) (*Verdict, error) {
+	prompt := buildJudgePrompt(text, promptTemplate)
+
+	key := aiStructuredVerdictCacheKey(judgeModel(), prompt)
+	val, err := cachedLookup(ctx, cacheKindVerdict, key, verdictCacheTTL(), func(ctx context.Context) (string, error) {
+		v, err := askVerdict(ctx, prompt)
+		if err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(v)
+		return string(b), err
+	})
+	if err != nil {
+		log.Printf("AI validation failed: %v", err)
+		return nil, err
+	}
+
+	var v Verdict
+	if err := json.Unmarshal([]byte(val), &v); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedVerdict, err)
+	}
+	return &v, nil
+}
+
+// askVerdict asks the judge until it answers with a parsable verdict, telling it what
+// was wrong with each malformed reply.
+func askVerdict(ctx context.Context, prompt string) (*Verdict, error) {
+	messages := []ChatMessage{{Role: "user", Content: prompt + verdictInstructions}}
+	extra := verdictResponseFormat()
+
+	var lastErr error
+	attempts := verdictRetries() + 1
+	for attempt := 1; attempt <= attempts; attempt++ {
+		reply, err := askJudgeMessages(ctx, messages, extra)
+		if err != nil {
+			return nil, err
+		}
+		v, err := parseVerdict(reply)
+		if err == nil {
+			return v, nil
+		}
+		lastErr = err
+		log.Printf("[ai] Malformed verdict (attempt %d/%d): %v", attempt, attempts, err)
+		messages = append(messages,
+			ChatMessage{Role: "assistant", Content: reply},
+			ChatMessage{Role: "user", Content: "Your reply was not valid (" + err.Error() + "). Respond again with ONLY the JSON object."},
+		)
+	}
+	return nil, fmt.Errorf("%w after %d attempt(s): %v", ErrMalformedVerdict, attempts, lastErr)
+}
+
+// verdictResponseFormat requests JSON-schema output from OpenAI-compatible judges
+// (AI_JUDGE_JSON_SCHEMA). Other providers reject the field and rely on the prompt.
+func verdictResponseFormat() map[string]interface{} {
+	if cfg := config.AppConfig; cfg != nil && !cfg.AIJudgeJSONSchema {
+		return nil
+	}
+	if _, ok := GetJudge().(*OpenAIProvider); !ok {
+		return nil
+	}
+	return map[string]interface{}{
+		"response_format": map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   "verdict",
+				"strict": true,
+				"schema": verdictSchema,
+			},
+		},
+	}
+}
+
+func verdictRetries() int {
+	if cfg := config.AppConfig; cfg != nil {
+		if cfg.AIVerdictMaxRetries < 0 {
+			return 0
+		}
+		return cfg.AIVerdictMaxRetries
+	}
+	return defaultVerdictRetries
+}
+
+// parseVerdict reads a verdict from a judge reply: a JSON object, possibly wrapped in a
+// code fence or surrounding prose, or a bare one-word label.
+func parseVerdict(reply string) (*Verdict, error) {
+	reply = strings.TrimSpace(reply)
+	if bareLabelRe.MatchString(reply) {
+		return &Verdict{Label: strings.ToUpper(strings.TrimRight(reply, ".!"))}, nil
+	}
+
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, errors.New("no JSON object in reply")
+	}
+
+	var raw struct {
+		Label      interface{} `json:"label"`
+		Score      interface{} `json:"score"`
+		Rationale  string      `json:"rationale"`
+		Categories []string    `json:"categories"`
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	v := &Verdict{Rationale: strings.TrimSpace(raw.Rationale), Categories: raw.Categories}
+	switch label := raw.Label.(type) {
+	case string:
+		v.Label = strings.ToUpper(strings.TrimSpace(label))
+	case bool:
+		v.Label = "NO"
+		if label {
+			v.Label = "YES"
+		}
+	}
+	if v.Label == "" {
+		return nil, errors.New("missing label")
+	}
+
+	if raw.Score != nil {
+		var score float64
+		switch s := raw.Score.(type) {
+		case float64:
+			score = s
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return nil, fmt.Errorf("score is not a number: %q", s)
+			}
+			score = f
+		default:
+			return nil, errors.New("score is not a number")
+		}
+		if score < 0 || score > 1 {
+			return nil, fmt.Errorf("score %v is outside [0, 1]", score)
+		}
+		v.Score = &score
+	}
+	return v, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"strconv"
 	"thyris-sz/internal/config"
 	"thyris-sz/internal/models"
 	"time"
@@ -18,9 +19,19 @@ var ctx = context.Background()
 const (
 	KeyPatterns  = "patterns:active"
 	KeyAllowlist = "allowlist:all"
-	KeyBlocklist = "blocklist:all"
+
+	// KeyBlocklistRules holds the full blocklist items (with match options);
+	// KeyBlocklistVersion changes whenever they are re-cached so compiled matchers can be rebuilt
+	KeyBlocklistRules   = "blocklist:rules"
+	KeyBlocklistVersion = "blocklist:rules:version"
+
+	// KeyVaultPrefix scopes tokenization vault hashes per RID (vault:{rid})
+	KeyVaultPrefix = "vault:"
 )
 
+// BlocklistKeys lists every cache key derived from the blocklist table
+var BlocklistKeys = []string{KeyBlocklistRules, KeyBlocklistVersion}
+
 func InitRedis() {
 	opt, err := redis.ParseURL(config.GetRedisURL())
 	if err != nil {
@@ -78,28 +89,64 @@ func GetAllowlist() (map[string]bool, error) {
 	return allowlist, err
 }
 
-// SetBlocklist caches the blocklist map
-func SetBlocklist(blocklist map[string]bool) error {
-	data, err := json.Marshal(blocklist)
+// SetBlocklistRules caches the blocklist items and stamps them with a new version
+func SetBlocklistRules(items []models.BlacklistItem) (string, error) {
+	data, err := json.Marshal(items)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return RDB.Set(ctx, KeyBlocklist, data, 1*time.Hour).Err()
+	version := strconv.FormatInt(time.Now().UnixNano(), 10)
+	pipe := RDB.TxPipeline()
+	pipe.Set(ctx, KeyBlocklistRules, data, 1*time.Hour)
+	pipe.Set(ctx, KeyBlocklistVersion, version, 1*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return version, nil
 }
 
-// GetBlocklist retrieves blocklist from cache
-func GetBlocklist() (map[string]bool, error) {
-	val, err := RDB.Get(ctx, KeyBlocklist).Result()
+// GetBlocklistRules retrieves the cached blocklist items together with their version
+func GetBlocklistRules() ([]models.BlacklistItem, string, error) {
+	vals, err := RDB.MGet(ctx, KeyBlocklistRules, KeyBlocklistVersion).Result()
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	data, ok1 := vals[0].(string)
+	version, ok2 := vals[1].(string)
+	if !ok1 || !ok2 {
+		return nil, "", redis.Nil
 	}
 
-	var blocklist map[string]bool
-	err = json.Unmarshal([]byte(val), &blocklist)
-	return blocklist, err
+	var items []models.BlacklistItem
+	err = json.Unmarshal([]byte(data), &items)
+	return items, version, err
+}
+
+// GetBlocklistVersion retrieves the version of the cached blocklist items
+func GetBlocklistVersion() (string, error) {
+	return RDB.Get(ctx, KeyBlocklistVersion).Result()
+}
+
+// SetVaultEntries stores placeholder -> original mappings for a RID.
+// All entries of a RID share a single hash whose TTL is refreshed on every write.
+func SetVaultEntries(rid string, entries map[string]string, ttl time.Duration) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	key := KeyVaultPrefix + rid
+	pipe := RDB.TxPipeline()
+	pipe.HSet(ctx, key, entries)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetVaultEntries retrieves all placeholder -> original mappings for a RID
+func GetVaultEntries(rid string) (map[string]string, error) {
+	return RDB.HGetAll(ctx, KeyVaultPrefix+rid).Result()
 }
 
-// ClearCache clears specific cache key
-func ClearCache(key string) {
-	RDB.Del(ctx, key)
+// ClearCache clears the given cache keys
+func ClearCache(keys ...string) {
+	RDB.Del(ctx, keys...)
 }
@@ -21,9 +21,52 @@ type Config struct {
 	GatewayBlockMode string
 	AppMode          string
 
+	// GatewayNonTextParts controls non-text content parts in user messages: ALLOW, STRIP or REJECT
+	GatewayNonTextParts string
+	// GatewayTokenInputs controls token-array input/prompt values of embeddings and completions: ALLOW, STRIP or REJECT
+	GatewayTokenInputs string
+
+	// Tool calling policy: allowed/denied tool names and validators required on tool-call arguments
+	GatewayToolAllowlist  []string
+	GatewayToolDenylist   []string
+	GatewayToolGuardrails []string
+
+	// Input coverage: message roles scanned and the conversation window (recent messages scanned together)
+	GatewayScanRoles          []string
+	GatewayConversationWindow int
+
 	// AI Provider settings
-	// Supported values: "OPENAI_COMPATIBLE" (default), "BEDROCK"
+	// Supported values: "OPENAI_COMPATIBLE" (default), "BEDROCK", "ANTHROPIC"
 	AIProvider string
+	// AI judge: the provider and model that score AI_PROMPT validators and hybrid
+	// confidence. Without AIJudgeProvider ("OPENAI_COMPATIBLE", "BEDROCK", "ANTHROPIC"),
+	// the gateway provider judges; AIJudgeModel then selects its model (or route).
+	AIJudgeProvider string
+	AIJudgeURL      string
+	AIJudgeAPIKey   string
+	AIJudgeModel    string
+	// Deadline of a single judge call (in milliseconds).
+	AIJudgeTimeoutMs int
+	// AI_PROMPT verdicts: request JSON-schema output from OpenAI-compatible judges, and
+	// how often a malformed reply is retried.
+	AIJudgeJSONSchema   bool
+	AIVerdictMaxRetries int
+	// Judge circuit breaker: consecutive failures that open it (0 disables it) and how
+	// long it stays open before a trial call (in seconds).
+	AIBreakerFailureThreshold int
+	AIBreakerCooldownSeconds  int
+	// AI result cache: entries of the in-process LRU in front of Redis (0 disables it)
+	// and how long confidence scores and AI_PROMPT verdicts are cached (in seconds).
+	AICacheLRUSize              int
+	AIConfidenceCacheTTLSeconds int
+	AIVerdictCacheTTLSeconds    int
+	// AI scoring of detection candidates: the latency budget of one request (in
+	// milliseconds, 0 = unbounded) and how many candidates are scored concurrently.
+	AIScoringBudgetMs    int
+	AIScoringConcurrency int
+	// Optional JSON file configuring several named providers and model-based routes with
+	// failover. When set, it takes precedence over AIProvider.
+	AIRoutingFile string
 
 	// AWS Bedrock settings (only used when AIProvider is "BEDROCK")
 	// Region is required when using Bedrock (e.g., "us-east-1", "eu-central-1")
@@ -32,19 +75,67 @@ type Config struct {
 	BedrockEndpointOverride string
 	// ModelID is the Bedrock model identifier (e.g., "anthropic.claude-3-sonnet-20240229-v1:0")
 	BedrockModelID string
+	// ConverseModels lists model IDs served through the Converse API (tool calling,
+	// system prompts, stop sequences); entries ending in "*" match by prefix
+	BedrockConverseModels []string
+
+	// Anthropic Messages API settings (AIProvider "ANTHROPIC", and the /v1/messages gateway)
+	AnthropicBaseURL string
+	AnthropicAPIKey  string
+	AnthropicModel   string
+	AnthropicVersion string
 
 	// Streaming / gateway settings
 	// Maximum size of the in-memory buffer used for streaming output guardrails (in bytes).
+	// Uncommitted text beyond this size is committed even if a match may still grow.
 	// If zero or negative, no explicit limit is enforced.
 	StreamMaxBufferBytes int
+	// Incremental stream-sync guardrails: committed bytes rescanned as left context, and
+	// trailing bytes held back until no pattern can still extend across them.
+	StreamGuardWindowBytes   int
+	StreamGuardHoldBackBytes int
 	// Behaviour when streaming events cannot be parsed or other non-guardrail errors occur.
 	// Supported values: "LENIENT" (default), "STRICT".
 	StreamFailMode string
+
+	// Entropy-based secret detection (Source "ENTROPY")
+	// Tokens of at least EntropyMinLength characters whose Shannon entropy (bits/char)
+	// exceeds the threshold of their charset are reported as HIGH_ENTROPY_SECRET.
+	EntropyMinLength       int
+	EntropyHexThreshold    float64
+	EntropyBase64Threshold float64
+	// Keywords looked up around a token (e.g. "api_key="); hits raise confidence.
+	EntropyKeywords []string
+	// When true, tokens without a nearby keyword are ignored.
+	EntropyRequireKeyword bool
+
+	// Batch detection settings (POST /detect/batch)
+	// Maximum number of items accepted in a single batch request.
+	DetectBatchMaxItems int
+	// Number of items processed concurrently per batch request.
+	DetectBatchWorkers int
+
+	// Tokenization vault settings
+	// When enabled, masked placeholders are stored per RID so they can be rehydrated later.
+	TokenVaultEnabled bool
+	// TTL of the placeholder -> original mappings stored for a RID (in seconds).
+	TokenVaultTTLSeconds int
+	// API key callers must present (X-TSZ-Vault-Key) to receive rehydrated originals.
+	// If empty, detokenization is denied for everyone.
+	TokenVaultAPIKey string
+
+	// Secret key for HMAC, FORMAT_PRESERVING and PSEUDONYM redaction strategies.
+	// If empty, a random key is generated per process and tokens change on restart.
+	RedactionHMACKey string
 }
 
 type FeatureFlags struct {
 	SemanticAnalysisEnabled bool
 	SchemaValidationEnabled bool
+	// TextNormalizationEnabled runs patterns on a de-obfuscated copy of the text by default
+	TextNormalizationEnabled bool
+	// EntropyDetectionEnabled flags high-randomness tokens alongside regex patterns
+	EntropyDetectionEnabled bool
 }
 
 var AppConfig *Config
@@ -65,20 +156,81 @@ func LoadConfig() {
 		AIAPIKey:         getEnv("AI_API_KEY", "ollama"), // Default to 'ollama' for local instances
 		AIModelName:      getEnv("AI_MODEL", "llama3"),
 
-		// AI Provider: OPENAI_COMPATIBLE (default) or BEDROCK
-		AIProvider: strings.ToUpper(getEnv("AI_PROVIDER", "OPENAI_COMPATIBLE")),
+		// AI Provider: OPENAI_COMPATIBLE (default), BEDROCK or ANTHROPIC
+		AIProvider:    strings.ToUpper(getEnv("AI_PROVIDER", "OPENAI_COMPATIBLE")),
+		AIRoutingFile: getEnv("AI_ROUTING_FILE", ""),
+
+		// AI judge settings
+		AIJudgeProvider:  strings.ToUpper(getEnv("AI_JUDGE_PROVIDER", "")),
+		AIJudgeURL:       getEnv("AI_JUDGE_URL", ""),
+		AIJudgeAPIKey:    getEnv("AI_JUDGE_API_KEY", ""),
+		AIJudgeModel:     getEnv("AI_JUDGE_MODEL", ""),
+		AIJudgeTimeoutMs: getEnvAsInt("AI_JUDGE_TIMEOUT_MS", 10000),
+
+		// Structured AI_PROMPT verdicts
+		AIJudgeJSONSchema:   getEnvAsBool("AI_JUDGE_JSON_SCHEMA", true),
+		AIVerdictMaxRetries: getEnvAsInt("AI_VERDICT_MAX_RETRIES", 2),
+
+		// AI judge circuit breaker
+		AIBreakerFailureThreshold: getEnvAsInt("AI_BREAKER_FAILURE_THRESHOLD", 5),
+		AIBreakerCooldownSeconds:  getEnvAsInt("AI_BREAKER_COOLDOWN_SECONDS", 30),
+
+		// AI result cache settings
+		AICacheLRUSize:              getEnvAsInt("AI_CACHE_LRU_SIZE", 10000),
+		AIConfidenceCacheTTLSeconds: getEnvAsInt("AI_CONFIDENCE_CACHE_TTL_SECONDS", 86400),
+		AIVerdictCacheTTLSeconds:    getEnvAsInt("AI_VERDICT_CACHE_TTL_SECONDS", 3600),
+
+		// AI scoring settings
+		AIScoringBudgetMs:    getEnvAsInt("AI_SCORING_BUDGET_MS", 5000),
+		AIScoringConcurrency: getEnvAsInt("AI_SCORING_CONCURRENCY", 8),
 
 		// AWS Bedrock settings
 		BedrockRegion:           getEnv("AWS_BEDROCK_REGION", ""),
 		BedrockEndpointOverride: getEnv("AWS_BEDROCK_ENDPOINT_OVERRIDE", ""),
 		BedrockModelID:          getEnv("AWS_BEDROCK_MODEL_ID", "anthropic.claude-3-sonnet-20240229-v1:0"),
+		BedrockConverseModels:   getEnvAsList("AWS_BEDROCK_CONVERSE_MODELS", ""),
+
+		// Anthropic Messages API settings
+		AnthropicBaseURL: getEnv("ANTHROPIC_BASE_URL", "https://api.anthropic.com"),
+		AnthropicAPIKey:  getEnv("ANTHROPIC_API_KEY", ""),
+		AnthropicModel:   getEnv("ANTHROPIC_MODEL", "claude-3-5-haiku-latest"),
+		AnthropicVersion: getEnv("ANTHROPIC_VERSION", "2023-06-01"),
 
 		Features: FeatureFlags{
-			SemanticAnalysisEnabled: getEnvAsBool("FEATURE_AI_SEMANTIC_ANALYSIS", true),
-			SchemaValidationEnabled: getEnvAsBool("FEATURE_JSON_SCHEMA_VALIDATION", true),
+			SemanticAnalysisEnabled:  getEnvAsBool("FEATURE_AI_SEMANTIC_ANALYSIS", true),
+			SchemaValidationEnabled:  getEnvAsBool("FEATURE_JSON_SCHEMA_VALIDATION", true),
+			TextNormalizationEnabled: getEnvAsBool("FEATURE_TEXT_NORMALIZATION", false),
+			EntropyDetectionEnabled:  getEnvAsBool("FEATURE_ENTROPY_DETECTION", false),
 		},
+		GatewayNonTextParts:   strings.ToUpper(getEnv("GATEWAY_NON_TEXT_PARTS", "ALLOW")),
+		GatewayTokenInputs:    strings.ToUpper(getEnv("GATEWAY_TOKEN_INPUTS", "REJECT")),
+		GatewayToolAllowlist:  getEnvAsList("GATEWAY_TOOL_ALLOWLIST", ""),
+		GatewayToolDenylist:   getEnvAsList("GATEWAY_TOOL_DENYLIST", ""),
+		GatewayToolGuardrails: getEnvAsList("GATEWAY_TOOL_CALL_GUARDRAILS", ""),
+
+		GatewayScanRoles:          getEnvAsList("GATEWAY_SCAN_ROLES", "user"),
+		GatewayConversationWindow: getEnvAsInt("GATEWAY_CONVERSATION_WINDOW", 0),
+
 		StreamMaxBufferBytes: getEnvAsInt("STREAM_MAX_BUFFER_BYTES", 262144),
 		StreamFailMode:       strings.ToUpper(getEnv("STREAM_FAIL_MODE", "LENIENT")),
+
+		StreamGuardWindowBytes:   getEnvAsInt("STREAM_GUARD_WINDOW_BYTES", 256),
+		StreamGuardHoldBackBytes: getEnvAsInt("STREAM_GUARD_HOLDBACK_BYTES", 128),
+
+		EntropyMinLength:       getEnvAsInt("ENTROPY_MIN_LENGTH", 20),
+		EntropyHexThreshold:    getEnvAsFloat("ENTROPY_HEX_THRESHOLD", 3.0),
+		EntropyBase64Threshold: getEnvAsFloat("ENTROPY_BASE64_THRESHOLD", 4.0),
+		EntropyKeywords:        getEnvAsList("ENTROPY_KEYWORDS", "key,secret,token,password,passwd,pwd,auth,credential,bearer,access"),
+		EntropyRequireKeyword:  getEnvAsBool("ENTROPY_REQUIRE_KEYWORD", false),
+
+		DetectBatchMaxItems: getEnvAsInt("DETECT_BATCH_MAX_ITEMS", 1000),
+		DetectBatchWorkers:  getEnvAsInt("DETECT_BATCH_WORKERS", 8),
+
+		TokenVaultEnabled:    getEnvAsBool("TOKEN_VAULT_ENABLED", false),
+		TokenVaultTTLSeconds: getEnvAsInt("TOKEN_VAULT_TTL_SECONDS", 3600),
+		TokenVaultAPIKey:     getEnv("TOKEN_VAULT_API_KEY", ""),
+
+		RedactionHMACKey: getEnv("REDACTION_HMAC_KEY", ""),
 	}
 }
 
@@ -106,6 +258,30 @@ func getEnvAsInt(key string, fallback int) int {
 	return i
 }
 
+func getEnvAsFloat(key string, fallback float64) float64 {
+	val := getEnv(key, "")
+	if val == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		log.Printf("Invalid float value for %s: %s (using fallback %v)", key, val, fallback)
+		return fallback
+	}
+	return f
+}
+
+// getEnvAsList splits a comma-separated value, dropping empty entries
+func getEnvAsList(key, fallback string) []string {
+	var out []string
+	for _, item := range strings.Split(getEnv(key, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
@@ -0,0 +1,89 @@
+package guardrails
+
+// ahoCorasick is a byte-level Aho-Corasick automaton matching many literal
+// keys in a single pass over the text, independent of the number of keys.
+type ahoCorasick struct {
+	nodes []acNode
+	lens  []int // byte length of each key
+}
+
+type acNode struct {
+	next map[byte]int32
+	fail int32
+	out  []int32 // ids of keys ending at this node, including via suffix links
+}
+
+// newAhoCorasick builds an automaton whose key ids are the indexes into keys.
+// Empty keys are ignored.
+func newAhoCorasick(keys []string) *ahoCorasick {
+	a := &ahoCorasick{
+		nodes: []acNode{{next: map[byte]int32{}}},
+		lens:  make([]int, len(keys)),
+	}
+
+	for id, key := range keys {
+		a.lens[id] = len(key)
+		if key == "" {
+			continue
+		}
+		state := int32(0)
+		for i := 0; i < len(key); i++ {
+			nxt, ok := a.nodes[state].next[key[i]]
+			if !ok {
+				a.nodes = append(a.nodes, acNode{next: map[byte]int32{}})
+				nxt = int32(len(a.nodes) - 1)
+				a.nodes[state].next[key[i]] = nxt
+			}
+			state = nxt
+		}
+		a.nodes[state].out = append(a.nodes[state].out, int32(id))
+	}
+
+	// Breadth-first pass to wire failure links and merge outputs
+	queue := make([]int32, 0, len(a.nodes))
+	for _, child := range a.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for c, child := range a.nodes[state].next {
+			fail := a.nodes[state].fail
+			for {
+				if nxt, ok := a.nodes[fail].next[c]; ok && nxt != child {
+					a.nodes[child].fail = nxt
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = a.nodes[fail].fail
+			}
+			a.nodes[child].out = append(a.nodes[child].out, a.nodes[a.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+
+	return a
+}
+
+// findAll reports every (possibly overlapping) occurrence of every key in text
+func (a *ahoCorasick) findAll(text string, fn func(id, start, end int)) {
+	state := int32(0)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		for {
+			if nxt, ok := a.nodes[state].next[c]; ok {
+				state = nxt
+				break
+			}
+			if state == 0 {
+				break
+			}
+			state = a.nodes[state].fail
+		}
+		for _, id := range a.nodes[state].out {
+			fn(int(id), i+1-a.lens[id], i+1)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package guardrails
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/models"
+)
+
+// AI scoring defaults, used when no configuration is loaded
+const (
+	defaultAIScoringBudget      = 5 * time.Second
+	defaultAIScoringConcurrency = 8
+)
+
+// Reasons reported in ConfidenceExplanation.AIFallback when a candidate kept its
+// regex-only confidence
+const (
+	AIFallbackBudgetExceeded = "BUDGET_EXCEEDED"
+	AIFallbackCanceled       = "CANCELED"
+	AIFallbackCircuitOpen    = "CIRCUIT_OPEN"
+	AIFallbackNotConfigured  = "AI_NOT_CONFIGURED"
+	AIFallbackError          = "AI_ERROR" // any other judge failure, e.g. an unparsable score
+)
+
+// aiScoringJob is a candidate awaiting its hybrid AI confidence
+type aiScoringJob struct {
+	index      int // position in the candidate list
+	value      string
+	label      string
+	regexScore float64
+}
+
+// withScoringBudget bounds AI scoring of one request by AI_SCORING_BUDGET_MS; a budget
+// of zero or less leaves ctx unbounded.
+func withScoringBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	budget := defaultAIScoringBudget
+	if c := config.AppConfig; c != nil {
+		budget = time.Duration(c.AIScoringBudgetMs) * time.Millisecond
+	}
+	if budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, budget)
+}
+
+func aiScoringConcurrency() int {
+	if c := config.AppConfig; c != nil && c.AIScoringConcurrency > 0 {
+		return c.AIScoringConcurrency
+	}
+	return defaultAIScoringConcurrency
+}
+
+// scoreWithAI refines candidates with AI micro-confidence across a bounded pool of
+// workers. Candidates not scored before ctx ends keep their regex-only confidence and
+// report why.
+func scoreWithAI(ctx context.Context, candidates []models.DetectionResult, jobs []aiScoringJob) {
+	if len(jobs) == 0 {
+		return
+	}
+
+	workers := aiScoringConcurrency()
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	queue := make(chan aiScoringJob)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				v, err := ai.ConfidenceWithAIContext(ctx, job.value, job.label)
+				applyAIScore(&candidates[job.index], job.regexScore, v, err, ctx.Err())
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// applyAIScore fuses an AI score into a candidate as the mean of both scores, or records
+// why it was not applied
+func applyAIScore(d *models.DetectionResult, regexScore, aiScore float64, err, ctxErr error) {
+	e := d.ConfidenceExplanation
+	if err != nil {
+		switch {
+		case errors.Is(err, ai.ErrCircuitOpen):
+			e.AIFallback = AIFallbackCircuitOpen
+		case errors.Is(ctxErr, context.DeadlineExceeded):
+			e.AIFallback = AIFallbackBudgetExceeded
+		case errors.Is(ctxErr, context.Canceled):
+			e.AIFallback = AIFallbackCanceled
+		case errors.Is(err, ai.ErrProviderNotConfigured):
+			e.AIFallback = AIFallbackNotConfigured
+		default:
+			e.AIFallback = AIFallbackError
+		}
+		return
+	}
+
+	final := roundConfidence((regexScore + aiScore) / 2)
+	e.HybridApplied = true
+	e.FinalScore = models.Confidence(final)
+	if aiScore > 0 {
+		e.AIScore = models.Confidence(roundConfidence(aiScore))
+	}
+	d.ConfidenceScore = models.Confidence(final)
+}
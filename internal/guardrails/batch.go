@@ -0,0 +1,104 @@
+package guardrails
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"thyris-sz/internal/models"
+)
+
+// Request validation errors shared by /detect and /detect/batch
+var (
+	ErrTextRequired = errors.New("Text field is required")
+	ErrInvalidMode  = errors.New("Invalid mode")
+	ErrInvalidJSON  = errors.New("json field must be a valid JSON document")
+)
+
+// validModes are the accepted values of DetectRequest.Mode
+var validModes = map[string]bool{
+	"MASK":   true,
+	"BLOCK":  true,
+	"DETECT": true,
+}
+
+// ValidateDetectRequest checks a detect request before it is processed
+func ValidateDetectRequest(req models.DetectRequest) error {
+	if len(req.JSON) > 0 {
+		if !json.Valid(req.JSON) {
+			return ErrInvalidJSON
+		}
+		if _, err := newJSONPathFilter(req.IncludePaths, req.ExcludePaths); err != nil {
+			return err
+		}
+	} else if req.Text == "" {
+		return ErrTextRequired
+	}
+	if req.Mode != "" && !validModes[req.Mode] {
+		return ErrInvalidMode
+	}
+	return nil
+}
+
+// DetectBatch runs detection for every request using a single rule-set load and a
+// pool of at most workers goroutines. Results keep the order of reqs; invalid items
+// carry an error instead of a response. An error is returned only when the rules
+// themselves cannot be loaded.
+func (d *Detector) DetectBatch(reqs []models.DetectRequest, workers int) ([]models.BatchDetectResult, error) {
+	return d.DetectBatchContext(context.Background(), reqs, workers)
+}
+
+// DetectBatchContext is DetectBatch with the AI scoring of every item bounded by ctx
+func (d *Detector) DetectBatchContext(ctx context.Context, reqs []models.DetectRequest, workers int) ([]models.BatchDetectResult, error) {
+	results := make([]models.BatchDetectResult, len(reqs))
+	if len(reqs) == 0 {
+		return results, nil
+	}
+
+	rules, err := loadRuleSet()
+	if err != nil {
+		return nil, err
+	}
+	return d.detectBatch(ctx, reqs, workers, rules), nil
+}
+
+// detectBatch processes reqs against rules with at most workers goroutines
+func (d *Detector) detectBatch(ctx context.Context, reqs []models.DetectRequest, workers int, rules *ruleSet) []models.BatchDetectResult {
+	results := make([]models.BatchDetectResult, len(reqs))
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(reqs) {
+		workers = len(reqs)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = d.detectBatchItem(ctx, i, reqs[i], rules)
+			}
+		}()
+	}
+
+	for i := range reqs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// detectBatchItem validates and processes a single batch item
+func (d *Detector) detectBatchItem(ctx context.Context, index int, req models.DetectRequest, rules *ruleSet) models.BatchDetectResult {
+	if err := ValidateDetectRequest(req); err != nil {
+		return models.BatchDetectResult{Index: index, Error: err.Error()}
+	}
+	resp := d.run(ctx, req, rules)
+	return models.BatchDetectResult{Index: index, Response: &resp}
+}
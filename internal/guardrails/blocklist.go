@@ -0,0 +1,271 @@
+package guardrails
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"thyris-sz/internal/cache"
+	"thyris-sz/internal/models"
+	"thyris-sz/internal/repository"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Blocklist match types
+const (
+	BlocklistMatchLiteral = "LITERAL"
+	BlocklistMatchRegex   = "REGEX"
+)
+
+// blocklistPlaceholder replaces every blocklist hit in redacted text
+const blocklistPlaceholder = "[BLOCKED]"
+
+// blocklistCheckInterval is how often the cached blocklist version is compared with
+// the compiled engine; between checks Detect uses the engine as is.
+const blocklistCheckInterval = time.Second
+
+// blocklistEngine is the compiled form of the blocklist. All literal items share
+// one Aho-Corasick automaton keyed on their most permissive form (NFKC + case
+// fold); each hit is then checked against the item's own match options.
+type blocklistEngine struct {
+	version   string
+	automaton *ahoCorasick
+	keyItems  [][]models.BlacklistItem // automaton key id -> items sharing that key
+	regexes   []blocklistRegex
+}
+
+type blocklistRegex struct {
+	item  models.BlacklistItem
+	regex *regexp.Regexp
+}
+
+var (
+	blocklistActive  atomic.Pointer[blocklistEngine]
+	blocklistChecked atomic.Int64 // unix nanos of the last version check
+	blocklistMu      sync.Mutex   // held while checking the version or rebuilding
+)
+
+// ValidateBlacklistItem normalizes the match type of item and checks that it can be compiled
+func ValidateBlacklistItem(item *models.BlacklistItem) error {
+	if strings.TrimSpace(item.Value) == "" {
+		return fmt.Errorf("value is required")
+	}
+
+	item.MatchType = strings.ToUpper(strings.TrimSpace(item.MatchType))
+	switch item.MatchType {
+	case "":
+		item.MatchType = BlocklistMatchLiteral
+	case BlocklistMatchLiteral:
+	case BlocklistMatchRegex:
+		if _, err := regexp.Compile(blocklistRegexSource(*item)); err != nil {
+			return fmt.Errorf("invalid regex: %v", err)
+		}
+	default:
+		return fmt.Errorf("unknown match_type %q (expected LITERAL or REGEX)", item.MatchType)
+	}
+	return nil
+}
+
+// loadBlocklistEngine returns the compiled blocklist. At most once per
+// blocklistCheckInterval one caller compares the cached blocklist version with the
+// engine and rebuilds it on change; everyone else uses the current engine.
+func loadBlocklistEngine() *blocklistEngine {
+	active := blocklistActive.Load()
+	if active != nil {
+		if !blocklistCheckDue() || !blocklistMu.TryLock() {
+			return active
+		}
+	} else {
+		blocklistMu.Lock()
+	}
+	defer blocklistMu.Unlock()
+
+	// Another caller may have built or checked the engine while we waited for the lock
+	active = blocklistActive.Load()
+	if active != nil && !blocklistCheckDue() {
+		return active
+	}
+	blocklistChecked.Store(time.Now().UnixNano())
+
+	if active != nil {
+		if version, err := cache.GetBlocklistVersion(); err == nil && version == active.version {
+			return active
+		}
+	}
+
+	items, version, err := repository.GetBlocklistRules()
+	if err != nil {
+		log.Printf("Error fetching blocklist: %v", err)
+		if active != nil {
+			return active
+		}
+		return &blocklistEngine{}
+	}
+
+	if active == nil || active.version != version {
+		active = newBlocklistEngine(items, version)
+		blocklistActive.Store(active)
+	}
+	return active
+}
+
+func blocklistCheckDue() bool {
+	return time.Since(time.Unix(0, blocklistChecked.Load())) >= blocklistCheckInterval
+}
+
+// InvalidateBlocklist makes the next Detect check the blocklist version, so changes
+// made through this instance apply without waiting for blocklistCheckInterval.
+func InvalidateBlocklist() {
+	blocklistChecked.Store(0)
+}
+
+// newBlocklistEngine compiles blocklist items into a matcher
+func newBlocklistEngine(items []models.BlacklistItem, version string) *blocklistEngine {
+	e := &blocklistEngine{version: version}
+
+	keyIndex := make(map[string]int)
+	var keys []string
+	for _, item := range items {
+		if item.Value == "" {
+			continue
+		}
+
+		if strings.EqualFold(item.MatchType, BlocklistMatchRegex) {
+			re, err := getCachedRegex(blocklistRegexSource(item))
+			if err != nil {
+				log.Printf("Invalid blocklist regex %q: %v", item.Value, err)
+				continue
+			}
+			e.regexes = append(e.regexes, blocklistRegex{item: item, regex: re})
+			continue
+		}
+
+		key := blocklistKey(item.Value)
+		id, ok := keyIndex[key]
+		if !ok {
+			id = len(keys)
+			keyIndex[key] = id
+			keys = append(keys, key)
+			e.keyItems = append(e.keyItems, nil)
+		}
+		e.keyItems[id] = append(e.keyItems[id], item)
+	}
+
+	if len(keys) > 0 {
+		e.automaton = newAhoCorasick(keys)
+	}
+	return e
+}
+
+// blocklistKey is the form literal items are indexed under in the automaton
+func blocklistKey(value string) string {
+	return strings.ToLower(norm.NFKC.String(value))
+}
+
+// blocklistRegexSource applies the case folding option to a regex item
+func blocklistRegexSource(item models.BlacklistItem) string {
+	if item.CaseInsensitive {
+		return "(?i)" + item.Value
+	}
+	return item.Value
+}
+
+// scan returns a BLOCKLIST detection for every match in text
+func (e *blocklistEngine) scan(text string) []models.DetectionResult {
+	if e == nil || text == "" {
+		return nil
+	}
+
+	var results []models.DetectionResult
+	add := func(start, end int) {
+		results = append(results, models.DetectionResult{
+			Type:        "BLOCKLIST",
+			Value:       text[start:end],
+			Placeholder: blocklistPlaceholder,
+			Start:       start,
+			End:         end,
+		})
+	}
+
+	if e.automaton != nil {
+		view := newTextView(text, true, true)
+		seen := make(map[[2]int]bool)
+		e.automaton.findAll(view.text, func(id, vStart, vEnd int) {
+			start, end := view.span(vStart, vEnd)
+			if start >= end || seen[[2]int{start, end}] {
+				return
+			}
+			for _, item := range e.keyItems[id] {
+				if literalMatches(item, text[start:end]) && (!item.WholeWord || isWholeWord(text, start, end)) {
+					seen[[2]int{start, end}] = true
+					add(start, end)
+					return
+				}
+			}
+		})
+	}
+
+	var normalized *textView
+	for _, r := range e.regexes {
+		view := &textView{text: text, srcLen: len(text)}
+		if r.item.Normalize {
+			if normalized == nil {
+				normalized = newTextView(text, true, false)
+			}
+			view = normalized
+		}
+		for _, loc := range r.regex.FindAllStringIndex(view.text, -1) {
+			start, end := view.span(loc[0], loc[1])
+			if start >= end || (r.item.WholeWord && !isWholeWord(text, start, end)) {
+				continue
+			}
+			add(start, end)
+		}
+	}
+
+	return results
+}
+
+// literalMatches checks an automaton hit (which matched in folded, normalized
+// form) against the stricter options of a literal item
+func literalMatches(item models.BlacklistItem, matched string) bool {
+	value := item.Value
+	if item.Normalize {
+		matched = norm.NFKC.String(matched)
+		value = norm.NFKC.String(value)
+	}
+	if item.CaseInsensitive {
+		return strings.ToLower(matched) == strings.ToLower(value)
+	}
+	return matched == value
+}
+
+// isWholeWord reports whether text[start:end] is not glued to surrounding letters
+// or digits. Edges of the match that are themselves non-word runes need no boundary.
+func isWholeWord(text string, start, end int) bool {
+	first, _ := utf8.DecodeRuneInString(text[start:end])
+	last, _ := utf8.DecodeLastRuneInString(text[start:end])
+
+	if start > 0 && isWordRune(first) {
+		if r, _ := utf8.DecodeLastRuneInString(text[:start]); isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(text) && isWordRune(last) {
+		if r, _ := utf8.DecodeRuneInString(text[end:]); isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || r == '_'
+}
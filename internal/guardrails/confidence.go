@@ -6,11 +6,20 @@ type ConfidenceContext struct {
 	PatternActive   bool
 	AllowlistHit    bool
 	BlacklistHit    bool
-	Source          string // REGEX, AI, SCHEMA
+	Source          string // REGEX, ENTROPY, AI, SCHEMA
+
+	// Post-match signals
+	Verified            bool // match passed its post-match verifier (checksum)
+	ContextExpected     bool // pattern declares positive context keywords
+	ContextKeywordHits  int  // positive keywords found near the match
+	NegativeKeywordHits int  // negative keywords found near the match
 }
 
-// ComputeConfidence returns deterministic, enterprise-grade confidence score (0-1)
-// ComputeConfidence computes heuristic confidence. For PII, prefer HybridConfidence.
+// piiCorroborationMargin keeps corroborated PII scores this far below the block threshold
+const piiCorroborationMargin = 0.05
+
+// ComputeConfidence returns deterministic, enterprise-grade confidence score (0-1).
+// PII scores are later refined with the AI judge's score (see applyAIScore).
 func ComputeConfidence(ctx ConfidenceContext) float64 {
 	// Hard blocks are absolute
 	if ctx.BlacklistHit {
@@ -30,7 +39,7 @@ func ComputeConfidence(ctx ConfidenceContext) float64 {
 		score += 0.4
 	case "SCHEMA":
 		score += 0.3
-	case "REGEX":
+	case "REGEX", "ENTROPY":
 		score += 0.2
 	default:
 		score += 0.1
@@ -60,6 +69,38 @@ func ComputeConfidence(ctx ConfidenceContext) float64 {
 		score -= 0.2
 	}
 
+	// 4. Structural verification (checksum) is a strong signal
+	unboosted := score
+	if ctx.Verified {
+		score += 0.15
+	}
+
+	// 5. Surrounding context: keywords corroborate or contradict the match
+	if ctx.NegativeKeywordHits > 0 {
+		score -= 0.3
+	}
+	if ctx.ContextKeywordHits > 0 {
+		boost := 0.1 * float64(ctx.ContextKeywordHits)
+		if boost > 0.2 {
+			boost = 0.2
+		}
+		score += boost
+	} else if ctx.ContextExpected {
+		score -= 0.1
+	}
+
+	// Verification and keywords confirm that a PII match is real, not that it must be
+	// blocked: they never lift it to the block threshold, so a masked type stays masked
+	if ctx.PatternCategory == "PII" && score > unboosted {
+		ceiling := GetCategoryThreshold(ctx.PatternCategory) - piiCorroborationMargin
+		if ceiling < unboosted {
+			ceiling = unboosted
+		}
+		if score > ceiling {
+			score = ceiling
+		}
+	}
+
 	// Clamp to [0,1]
 	if score < 0 {
 		return 0
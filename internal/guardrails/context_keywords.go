@@ -0,0 +1,104 @@
+package guardrails
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"thyris-sz/internal/models"
+)
+
+// defaultContextWindow is the number of characters inspected on each side of a match
+// when a pattern declares context keywords without a window size
+const defaultContextWindow = 50
+
+// contextWindow returns the text surrounding [start, end) limited to window runes on each side
+func contextWindow(text string, start, end, window int) string {
+	if window <= 0 {
+		window = defaultContextWindow
+	}
+
+	from := start
+	for n := 0; n < window && from > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:from])
+		from -= size
+	}
+
+	to := end
+	for n := 0; n < window && to < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[to:])
+		to += size
+	}
+
+	return text[from:start] + " " + text[end:to]
+}
+
+// matchContextKeywords returns the keywords found (case-insensitively, as whole words) in
+// the surroundings of a match
+func matchContextKeywords(surroundings string, keywords []string) []string {
+	if len(keywords) == 0 {
+		return nil
+	}
+
+	lowered := strings.ToLower(surroundings)
+	var hits []string
+	for _, kw := range keywords {
+		needle := strings.ToLower(strings.TrimSpace(kw))
+		if needle != "" && containsWord(lowered, needle) {
+			hits = append(hits, kw)
+		}
+	}
+	return dropNestedKeywords(hits)
+}
+
+// containsWord reports whether needle occurs in s as a whole word (see isWholeWord),
+// so "vkn" does not match inside "vknx"
+func containsWord(s, needle string) bool {
+	for from := 0; from <= len(s)-len(needle); {
+		i := strings.Index(s[from:], needle)
+		if i < 0 {
+			return false
+		}
+		start := from + i
+		if isWholeWord(s, start, start+len(needle)) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(s[start:])
+		from = start + size
+	}
+	return false
+}
+
+// dropNestedKeywords removes hits contained in a longer hit ("vergi" in "vergi no"), so
+// one mention is not counted twice
+func dropNestedKeywords(hits []string) []string {
+	if len(hits) < 2 {
+		return hits
+	}
+
+	kept := hits[:0:0]
+	for i, kw := range hits {
+		needle := strings.ToLower(strings.TrimSpace(kw))
+		nested := false
+		for j, other := range hits {
+			outer := strings.ToLower(strings.TrimSpace(other))
+			if i != j && len(outer) > len(needle) && strings.Contains(outer, needle) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			kept = append(kept, kw)
+		}
+	}
+	return kept
+}
+
+// scanContextKeywords evaluates the pattern's positive and negative context keywords around a match
+func scanContextKeywords(text string, start, end int, p models.Pattern) (positive []string, negative []string) {
+	if len(p.ContextKeywords) == 0 && len(p.NegativeContextKeywords) == 0 {
+		return nil, nil
+	}
+
+	surroundings := contextWindow(text, start, end, p.ContextWindow)
+	return matchContextKeywords(surroundings, p.ContextKeywords), matchContextKeywords(surroundings, p.NegativeContextKeywords)
+}
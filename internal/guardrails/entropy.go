@@ -0,0 +1,179 @@
+package guardrails
+
+import (
+	"math"
+	"regexp"
+
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/models"
+)
+
+// EntropySecretType is the detection type reported by the entropy detector
+const EntropySecretType = "HIGH_ENTROPY_SECRET"
+
+// Charsets the entropy detector distinguishes; hex tokens carry at most 4 bits
+// per character and need a lower threshold than base64-like tokens (6 bits)
+const (
+	entropyCharsetHex    = "HEX"
+	entropyCharsetBase64 = "BASE64"
+)
+
+// Entropy defaults, used when no configuration is loaded
+const (
+	defaultEntropyMinLength       = 20
+	defaultEntropyHexThreshold    = 3.0
+	defaultEntropyBase64Threshold = 4.0
+)
+
+var (
+	entropyTokenRe = regexp.MustCompile(`[A-Za-z0-9+/_\-]+={0,2}`)
+	hexTokenRe     = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+)
+
+// entropySettings are the resolved detector options
+type entropySettings struct {
+	minLength       int
+	hexThreshold    float64
+	base64Threshold float64
+	keywords        []string
+	requireKeyword  bool
+}
+
+// entropyEnabled reports whether the entropy detector runs (FEATURE_ENTROPY_DETECTION)
+func entropyEnabled() bool {
+	return config.AppConfig != nil && config.AppConfig.Features.EntropyDetectionEnabled
+}
+
+func loadEntropySettings() entropySettings {
+	s := entropySettings{
+		minLength:       defaultEntropyMinLength,
+		hexThreshold:    defaultEntropyHexThreshold,
+		base64Threshold: defaultEntropyBase64Threshold,
+	}
+	if c := config.AppConfig; c != nil {
+		if c.EntropyMinLength > 0 {
+			s.minLength = c.EntropyMinLength
+		}
+		if c.EntropyHexThreshold > 0 {
+			s.hexThreshold = c.EntropyHexThreshold
+		}
+		if c.EntropyBase64Threshold > 0 {
+			s.base64Threshold = c.EntropyBase64Threshold
+		}
+		s.keywords = c.EntropyKeywords
+		s.requireKeyword = c.EntropyRequireKeyword
+	}
+	return s
+}
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	h := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// classifyToken returns the charset of token and whether it is a plausible secret.
+// Base64-like tokens must mix letters and digits, which keeps words, paths and
+// identifiers out.
+func classifyToken(token string) (string, bool) {
+	if hexTokenRe.MatchString(token) {
+		return entropyCharsetHex, true
+	}
+	hasLetter, hasDigit := false, false
+	for i := 0; i < len(token); i++ {
+		c := token[i]
+		switch {
+		case c >= '0' && c <= '9':
+			hasDigit = true
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			hasLetter = true
+		}
+	}
+	return entropyCharsetBase64, hasLetter && hasDigit
+}
+
+// scanEntropy reports high-entropy tokens of text that do not overlap an existing candidate
+func scanEntropy(text, rid string, allowlist map[string]bool, existing []models.DetectionResult, settings entropySettings) []models.DetectionResult {
+	var results []models.DetectionResult
+
+	allowThreshold, blockThreshold, thresholdSource := resolveThresholds(nil, "SECRET")
+
+	for _, loc := range entropyTokenRe.FindAllStringIndex(text, -1) {
+		start, end := loc[0], loc[1]
+		token := text[start:end]
+		if len(token) < settings.minLength || allowlist[token] || overlapsAny(start, end, existing) {
+			continue
+		}
+
+		charset, plausible := classifyToken(token)
+		if !plausible {
+			continue
+		}
+		threshold := settings.base64Threshold
+		if charset == entropyCharsetHex {
+			threshold = settings.hexThreshold
+		}
+		entropy := shannonEntropy(token)
+		if entropy < threshold {
+			continue
+		}
+
+		hits := matchContextKeywords(contextWindow(text, start, end, defaultContextWindow), settings.keywords)
+		if settings.requireKeyword && len(hits) == 0 {
+			continue
+		}
+
+		score := ComputeConfidence(ConfidenceContext{
+			PatternCategory:    "SECRET",
+			PatternActive:      true,
+			Source:             "ENTROPY",
+			ContextKeywordHits: len(hits),
+		})
+
+		allowTh, blockTh := allowThreshold, blockThreshold
+		results = append(results, models.DetectionResult{
+			Type:            EntropySecretType,
+			Value:           token,
+			Placeholder:     generatePlaceholder(EntropySecretType, rid),
+			Start:           start,
+			End:             end,
+			ConfidenceScore: models.Confidence(roundConfidence(score)),
+			ConfidenceExplanation: &models.ConfidenceExplanation{
+				Source:          "ENTROPY",
+				Category:        "SECRET",
+				PatternActive:   true,
+				Entropy:         math.Round(entropy*100) / 100,
+				EntropyCharset:  charset,
+				ContextKeywords: hits,
+				BlockThreshold:  &blockTh,
+				AllowThreshold:  &allowTh,
+				ThresholdSource: thresholdSource,
+				FinalScore:      models.Confidence(roundConfidence(score)),
+			},
+		})
+	}
+	return results
+}
+
+// overlapsAny reports whether [start, end) intersects any detection
+func overlapsAny(start, end int, detections []models.DetectionResult) bool {
+	for _, d := range detections {
+		if start < d.End && d.Start < end {
+			return true
+		}
+	}
+	return false
+}
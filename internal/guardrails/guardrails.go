@@ -1,13 +1,14 @@
 package guardrails
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
 	"strings"
 	"sync"
-	"thyris-sz/internal/ai"
 	"thyris-sz/internal/models"
 	"thyris-sz/internal/repository"
 	"time"
@@ -46,6 +47,15 @@ func resolveAction(score float64, allowThreshold float64, blockThreshold float64
 	return "MASK"
 }
 
+// detectionThresholds returns the thresholds resolved for a detection at candidate time,
+// falling back to the global chain for detections without an explanation (e.g. blocklist hits).
+func detectionThresholds(d models.DetectionResult) (allow float64, block float64, source string) {
+	if e := d.ConfidenceExplanation; e != nil && e.AllowThreshold != nil && e.BlockThreshold != nil {
+		return *e.AllowThreshold, *e.BlockThreshold, e.ThresholdSource
+	}
+	return resolveThresholds(nil, "")
+}
+
 // NewDetector creates a new instance of Detector
 func NewDetector() *Detector {
 	if count, err := repository.CountActivePatterns(); err != nil {
@@ -56,114 +66,84 @@ func NewDetector() *Detector {
 	return &Detector{}
 }
 
-// Detect scans the input text for PII and returns redacted text and detections
-func (d *Detector) Detect(req models.DetectRequest) models.DetectResponse {
-	var blocked bool
-	var messages []string
+// ruleSet is the detection configuration shared by one or more Detect calls
+type ruleSet struct {
+	patterns  []models.Pattern
+	allowlist map[string]bool
+	blocklist *blocklistEngine
+}
 
-	// 0. Guardrails / Validators Execution
-	// Collect unique validators to run
-	validatorsToRun := make(map[string]bool)
-	if req.ExpectedFormat != "" {
-		validatorsToRun[req.ExpectedFormat] = true
-	}
-	for _, g := range req.Guardrails {
-		validatorsToRun[g] = true
+// loadRuleSet fetches patterns, allowlist and the compiled blocklist
+func loadRuleSet() (*ruleSet, error) {
+	patterns, err := repository.GetActivePatterns()
+	if err != nil {
+		return nil, err
 	}
 
-	var validatorResults []models.ValidatorResult
-	for vName := range validatorsToRun {
-		validator, _ := repository.GetValidatorByName(vName)
-		valid, err := ValidateFormat(req.Text, vName)
-		confidence := 0.5
-
-		// AI validators get higher, model-based confidence baseline
-		if validator != nil && validator.Type == "AI_PROMPT" {
-			confidence = 0.85
-		}
-		if err != nil {
-			confidence = 1.0
-			log.Printf("Validator error [%s]: %v", vName, err)
-			blocked = true
-			messages = append(messages, fmt.Sprintf("Error in guardrail '%s': %v", vName, err))
-		} else if !valid {
-			confidence = 0.9
-			blocked = true
-			messages = append(messages, fmt.Sprintf("Content blocked by security policy: %s", vName))
-		} else {
-			confidence = 0.7
-		}
-
-		validatorResults = append(validatorResults, models.ValidatorResult{
-			Name:            vName,
-			Type:            "VALIDATOR",
-			Passed:          valid && err == nil,
-			ConfidenceScore: models.Confidence(roundConfidence(confidence)),
-		})
+	allowlistMap, err := repository.GetAllowlistMap()
+	if err != nil {
+		log.Printf("Error fetching allowlist: %v", err)
+		allowlistMap = make(map[string]bool)
 	}
 
-	// Note: We continue to PII detection even if blocked by guardrails,
-	// to provide full visibility as requested.
+	return &ruleSet{
+		patterns:  patterns,
+		allowlist: allowlistMap,
+		blocklist: loadBlocklistEngine(),
+	}, nil
+}
 
-	var candidates []models.DetectionResult
-	redactedText := req.Text
+// Detect scans the input text for PII and returns redacted text and detections
+func (d *Detector) Detect(req models.DetectRequest) models.DetectResponse {
+	return d.DetectContext(context.Background(), req)
+}
 
-	dbPatterns, err := repository.GetActivePatterns()
+// DetectContext is Detect with AI scoring bounded by ctx as well as the request's
+// latency budget (AI_SCORING_BUDGET_MS)
+func (d *Detector) DetectContext(ctx context.Context, req models.DetectRequest) models.DetectResponse {
+	rules, err := loadRuleSet()
 	if err != nil {
 		log.Printf("Error fetching patterns: %v", err)
-		return models.DetectResponse{RedactedText: req.Text}
+		return models.DetectResponse{RedactedText: req.Text, RedactedJSON: req.JSON}
 	}
+	return d.run(ctx, req, rules)
+}
 
-	allowlistMap, err := repository.GetAllowlistMap()
-	if err != nil {
-		log.Printf("Error fetching allowlist: %v", err)
-		allowlistMap = make(map[string]bool)
+// run dispatches a request to plain-text or structured detection under one latency budget
+func (d *Detector) run(ctx context.Context, req models.DetectRequest, rules *ruleSet) models.DetectResponse {
+	ctx, cancel := withScoringBudget(ctx)
+	defer cancel()
+	if len(req.JSON) > 0 {
+		return d.detectStructured(ctx, req, rules)
 	}
+	return d.detect(ctx, req, rules)
+}
 
-	blocklistMap, err := repository.GetBlocklistMap()
-	if err != nil {
-		log.Printf("Error fetching blocklist: %v", err)
-		blocklistMap = make(map[string]bool)
-	}
+// detect runs detection for a single request against preloaded rules
+func (d *Detector) detect(ctx context.Context, req models.DetectRequest, rules *ruleSet) models.DetectResponse {
+	// 0. Guardrails / Validators Execution
+	validatorResults, blocked, messages := runValidators(req.Text, req)
 
-	// 1. Scan Blocklist (Exact/Contains match)
-	for badWord := range blocklistMap {
-		// Simple Contains check (case-sensitive? usually blocklists are insensitive, but map keys are likely as-is)
-		// For better performance/accuracy, we should compile these into a regex, but for now iterate.
-		if strings.Contains(req.Text, badWord) {
-			// Find all occurrences
-			// Note: strings.Index only finds first. regexp is better.
-			// Let's use a simple regex for the literal string to find all indices.
-			// escaped := regexp.QuoteMeta(badWord) // Unused for now
-			// Word boundary? The user asked for "blacklist", usually implies keywords.
-			// Let's enforce word boundary for better quality \bWORD\b
-			// But for Turkish/Unicode, \b might be tricky. Let's use simple literal search for now to be safe.
-			// actually literal search might match "scunthorpe".
-			// Let's stick to simple strings.Contains and find all.
-
-			// Finding all indices of substring
-			searchStr := req.Text
-			offset := 0
-			for {
-				idx := strings.Index(searchStr, badWord)
-				if idx == -1 {
-					break
-				}
-				realStart := offset + idx
-				realEnd := realStart + len(badWord)
+	// Note: We continue to PII detection even if blocked by guardrails,
+	// to provide full visibility as requested.
 
-				candidates = append(candidates, models.DetectionResult{
-					Type:        "BLOCKLIST",
-					Value:       badWord,
-					Placeholder: "[BLOCKED]", // Or use generatesPlaceholder
-					Start:       realStart,
-					End:         realEnd,
-				})
+	var candidates []models.DetectionResult
+	var aiJobs []aiScoringJob
+	// vaultable holds placeholders unique to their value, the only ones the vault may store
+	vaultable := make(map[string]bool)
+	redactedText := req.Text
 
-				// Move search forward
-				searchStr = searchStr[idx+len(badWord):]
-				offset = realEnd
-			}
+	dbPatterns, allowlistMap := rules.patterns, rules.allowlist
+
+	// 1. Scan Blocklist (single pass over all terms)
+	candidates = append(candidates, rules.blocklist.scan(req.Text)...)
+
+	// Normalization pre-pass: patterns also run on a de-obfuscated view whose
+	// offsets map back to the original text
+	views := []*textView{newTextView(req.Text, false, false)}
+	if normalizationEnabled(req) {
+		if normalized := normalizeForDetection(req.Text); normalized.text != req.Text {
+			views = append(views, normalized)
 		}
 	}
 
@@ -175,58 +155,113 @@ func (d *Detector) Detect(req models.DetectRequest) models.DetectResponse {
 			continue
 		}
 
-		matches := regex.FindAllStringIndex(req.Text, -1)
-		for _, match := range matches {
-			value := req.Text[match[0]:match[1]]
+		// Threshold resolution: pattern override -> category env -> global env -> default
+		allowThreshold, blockThreshold, thresholdSource := resolveThresholds(&p, p.Category)
 
-			if allowlistMap[value] {
-				continue
-			}
+		seen := make(map[[2]int]bool)
+		for _, view := range views {
+			matches := regex.FindAllStringIndex(view.text, -1)
+			for _, match := range matches {
+				start, end := view.span(match[0], match[1])
+				if start >= end || seen[[2]int{start, end}] {
+					continue
+				}
+				seen[[2]int{start, end}] = true
 
-			placeholder := generatePlaceholder(p.Name, req.RID)
+				// value is what gets redacted; matched is what the pattern saw after normalization
+				value := req.Text[start:end]
+				matched := view.text[match[0]:match[1]]
 
-			ctx := ConfidenceContext{
-				PatternCategory: p.Category,
-				PatternActive:   p.IsActive,
-				AllowlistHit:    false,
-				BlacklistHit:    false,
-				Source:          "REGEX",
-			}
+				if allowlistMap[value] || allowlistMap[matched] {
+					continue
+				}
 
-			regexScore := ComputeConfidence(ctx)
-			finalConfidence := regexScore
-			var aiScore float64
+				// Post-match verification: drop or down-score matches failing their checksum
+				var verifierPassed *bool
+				if p.Verifier != "" {
+					if passed, known := runVerifier(p.Verifier, matched); known {
+						verifierPassed = &passed
+						if !passed && !strings.EqualFold(p.VerifierPolicy, VerifierPolicyDownscore) {
+							continue
+						}
+					}
+				}
 
-			// Hybrid PII confidence: refine with AI micro-confidence
-			if p.Category == "PII" {
-				if v, err := ai.ConfidenceWithAI(value, p.Name); err == nil {
-					aiScore = v
-					finalConfidence = (regexScore + v) / 2
+				placeholder := redact(&p, value, req.RID)
+				if isVaultableStrategy(p.RedactionStrategy) {
+					vaultable[placeholder] = true
 				}
-			}
 
-			explanation := &models.ConfidenceExplanation{
-				Source:        "HYBRID",
-				RegexScore:    models.Confidence(roundConfidence(regexScore)),
-				Category:      p.Category,
-				PatternActive: p.IsActive,
-				FinalScore:    models.Confidence(roundConfidence(finalConfidence)),
-			}
+				positiveHits, negativeHits := scanContextKeywords(req.Text, start, end, p)
+
+				confCtx := ConfidenceContext{
+					PatternCategory:     p.Category,
+					PatternActive:       p.IsActive,
+					AllowlistHit:        false,
+					BlacklistHit:        false,
+					Verified:            verifierPassed != nil && *verifierPassed,
+					ContextExpected:     len(p.ContextKeywords) > 0,
+					ContextKeywordHits:  len(positiveHits),
+					NegativeKeywordHits: len(negativeHits),
+					Source:              "REGEX",
+				}
+
+				regexScore := ComputeConfidence(confCtx)
+				if verifierPassed != nil && !*verifierPassed {
+					regexScore *= verifierFailPenalty
+				}
+				finalConfidence := regexScore
 
-			if aiScore > 0 {
-				explanation.AIScore = models.Confidence(roundConfidence(aiScore))
+				// Hybrid PII confidence: refined with AI micro-confidence once all candidates are known
+				if p.Category == "PII" {
+					aiJobs = append(aiJobs, aiScoringJob{index: len(candidates), value: matched, label: p.Name, regexScore: regexScore})
+				}
+
+				allowTh, blockTh := allowThreshold, blockThreshold
+				explanation := &models.ConfidenceExplanation{
+					Source:          "HYBRID",
+					RegexScore:      models.Confidence(roundConfidence(regexScore)),
+					Category:        p.Category,
+					PatternActive:   p.IsActive,
+					BlockThreshold:  &blockTh,
+					AllowThreshold:  &allowTh,
+					ThresholdSource: thresholdSource,
+					FinalScore:      models.Confidence(roundConfidence(finalConfidence)),
+				}
+
+				if verifierPassed != nil {
+					explanation.Verifier = strings.ToUpper(p.Verifier)
+					explanation.VerifierPassed = verifierPassed
+				}
+				explanation.ContextKeywords = positiveHits
+				explanation.NegativeContextKeywords = negativeHits
+				if matched != value {
+					explanation.NormalizedValue = matched
+				}
+
+				candidates = append(candidates, models.DetectionResult{
+					Type:                  p.Name,
+					Value:                 value,
+					Placeholder:           placeholder,
+					Start:                 start,
+					End:                   end,
+					ConfidenceScore:       models.Confidence(roundConfidence(finalConfidence)),
+					ConfidenceExplanation: explanation,
+				})
 			}
+		}
+	}
+
+	// AI scoring fans out within the request's latency budget
+	scoreWithAI(ctx, candidates, aiJobs)
 
-			candidates = append(candidates, models.DetectionResult{
-				Type:                  p.Name,
-				Value:                 value,
-				Placeholder:           placeholder,
-				Start:                 match[0],
-				End:                   match[1],
-				ConfidenceScore:       models.Confidence(roundConfidence(finalConfidence)),
-				ConfidenceExplanation: explanation,
-			})
+	// Entropy source: high-randomness tokens no pattern accounted for
+	if entropyEnabled() {
+		secrets := scanEntropy(req.Text, req.RID, allowlistMap, candidates, loadEntropySettings())
+		for _, d := range secrets {
+			vaultable[d.Placeholder] = true
 		}
+		candidates = append(candidates, secrets...)
 	}
 
 	// 3. Sort candidates by Start index ASC, then by End index DESC (Longest match wins)
@@ -283,21 +318,27 @@ func (d *Detector) Detect(req models.DetectRequest) models.DetectResponse {
 	containsPII := len(detections) > 0
 
 	// Confidence-based action mapping (enterprise)
-	blockThreshold := getBlockThreshold()
-	allowThreshold := getAllowThreshold()
-
 	for _, d := range detections {
 		score := float64(d.ConfidenceScore)
+		allowThreshold, blockThreshold, thresholdSource := detectionThresholds(d)
 		action := resolveAction(score, allowThreshold, blockThreshold)
 
+		var patternCategory string
+		if d.ConfidenceExplanation != nil {
+			patternCategory = d.ConfidenceExplanation.Category
+		}
+
 		// Publish security event
 		publishSecurityEvent(models.SecurityEvent{
 			Type:            action,
 			Action:          action,
 			Category:        d.Type,
 			Pattern:         d.Type,
+			PatternCategory: patternCategory,
 			ConfidenceScore: score,
 			Threshold:       blockThreshold,
+			AllowThreshold:  allowThreshold,
+			ThresholdSource: thresholdSource,
 			RequestID:       req.RID,
 			Timestamp:       time.Now().Unix(),
 		})
@@ -335,6 +376,10 @@ func (d *Detector) Detect(req models.DetectRequest) models.DetectResponse {
 			result = append(result, req.Text[currentIndex:]...)
 		}
 		redactedText = string(result)
+
+		if req.Tokenize {
+			storeTokens(req.RID, detections, vaultable)
+		}
 	}
 
 	finalMessage := ""
@@ -343,6 +388,87 @@ func (d *Detector) Detect(req models.DetectRequest) models.DetectResponse {
 	}
 
 	// 6. Compute overall confidence (weighted)
+	overall := overallConfidence(detections, validatorResults)
+
+	return models.DetectResponse{
+		RedactedText:      redactedText,
+		Detections:        detections,
+		ValidatorResults:  validatorResults,
+		Breakdown:         breakdown,
+		Blocked:           blocked,
+		ContainsPII:       containsPII,
+		OverallConfidence: models.Confidence(roundConfidence(overall)),
+		Message:           finalMessage,
+	}
+}
+
+// runValidators executes the expected format and guardrail validators of req against text
+func runValidators(text string, req models.DetectRequest) (validatorResults []models.ValidatorResult, blocked bool, messages []string) {
+	// Collect unique validators to run
+	validatorsToRun := make(map[string]bool)
+	if req.ExpectedFormat != "" {
+		validatorsToRun[req.ExpectedFormat] = true
+	}
+	for _, g := range req.Guardrails {
+		validatorsToRun[g] = true
+	}
+
+	for vName := range validatorsToRun {
+		var outcome validatorOutcome
+		validator, err := repository.GetValidatorByName(vName)
+		if err != nil {
+			err = errors.New("validator not found: " + vName)
+		} else {
+			outcome, err = runValidator(text, validator, repository.GetValidatorByName)
+		}
+
+		if err != nil {
+			log.Printf("Validator error [%s]: %v", vName, err)
+			blocked = true
+			messages = append(messages, fmt.Sprintf("Error in guardrail '%s': %v", vName, err))
+		} else if !outcome.valid {
+			blocked = true
+			messages = append(messages, fmt.Sprintf("Content blocked by security policy: %s", vName))
+		}
+
+		result := models.ValidatorResult{
+			Name:            vName,
+			Type:            "VALIDATOR",
+			Passed:          outcome.valid && err == nil,
+			ConfidenceScore: models.Confidence(roundConfidence(validatorConfidence(outcome, err))),
+			Degraded:        outcome.degraded,
+		}
+		if v := outcome.verdict; v != nil {
+			result.Label = v.Label
+			result.Rationale = v.Rationale
+			result.Categories = v.Categories
+		}
+		validatorResults = append(validatorResults, result)
+	}
+
+	return validatorResults, blocked, messages
+}
+
+// validatorConfidence is how sure a validator is of its outcome: the judge's own score
+// for AI verdicts, otherwise a fixed level per outcome
+func validatorConfidence(outcome validatorOutcome, err error) float64 {
+	switch {
+	case err != nil:
+		return 1.0
+	case outcome.verdict != nil && outcome.verdict.Score != nil:
+		return *outcome.verdict.Score
+	case outcome.degraded == DegradedFailOpen:
+		// Passed without a verdict
+		return 0.5
+	case !outcome.valid:
+		return 0.9
+	default:
+		return 0.7
+	}
+}
+
+// overallConfidence is the weighted mean of detection and validator scores
+func overallConfidence(detections []models.DetectionResult, validatorResults []models.ValidatorResult) float64 {
 	overall := 0.0
 	weight := 0.0
 
@@ -363,15 +489,5 @@ func (d *Detector) Detect(req models.DetectRequest) models.DetectResponse {
 	if weight > 0 {
 		overall = overall / weight
 	}
-
-	return models.DetectResponse{
-		RedactedText:      redactedText,
-		Detections:        detections,
-		ValidatorResults:  validatorResults,
-		Breakdown:         breakdown,
-		Blocked:           blocked,
-		ContainsPII:       containsPII,
-		OverallConfidence: models.Confidence(roundConfidence(overall)),
-		Message:           finalMessage,
-	}
+	return overall
 }
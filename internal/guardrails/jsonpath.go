@@ -0,0 +1,213 @@
+package guardrails
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// jsonPathSegment is one step of the location of a value inside a JSON document
+type jsonPathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// formatJSONPath renders a location as a JSONPath such as $.user.emails[0]
+func formatJSONPath(path []jsonPathSegment) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, seg := range path {
+		switch {
+		case seg.isIndex:
+			b.WriteString("[" + strconv.Itoa(seg.index) + "]")
+		case identifierRe.MatchString(seg.key):
+			b.WriteString("." + seg.key)
+		default:
+			b.WriteString("['" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(seg.key) + "']")
+		}
+	}
+	return b.String()
+}
+
+// jsonPathSelector is one step of a compiled include/exclude expression
+type jsonPathSelector struct {
+	descendant bool // ".." - matches at any depth below the previous step
+	wildcard   bool // "*" - any key or index
+	key        string
+	index      int
+	isIndex    bool
+}
+
+func (s jsonPathSelector) matches(seg jsonPathSegment) bool {
+	if s.wildcard {
+		return true
+	}
+	if s.isIndex {
+		return seg.isIndex && seg.index == s.index
+	}
+	return !seg.isIndex && seg.key == s.key
+}
+
+// jsonPathExpr is a compiled JSONPath subset: $, .key, ['key'], [n], [*], .*, ..key
+type jsonPathExpr []jsonPathSelector
+
+// compileJSONPath parses a JSONPath expression
+func compileJSONPath(expr string) (jsonPathExpr, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("invalid JSONPath %q: must start with $", expr)
+	}
+
+	var sel jsonPathExpr
+	rest := expr[1:]
+	for rest != "" {
+		descendant := false
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			descendant = true
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, "["):
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %q: unexpected %q", expr, rest)
+		}
+
+		var s jsonPathSelector
+		var err error
+		if strings.HasPrefix(rest, "[") {
+			s, rest, err = parseBracketSelector(rest)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSONPath %q: %v", expr, err)
+			}
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			if name == "" {
+				return nil, fmt.Errorf("invalid JSONPath %q: empty member name", expr)
+			}
+			if name == "*" {
+				s.wildcard = true
+			} else {
+				s.key = name
+			}
+		}
+		s.descendant = descendant
+		sel = append(sel, s)
+	}
+	return sel, nil
+}
+
+// parseBracketSelector parses ['key'], ["key"], [n] or [*] at the start of rest
+func parseBracketSelector(rest string) (jsonPathSelector, string, error) {
+	var s jsonPathSelector
+	if len(rest) > 1 && (rest[1] == '\'' || rest[1] == '"') {
+		quote := rest[1]
+		var key strings.Builder
+		for i := 2; i < len(rest); i++ {
+			c := rest[i]
+			if c == '\\' && i+1 < len(rest) {
+				key.WriteByte(rest[i+1])
+				i++
+				continue
+			}
+			if c == quote {
+				if i+1 >= len(rest) || rest[i+1] != ']' {
+					return s, "", fmt.Errorf("expected ] after quoted name")
+				}
+				s.key = key.String()
+				return s, rest[i+2:], nil
+			}
+			key.WriteByte(c)
+		}
+		return s, "", fmt.Errorf("unterminated quoted name")
+	}
+
+	end := strings.IndexByte(rest, ']')
+	if end < 0 {
+		return s, "", fmt.Errorf("unterminated [")
+	}
+	inner := strings.TrimSpace(rest[1:end])
+	if inner == "*" {
+		s.wildcard = true
+	} else {
+		n, err := strconv.Atoi(inner)
+		if err != nil || n < 0 {
+			return s, "", fmt.Errorf("unsupported selector [%s]", inner)
+		}
+		s.index, s.isIndex = n, true
+	}
+	return s, rest[end+1:], nil
+}
+
+// matchPrefix reports whether the expression selects path or one of its ancestors,
+// so that "$.user" covers every value below user.
+func (e jsonPathExpr) matchPrefix(path []jsonPathSegment) bool {
+	if len(e) == 0 {
+		return true
+	}
+	s := e[0]
+	if s.descendant {
+		for i := range path {
+			if s.matches(path[i]) && e[1:].matchPrefix(path[i+1:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	return s.matches(path[0]) && e[1:].matchPrefix(path[1:])
+}
+
+// jsonPathFilter decides which string leaves are scanned
+type jsonPathFilter struct {
+	include []jsonPathExpr
+	exclude []jsonPathExpr
+}
+
+// newJSONPathFilter compiles include/exclude expressions
+func newJSONPathFilter(include, exclude []string) (*jsonPathFilter, error) {
+	f := &jsonPathFilter{}
+	for _, expr := range include {
+		e, err := compileJSONPath(expr)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, e)
+	}
+	for _, expr := range exclude {
+		e, err := compileJSONPath(expr)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, e)
+	}
+	return f, nil
+}
+
+// allows reports whether a leaf at path is scanned: included (or no includes) and not excluded
+func (f *jsonPathFilter) allows(path []jsonPathSegment) bool {
+	for _, e := range f.exclude {
+		if e.matchPrefix(path) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, e := range f.include {
+		if e.matchPrefix(path) {
+			return true
+		}
+	}
+	return false
+}
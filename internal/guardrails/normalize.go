@@ -0,0 +1,184 @@
+package guardrails
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/models"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Embedded payload candidates considered for decoding
+var (
+	base64Run     = regexp.MustCompile(`[A-Za-z0-9+/_-]{16,}={0,2}`)
+	hexRun        = regexp.MustCompile(`(?:0[xX])?[0-9A-Fa-f]{16,}`)
+	hexEscapeRun  = regexp.MustCompile(`(?:\\x[0-9A-Fa-f]{2}){4,}`)
+	urlEncodedRun = regexp.MustCompile(`[^\s]*%[0-9A-Fa-f]{2}[^\s]*`)
+)
+
+// minDecodedRunes is the shortest decoded payload worth scanning
+const minDecodedRunes = 4
+
+// confusables maps common Cyrillic and Greek homoglyphs to their Latin lookalikes
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's', 'ԁ': 'd',
+	'һ': 'h', 'ӏ': 'l', 'ԛ': 'q', 'ԝ': 'w', 'ѵ': 'v',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P',
+	'С': 'C', 'Т': 'T', 'У': 'Y', 'Х': 'X', 'І': 'I', 'Ј': 'J', 'Ѕ': 'S', 'Ԁ': 'D',
+	// Greek
+	'α': 'a', 'ο': 'o', 'ν': 'v', 'ρ': 'p', 'ι': 'i', 'κ': 'k', 'τ': 't', 'υ': 'u',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M',
+	'Ν': 'N', 'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	// Latin lookalikes outside ASCII
+	'ɑ': 'a', 'ɡ': 'g', 'ı': 'i', 'ȷ': 'j',
+}
+
+// normalizationEnabled reports whether the de-obfuscation pre-pass should run.
+// The request flag wins over the FEATURE_TEXT_NORMALIZATION default.
+func normalizationEnabled(req models.DetectRequest) bool {
+	if req.Normalize != nil {
+		return *req.Normalize
+	}
+	return config.AppConfig != nil && config.AppConfig.Features.TextNormalizationEnabled
+}
+
+// normalizeForDetection builds a de-obfuscated view of text: embedded base64,
+// hex and URL-encoded payloads are decoded, then every character goes through
+// NFKC, zero-width/format characters are removed and confusables are mapped to
+// Latin. Matches in the view map back to the original span they came from;
+// anything found inside a decoded payload maps to the whole encoded run.
+func normalizeForDetection(text string) *textView {
+	b := newViewBuilder(len(text))
+	pos := 0
+	for _, r := range decodedRegions(text) {
+		normalizeInto(b, text[pos:r.start], pos)
+		b.emit(foldObfuscation(norm.NFKC.String(r.decoded)), r.start, r.end)
+		pos = r.end
+	}
+	normalizeInto(b, text[pos:], pos)
+	return b.view(len(text))
+}
+
+// normalizeInto appends the normalized form of segment (found at offset in the original)
+func normalizeInto(b *viewBuilder, segment string, offset int) {
+	if segment == "" {
+		return
+	}
+	var it norm.Iter
+	it.InitString(norm.NFKC, segment)
+	for !it.Done() {
+		start := it.Pos()
+		out := foldObfuscation(string(it.Next()))
+		b.emit(out, offset+start, offset+it.Pos())
+	}
+}
+
+// foldObfuscation strips invisible format characters and maps confusables
+func foldObfuscation(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Cf, r) {
+			return -1 // zero-width spaces/joiners, BOM, soft hyphen, bidi controls
+		}
+		if l, ok := confusables[r]; ok {
+			return l
+		}
+		return r
+	}, s)
+}
+
+// decodedRegion is an encoded run of the original text and its decoded payload
+type decodedRegion struct {
+	start, end int
+	decoded    string
+}
+
+// decodedRegions finds non-overlapping encoded payloads that decode to readable text
+func decodedRegions(text string) []decodedRegion {
+	var regions []decodedRegion
+	collect := func(re *regexp.Regexp, decode func(string) (string, bool)) {
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if decoded, ok := decode(text[loc[0]:loc[1]]); ok {
+				regions = append(regions, decodedRegion{start: loc[0], end: loc[1], decoded: decoded})
+			}
+		}
+	}
+	collect(hexEscapeRun, decodeHexEscapes)
+	collect(hexRun, decodeHex)
+	collect(base64Run, decodeBase64)
+	collect(urlEncodedRun, decodeURL)
+
+	// Longest region wins on overlap, mirroring candidate selection in Detect
+	sort.SliceStable(regions, func(i, j int) bool {
+		if regions[i].start != regions[j].start {
+			return regions[i].start < regions[j].start
+		}
+		return regions[i].end > regions[j].end
+	})
+	var kept []decodedRegion
+	end := 0
+	for _, r := range regions {
+		if r.start < end {
+			continue
+		}
+		kept = append(kept, r)
+		end = r.end
+	}
+	return kept
+}
+
+func decodeBase64(s string) (string, bool) {
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if out, err := enc.DecodeString(s); err == nil {
+			return readable(out)
+		}
+	}
+	return "", false
+}
+
+func decodeHex(s string) (string, bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 != 0 {
+		return "", false
+	}
+	out, err := hex.DecodeString(s)
+	if err != nil {
+		return "", false
+	}
+	return readable(out)
+}
+
+func decodeHexEscapes(s string) (string, bool) {
+	return decodeHex(strings.ReplaceAll(s, `\x`, ""))
+}
+
+func decodeURL(s string) (string, bool) {
+	out, err := url.PathUnescape(s)
+	if err != nil || out == s {
+		return "", false
+	}
+	return readable([]byte(out))
+}
+
+// readable accepts decoded bytes only if they look like text, which keeps
+// hashes, keys and card numbers that happen to be valid hex/base64 untouched
+func readable(b []byte) (string, bool) {
+	if !utf8.Valid(b) || utf8.RuneCount(b) < minDecodedRunes {
+		return "", false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return "", false
+		}
+	}
+	return string(b), true
+}
@@ -0,0 +1,177 @@
+package guardrails
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+	"sync"
+	"unicode"
+
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/models"
+)
+
+// Redaction strategies usable in Pattern.RedactionStrategy
+const (
+	RedactionRandom           = "RANDOM"            // unique random placeholder (default)
+	RedactionPartial          = "PARTIAL"           // mask all but the last characters, keep separators
+	RedactionLabel            = "LABEL"             // fixed label such as [EMAIL]
+	RedactionHMAC             = "HMAC"              // keyed hash, identical values join across requests
+	RedactionFormatPreserving = "FORMAT_PRESERVING" // same shape, pseudonymous characters
+	RedactionPseudonym        = "PSEUDONYM"         // deterministic within a RID
+)
+
+// defaultPartialKeepLast is how many trailing characters PARTIAL leaves visible
+const defaultPartialKeepLast = 4
+
+// hmacTokenLength is the number of hex characters kept from keyed hashes
+const hmacTokenLength = 16
+
+var (
+	redactionKeyOnce sync.Once
+	redactionKey     []byte
+)
+
+// redactionHMACKey returns REDACTION_HMAC_KEY, or a per-process random key when unset
+// (tokens are then only stable until restart).
+func redactionHMACKey() []byte {
+	redactionKeyOnce.Do(func() {
+		if config.AppConfig != nil && config.AppConfig.RedactionHMACKey != "" {
+			redactionKey = []byte(config.AppConfig.RedactionHMACKey)
+			return
+		}
+		log.Println("REDACTION_HMAC_KEY is not set; HMAC and pseudonym tokens will change on restart")
+		redactionKey = make([]byte, 32)
+		if _, err := rand.Read(redactionKey); err != nil {
+			redactionKey = []byte(generateRandomString(32))
+		}
+	})
+	return redactionKey
+}
+
+// IsValidRedactionStrategy reports whether name is a known strategy (empty means default)
+func IsValidRedactionStrategy(name string) bool {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "", RedactionRandom, RedactionPartial, RedactionLabel, RedactionHMAC, RedactionFormatPreserving, RedactionPseudonym:
+		return true
+	}
+	return false
+}
+
+// isVaultableStrategy reports whether a strategy yields placeholders that identify a
+// single value. LABEL and PARTIAL placeholders are shared by different values, so
+// storing them would let one message overwrite another's original under the same RID.
+// FORMAT_PRESERVING placeholders look like ordinary values, so rehydration would also
+// rewrite text that merely happens to equal one.
+func isVaultableStrategy(name string) bool {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "", RedactionRandom, RedactionHMAC, RedactionPseudonym:
+		return true
+	}
+	return false
+}
+
+// redact returns the replacement for value according to the pattern's redaction strategy
+func redact(p *models.Pattern, value, rid string) string {
+	switch strings.ToUpper(strings.TrimSpace(p.RedactionStrategy)) {
+	case RedactionPartial:
+		keep := p.RedactionKeepLast
+		if keep <= 0 {
+			keep = defaultPartialKeepLast
+		}
+		return partialMask(value, keep)
+	case RedactionLabel:
+		if p.RedactionLabel != "" {
+			return p.RedactionLabel
+		}
+		return "[" + p.Name + "]"
+	case RedactionHMAC:
+		return "[" + p.Name + "_" + keyedToken(value) + "]"
+	case RedactionFormatPreserving:
+		return formatPreservingPseudonym(value)
+	case RedactionPseudonym:
+		if rid == "" {
+			return "[" + p.Name + "_" + keyedToken(value) + "]"
+		}
+		return "[" + rid + "_" + p.Name + "_" + keyedToken(rid+"\x00"+value) + "]"
+	default:
+		return generatePlaceholder(p.Name, rid)
+	}
+}
+
+// keyedToken is a short hex HMAC-SHA256 of value
+func keyedToken(value string) string {
+	mac := hmac.New(sha256.New, redactionHMACKey())
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:hmacTokenLength]
+}
+
+// partialMask replaces letters and digits with '*' except the last keep of them;
+// separators stay in place (4111-1111-1111-1234 -> ****-****-****-1234). Values with
+// no more than keep letters and digits are masked entirely.
+func partialMask(value string, keep int) string {
+	runes := []rune(value)
+	alnum := 0
+	for _, r := range runes {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			alnum++
+		}
+	}
+	if alnum <= keep {
+		keep = 0
+	}
+	visible := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			continue
+		}
+		if visible < keep {
+			visible++
+			continue
+		}
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+// formatPreservingPseudonym deterministically replaces digits with digits and
+// letters with letters of the same case, keeping every other character, so the
+// result still passes shape checks downstream (emails stay emails, IBANs stay IBANs)
+func formatPreservingPseudonym(value string) string {
+	mac := hmac.New(sha256.New, redactionHMACKey())
+	mac.Write([]byte(value))
+	stream := mac.Sum(nil)
+
+	var b strings.Builder
+	b.Grow(len(value))
+	i := 0
+	next := func() int {
+		if i == len(stream) {
+			// Extend the key stream for long values
+			mac.Reset()
+			mac.Write(stream)
+			stream = mac.Sum(nil)
+			i = 0
+		}
+		v := int(stream[i])
+		i++
+		return v
+	}
+
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteByte(byte('0' + next()%10))
+		case r >= 'a' && r <= 'z':
+			b.WriteByte(byte('a' + next()%26))
+		case r >= 'A' && r <= 'Z':
+			b.WriteByte(byte('A' + next()%26))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
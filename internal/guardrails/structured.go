@@ -0,0 +1,210 @@
+package guardrails
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+
+	"thyris-sz/internal/models"
+)
+
+// jsonLeaf is a string value of a JSON document and the raw token it was read from
+type jsonLeaf struct {
+	path       []jsonPathSegment
+	value      string
+	start, end int // byte range of the quoted token in the document
+}
+
+// jsonFrame tracks the position inside an open object or array
+type jsonFrame struct {
+	isObject  bool
+	expectKey bool
+	key       string
+	index     int
+}
+
+// jsonStringLeaves lists every string value (not object key) of doc in document order
+func jsonStringLeaves(doc []byte) ([]jsonLeaf, error) {
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+
+	var stack []*jsonFrame
+	var leaves []jsonLeaf
+
+	currentPath := func() []jsonPathSegment {
+		path := make([]jsonPathSegment, 0, len(stack))
+		for _, f := range stack {
+			if f.isObject {
+				path = append(path, jsonPathSegment{key: f.key})
+			} else {
+				path = append(path, jsonPathSegment{index: f.index, isIndex: true})
+			}
+		}
+		return path
+	}
+	valueDone := func() {
+		if len(stack) == 0 {
+			return
+		}
+		top := stack[len(stack)-1]
+		if top.isObject {
+			top.expectKey = true
+		} else {
+			top.index++
+		}
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch v := tok.(type) {
+		case json.Delim:
+			switch v {
+			case '{':
+				stack = append(stack, &jsonFrame{isObject: true, expectKey: true})
+			case '[':
+				stack = append(stack, &jsonFrame{})
+			default:
+				stack = stack[:len(stack)-1]
+				valueDone()
+			}
+		case string:
+			if len(stack) > 0 && stack[len(stack)-1].isObject && stack[len(stack)-1].expectKey {
+				top := stack[len(stack)-1]
+				top.key = v
+				top.expectKey = false
+				continue
+			}
+			end := int(dec.InputOffset())
+			leaves = append(leaves, jsonLeaf{
+				path:  currentPath(),
+				value: v,
+				start: rawStringStart(doc, end),
+				end:   end,
+			})
+			valueDone()
+		default:
+			valueDone()
+		}
+	}
+	return leaves, nil
+}
+
+// rawStringStart finds the opening quote of the string token ending at end.
+// Inner quotes are always escaped, so the first quote preceded by an even
+// number of backslashes (scanning backwards) opens the token.
+func rawStringStart(doc []byte, end int) int {
+	for i := end - 2; i >= 0; i-- {
+		if doc[i] != '"' {
+			continue
+		}
+		backslashes := 0
+		for j := i - 1; j >= 0 && doc[j] == '\\'; j-- {
+			backslashes++
+		}
+		if backslashes%2 == 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// encodeJSONString encodes s as a JSON string token without HTML escaping
+func encodeJSONString(s string) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// detectStructured walks every string leaf of req.JSON through the regular
+// detection pipeline. Detections carry the JSON path of their leaf with offsets
+// relative to the leaf value, and redaction rewrites only the affected string
+// tokens so the result stays a valid document with the original layout.
+func (d *Detector) detectStructured(ctx context.Context, req models.DetectRequest, rules *ruleSet) models.DetectResponse {
+	doc := []byte(req.JSON)
+
+	filter, err := newJSONPathFilter(req.IncludePaths, req.ExcludePaths)
+	if err != nil {
+		return models.DetectResponse{RedactedJSON: req.JSON, Message: err.Error()}
+	}
+
+	leaves, err := jsonStringLeaves(doc)
+	if err != nil {
+		log.Printf("Failed to parse structured payload: %v", err)
+		return models.DetectResponse{RedactedJSON: req.JSON, Message: "Invalid JSON payload"}
+	}
+
+	// Validators judge the document as a whole
+	validatorResults, blocked, messages := runValidators(string(doc), req)
+
+	var detections []models.DetectionResult
+	breakdown := make(map[string]int)
+	containsPII := false
+	seenMessages := make(map[string]bool, len(messages))
+	for _, m := range messages {
+		seenMessages[m] = true
+	}
+
+	var out bytes.Buffer
+	last := 0
+	for _, leaf := range leaves {
+		if leaf.value == "" || !filter.allows(leaf.path) {
+			continue
+		}
+
+		leafReq := req
+		leafReq.Text = leaf.value
+		leafReq.JSON = nil
+		leafReq.ExpectedFormat = ""
+		leafReq.Guardrails = nil
+
+		resp := d.detect(ctx, leafReq, rules)
+		if len(resp.Detections) == 0 && !resp.Blocked {
+			continue
+		}
+
+		path := formatJSONPath(leaf.path)
+		for _, det := range resp.Detections {
+			det.Path = path
+			detections = append(detections, det)
+		}
+		for k, v := range resp.Breakdown {
+			breakdown[k] += v
+		}
+		containsPII = containsPII || resp.ContainsPII
+		blocked = blocked || resp.Blocked
+		if resp.Message != "" && !seenMessages[resp.Message] {
+			seenMessages[resp.Message] = true
+			messages = append(messages, resp.Message)
+		}
+
+		if resp.RedactedText != leaf.value {
+			out.Write(doc[last:leaf.start])
+			out.Write(encodeJSONString(resp.RedactedText))
+			last = leaf.end
+		}
+	}
+	out.Write(doc[last:])
+
+	return models.DetectResponse{
+		RedactedJSON:      json.RawMessage(out.Bytes()),
+		Detections:        detections,
+		ValidatorResults:  validatorResults,
+		Breakdown:         breakdown,
+		Blocked:           blocked,
+		ContainsPII:       containsPII,
+		OverallConfidence: models.Confidence(roundConfidence(overallConfidence(detections, validatorResults))),
+		Message:           strings.Join(messages, "; "),
+	}
+}
@@ -1,6 +1,12 @@
 package guardrails
 
-import "thyris-sz/internal/models"
+import (
+	"context"
+	"errors"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/models"
+)
 
 // This file exposes a minimal set of helpers intended ONLY for unit tests
 // living under the top-level tests/ tree. These keep the production code
@@ -38,7 +44,121 @@ func TestGeneratePlaceholderForUnit(patternName, rid string) string {
 	return generatePlaceholder(patternName, rid)
 }
 
+// TestDetectBatchWithPatternsForUnit runs DetectBatch against the given patterns
+// instead of the database-backed rule set.
+func TestDetectBatchWithPatternsForUnit(reqs []models.DetectRequest, patterns []models.Pattern, workers int) []models.BatchDetectResult {
+	rules := &ruleSet{patterns: patterns, allowlist: map[string]bool{}, blocklist: newBlocklistEngine(nil, "test")}
+	return (&Detector{}).detectBatch(context.Background(), reqs, workers, rules)
+}
+
+func TestRehydrateForUnit(text string, entries map[string]string) (string, int) {
+	return rehydrate(text, entries)
+}
+
+func TestStoreTokensForUnit(rid string, detections []models.DetectionResult) {
+	vaultable := make(map[string]bool, len(detections))
+	for _, d := range detections {
+		vaultable[d.Placeholder] = true
+	}
+	storeTokens(rid, detections, vaultable)
+}
+
+func TestVaultEntriesForUnit(detections []models.DetectionResult, vaultable map[string]bool) map[string]string {
+	return vaultEntries(detections, vaultable)
+}
+
+func TestIsVaultableStrategyForUnit(name string) bool {
+	return isVaultableStrategy(name)
+}
+
 // SIEM helper for unit tests
 func TestPublishSecurityEventForUnit(ev models.SecurityEvent) {
 	publishSecurityEvent(ev)
 }
+
+func TestResolveThresholdsForUnit(p *models.Pattern, category string) (float64, float64, string) {
+	return resolveThresholds(p, category)
+}
+
+func TestRunVerifierForUnit(name, value string) (bool, bool) {
+	return runVerifier(name, value)
+}
+
+func TestScanContextKeywordsForUnit(text string, start, end int, p models.Pattern) ([]string, []string) {
+	return scanContextKeywords(text, start, end, p)
+}
+
+func TestBlocklistScanForUnit(items []models.BlacklistItem, text string) []models.DetectionResult {
+	return newBlocklistEngine(items, "test").scan(text)
+}
+
+// TestNormalizeForDetectionForUnit returns the normalized text and a function
+// mapping a normalized range back to the original text.
+func TestNormalizeForDetectionForUnit(text string) (string, func(start, end int) (int, int)) {
+	view := normalizeForDetection(text)
+	return view.text, view.span
+}
+
+func TestRedactForUnit(p models.Pattern, value, rid string) string {
+	return redact(&p, value, rid)
+}
+
+// TestJSONStringLeavesForUnit lists the string leaves of doc selected by the
+// include/exclude JSONPaths as path, value and raw token.
+func TestJSONStringLeavesForUnit(doc string, include, exclude []string) (paths, values, raws []string, err error) {
+	filter, err := newJSONPathFilter(include, exclude)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	leaves, err := jsonStringLeaves([]byte(doc))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, l := range leaves {
+		if !filter.allows(l.path) {
+			continue
+		}
+		paths = append(paths, formatJSONPath(l.path))
+		values = append(values, l.value)
+		raws = append(raws, doc[l.start:l.end])
+	}
+	return paths, values, raws, nil
+}
+
+func TestShannonEntropyForUnit(s string) float64 {
+	return shannonEntropy(s)
+}
+
+// TestScanEntropyForUnit runs the entropy detector with explicit settings
+func TestScanEntropyForUnit(text string, minLength int, hexThreshold, base64Threshold float64, keywords []string, requireKeyword bool, existing []models.DetectionResult) []models.DetectionResult {
+	return scanEntropy(text, "", nil, existing, entropySettings{
+		minLength:       minLength,
+		hexThreshold:    hexThreshold,
+		base64Threshold: base64Threshold,
+		keywords:        keywords,
+		requireKeyword:  requireKeyword,
+	})
+}
+
+// TestDetectWithPatternsForUnit runs detection against the given patterns instead of
+// the database, under the request's AI scoring budget
+func TestDetectWithPatternsForUnit(ctx context.Context, req models.DetectRequest, patterns []models.Pattern) models.DetectResponse {
+	rules := &ruleSet{patterns: patterns, allowlist: map[string]bool{}, blocklist: newBlocklistEngine(nil, "test")}
+	return (&Detector{}).run(ctx, req, rules)
+}
+
+// TestRunValidatorForUnit runs a validator, resolving fallback validators from others
+// instead of the database, and reports its validity, degraded mode, AI verdict and the
+// confidence it is reported with
+func TestRunValidatorForUnit(text string, v models.FormatValidator, others []models.FormatValidator) (bool, string, *ai.Verdict, float64, error) {
+	lookup := func(name string) (*models.FormatValidator, error) {
+		for i := range others {
+			if others[i].Name == name {
+				return &others[i], nil
+			}
+		}
+		return nil, errors.New("record not found")
+	}
+	outcome, err := runValidator(text, &v, lookup)
+	return outcome.valid, outcome.degraded, outcome.verdict, validatorConfidence(outcome, err), err
+}
@@ -0,0 +1,100 @@
+package guardrails
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// textView is a transformed copy of an input text that remembers, for every
+// byte, which span of the original produced it. Matches found in the view can
+// therefore be mapped back to exact offsets in the original text.
+type textView struct {
+	text   string
+	srcLen int
+	starts []int // starts[i] is the original offset of the segment that produced byte i
+	ends   []int // ends[i] is the original end offset of that segment
+	mapped bool  // false when text is the original and offsets need no mapping
+}
+
+// newTextView builds a view of text, optionally NFKC-normalized and case-folded.
+func newTextView(text string, normalize, fold bool) *textView {
+	if !normalize && !fold {
+		return &textView{text: text, srcLen: len(text)}
+	}
+
+	b := newViewBuilder(len(text))
+	emit := func(segment string, start, end int) {
+		if fold {
+			segment = strings.ToLower(segment)
+		}
+		b.emit(segment, start, end)
+	}
+
+	if normalize {
+		var it norm.Iter
+		it.InitString(norm.NFKC, text)
+		for !it.Done() {
+			start := it.Pos()
+			segment := string(it.Next())
+			emit(segment, start, it.Pos())
+		}
+	} else {
+		for i, r := range text {
+			emit(string(r), i, i+utf8.RuneLen(r))
+		}
+	}
+
+	return b.view(len(text))
+}
+
+// span maps the view range [start, end) back to a range of the original text
+func (v *textView) span(start, end int) (int, int) {
+	if !v.mapped {
+		return start, end
+	}
+	if start >= len(v.text) {
+		return v.srcLen, v.srcLen
+	}
+	origStart := v.starts[start]
+	if end <= start {
+		return origStart, origStart
+	}
+	return origStart, v.ends[end-1]
+}
+
+// viewBuilder accumulates transformed segments along with their source spans
+type viewBuilder struct {
+	buf    strings.Builder
+	starts []int
+	ends   []int
+}
+
+func newViewBuilder(capacity int) *viewBuilder {
+	b := &viewBuilder{
+		starts: make([]int, 0, capacity),
+		ends:   make([]int, 0, capacity),
+	}
+	b.buf.Grow(capacity)
+	return b
+}
+
+// emit appends out, recording that it was produced from original[start:end]
+func (b *viewBuilder) emit(out string, start, end int) {
+	b.buf.WriteString(out)
+	for i := 0; i < len(out); i++ {
+		b.starts = append(b.starts, start)
+		b.ends = append(b.ends, end)
+	}
+}
+
+func (b *viewBuilder) view(srcLen int) *textView {
+	return &textView{
+		text:   b.buf.String(),
+		srcLen: srcLen,
+		starts: b.starts,
+		ends:   b.ends,
+		mapped: true,
+	}
+}
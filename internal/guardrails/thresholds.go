@@ -3,35 +3,106 @@ package guardrails
 import (
 	"os"
 	"strconv"
+	"strings"
+	"thyris-sz/internal/models"
 )
 
-func getAllowThreshold() float64 {
-	if v := os.Getenv("CONFIDENCE_ALLOW_THRESHOLD"); v != "" {
+const (
+	defaultAllowThreshold = 0.30
+	defaultBlockThreshold = 0.85
+)
+
+// Threshold sources reported in ConfidenceExplanation / SecurityEvent
+const (
+	ThresholdSourcePattern  = "PATTERN"
+	ThresholdSourceCategory = "CATEGORY"
+	ThresholdSourceEnv      = "ENV"
+	ThresholdSourceDefault  = "DEFAULT"
+)
+
+// thresholdSourceRank orders sources from least to most specific
+var thresholdSourceRank = map[string]int{
+	ThresholdSourceDefault:  0,
+	ThresholdSourceEnv:      1,
+	ThresholdSourceCategory: 2,
+	ThresholdSourcePattern:  3,
+}
+
+// envFloat reads a float environment variable
+func envFloat(key string) (float64, bool) {
+	if v := os.Getenv(key); v != "" {
 		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			return f
+			return f, true
 		}
 	}
-	return 0.30
+	return 0, false
+}
+
+func getAllowThreshold() float64 {
+	if f, ok := envFloat("CONFIDENCE_ALLOW_THRESHOLD"); ok {
+		return f
+	}
+	return defaultAllowThreshold
 }
 
 func getBlockThreshold() float64 {
-	if v := os.Getenv("CONFIDENCE_BLOCK_THRESHOLD"); v != "" {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			return f
-		}
+	if f, ok := envFloat("CONFIDENCE_BLOCK_THRESHOLD"); ok {
+		return f
 	}
-	return 0.85
+	return defaultBlockThreshold
 }
 
 // Enterprise: category based threshold resolver
 func GetCategoryThreshold(category string) float64 {
-	key := "CONFIDENCE_" + category + "_THRESHOLD"
-	if v := os.Getenv(key); v != "" {
-		if f, err := strconv.ParseFloat(v, 64); err == nil {
-			return f
-		}
+	if f, ok := envFloat(categoryThresholdKey(category)); ok {
+		return f
 	}
 
 	// fallback to global block threshold
 	return getBlockThreshold()
 }
+
+func categoryThresholdKey(category string) string {
+	return "CONFIDENCE_" + strings.ToUpper(category) + "_THRESHOLD"
+}
+
+// resolveAllowThreshold walks pattern override -> global env -> default
+func resolveAllowThreshold(p *models.Pattern) (float64, string) {
+	if p != nil && p.AllowThreshold != nil {
+		return *p.AllowThreshold, ThresholdSourcePattern
+	}
+	if f, ok := envFloat("CONFIDENCE_ALLOW_THRESHOLD"); ok {
+		return f, ThresholdSourceEnv
+	}
+	return defaultAllowThreshold, ThresholdSourceDefault
+}
+
+// resolveBlockThreshold walks pattern override -> category env -> global env -> default
+func resolveBlockThreshold(p *models.Pattern, category string) (float64, string) {
+	if p != nil && p.BlockThreshold != nil {
+		return *p.BlockThreshold, ThresholdSourcePattern
+	}
+	if category != "" {
+		if f, ok := envFloat(categoryThresholdKey(category)); ok {
+			return f, ThresholdSourceCategory
+		}
+	}
+	if f, ok := envFloat("CONFIDENCE_BLOCK_THRESHOLD"); ok {
+		return f, ThresholdSourceEnv
+	}
+	return defaultBlockThreshold, ThresholdSourceDefault
+}
+
+// resolveThresholds returns the allow/block thresholds applicable to a detection.
+// The reported source is the most specific level that contributed either value.
+// p may be nil for detections that are not backed by a pattern (e.g. blocklist hits).
+func resolveThresholds(p *models.Pattern, category string) (allow float64, block float64, source string) {
+	allow, allowSource := resolveAllowThreshold(p)
+	block, blockSource := resolveBlockThreshold(p, category)
+
+	source = blockSource
+	if thresholdSourceRank[allowSource] > thresholdSourceRank[blockSource] {
+		source = allowSource
+	}
+	return allow, block, source
+}
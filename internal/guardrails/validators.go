@@ -1,12 +1,17 @@
 package guardrails
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"log"
 	"regexp"
+	"strings"
 	"thyris-sz/internal/ai"
 	"thyris-sz/internal/config"
+	"thyris-sz/internal/models"
 	"thyris-sz/internal/repository"
 
 	"github.com/xeipuuv/gojsonschema"
@@ -46,46 +51,114 @@ func isValidSchema(jsonContent string, schemaContent string) (bool, error) {
 	return false, errors.New(errMsg)
 }
 
+// Degraded modes of AI_PROMPT validators
+const (
+	DegradedFailClosed = "FAIL_CLOSED"
+	DegradedFailOpen   = "FAIL_OPEN"
+	DegradedFallback   = "FALLBACK"
+)
+
+// validatorLookup resolves a validator by name
+type validatorLookup func(name string) (*models.FormatValidator, error)
+
+// ValidateDegradedMode checks the degraded-mode settings of a validator
+func ValidateDegradedMode(v models.FormatValidator) error {
+	switch strings.ToUpper(v.DegradedMode) {
+	case "", DegradedFailClosed, DegradedFailOpen:
+		return nil
+	case DegradedFallback:
+		if v.FallbackValidator == "" {
+			return errors.New("fallback_validator is required for degraded_mode FALLBACK")
+		}
+		return nil
+	default:
+		return errors.New("degraded_mode must be FAIL_CLOSED, FAIL_OPEN or FALLBACK")
+	}
+}
+
 // ValidateFormat validates the text against a named format rule
 func ValidateFormat(text string, formatName string) (bool, error) {
 	validator, err := repository.GetValidatorByName(formatName)
 	if err != nil {
 		return false, errors.New("validator not found: " + formatName)
 	}
+	outcome, err := runValidator(text, validator, repository.GetValidatorByName)
+	return outcome.valid, err
+}
 
+// validatorOutcome is the result of running one validator
+type validatorOutcome struct {
+	valid    bool
+	degraded string      // degraded mode applied, if the AI judge was unavailable
+	verdict  *ai.Verdict // AI_PROMPT validators only
+}
+
+// runValidator validates text against a validator. AI_PROMPT validators pass when the
+// judge's verdict label is the expected response; when the judge cannot be reached,
+// the validator's degraded mode decides the outcome.
+func runValidator(text string, validator *models.FormatValidator, lookup validatorLookup) (validatorOutcome, error) {
 	switch validator.Type {
 	case "BUILTIN":
 		switch validator.Name {
 		case "JSON":
-			return isValidJSON(text), nil
+			return validatorOutcome{valid: isValidJSON(text)}, nil
 		case "XML":
-			return isValidXML(text), nil
+			return validatorOutcome{valid: isValidXML(text)}, nil
 		default:
-			return false, errors.New("unknown builtin validator: " + validator.Name)
+			return validatorOutcome{}, errors.New("unknown builtin validator: " + validator.Name)
 		}
 	case "REGEX":
 		matched, err := regexp.MatchString(validator.Rule, text)
 		if err != nil {
-			return false, err
+			return validatorOutcome{}, err
 		}
-		return matched, nil
+		return validatorOutcome{valid: matched}, nil
 	case "SCHEMA":
 		if !config.AppConfig.Features.SchemaValidationEnabled {
-			return true, nil // Skip validation if feature is disabled
+			return validatorOutcome{valid: true}, nil // Skip validation if feature is disabled
 		}
 		// Ensure content is valid JSON first
 		if !isValidJSON(text) {
-			return false, errors.New("content is not valid JSON")
+			return validatorOutcome{}, errors.New("content is not valid JSON")
 		}
-		return isValidSchema(text, validator.Rule)
+		valid, err := isValidSchema(text, validator.Rule)
+		return validatorOutcome{valid: valid}, err
 	case "AI_PROMPT":
 		if !config.AppConfig.Features.SemanticAnalysisEnabled {
 			// Security best practice: Fail Closed.
-			return false, errors.New("AI validation is disabled by feature flag")
+			return validatorOutcome{}, errors.New("AI validation is disabled by feature flag")
+		}
+		verdict, err := ai.JudgeVerdict(context.Background(), text, validator.Rule)
+		if err != nil {
+			return degradedValidation(text, validator, lookup, err)
+		}
+		return validatorOutcome{valid: verdict.Matches(validator.ExpectedResponse), verdict: verdict}, nil
+	default:
+		return validatorOutcome{}, errors.New("unknown validator type: " + validator.Type)
+	}
+}
+
+// degradedValidation applies the degraded mode of an AI_PROMPT validator whose judge
+// call failed with aiErr
+func degradedValidation(text string, validator *models.FormatValidator, lookup validatorLookup, aiErr error) (validatorOutcome, error) {
+	switch strings.ToUpper(validator.DegradedMode) {
+	case DegradedFailOpen:
+		log.Printf("Validator %s degraded (FAIL_OPEN): %v", validator.Name, aiErr)
+		return validatorOutcome{valid: true, degraded: DegradedFailOpen}, nil
+	case DegradedFallback:
+		degraded := DegradedFallback + ":" + validator.FallbackValidator
+		fallback, err := lookup(validator.FallbackValidator)
+		if err != nil || fallback == nil {
+			return validatorOutcome{degraded: degraded}, fmt.Errorf("%v; fallback validator not found: %s", aiErr, validator.FallbackValidator)
+		}
+		if fallback.Type != "REGEX" {
+			return validatorOutcome{degraded: degraded}, fmt.Errorf("%v; fallback validator %s is not a REGEX validator", aiErr, fallback.Name)
 		}
-		// Use AI Client to validate
-		return ai.CheckWithAI(text, validator.Rule, validator.ExpectedResponse)
+		log.Printf("Validator %s degraded (%s): %v", validator.Name, degraded, aiErr)
+		outcome, err := runValidator(text, fallback, lookup)
+		outcome.degraded = degraded
+		return outcome, err
 	default:
-		return false, errors.New("unknown validator type: " + validator.Type)
+		return validatorOutcome{degraded: DegradedFailClosed}, aiErr
 	}
 }
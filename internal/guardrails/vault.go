@@ -0,0 +1,96 @@
+package guardrails
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"thyris-sz/internal/cache"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/models"
+)
+
+// ErrVaultRIDRequired is returned when a vault operation is attempted without a RID.
+var ErrVaultRIDRequired = errors.New("rid is required for tokenization vault")
+
+// vaultTTL returns the configured lifetime of vault entries
+func vaultTTL() time.Duration {
+	if config.AppConfig != nil && config.AppConfig.TokenVaultTTLSeconds > 0 {
+		return time.Duration(config.AppConfig.TokenVaultTTLSeconds) * time.Second
+	}
+	return time.Hour
+}
+
+// storeTokens persists placeholder -> original mappings of the given detections under the RID.
+// Nothing is stored unless TOKEN_VAULT_ENABLED is set.
+func storeTokens(rid string, detections []models.DetectionResult, vaultable map[string]bool) {
+	if config.AppConfig == nil || !config.AppConfig.TokenVaultEnabled {
+		return
+	}
+	if rid == "" || len(detections) == 0 {
+		return
+	}
+
+	if err := cache.SetVaultEntries(rid, vaultEntries(detections, vaultable), vaultTTL()); err != nil {
+		log.Printf("Failed to store tokens in vault for RID %s: %v", rid, err)
+	}
+}
+
+// vaultEntries maps placeholders to originals. Only placeholders in vaultable
+// (collision-free redaction strategies) are kept; blocklist hits never are.
+func vaultEntries(detections []models.DetectionResult, vaultable map[string]bool) map[string]string {
+	entries := make(map[string]string, len(detections))
+	ambiguous := make(map[string]bool)
+	for _, d := range detections {
+		if d.Type == "BLOCKLIST" || !vaultable[d.Placeholder] || ambiguous[d.Placeholder] {
+			continue
+		}
+		// Guard against two values yielding the same placeholder
+		if existing, ok := entries[d.Placeholder]; ok && existing != d.Value {
+			delete(entries, d.Placeholder)
+			ambiguous[d.Placeholder] = true
+			continue
+		}
+		entries[d.Placeholder] = d.Value
+	}
+	return entries
+}
+
+// Detokenize swaps placeholders stored for the RID back to their original values.
+// It returns the rehydrated text and the number of replaced placeholders.
+func Detokenize(rid string, text string) (string, int, error) {
+	if rid == "" {
+		return text, 0, ErrVaultRIDRequired
+	}
+
+	entries, err := cache.GetVaultEntries(rid)
+	if err != nil {
+		return text, 0, err
+	}
+
+	rehydrated, count := rehydrate(text, entries)
+	return rehydrated, count, nil
+}
+
+// rehydrate replaces every known placeholder in text with its original value
+func rehydrate(text string, entries map[string]string) (string, int) {
+	if len(entries) == 0 || text == "" {
+		return text, 0
+	}
+
+	count := 0
+	pairs := make([]string, 0, len(entries)*2)
+	for placeholder, original := range entries {
+		if n := strings.Count(text, placeholder); n > 0 {
+			count += n
+			pairs = append(pairs, placeholder, original)
+		}
+	}
+
+	if count == 0 {
+		return text, 0
+	}
+
+	return strings.NewReplacer(pairs...).Replace(text), count
+}
@@ -0,0 +1,202 @@
+package guardrails
+
+import (
+	"log"
+	"strings"
+)
+
+// Verifier policies applied when a regex match fails its checksum
+const (
+	VerifierPolicyDrop      = "DROP"      // discard the candidate (default)
+	VerifierPolicyDownscore = "DOWNSCORE" // keep the candidate with reduced confidence
+)
+
+// verifierFailPenalty is the multiplier applied to the regex score of candidates
+// that fail verification under the DOWNSCORE policy
+const verifierFailPenalty = 0.5
+
+// verifierFunc validates a regex match beyond its shape (checksums, reserved ranges)
+type verifierFunc func(value string) bool
+
+// verifiers maps the names usable in Pattern.Verifier to their implementation
+var verifiers = map[string]verifierFunc{
+	"LUHN":    verifyLuhn,
+	"TCKN":    verifyTCKN,
+	"VKN":     verifyVKN,
+	"IBAN":    verifyIBAN,
+	"UK_NINO": verifyUKNINO,
+	"US_SSN":  verifyUSSSN,
+}
+
+// IsValidVerifier reports whether name is a known verifier (empty means none)
+func IsValidVerifier(name string) bool {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" {
+		return true
+	}
+	_, ok := verifiers[name]
+	return ok
+}
+
+// runVerifier runs the named verifier on value. known is false when no verifier
+// with that name exists, in which case the match is treated as unverified.
+func runVerifier(name string, value string) (passed bool, known bool) {
+	fn, ok := verifiers[strings.ToUpper(strings.TrimSpace(name))]
+	if !ok {
+		log.Printf("Unknown pattern verifier: %s", name)
+		return false, false
+	}
+	return fn(value), true
+}
+
+// stripSeparators removes spaces and dashes commonly used to group identifiers
+func stripSeparators(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '\t' {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// digitsOf converts a string of ASCII digits to ints; ok is false on any other character
+func digitsOf(value string) ([]int, bool) {
+	digits := make([]int, 0, len(value))
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return nil, false
+		}
+		digits = append(digits, int(r-'0'))
+	}
+	return digits, true
+}
+
+// verifyLuhn checks payment card numbers with the Luhn (mod 10) algorithm
+func verifyLuhn(value string) bool {
+	digits, ok := digitsOf(stripSeparators(value))
+	if !ok || len(digits) < 12 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// verifyTCKN checks Turkish Identification Numbers (11 digits, two check digits)
+func verifyTCKN(value string) bool {
+	d, ok := digitsOf(stripSeparators(value))
+	if !ok || len(d) != 11 || d[0] == 0 {
+		return false
+	}
+
+	odd := d[0] + d[2] + d[4] + d[6] + d[8]
+	even := d[1] + d[3] + d[5] + d[7]
+	d10 := ((odd*7-even)%10 + 10) % 10
+	if d[9] != d10 {
+		return false
+	}
+
+	sum := 0
+	for _, v := range d[:10] {
+		sum += v
+	}
+	return d[10] == sum%10
+}
+
+// verifyVKN checks Turkish Tax Identification Numbers (10 digits, last is a check digit)
+func verifyVKN(value string) bool {
+	d, ok := digitsOf(stripSeparators(value))
+	if !ok || len(d) != 10 {
+		return false
+	}
+
+	sum := 0
+	for i := 0; i < 9; i++ {
+		tmp := (d[i] + 9 - i) % 10
+		v := (tmp * (1 << (9 - i))) % 9
+		if tmp != 0 && v == 0 {
+			v = 9
+		}
+		sum += v
+	}
+	return d[9] == (10-sum%10)%10
+}
+
+// verifyIBAN checks International Bank Account Numbers with the ISO 13616 mod-97 rule
+func verifyIBAN(value string) bool {
+	iban := strings.ToUpper(stripSeparators(value))
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	rearranged := iban[4:] + iban[:4]
+	remainder := 0
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			remainder = (remainder*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			remainder = (remainder*100 + int(r-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// invalidNINOPrefixes are prefixes never allocated by HMRC
+var invalidNINOPrefixes = map[string]bool{
+	"BG": true, "GB": true, "KN": true, "NK": true, "NT": true, "TN": true, "ZZ": true,
+}
+
+// verifyUKNINO checks UK National Insurance Numbers against HMRC prefix rules
+func verifyUKNINO(value string) bool {
+	nino := strings.ToUpper(stripSeparators(value))
+	if len(nino) != 9 {
+		return false
+	}
+
+	first, second := nino[0], nino[1]
+	if strings.IndexByte("DFIQUV", first) >= 0 || strings.IndexByte("DFIOQUV", second) >= 0 {
+		return false
+	}
+	if first < 'A' || first > 'Z' || second < 'A' || second > 'Z' {
+		return false
+	}
+	if invalidNINOPrefixes[nino[:2]] {
+		return false
+	}
+	if _, ok := digitsOf(nino[2:8]); !ok {
+		return false
+	}
+	return nino[8] >= 'A' && nino[8] <= 'D'
+}
+
+// verifyUSSSN checks US Social Security Numbers against SSA area/group/serial rules
+func verifyUSSSN(value string) bool {
+	d, ok := digitsOf(stripSeparators(value))
+	if !ok || len(d) != 9 {
+		return false
+	}
+
+	area := d[0]*100 + d[1]*10 + d[2]
+	group := d[3]*10 + d[4]
+	serial := d[5]*1000 + d[6]*100 + d[7]*10 + d[8]
+
+	if area == 0 || area == 666 || area >= 900 {
+		return false
+	}
+	return group != 0 && serial != 0
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"os"
+	"thyris-sz/internal/ai"
 	"thyris-sz/internal/cache"
+	"thyris-sz/internal/guardrails"
 	"thyris-sz/internal/models"
 	"thyris-sz/internal/repository"
 )
@@ -26,7 +28,8 @@ func ReloadCache(w http.ResponseWriter, r *http.Request) {
 	// Clear caches
 	cache.ClearCache(cache.KeyPatterns)
 	cache.ClearCache(cache.KeyAllowlist)
-	cache.ClearCache(cache.KeyBlocklist)
+	cache.ClearCache(cache.BlocklistKeys...)
+	guardrails.InvalidateBlocklist()
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -59,6 +62,18 @@ func UpdatePatternPolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Thresholds must be valid confidence values; nil clears the override
+	for _, th := range []*float64{req.BlockThreshold, req.AllowThreshold} {
+		if th != nil && (*th < 0 || *th > 1) {
+			http.Error(w, "Thresholds must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.BlockThreshold != nil && req.AllowThreshold != nil && *req.AllowThreshold > *req.BlockThreshold {
+		http.Error(w, "allow_threshold must not exceed block_threshold", http.StatusBadRequest)
+		return
+	}
+
 	pattern, err := repository.GetPatternByID(req.PatternID)
 	if err != nil || pattern == nil {
 		http.Error(w, "Pattern not found", http.StatusNotFound)
@@ -90,3 +105,21 @@ func UpdatePatternPolicy(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// AICacheStats reports hit ratios of the AI confidence and verdict caches
+// GET /admin/ai-cache/stats
+func AICacheStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	adminKey := os.Getenv("ADMIN_API_KEY")
+	if adminKey == "" || r.Header.Get("X-ADMIN-KEY") != adminKey {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ai.AICacheStats())
+}
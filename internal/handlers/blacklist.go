@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"thyris-sz/internal/cache"
 	"thyris-sz/internal/database"
+	"thyris-sz/internal/guardrails"
 	"thyris-sz/internal/models"
 )
 
@@ -17,13 +18,19 @@ func CreateBlacklistItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := guardrails.ValidateBlacklistItem(&item); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if result := database.DB.Create(&item); result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Invalidate cache
-	cache.ClearCache(cache.KeyBlocklist)
+	cache.ClearCache(cache.BlocklistKeys...)
+	guardrails.InvalidateBlocklist()
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(item)
@@ -53,7 +60,8 @@ func DeleteBlacklistItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Invalidate cache
-	cache.ClearCache(cache.KeyBlocklist)
+	cache.ClearCache(cache.BlocklistKeys...)
+	guardrails.InvalidateBlocklist()
 
 	w.WriteHeader(http.StatusNoContent)
 }
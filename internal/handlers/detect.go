@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/models"
+	"time"
+)
+
+// LogDetectAudit writes the audit line emitted for every processed detect request
+func LogDetectAudit(rid string, startTime time.Time, result models.DetectResponse) {
+	var breakdownParts []string
+	totalDetections := 0
+	for typeName, count := range result.Breakdown {
+		breakdownParts = append(breakdownParts, fmt.Sprintf("%s: %d", typeName, count))
+		totalDetections += count
+	}
+	breakdownStr := strings.Join(breakdownParts, ", ")
+	if breakdownStr == "" {
+		breakdownStr = "None"
+	}
+
+	if rid == "" {
+		rid = "NO-RID"
+	}
+
+	log.Printf("[AUDIT] Request ID: %s | Time: %s | Duration: %v | Total Found: %d | Breakdown: {%s}",
+		rid,
+		startTime.Format(time.RFC3339),
+		time.Since(startTime),
+		totalDetections,
+		breakdownStr,
+	)
+}
+
+// writeJSONError writes a {"error": msg} body with the given status
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// NewDetectBatchHandler returns the handler for POST /detect/batch.
+// Rules are loaded once per batch and items are processed by a bounded worker pool.
+func NewDetectBatchHandler(detector *guardrails.Detector) http.HandlerFunc {
+	return newDetectBatchHandler(detector.DetectBatchContext)
+}
+
+// newDetectBatchHandler builds the /detect/batch handler on detectBatch, which runs the
+// items with at most workers goroutines
+func newDetectBatchHandler(detectBatch func(ctx context.Context, reqs []models.DetectRequest, workers int) ([]models.BatchDetectResult, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.BatchDetectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+			return
+		}
+
+		if len(req.Items) == 0 {
+			writeJSONError(w, http.StatusBadRequest, "items must not be empty")
+			return
+		}
+
+		maxItems, workers := 1000, 8
+		if config.AppConfig != nil {
+			maxItems, workers = config.AppConfig.DetectBatchMaxItems, config.AppConfig.DetectBatchWorkers
+		}
+		if maxItems > 0 && len(req.Items) > maxItems {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch exceeds %d items", maxItems))
+			return
+		}
+
+		startTime := time.Now()
+		results, err := detectBatch(r.Context(), req.Items, workers)
+		if err != nil {
+			log.Printf("Batch detection failed to load rules: %v", err)
+			writeJSONError(w, http.StatusInternalServerError, "Failed to load detection rules")
+			return
+		}
+
+		resp := models.BatchDetectResponse{Results: results}
+		for _, res := range results {
+			if res.Error != "" {
+				resp.Failed++
+				continue
+			}
+			LogDetectAudit(req.Items[res.Index].RID, startTime, *res.Response)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
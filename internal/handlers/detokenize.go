@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/guardrails"
+)
+
+// DetokenizeRequest represents the payload for rehydrating placeholders
+type DetokenizeRequest struct {
+	RID  string `json:"rid"`
+	Text string `json:"text"`
+}
+
+// DetokenizeResponse represents the rehydrated text
+type DetokenizeResponse struct {
+	Text     string `json:"text"`
+	Replaced int    `json:"replaced"`
+}
+
+// isVaultAuthorized reports whether the caller presented a valid vault key (X-TSZ-Vault-Key)
+func isVaultAuthorized(r *http.Request) bool {
+	if config.AppConfig == nil || config.AppConfig.TokenVaultAPIKey == "" {
+		return false
+	}
+	provided := r.Header.Get("X-TSZ-Vault-Key")
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(config.AppConfig.TokenVaultAPIKey)) == 1
+}
+
+// Detokenize swaps vault placeholders in the given text back to their original values
+// POST /detokenize
+func Detokenize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !isVaultAuthorized(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req DetokenizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if req.RID == "" {
+		http.Error(w, "rid is required", http.StatusBadRequest)
+		return
+	}
+
+	text, replaced, err := guardrails.Detokenize(req.RID, req.Text)
+	if err != nil {
+		http.Error(w, "Failed to read tokenization vault", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DetokenizeResponse{
+		Text:     text,
+		Replaced: replaced,
+	})
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -17,6 +18,53 @@ import (
 	"thyris-sz/internal/models"
 )
 
+// GatewayOption configures optional behaviour of the chat gateway.
+type GatewayOption func(*gatewayOptions)
+
+// gatewayOptions holds the resolved gateway configuration.
+type gatewayOptions struct {
+	tokenVault         bool
+	nonTextParts       string
+	tokenInputs        string
+	tools              ToolPolicy
+	scanRoles          map[string]bool
+	conversationWindow int
+}
+
+// Policies for non-text content parts (image_url, input_audio, file, ...) in scanned messages
+const (
+	NonTextPartsAllow  = "ALLOW"
+	NonTextPartsStrip  = "STRIP"
+	NonTextPartsReject = "REJECT"
+)
+
+// WithTokenVault enables the tokenization vault: placeholders produced while masking
+// user messages are stored per RID, and callers presenting a valid X-TSZ-Vault-Key
+// receive non-streaming assistant output with those placeholders swapped back to originals.
+func WithTokenVault(enabled bool) GatewayOption {
+	return func(o *gatewayOptions) {
+		o.tokenVault = enabled
+	}
+}
+
+// WithNonTextPartPolicy sets how non-text content parts of scanned messages are handled:
+// ALLOW forwards them unscanned, STRIP removes them before forwarding and REJECT fails
+// the request with HTTP 400. Unknown values fall back to ALLOW.
+func WithNonTextPartPolicy(policy string) GatewayOption {
+	return func(o *gatewayOptions) {
+		o.nonTextParts = strings.ToUpper(strings.TrimSpace(policy))
+	}
+}
+
+// WithTokenInputPolicy sets how token-array "input"/"prompt" values of the embeddings and
+// completions gateways are handled, with the values of WithNonTextPartPolicy. Token arrays
+// cannot be scanned, so unset or unknown values fall back to REJECT.
+func WithTokenInputPolicy(policy string) GatewayOption {
+	return func(o *gatewayOptions) {
+		o.tokenInputs = strings.ToUpper(strings.TrimSpace(policy))
+	}
+}
+
 // NewOpenAIChatGateway returns an HTTP handler that exposes an OpenAI-compatible
 // /v1/chat/completions endpoint.
 //
@@ -28,13 +76,28 @@ import (
 //  5. For non-streaming calls, optionally apply guardrails on assistant output
 //  6. For streaming calls, proxy the upstream event-stream and, depending on headers,
 //     optionally apply output guardrails in a streaming-safe way (see stream modes below).
-func NewOpenAIChatGateway(detector *guardrails.Detector) http.HandlerFunc {
+func NewOpenAIChatGateway(detector *guardrails.Detector, opts ...GatewayOption) http.HandlerFunc {
+	return newOpenAIChatGateway(detector.DetectContext, opts...)
+}
+
+// newOpenAIChatGateway implements NewOpenAIChatGateway with an explicit detection function
+func newOpenAIChatGateway(detectContext contextDetectFunc, opts ...GatewayOption) http.HandlerFunc {
+	options := gatewayOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			writeOpenAIError(w, http.StatusMethodNotAllowed, "Method not allowed", "method_not_allowed")
 			return
 		}
 
+		// Detection (and its AI scoring) stops when the client goes away
+		detect := detectContext.bind(r.Context())
+
 		// 1) Parse payload and stream flag
 		payload, stream, err := parseChatGatewayPayload(r)
 		if err != nil {
@@ -51,10 +114,27 @@ func NewOpenAIChatGateway(detector *guardrails.Detector) http.HandlerFunc {
 		// 2) Extract metadata (RID, guardrails list, streaming options)
 		rid, guardrailsList := extractGatewayMetadata(r)
 		mode, onFail := extractGatewayStreamOptions(r)
+		scope := extractGatewayScanScope(r, options)
 		log.Printf("[gateway] RID=%s stream=%v mode=%s onFail=%s guardrails=%v gateway_block_mode=%s", rid, stream, mode, onFail, guardrailsList, config.AppConfig.GatewayBlockMode)
 
-		// 3) Apply input guardrails on user messages
-		sanitizedMessages, blocked, blockMessage, inputDetects := applyInputGuardrails(detector, messages, rid, guardrailsList)
+		// Calls to tools removed below can still come back, so the offer made by the client counts
+		checkStreamedTools := stream && options.tools.active() && declaresTools(payload)
+		if removed := filterDeclaredTools(payload, options.tools); len(removed) > 0 {
+			log.Printf("[gateway] RID=%s removed tools not permitted by tool policy: %v", rid, removed)
+		}
+		if checkStreamedTools && mode == "stream-async" {
+			writeOpenAIErrorWithMeta(w, http.StatusBadRequest, errToolPolicyStreamMode, "tsz_tool_policy_stream_mode", map[string]interface{}{"rid": rid})
+			return
+		}
+
+		// 3) Apply the non-text part policy and input guardrails on user messages
+		if err := applyNonTextPartPolicy(messages, scope.roles, options.nonTextParts); err != nil {
+			log.Printf("[gateway] RID=%s rejected: %v", rid, err)
+			writeOpenAIErrorWithMeta(w, http.StatusBadRequest, err.Error(), "tsz_non_text_content", map[string]interface{}{"rid": rid})
+			return
+		}
+
+		sanitizedMessages, blocked, blockMessage, inputDetects := applyInputGuardrails(detect, messages, rid, guardrailsList, scope, options.tokenVault)
 		if blocked {
 			triggeredGuardrails := computeTriggeredGuardrails(inputDetects, nil)
 			log.Printf("[gateway] RID=%s blocked on input guardrails: %s (gateway_block_mode=%s, guardrails=%v)", rid, blockMessage, config.AppConfig.GatewayBlockMode, triggeredGuardrails)
@@ -103,7 +183,7 @@ func NewOpenAIChatGateway(detector *guardrails.Detector) http.HandlerFunc {
 				}
 			} else {
 				// Provider doesn't support forwarding, fall back to direct HTTP
-				upstreamResp, err = sendDirectUpstreamRequest(payload)
+				upstreamResp, err = sendDirectUpstreamRequest(ai.EndpointChatCompletions, payload)
 				if err != nil {
 					log.Printf("[gateway] RID=%s upstream LLM request failed: %v", rid, err)
 					writeOpenAIError(w, http.StatusBadGateway, "Failed to reach upstream LLM service", "upstream_unreachable")
@@ -112,7 +192,7 @@ func NewOpenAIChatGateway(detector *guardrails.Detector) http.HandlerFunc {
 			}
 		} else {
 			// No provider configured, use direct HTTP
-			upstreamResp, err = sendDirectUpstreamRequest(payload)
+			upstreamResp, err = sendDirectUpstreamRequest(ai.EndpointChatCompletions, payload)
 			if err != nil {
 				log.Printf("[gateway] RID=%s upstream LLM request failed: %v", rid, err)
 				writeOpenAIError(w, http.StatusBadGateway, "Failed to reach upstream LLM service", "upstream_unreachable")
@@ -127,21 +207,36 @@ func NewOpenAIChatGateway(detector *guardrails.Detector) http.HandlerFunc {
 			// Streaming mode: choose strategy based on headers
 			switch mode {
 			case "stream-sync":
-				streamWithOutputGuardrails(detector, rid, guardrailsList, upstreamResp, w, onFail)
+				streamWithOutputGuardrails(detect, rid, guardrailsList, options.tools, upstreamResp, w, onFail, requestedChoices(payload))
 			case "stream-async":
-				proxyStreamWithAsyncValidation(detector, rid, guardrailsList, upstreamResp, w)
+				proxyStreamWithAsyncValidation(detectContext.bind(context.WithoutCancel(r.Context())), rid, guardrailsList, upstreamResp, w)
 			default: // "final-only" or unknown
+				if checkStreamedTools {
+					// Text passes through unchanged; tool calls are still checked
+					passThrough := func() *streamGuard { return newStreamGuardWithDetect(detect, rid, nil, onFail) }
+					streamChoicesWithGuards(passThrough, detect, rid, guardrailsList, options.tools, upstreamResp, w, onFail, requestedChoices(payload))
+					return
+				}
 				proxyStreamResponse(w, upstreamResp)
 			}
 			return
 		}
 
 		// Non-streaming: apply output guardrails on the full assistant response
-		processNonStreamResponse(detector, rid, guardrailsList, upstreamResp, w, inputDetects)
+		detokenize := options.tokenVault && isVaultAuthorized(r)
+		processNonStreamResponse(detect, rid, guardrailsList, upstreamResp, w, inputDetects, detokenize, options.tools)
 		log.Printf("[gateway] RID=%s non-stream response completed with status=%d", rid, upstreamResp.StatusCode)
 	}
 }
 
+// requestedChoices returns the number of choices requested with "n" (default 1).
+func requestedChoices(payload map[string]interface{}) int {
+	if n, ok := payload["n"].(float64); ok && n > 1 {
+		return int(n)
+	}
+	return 1
+}
+
 // parseChatGatewayPayload parses the incoming JSON body and extracts the payload + stream flag.
 func parseChatGatewayPayload(r *http.Request) (map[string]interface{}, bool, error) {
 	var payload map[string]interface{}
@@ -200,67 +295,204 @@ func extractGatewayStreamOptions(r *http.Request) (mode, onFail string) {
 	return mode, onFail
 }
 
-// applyInputGuardrails runs detection/guardrails on user messages and returns sanitized messages.
-func applyInputGuardrails(detector *guardrails.Detector, messages []interface{}, rid string, guardrailsList []string) ([]interface{}, bool, string, []models.DetectResponse) {
-	blocked := false
-	blockMessage := ""
-	var detectResponses []models.DetectResponse
+// applyNonTextPartPolicy enforces the non-text part policy on scanned messages whose
+// content is an array of parts. Stripping rewrites the message in place; a message
+// left without parts gets an empty string content. Anthropic tool_use and tool_result
+// blocks are scanned like text and are not subject to the policy.
+func applyNonTextPartPolicy(messages []interface{}, roles map[string]bool, policy string) error {
+	if policy != NonTextPartsStrip && policy != NonTextPartsReject {
+		return nil
+	}
 
 	for i, rm := range messages {
 		msgMap, ok := rm.(map[string]interface{})
 		if !ok {
 			continue
 		}
+		if role, _ := msgMap["role"].(string); !roles[role] {
+			continue
+		}
+		parts, ok := msgMap["content"].([]interface{})
+		if !ok {
+			continue
+		}
+
+		kept := make([]interface{}, 0, len(parts))
+		for _, part := range parts {
+			partType := contentPartType(part)
+			if partType == "text" || partType == "tool_use" || partType == "tool_result" {
+				kept = append(kept, part)
+				continue
+			}
+			if policy == NonTextPartsReject {
+				return fmt.Errorf("message %d contains a non-text content part (%s), which is not allowed under guardrails", i, partType)
+			}
+		}
+
+		if len(kept) == 0 {
+			msgMap["content"] = ""
+		} else {
+			msgMap["content"] = kept
+		}
+	}
+	return nil
+}
+
+// contentPartType returns the "type" of an OpenAI content part, or "unknown"
+func contentPartType(part interface{}) string {
+	partMap, ok := part.(map[string]interface{})
+	if !ok {
+		return "unknown"
+	}
+	if t, _ := partMap["type"].(string); t != "" {
+		return t
+	}
+	return "unknown"
+}
+
+// applyInputGuardrails runs detection/guardrails on messages whose role is in scope and on the
+// arguments of earlier assistant tool calls, and returns sanitized messages.
+// Content may be a plain string or an array of content parts; every text part is scanned and
+// rewritten on its own while other parts are left untouched. Tool-call arguments holding
+// JSON are masked leaf by leaf so they stay valid JSON. When the scope has a conversation
+// window, the recent history is then scanned as a whole (see scanConversationWindow).
+// When tokenize is set, placeholders are stored in the tokenization vault under the RID.
+func applyInputGuardrails(detect detectFunc, messages []interface{}, rid string, guardrailsList []string, scope scanScope, tokenize bool) ([]interface{}, bool, string, []models.DetectResponse) {
+	scanner := &inputScanner{detect: detect, rid: rid, guardrailsList: guardrailsList, tokenize: tokenize}
+
+	for i, rm := range messages {
+		if scanner.blocked {
+			break
+		}
 
+		msgMap, ok := rm.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		// Tool calls the assistant made are always scanned; text only for roles in scope
 		role, _ := msgMap["role"].(string)
-		content, _ := msgMap["content"].(string)
-		if content == "" {
+		if role == "assistant" {
+			calls, _ := msgMap["tool_calls"].([]interface{})
+			for _, call := range calls {
+				if fn, _, args := toolCallFunction(call); fn != nil && args != "" && !scanner.blocked {
+					fn["arguments"] = scanner.toolArguments(args)
+				}
+			}
+		}
+		if !scope.roles[role] || scanner.blocked {
 			continue
 		}
 
-		// For now we only scan user messages
-		if role != "user" {
+		switch content := msgMap["content"].(type) {
+		case string:
+			if content == "" {
+				continue
+			}
+			// Tool results are usually JSON; mask them leaf by leaf to keep them valid
+			if role == "tool" {
+				msgMap["content"] = scanner.toolArguments(content)
+			} else {
+				msgMap["content"] = scanner.text(content)
+			}
+		case []interface{}:
+			scanner.textParts(content)
+		default:
 			continue
 		}
+		messages[i] = msgMap
+	}
+
+	if !scanner.blocked && scope.window > 0 {
+		if resp := scanConversationWindow(detect, messages, scope, rid, tokenize); resp != nil {
+			scanner.record(*resp)
+		}
+	}
 
-		resp := detector.Detect(models.DetectRequest{
-			Text:       content,
-			RID:        rid,
-			Guardrails: guardrailsList,
-		})
+	return messages, scanner.blocked, scanner.blockMessage, scanner.responses
+}
 
-		detectResponses = append(detectResponses, resp)
+// inputScanner runs input guardrails on the texts of one request and collects the results.
+// Once a text is blocked, the caller is expected to stop scanning.
+type inputScanner struct {
+	detect         detectFunc
+	rid            string
+	guardrailsList []string
+	tokenize       bool
+
+	responses    []models.DetectResponse
+	blocked      bool
+	blockMessage string
+}
 
-		logGatewayDetectSummary("input", rid, resp)
+// record keeps a detection response and tracks blocking
+func (s *inputScanner) record(resp models.DetectResponse) {
+	s.responses = append(s.responses, resp)
 
-		if resp.Blocked {
-			blocked = true
-			if resp.Message != "" {
-				blockMessage = resp.Message
-			} else {
-				blockMessage = "Request blocked by TSZ security policy"
-			}
-			break
+	logGatewayDetectSummary("input", s.rid, resp)
+
+	if resp.Blocked {
+		s.blocked = true
+		if resp.Message != "" {
+			s.blockMessage = resp.Message
+		} else {
+			s.blockMessage = "Request blocked by TSZ security policy"
 		}
+	}
+}
 
-		if resp.RedactedText != "" {
-			msgMap["content"] = resp.RedactedText
-			messages[i] = msgMap
+// text runs detection on one text and returns the text to forward
+func (s *inputScanner) text(text string) string {
+	resp := s.detect(models.DetectRequest{
+		Text:       text,
+		RID:        s.rid,
+		Guardrails: s.guardrailsList,
+		Tokenize:   s.tokenize,
+	})
+	s.record(resp)
+
+	if resp.RedactedText != "" {
+		return resp.RedactedText
+	}
+	return text
+}
+
+// textParts scans every non-empty "text" part of a content array in place
+func (s *inputScanner) textParts(parts []interface{}) {
+	for _, part := range parts {
+		if s.blocked {
+			return
+		}
+		partMap, ok := part.(map[string]interface{})
+		if !ok || contentPartType(partMap) != "text" {
+			continue
+		}
+		if text, _ := partMap["text"].(string); text != "" {
+			partMap["text"] = s.text(text)
 		}
 	}
+}
 
-	return messages, blocked, blockMessage, detectResponses
+// toolArguments masks tool-call arguments, leaf by leaf when they hold JSON
+func (s *inputScanner) toolArguments(args string) string {
+	sanitized, resp := scanToolArguments(s.detect, args, models.DetectRequest{
+		RID:        s.rid,
+		Guardrails: s.guardrailsList,
+		Tokenize:   s.tokenize,
+	})
+	s.record(resp)
+	return sanitized
 }
 
-// sendDirectUpstreamRequest sends a direct HTTP request to the upstream OpenAI-compatible endpoint.
-// This is used when no provider is configured or for backward compatibility.
-func sendDirectUpstreamRequest(payload map[string]interface{}) (*http.Response, error) {
+// sendDirectUpstreamRequest sends a direct HTTP request to an upstream OpenAI-compatible endpoint
+// (e.g. ai.EndpointChatCompletions). This is used when no provider is configured or for backward compatibility.
+func sendDirectUpstreamRequest(endpoint string, payload map[string]interface{}) (*http.Response, error) {
 	forwardBody, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	upstreamURL := strings.TrimRight(config.AppConfig.AIModelURL, "/") + "/chat/completions"
+	upstreamURL := strings.TrimRight(config.AppConfig.AIModelURL, "/") + endpoint
 
 	req, err := http.NewRequest(http.MethodPost, upstreamURL, bytes.NewReader(forwardBody))
 	if err != nil {
@@ -276,8 +508,13 @@ func sendDirectUpstreamRequest(payload map[string]interface{}) (*http.Response,
 	return client.Do(req)
 }
 
-// processNonStreamResponse reads the upstream JSON response and applies output guardrails.
-func processNonStreamResponse(detector *guardrails.Detector, rid string, guardrailsList []string, upstreamResp *http.Response, w http.ResponseWriter, inputDetects []models.DetectResponse) {
+// processNonStreamResponse reads the upstream JSON response and applies output guardrails
+// to every choice. In BLOCK mode a blocked choice is withheld (content null, finish_reason
+// "content_filter") as long as another choice remains; otherwise the request fails.
+// Tool calls are checked against the tool policy and their arguments masked; calls that are
+// denied or fail a required validator are withheld (or fail the request in BLOCK mode).
+// When detokenize is set, vault placeholders echoed by the model are swapped back to originals.
+func processNonStreamResponse(detect detectFunc, rid string, guardrailsList []string, upstreamResp *http.Response, w http.ResponseWriter, inputDetects []models.DetectResponse, detokenize bool, tools ToolPolicy) {
 	upstreamBody, err := io.ReadAll(upstreamResp.Body)
 	if err != nil {
 		log.Printf("Failed to read upstream response body: %v", err)
@@ -287,6 +524,8 @@ func processNonStreamResponse(detector *guardrails.Detector, rid string, guardra
 
 	var upstreamPayload map[string]interface{}
 	var outputDetects []models.DetectResponse
+	var withheldToolCalls []blockedToolCall
+	var blockedChoices []int
 	if err := json.Unmarshal(upstreamBody, &upstreamPayload); err == nil {
 		choicesRaw, ok := upstreamPayload["choices"].([]interface{})
 		if ok {
@@ -301,13 +540,37 @@ func processNonStreamResponse(detector *guardrails.Detector, rid string, guardra
 					continue
 				}
 
+				// Tool calls: enforce the tool policy and mask arguments
+				toolDetects, withheld := applyToolCallGuardrails(detect, msg, rid, guardrailsList, tools)
+				outputDetects = append(outputDetects, toolDetects...)
+				if len(withheld) > 0 {
+					withheldToolCalls = append(withheldToolCalls, withheld...)
+
+					if config.AppConfig.GatewayBlockMode == "BLOCK" {
+						meta := map[string]interface{}{
+							"rid":                rid,
+							"guardrails":         computeTriggeredGuardrails(inputDetects, outputDetects),
+							"input":              inputDetects,
+							"output":             outputDetects,
+							"blocked_tool_calls": withheldToolCalls,
+						}
+
+						writeOpenAIErrorWithMeta(w, http.StatusBadRequest, withheld[0].Reason, "tsz_tool_call_blocked", meta)
+						return
+					}
+
+					if _, ok := msg["tool_calls"]; !ok && choiceMap["finish_reason"] == "tool_calls" {
+						choiceMap["finish_reason"] = "content_filter"
+					}
+				}
+
 				content, _ := msg["content"].(string)
 				if content == "" {
 					continue
 				}
 
 				// Output guardrails
-				outResp := detector.Detect(models.DetectRequest{
+				outResp := detect(models.DetectRequest{
 					Text:       content,
 					RID:        rid + "-OUT",
 					Guardrails: guardrailsList,
@@ -327,12 +590,24 @@ func processNonStreamResponse(detector *guardrails.Detector, rid string, guardra
 					log.Printf("[gateway] RID=%s blocked on output guardrails: %s (gateway_block_mode=%s, guardrails=%v)", rid, msgText, config.AppConfig.GatewayBlockMode, triggeredGuardrails)
 
 					if config.AppConfig.GatewayBlockMode == "BLOCK" {
+						// With several choices only the blocked one is withheld; the
+						// request fails once no choice is left.
+						blockedChoices = append(blockedChoices, choiceIndex(choiceMap, i))
+						if len(blockedChoices) < len(choicesRaw) {
+							msg["content"] = nil
+							choiceMap["finish_reason"] = "content_filter"
+							continue
+						}
+
 						meta := map[string]interface{}{
 							"rid":        rid,
 							"guardrails": triggeredGuardrails,
 							"input":      inputDetects,
 							"output":     outputDetects,
 						}
+						if len(choicesRaw) > 1 {
+							meta["blocked_choices"] = blockedChoices
+						}
 
 						writeOpenAIErrorWithMeta(w, http.StatusBadRequest, msgText, "tsz_output_blocked", meta)
 						return
@@ -342,9 +617,20 @@ func processNonStreamResponse(detector *guardrails.Detector, rid string, guardra
 
 				if outResp.RedactedText != "" {
 					msg["content"] = outResp.RedactedText
-					choiceMap["message"] = msg
-					choicesRaw[i] = choiceMap
 				}
+
+				if detokenize {
+					outText, _ := msg["content"].(string)
+					if rehydrated, replaced, err := guardrails.Detokenize(rid, outText); err != nil {
+						log.Printf("[gateway] RID=%s detokenization failed: %v", rid, err)
+					} else if replaced > 0 {
+						log.Printf("[gateway] RID=%s detokenized %d placeholder(s) in output", rid, replaced)
+						msg["content"] = rehydrated
+					}
+				}
+
+				choiceMap["message"] = msg
+				choicesRaw[i] = choiceMap
 			}
 
 			triggeredGuardrails := computeTriggeredGuardrails(inputDetects, outputDetects)
@@ -354,8 +640,14 @@ func processNonStreamResponse(detector *guardrails.Detector, rid string, guardra
 				"input":      inputDetects,
 				"output":     outputDetects,
 			}
+			if len(withheldToolCalls) > 0 {
+				meta["blocked_tool_calls"] = withheldToolCalls
+			}
+			if len(blockedChoices) > 0 {
+				meta["blocked_choices"] = blockedChoices
+			}
 
-			upstreamPayload["tsz_meta"] = meta
+			upstreamPayload["tsz_meta"] = withAIStatus(meta)
 
 			if sanitizedBody, err := json.Marshal(upstreamPayload); err == nil {
 				upstreamBody = sanitizedBody
@@ -458,6 +750,18 @@ func writeOpenAIError(w http.ResponseWriter, status int, message string, code st
 	writeOpenAIErrorWithMeta(w, status, message, code, nil)
 }
 
+// withAIStatus reports the AI judge's circuit breaker in tsz_meta while it is not closed,
+// so degraded AI checks are visible to callers
+func withAIStatus(meta map[string]interface{}) map[string]interface{} {
+	if meta == nil {
+		return nil
+	}
+	if breaker := ai.JudgeBreaker(); breaker.State != ai.BreakerClosed {
+		meta["ai_breaker"] = breaker
+	}
+	return meta
+}
+
 // writeOpenAIErrorWithMeta writes an error in OpenAI-compatible format and optionally attaches TSZ metadata.
 func writeOpenAIErrorWithMeta(w http.ResponseWriter, status int, message string, code string, meta map[string]interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -473,7 +777,7 @@ func writeOpenAIErrorWithMeta(w http.ResponseWriter, status int, message string,
 	}
 
 	if meta != nil {
-		body["tsz_meta"] = meta
+		body["tsz_meta"] = withAIStatus(meta)
 	}
 
 	_ = json.NewEncoder(w).Encode(body)
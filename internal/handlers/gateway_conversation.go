@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"thyris-sz/internal/models"
+)
+
+// scannableRoles are the message roles input guardrails can cover
+var scannableRoles = map[string]bool{
+	"system":    true,
+	"developer": true,
+	"user":      true,
+	"assistant": true,
+	"tool":      true,
+}
+
+// defaultScanRoles is used when neither config nor headers select roles
+var defaultScanRoles = []string{"user"}
+
+// windowSeparator joins messages in the conversation window. A space lets
+// patterns that allow whitespace (card numbers, IBANs) match across turns.
+const windowSeparator = " "
+
+// WithScanRoles sets the message roles whose content is scanned on input.
+// Unknown roles are ignored; an empty list keeps the default (user).
+func WithScanRoles(roles []string) GatewayOption {
+	return func(o *gatewayOptions) {
+		o.scanRoles = parseScanRoles(roles)
+	}
+}
+
+// WithConversationWindow enables the conversation-level scan over the last n scanned
+// messages. Zero disables it.
+func WithConversationWindow(n int) GatewayOption {
+	return func(o *gatewayOptions) {
+		if n > 0 {
+			o.conversationWindow = n
+		}
+	}
+}
+
+// scanScope is the per-request input coverage: which roles are scanned and how many
+// recent messages the conversation window covers
+type scanScope struct {
+	roles  map[string]bool
+	window int
+}
+
+// parseScanRoles normalizes a role list, dropping unknown roles
+func parseScanRoles(roles []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, r := range roles {
+		r = strings.ToLower(strings.TrimSpace(r))
+		if scannableRoles[r] {
+			set[r] = true
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	return set
+}
+
+// extractGatewayScanScope resolves the scan scope from the gateway options, widened by
+// headers. Headers can only add coverage: their roles are scanned in addition to the
+// configured ones, and a window smaller than the configured one is ignored.
+//
+// X-TSZ-Scan-Roles: comma-separated roles (system, developer, user, assistant, tool)
+// X-TSZ-Conversation-Window: number of recent messages scanned together
+func extractGatewayScanScope(r *http.Request, options gatewayOptions) scanScope {
+	configured := options.scanRoles
+	if configured == nil {
+		configured = parseScanRoles(defaultScanRoles)
+	}
+	scope := scanScope{roles: make(map[string]bool, len(scannableRoles)), window: options.conversationWindow}
+	for role := range configured {
+		scope.roles[role] = true
+	}
+
+	if hdr := r.Header.Get("X-TSZ-Scan-Roles"); hdr != "" {
+		for role := range parseScanRoles(strings.Split(hdr, ",")) {
+			scope.roles[role] = true
+		}
+	}
+	if hdr := strings.TrimSpace(r.Header.Get("X-TSZ-Conversation-Window")); hdr != "" {
+		if n, err := strconv.Atoi(hdr); err == nil && n > scope.window {
+			scope.window = n
+		}
+	}
+	return scope
+}
+
+// windowSegment is one text of the conversation window and where it came from
+type windowSegment struct {
+	message int // index into messages
+	part    int // index into the content parts, -1 for string content
+	start   int // offset of the segment in the window text
+	text    string
+}
+
+func (s windowSegment) end() int {
+	return s.start + len(s.text)
+}
+
+// path locates the segment in the request body
+func (s windowSegment) path() string {
+	if s.part < 0 {
+		return fmt.Sprintf("$.messages[%d].content", s.message)
+	}
+	return fmt.Sprintf("$.messages[%d].content[%d].text", s.message, s.part)
+}
+
+// conversationSegments returns the texts of the last window messages with a scanned
+// role, in conversation order
+func conversationSegments(messages []interface{}, roles map[string]bool, window int) []windowSegment {
+	first := len(messages)
+	for count := 0; first > 0 && count < window; {
+		first--
+		msgMap, ok := messages[first].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if role, _ := msgMap["role"].(string); roles[role] {
+			count++
+		}
+	}
+
+	var segments []windowSegment
+	for i := first; i < len(messages); i++ {
+		msgMap, ok := messages[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if role, _ := msgMap["role"].(string); !roles[role] {
+			continue
+		}
+
+		switch content := msgMap["content"].(type) {
+		case string:
+			if content != "" {
+				segments = append(segments, windowSegment{message: i, part: -1, text: content})
+			}
+		case []interface{}:
+			for j, part := range content {
+				partMap, ok := part.(map[string]interface{})
+				if !ok || contentPartType(partMap) != "text" {
+					continue
+				}
+				if text, _ := partMap["text"].(string); text != "" {
+					segments = append(segments, windowSegment{message: i, part: j, text: text})
+				}
+			}
+		}
+	}
+	return segments
+}
+
+// setSegmentText writes a segment's text back into its message
+func setSegmentText(messages []interface{}, seg windowSegment) {
+	msgMap := messages[seg.message].(map[string]interface{})
+	if seg.part < 0 {
+		msgMap["content"] = seg.text
+		return
+	}
+	parts := msgMap["content"].([]interface{})
+	parts[seg.part].(map[string]interface{})["text"] = seg.text
+}
+
+// segmentEdit replaces [start, end) of a segment's text
+type segmentEdit struct {
+	start, end  int
+	replacement string
+}
+
+// scanConversationWindow runs detection over the concatenated recent history so that
+// values split across messages are caught. Messages are expected to be sanitized
+// already, so only detections spanning more than one message (or content part) are
+// kept; their path and offsets point at the message where they start. Those values
+// are masked in every message they touch: the first part becomes the placeholder and
+// the rest is removed. Validators are not run on the window, since format guardrails
+// would judge the concatenation rather than a message.
+// It returns nil when nothing crosses a message boundary.
+func scanConversationWindow(detect detectFunc, messages []interface{}, scope scanScope, rid string, tokenize bool) *models.DetectResponse {
+	segments := conversationSegments(messages, scope.roles, scope.window)
+	if len(segments) < 2 {
+		return nil
+	}
+
+	var b strings.Builder
+	for i := range segments {
+		if i > 0 {
+			b.WriteString(windowSeparator)
+		}
+		segments[i].start = b.Len()
+		b.WriteString(segments[i].text)
+	}
+
+	resp := detect(models.DetectRequest{
+		Text:     b.String(),
+		RID:      rid,
+		Tokenize: tokenize,
+	})
+
+	edits := make(map[int][]segmentEdit)
+	var crossing []models.DetectionResult
+	for _, d := range resp.Detections {
+		var touched []int
+		for k, seg := range segments {
+			if d.Start < seg.end() && seg.start < d.End {
+				touched = append(touched, k)
+			}
+		}
+		if len(touched) < 2 {
+			continue
+		}
+
+		for n, k := range touched {
+			seg := segments[k]
+			edit := segmentEdit{start: max(d.Start, seg.start) - seg.start, end: min(d.End, seg.end()) - seg.start}
+			if n == 0 {
+				edit.replacement = d.Placeholder
+			}
+			edits[k] = append(edits[k], edit)
+		}
+
+		origin := segments[touched[0]]
+		d.Path = origin.path()
+		d.Start -= origin.start
+		d.End -= origin.start
+		crossing = append(crossing, d)
+	}
+
+	if len(crossing) == 0 && !resp.Blocked {
+		return nil
+	}
+
+	for k, list := range edits {
+		sort.Slice(list, func(i, j int) bool { return list[i].start > list[j].start })
+		seg := segments[k]
+		for _, e := range list {
+			seg.text = seg.text[:e.start] + e.replacement + seg.text[e.end:]
+		}
+		setSegmentText(messages, seg)
+	}
+
+	breakdown := make(map[string]int)
+	for _, d := range crossing {
+		breakdown[d.Type]++
+	}
+	resp.RedactedText = ""
+	resp.Detections = crossing
+	resp.Breakdown = breakdown
+	resp.ContainsPII = len(crossing) > 0
+	return &resp
+}
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/models"
+)
+
+// batchDetectFunc runs detection on several requests at once; it is Detector.DetectBatchContext outside of tests
+type batchDetectFunc func(context.Context, []models.DetectRequest) ([]models.BatchDetectResult, error)
+
+// inputGateway describes an OpenAI-compatible endpoint whose request carries a list of
+// texts in one field, such as embeddings "input" or legacy completions "prompt"
+type inputGateway struct {
+	name     string // for logs
+	endpoint string // upstream endpoint, e.g. ai.EndpointEmbeddings
+	field    string // request field holding the texts
+	// output reports whether choices[].text of responses is scanned
+	output bool
+}
+
+var (
+	embeddingsGateway  = inputGateway{name: "embeddings", endpoint: ai.EndpointEmbeddings, field: "input"}
+	completionsGateway = inputGateway{name: "completions", endpoint: ai.EndpointCompletions, field: "prompt", output: true}
+)
+
+// NewOpenAIEmbeddingsGateway returns an HTTP handler that exposes an OpenAI-compatible
+// /v1/embeddings endpoint. Every string of "input" is scanned before it is embedded, so
+// masked text (not raw PII) reaches the vector store; in BLOCK mode a blocked string
+// fails the whole request. Token-array inputs cannot be scanned: they are refused under
+// the default REJECT token input policy, removed under STRIP and forwarded as-is (and
+// flagged in tsz_meta) under ALLOW.
+func NewOpenAIEmbeddingsGateway(detector *guardrails.Detector, opts ...GatewayOption) http.HandlerFunc {
+	return newInputGateway(embeddingsGateway, detectorBatch(detector), detector.DetectContext, opts...)
+}
+
+// NewOpenAICompletionsGateway returns an HTTP handler that exposes an OpenAI-compatible
+// legacy /v1/completions endpoint. Every prompt is scanned like embeddings input, and
+// choices[].text gets output guardrails as on the chat gateway, including the
+// X-TSZ-Stream-Mode handling of streaming responses.
+func NewOpenAICompletionsGateway(detector *guardrails.Detector, opts ...GatewayOption) http.HandlerFunc {
+	return newInputGateway(completionsGateway, detectorBatch(detector), detector.DetectContext, opts...)
+}
+
+// detectorBatch runs Detector.DetectBatchContext with the DETECT_BATCH_WORKERS pool size
+func detectorBatch(detector *guardrails.Detector) batchDetectFunc {
+	return func(ctx context.Context, reqs []models.DetectRequest) ([]models.BatchDetectResult, error) {
+		workers := 1
+		if config.AppConfig != nil {
+			workers = config.AppConfig.DetectBatchWorkers
+		}
+		return detector.DetectBatchContext(ctx, reqs, workers)
+	}
+}
+
+// newInputGateway implements the embeddings and completions gateways with explicit detection functions
+func newInputGateway(gw inputGateway, detectBatch batchDetectFunc, detectContext contextDetectFunc, opts ...GatewayOption) http.HandlerFunc {
+	options := gatewayOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "Method not allowed", "method_not_allowed")
+			return
+		}
+
+		// Detection (and its AI scoring) stops when the client goes away
+		detect := detectContext.bind(r.Context())
+
+		payload, stream, err := parseChatGatewayPayload(r)
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, err.Error(), "invalid_request_error")
+			return
+		}
+
+		texts, tokens, ok := collectInputTexts(payload[gw.field])
+		if !ok {
+			writeOpenAIError(w, http.StatusBadRequest, "'"+gw.field+"' must be a string, an array of strings or an array of tokens", "invalid_request_error")
+			return
+		}
+
+		rid, guardrailsList := extractGatewayMetadata(r)
+		mode, onFail := extractGatewayStreamOptions(r)
+		log.Printf("[gateway-%s] RID=%s stream=%v mode=%s items=%d guardrails=%v gateway_block_mode=%s", gw.name, rid, stream, mode, len(texts), guardrailsList, config.AppConfig.GatewayBlockMode)
+
+		unscanned := false
+		if tokens {
+			switch options.tokenInputs {
+			case NonTextPartsAllow:
+				unscanned = true
+				log.Printf("[gateway-%s] RID=%s token-array %s forwarded without scanning", gw.name, rid, gw.field)
+			case NonTextPartsStrip:
+				if len(texts) == 0 {
+					writeOpenAIErrorWithMeta(w, http.StatusBadRequest, "'"+gw.field+"' holds only token arrays, which are stripped under guardrails", "tsz_non_text_content", map[string]interface{}{"rid": rid})
+					return
+				}
+				payload[gw.field] = stripInputTokens(payload[gw.field])
+				log.Printf("[gateway-%s] RID=%s token-array %s stripped", gw.name, rid, gw.field)
+			default: // REJECT, unset or unknown
+				writeOpenAIErrorWithMeta(w, http.StatusBadRequest, "'"+gw.field+"' contains token arrays, which cannot be scanned under guardrails", "tsz_non_text_content", map[string]interface{}{"rid": rid})
+				return
+			}
+		}
+
+		sanitized, blocked, blockMessage, inputDetects := scanInputTexts(r.Context(), detectBatch, texts, rid, guardrailsList, options.tokenVault)
+		if blocked {
+			triggeredGuardrails := computeTriggeredGuardrails(inputDetects, nil)
+			log.Printf("[gateway-%s] RID=%s blocked on input guardrails: %s (gateway_block_mode=%s, guardrails=%v)", gw.name, rid, blockMessage, config.AppConfig.GatewayBlockMode, triggeredGuardrails)
+
+			if config.AppConfig.GatewayBlockMode == "BLOCK" {
+				meta := map[string]interface{}{
+					"rid":        rid,
+					"guardrails": triggeredGuardrails,
+					"input":      inputDetects,
+				}
+
+				writeOpenAIErrorWithMeta(w, http.StatusBadRequest, blockMessage, "tsz_content_blocked", meta)
+				return
+			}
+		}
+		payload[gw.field] = replaceInputTexts(payload[gw.field], sanitized)
+
+		upstreamResp, err := forwardOpenAIEndpoint(r, gw.endpoint, payload)
+		if errors.Is(err, ai.ErrForwardingNotSupported) {
+			writeOpenAIError(w, http.StatusBadRequest, "This endpoint is not supported by the configured provider.", "endpoint_not_supported")
+			return
+		}
+		if err != nil {
+			log.Printf("[gateway-%s] RID=%s upstream request failed: %v", gw.name, rid, err)
+			writeOpenAIError(w, http.StatusBadGateway, "Failed to reach upstream LLM service", "upstream_unreachable")
+			return
+		}
+		defer upstreamResp.Body.Close()
+
+		log.Printf("[gateway-%s] RID=%s upstream_status=%d", gw.name, rid, upstreamResp.StatusCode)
+
+		if stream {
+			switch {
+			case gw.output && mode == "stream-sync":
+				newGuard := func() *streamGuard {
+					return newStreamGuardWithDetect(detect, rid, guardrailsList, onFail)
+				}
+				streamChoicesWithGuards(newGuard, detect, rid, guardrailsList, ToolPolicy{}, upstreamResp, w, onFail, requestedChoices(payload))
+			case gw.output && mode == "stream-async":
+				proxyStreamWithAsyncValidation(detectContext.bind(context.WithoutCancel(r.Context())), rid, guardrailsList, upstreamResp, w)
+			default: // "final-only" or unknown
+				proxyStreamResponse(w, upstreamResp)
+			}
+			return
+		}
+
+		var detokenize bool
+		if gw.output {
+			detokenize = options.tokenVault && isVaultAuthorized(r)
+		}
+		processInputGatewayResponse(gw, detect, rid, guardrailsList, upstreamResp, w, inputDetects, detokenize, unscanned)
+	}
+}
+
+// forwardOpenAIEndpoint forwards a request through the configured provider when it is an
+// OpenAIForwarder, otherwise directly to AI_MODEL_URL.
+func forwardOpenAIEndpoint(r *http.Request, endpoint string, payload map[string]interface{}) (*http.Response, error) {
+	if forwarder := ai.AsOpenAIForwarder(ai.GetProvider()); forwarder != nil {
+		return forwarder.ForwardEndpoint(r.Context(), endpoint, payload)
+	}
+	return sendDirectUpstreamRequest(endpoint, payload)
+}
+
+// collectInputTexts returns the strings of an "input" or "prompt" value in order. tokens is
+// set when the value holds token arrays, which are skipped; ok is false for other shapes.
+func collectInputTexts(value interface{}) (texts []string, tokens bool, ok bool) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, false, true
+	case []interface{}:
+		for _, item := range v {
+			switch item := item.(type) {
+			case string:
+				texts = append(texts, item)
+			case float64, []interface{}:
+				tokens = true
+			default:
+				return nil, false, false
+			}
+		}
+		return texts, tokens, true
+	default:
+		return nil, false, false
+	}
+}
+
+// stripInputTokens removes the token arrays (and bare tokens) from an "input" or "prompt"
+// array, keeping its strings in order
+func stripInputTokens(value interface{}) interface{} {
+	v, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+	kept := make([]interface{}, 0, len(v))
+	for _, item := range v {
+		if _, ok := item.(string); ok {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// replaceInputTexts writes texts back over the strings of value, in the order
+// collectInputTexts returned them
+func replaceInputTexts(value interface{}, texts []string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return texts[0]
+	case []interface{}:
+		next := 0
+		for i, item := range v {
+			if _, ok := item.(string); ok {
+				v[i] = texts[next]
+				next++
+			}
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+// scanInputTexts runs input guardrails on every non-empty text in a single batch and
+// returns the texts to forward. If the rules cannot be loaded, texts are forwarded
+// unchanged, as Detector.Detect does.
+func scanInputTexts(ctx context.Context, detectBatch batchDetectFunc, texts []string, rid string, guardrailsList []string, tokenize bool) ([]string, bool, string, []models.DetectResponse) {
+	var reqs []models.DetectRequest
+	var positions []int
+	for i, text := range texts {
+		if text == "" {
+			continue
+		}
+		reqs = append(reqs, models.DetectRequest{
+			Text:       text,
+			RID:        rid,
+			Guardrails: guardrailsList,
+			Tokenize:   tokenize,
+		})
+		positions = append(positions, i)
+	}
+
+	sanitized := append([]string(nil), texts...)
+	if len(reqs) == 0 {
+		return sanitized, false, "", nil
+	}
+
+	results, err := detectBatch(ctx, reqs)
+	if err != nil {
+		log.Printf("Error fetching patterns: %v", err)
+		return sanitized, false, "", nil
+	}
+
+	scanner := &inputScanner{rid: rid}
+	for k, res := range results {
+		if res.Response == nil {
+			continue
+		}
+		scanner.record(*res.Response)
+		if res.Response.RedactedText != "" {
+			sanitized[positions[k]] = res.Response.RedactedText
+		}
+	}
+	return sanitized, scanner.blocked, scanner.blockMessage, scanner.responses
+}
+
+// processInputGatewayResponse reads the upstream JSON response, applies output guardrails to
+// choices[].text when the endpoint has output, and attaches tsz_meta. As on the chat gateway,
+// in BLOCK mode a blocked choice is withheld (empty text, finish_reason "content_filter") as
+// long as another choice remains; otherwise the request fails. unscanned reports token-array
+// input forwarded without scanning.
+func processInputGatewayResponse(gw inputGateway, detect detectFunc, rid string, guardrailsList []string, upstreamResp *http.Response, w http.ResponseWriter, inputDetects []models.DetectResponse, detokenize, unscanned bool) {
+	upstreamBody, err := io.ReadAll(upstreamResp.Body)
+	if err != nil {
+		log.Printf("Failed to read upstream response body: %v", err)
+		writeOpenAIError(w, http.StatusBadGateway, "Failed to read upstream LLM response", "upstream_read_error")
+		return
+	}
+
+	var upstreamPayload map[string]interface{}
+	if upstreamResp.StatusCode == http.StatusOK && json.Unmarshal(upstreamBody, &upstreamPayload) == nil {
+		var outputDetects []models.DetectResponse
+		var blockedChoices []int
+
+		var choicesRaw []interface{}
+		if gw.output {
+			choicesRaw, _ = upstreamPayload["choices"].([]interface{})
+		}
+		for i, ch := range choicesRaw {
+			choiceMap, ok := ch.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			text, _ := choiceMap["text"].(string)
+			if text == "" {
+				continue
+			}
+
+			// Output guardrails
+			outResp := detect(models.DetectRequest{
+				Text:       text,
+				RID:        rid + "-OUT",
+				Guardrails: guardrailsList,
+			})
+			outputDetects = append(outputDetects, outResp)
+			logGatewayDetectSummary("output-nonstream", rid, outResp)
+
+			if outResp.Blocked {
+				msgText := outResp.Message
+				if msgText == "" {
+					msgText = "Completion blocked by TSZ security policy"
+				}
+
+				triggeredGuardrails := computeTriggeredGuardrails(inputDetects, outputDetects)
+				log.Printf("[gateway-%s] RID=%s blocked on output guardrails: %s (gateway_block_mode=%s, guardrails=%v)", gw.name, rid, msgText, config.AppConfig.GatewayBlockMode, triggeredGuardrails)
+
+				if config.AppConfig.GatewayBlockMode == "BLOCK" {
+					blockedChoices = append(blockedChoices, choiceIndex(choiceMap, i))
+					if len(blockedChoices) < len(choicesRaw) {
+						choiceMap["text"] = ""
+						choiceMap["finish_reason"] = "content_filter"
+						continue
+					}
+
+					meta := map[string]interface{}{
+						"rid":        rid,
+						"guardrails": triggeredGuardrails,
+						"input":      inputDetects,
+						"output":     outputDetects,
+					}
+					if len(choicesRaw) > 1 {
+						meta["blocked_choices"] = blockedChoices
+					}
+
+					writeOpenAIErrorWithMeta(w, http.StatusBadRequest, msgText, "tsz_output_blocked", meta)
+					return
+				}
+			}
+
+			if outResp.RedactedText != "" {
+				choiceMap["text"] = outResp.RedactedText
+			}
+
+			if detokenize {
+				outText, _ := choiceMap["text"].(string)
+				if rehydrated, replaced, err := guardrails.Detokenize(rid, outText); err != nil {
+					log.Printf("[gateway-%s] RID=%s detokenization failed: %v", gw.name, rid, err)
+				} else if replaced > 0 {
+					log.Printf("[gateway-%s] RID=%s detokenized %d placeholder(s) in output", gw.name, rid, replaced)
+					choiceMap["text"] = rehydrated
+				}
+			}
+		}
+
+		meta := map[string]interface{}{
+			"rid":        rid,
+			"guardrails": computeTriggeredGuardrails(inputDetects, outputDetects),
+			"input":      inputDetects,
+		}
+		if gw.output {
+			meta["output"] = outputDetects
+		}
+		if len(blockedChoices) > 0 {
+			meta["blocked_choices"] = blockedChoices
+		}
+		if unscanned {
+			meta["unscanned_input"] = true
+		}
+		upstreamPayload["tsz_meta"] = withAIStatus(meta)
+
+		if sanitizedBody, err := json.Marshal(upstreamPayload); err == nil {
+			upstreamBody = sanitizedBody
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(upstreamResp.StatusCode)
+	if _, err := w.Write(upstreamBody); err != nil {
+		log.Printf("Failed to write gateway response body: %v", err)
+	}
+}
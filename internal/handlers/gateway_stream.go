@@ -7,10 +7,10 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"sort"
 	"strings"
 
 	"thyris-sz/internal/config"
-	"thyris-sz/internal/guardrails"
 	"thyris-sz/internal/models"
 )
 
@@ -50,14 +50,46 @@ func proxyStreamResponse(w http.ResponseWriter, resp *http.Response) {
 }
 
 // streamWithOutputGuardrails proxies a streaming response while applying output guardrails
-// on the accumulated assistant content and streaming only the sanitized output.
+// incrementally (see streamGuard) and streaming only the sanitized output.
+//
+// Every choice index has its own guard, so with n>1 each choice is validated and released
+// independently. Text held back by a guard is released with the chunk carrying the choice's
+// finish_reason, or at the end of the stream. With onFail "halt", a blocked choice is finished
+// with finish_reason "content_filter" while the other choices continue; once all requested
+// choices are halted the stream ends with an error event.
+//
+// tool_calls deltas are buffered per choice until its finish_reason, checked against the
+// tool policy and sent as one delta with masked arguments. Withheld calls are dropped and
+// reported in the choice's "tsz_blocked_tool_calls"; when none is left, a finish_reason of
+// "tool_calls" becomes "content_filter".
 func streamWithOutputGuardrails(
-	detector *guardrails.Detector,
+	detect detectFunc,
 	rid string,
 	guardrailsList []string,
+	tools ToolPolicy,
 	upstreamResp *http.Response,
 	w http.ResponseWriter,
 	onFail string,
+	choices int,
+) {
+	newGuard := func() *streamGuard {
+		return newStreamGuardWithDetect(detect, rid, guardrailsList, onFail)
+	}
+	streamChoicesWithGuards(newGuard, detect, rid, guardrailsList, tools, upstreamResp, w, onFail, choices)
+}
+
+// streamChoicesWithGuards implements streamWithOutputGuardrails with one guard per choice
+// created by newGuard.
+func streamChoicesWithGuards(
+	newGuard func() *streamGuard,
+	detect detectFunc,
+	rid string,
+	guardrailsList []string,
+	tools ToolPolicy,
+	upstreamResp *http.Response,
+	w http.ResponseWriter,
+	onFail string,
+	choices int,
 ) {
 	if ct := upstreamResp.Header.Get("Content-Type"); ct != "" {
 		w.Header().Set("Content-Type", ct)
@@ -76,15 +108,113 @@ func streamWithOutputGuardrails(
 		return
 	}
 
-	maxBuf := config.AppConfig.StreamMaxBufferBytes
 	failMode := strings.ToUpper(config.AppConfig.StreamFailMode)
+	if choices < 1 {
+		choices = 1
+	}
+
+	states := make(map[int]*choiceStream)
+	halted := 0
+	var template map[string]interface{} // last upstream event, for events TSZ emits itself
+
+	stateFor := func(idx int) *choiceStream {
+		st, ok := states[idx]
+		if !ok {
+			st = &choiceStream{guard: newGuard()}
+			states[idx] = st
+		}
+		return st
+	}
+
+	// writeEvent writes an event and flushes it; it returns false when the client is gone
+	writeEvent := func(event map[string]interface{}) bool {
+		if err := writeSSEEvent(w, event); err != nil {
+			log.Printf("[gateway-stream] Failed to write SSE event RID=%s: %v", rid, err)
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	// haltChoice finishes a blocked choice; it returns false when the stream must stop
+	haltChoice := func(idx int, errMsg string) bool {
+		log.Printf("[gateway-stream] RID=%s choice=%d output blocked by guardrails: %s", rid, idx, errMsg)
+		states[idx].done = true
+		halted++
+		if halted >= choices {
+			writeStreamErrorEvent(w, flusher, errMsg)
+			return false
+		}
+		event := choiceEvent(template, idx, map[string]interface{}{}, "content_filter")
+		event["choices"].([]interface{})[0].(map[string]interface{})["tsz_error"] = map[string]interface{}{
+			"message": errMsg,
+			"code":    "tsz_output_blocked",
+		}
+		return writeEvent(event)
+	}
+
+	// finishToolCalls checks the buffered tool calls of a finishing choice and puts the
+	// ones not withheld into its delta
+	finishToolCalls := func(choice map[string]interface{}, st *choiceStream) {
+		if len(st.toolCalls) == 0 {
+			return
+		}
+		kept, withheld := st.checkToolCalls(detect, rid, guardrailsList, tools)
+		delta, _ := choice["delta"].(map[string]interface{})
+		if delta == nil {
+			delta = make(map[string]interface{})
+			choice["delta"] = delta
+		}
+		if len(kept) > 0 {
+			delta["tool_calls"] = kept
+		}
+		if len(withheld) > 0 {
+			log.Printf("[gateway-stream] RID=%s withheld %d streamed tool call(s)", rid, len(withheld))
+			choice["tsz_blocked_tool_calls"] = withheld
+			if len(kept) == 0 && choice["finish_reason"] == "tool_calls" {
+				choice["finish_reason"] = "content_filter"
+			}
+		}
+	}
+
+	// release flushes held-back text of every unfinished choice; it returns false when
+	// the stream must stop
+	release := func() bool {
+		indices := make([]int, 0, len(states))
+		for idx := range states {
+			indices = append(indices, idx)
+		}
+		sort.Ints(indices)
 
-	var rawBuffer strings.Builder      // raw assistant content from upstream
-	var validatedSoFar strings.Builder // sanitized content already sent to the client
+		for _, idx := range indices {
+			st := states[idx]
+			if st.done {
+				continue
+			}
+			st.done = true
+			out, blocked, errMsg := st.guard.flush()
+			if blocked {
+				if !haltChoice(idx, errMsg) {
+					return false
+				}
+				continue
+			}
+			delta := map[string]interface{}{}
+			if out != "" {
+				delta["content"] = out
+			}
+			event := choiceEvent(template, idx, delta, nil)
+			finishToolCalls(event["choices"].([]interface{})[0].(map[string]interface{}), st)
+			if len(delta) > 0 && !writeEvent(event) {
+				return false
+			}
+		}
+		return true
+	}
 
 	reader := bufio.NewReader(upstreamResp.Body)
 
-	log.Printf("[gateway-stream] RID=%s mode=stream-sync guardrails=%v onFail=%s maxBuf=%d failMode=%s", rid, guardrailsList, onFail, maxBuf, failMode)
+	log.Printf("[gateway-stream] RID=%s mode=stream-sync guardrails=%v onFail=%s choices=%d failMode=%s", rid, guardrailsList, onFail, choices, failMode)
 
 	for {
 		select {
@@ -104,6 +234,9 @@ func streamWithOutputGuardrails(
 				// Forward [DONE] as-is.
 				if jsonPart == "[DONE]" {
 					log.Printf("[gateway-stream] RID=%s received [DONE]", rid)
+					if !release() {
+						return
+					}
 					if _, writeErr := w.Write([]byte(line)); writeErr != nil {
 						log.Printf("[gateway-stream] Failed to write [DONE] event: %v", writeErr)
 					}
@@ -135,74 +268,93 @@ func streamWithOutputGuardrails(
 					flusher.Flush()
 					continue
 				}
+				template = event
 
-				contentDelta := extractDeltaContent(event)
-				if contentDelta == "" {
-					// No content in this event; forward as-is.
-					if _, writeErr := w.Write([]byte(line)); writeErr != nil {
-						log.Printf("[gateway-stream] Failed to write SSE line without content: %v", writeErr)
+				choicesRaw, _ := event["choices"].([]interface{})
+				modified := false
+				kept := make([]interface{}, 0, len(choicesRaw))
+
+				for pos, raw := range choicesRaw {
+					choice, ok := raw.(map[string]interface{})
+					if !ok {
+						kept = append(kept, raw)
+						continue
 					}
-					flusher.Flush()
-					continue
-				}
 
-				// Append new content to the raw buffer.
-				rawBuffer.WriteString(contentDelta)
-
-				// Enforce max buffer size if configured.
-				if maxBuf > 0 && rawBuffer.Len() > maxBuf {
-					// Keep only the last maxBuf bytes to bound memory usage.
-					raw := rawBuffer.String()
-					if len(raw) > maxBuf {
-						trimmedRaw := raw[len(raw)-maxBuf:]
-						rawBuffer.Reset()
-						rawBuffer.WriteString(trimmedRaw)
-						log.Printf("[gateway-stream] RID=%s raw buffer truncated to %d bytes", rid, maxBuf)
+					idx := choiceIndex(choice, pos)
+					st := stateFor(idx)
+					if st.done {
+						// Halted (or already finished) choices get no further chunks
+						modified = true
+						continue
 					}
-				}
 
-				blocked, sanitized, errMsg := runOutputGuardrails(detector, rid, guardrailsList, rawBuffer.String(), onFail)
-				if blocked {
-					log.Printf("[gateway-stream] RID=%s output blocked by guardrails: %s", rid, errMsg)
-					writeStreamErrorEvent(w, flusher, errMsg)
-					return
-				}
+					bufferedTools := st.bufferToolCalls(choice)
+					content := choiceDeltaContent(choice)
+					finish := choiceFinishReason(choice)
+					if content == "" && finish == "" {
+						if bufferedTools {
+							// tool_calls are sent once the choice finishes
+							modified = true
+							if delta, _ := choice["delta"].(map[string]interface{}); len(delta) == 0 {
+								continue
+							}
+						}
+						kept = append(kept, choice)
+						continue
+					}
 
-				// Compute the new portion that has not yet been sent to the client.
-				if len(sanitized) < validatedSoFar.Len() {
-					// This should never happen; log and continue without sending new data.
-					log.Printf("[gateway-stream] RID=%s sanitized output length (%d) is smaller than already streamed length (%d)", rid, len(sanitized), validatedSoFar.Len())
-					continue
+					modified = true
+					out := ""
+					if content != "" {
+						released, blocked, errMsg := st.guard.push(content)
+						if blocked {
+							if !haltChoice(idx, errMsg) {
+								return
+							}
+							continue
+						}
+						out = released
+					}
+					if finish != "" {
+						st.done = true
+						rest, blocked, errMsg := st.guard.flush()
+						if blocked {
+							if !haltChoice(idx, errMsg) {
+								return
+							}
+							continue
+						}
+						out += rest
+					}
+
+					hasDelta := setChoiceDeltaContent(choice, out)
+					if finish != "" {
+						finishToolCalls(choice, st)
+					}
+					if !hasDelta && finish == "" {
+						// Everything received for this choice is held back by its guard.
+						continue
+					}
+					kept = append(kept, choice)
 				}
 
-				newDelta := sanitized[validatedSoFar.Len():]
-				if len(newDelta) == 0 {
-					// Nothing new to send (e.g. only earlier content was sanitized).
+				if !modified {
+					// No content in this event; forward as-is.
+					if _, writeErr := w.Write([]byte(line)); writeErr != nil {
+						log.Printf("[gateway-stream] Failed to write SSE line without content: %v", writeErr)
+					}
+					flusher.Flush()
 					continue
 				}
-
-				setDeltaContent(event, newDelta)
-				payload, err := json.Marshal(event)
-				if err != nil {
-					log.Printf("[gateway-stream] Failed to marshal sanitized SSE event RID=%s: %v", rid, err)
+				if len(kept) == 0 {
 					continue
 				}
 
-				if _, writeErr := w.Write([]byte("data: ")); writeErr != nil {
-					log.Printf("[gateway-stream] Failed to write SSE data prefix RID=%s: %v", rid, writeErr)
-					return
-				}
-				if _, writeErr := w.Write(payload); writeErr != nil {
-					log.Printf("[gateway-stream] Failed to write SSE payload RID=%s: %v", rid, writeErr)
+				event["choices"] = kept
+				if !writeEvent(event) {
 					return
 				}
-				if _, writeErr := w.Write([]byte("\n\n")); writeErr != nil {
-					log.Printf("[gateway-stream] Failed to write SSE newline RID=%s: %v", rid, writeErr)
-					return
-				}
-
-				flusher.Flush()
-				validatedSoFar.WriteString(newDelta)
 				continue
 			}
 
@@ -218,17 +370,102 @@ func streamWithOutputGuardrails(
 			if err != io.EOF {
 				log.Printf("[gateway-stream] Error reading streaming response body with guardrails RID=%s: %v", rid, err)
 			}
+			release()
 			break
 		}
 	}
 
-	log.Printf("[gateway-stream] RID=%s stream-sync completed", rid)
+	scans, detections := 0, 0
+	for _, st := range states {
+		scans += st.guard.scans
+		detections += len(st.guard.detections)
+	}
+	log.Printf("[gateway-stream] RID=%s stream-sync completed (choices=%d, halted=%d, scans=%d, detections=%d)", rid, len(states), halted, scans, detections)
+}
+
+// choiceStream is the output guardrail state of one streamed choice
+type choiceStream struct {
+	guard *streamGuard
+	done  bool // finished or halted; no further chunks are sent
+
+	// tool_calls deltas are buffered by their index until the choice finishes
+	toolCalls     map[int]*streamedToolCall
+	toolCallOrder []int
+}
+
+// streamedToolCall is a tool call assembled from tool_calls deltas
+type streamedToolCall struct {
+	id   string
+	name string
+	args strings.Builder
+}
+
+// bufferToolCalls takes the tool_calls out of a streamed choice's delta and appends them
+// to the buffered calls. It reports whether the delta carried any.
+func (st *choiceStream) bufferToolCalls(choice map[string]interface{}) bool {
+	delta, _ := choice["delta"].(map[string]interface{})
+	calls, ok := delta["tool_calls"].([]interface{})
+	if !ok {
+		return false
+	}
+	delete(delta, "tool_calls")
+
+	if st.toolCalls == nil {
+		st.toolCalls = make(map[int]*streamedToolCall)
+	}
+	for pos, raw := range calls {
+		call, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		idx := choiceIndex(call, pos)
+		tc, ok := st.toolCalls[idx]
+		if !ok {
+			tc = &streamedToolCall{}
+			st.toolCalls[idx] = tc
+			st.toolCallOrder = append(st.toolCallOrder, idx)
+		}
+		if id, _ := call["id"].(string); id != "" {
+			tc.id = id
+		}
+		if fn, ok := call["function"].(map[string]interface{}); ok {
+			if name, _ := fn["name"].(string); name != "" {
+				tc.name = name
+			}
+			args, _ := fn["arguments"].(string)
+			tc.args.WriteString(args)
+		}
+	}
+	return true
+}
+
+// checkToolCalls applies the tool policy to the buffered tool calls and returns the ones
+// to send, renumbered and with masked arguments, along with the withheld ones.
+func (st *choiceStream) checkToolCalls(detect detectFunc, rid string, guardrailsList []string, tools ToolPolicy) ([]interface{}, []blockedToolCall) {
+	var kept []interface{}
+	var withheld []blockedToolCall
+	for _, idx := range st.toolCallOrder {
+		tc := st.toolCalls[idx]
+		sanitized, _, blocked := checkToolCall(detect, rid, guardrailsList, tools, tc.id, tc.name, tc.args.String())
+		if blocked != nil {
+			withheld = append(withheld, *blocked)
+			continue
+		}
+		kept = append(kept, map[string]interface{}{
+			"index":    len(kept),
+			"id":       tc.id,
+			"type":     "function",
+			"function": map[string]interface{}{"name": tc.name, "arguments": sanitized},
+		})
+	}
+	st.toolCalls, st.toolCallOrder = nil, nil
+	return kept, withheld
 }
 
 // proxyStreamWithAsyncValidation proxies the upstream streaming response as-is to the client,
 // while also capturing the full stream and running guardrails asynchronously for logging/SIEM.
 func proxyStreamWithAsyncValidation(
-	detector *guardrails.Detector,
+	detect detectFunc,
 	rid string,
 	guardrailsList []string,
 	upstreamResp *http.Response,
@@ -285,7 +522,7 @@ func proxyStreamWithAsyncValidation(
 
 		text := string(all)
 		log.Printf("[gateway-stream] RID=%s starting async output validation (bytes=%d, guardrails=%v)", rid, len(all), guards)
-		_ = detector.Detect(models.DetectRequest{
+		_ = detect(models.DetectRequest{
 			Text:       text,
 			RID:        rid + "-OUT-ASYNC",
 			Guardrails: guards,
@@ -293,83 +530,96 @@ func proxyStreamWithAsyncValidation(
 	}(buf.Bytes(), rid, guardrailsList)
 }
 
-// runOutputGuardrails applies guardrails to the full assistant text and returns a sanitized version.
-// Depending on onFail, it may instruct the caller to halt streaming.
-func runOutputGuardrails(
-	detector *guardrails.Detector,
-	rid string,
-	guardrailsList []string,
-	text string,
-	onFail string,
-) (blocked bool, sanitized string, msg string) {
-	// If no guardrails are configured, return the original text.
-	if len(guardrailsList) == 0 {
-		return false, text, ""
-	}
-
-	resp := detector.Detect(models.DetectRequest{
-		Text:       text,
-		RID:        rid + "-OUT-STREAM",
-		Guardrails: guardrailsList,
-	})
-
-	if resp.Blocked && onFail == "halt" {
-		msg = resp.Message
-		if msg == "" {
-			msg = "Assistant response blocked by TSZ security policy"
-		}
-		return true, "", msg
+// choiceIndex returns the "index" of a streamed choice, defaulting to its position.
+func choiceIndex(choice map[string]interface{}, pos int) int {
+	if idx, ok := choice["index"].(float64); ok {
+		return int(idx)
 	}
+	return pos
+}
 
-	if resp.RedactedText != "" {
-		return false, resp.RedactedText, ""
+// choiceDeltaContent returns the delta.content of a streamed chat choice, or the text of
+// a streamed legacy completion choice.
+func choiceDeltaContent(choice map[string]interface{}) string {
+	if text, ok := choice["text"].(string); ok {
+		return text
 	}
+	delta, _ := choice["delta"].(map[string]interface{})
+	content, _ := delta["content"].(string)
+	return content
+}
 
-	return false, text, ""
+// choiceFinishReason returns the finish_reason of a streamed choice, if set.
+func choiceFinishReason(choice map[string]interface{}) string {
+	reason, _ := choice["finish_reason"].(string)
+	return reason
 }
 
-// extractDeltaContent extracts the first choice.delta.content value from an SSE event payload.
-func extractDeltaContent(event map[string]interface{}) string {
-	choicesRaw, ok := event["choices"].([]interface{})
-	if !ok || len(choicesRaw) == 0 {
-		return ""
+// setChoiceDeltaContent sets delta.content of a streamed choice, removing it when content
+// is empty. It reports whether the delta still carries anything to send. Legacy
+// completion choices carry their text in "text" instead.
+func setChoiceDeltaContent(choice map[string]interface{}, content string) bool {
+	if _, ok := choice["text"].(string); ok {
+		choice["text"] = content
+		return content != ""
 	}
-
-	choiceMap, ok := choicesRaw[0].(map[string]interface{})
+	delta, ok := choice["delta"].(map[string]interface{})
 	if !ok {
-		return ""
+		delta = make(map[string]interface{})
 	}
-
-	delta, ok := choiceMap["delta"].(map[string]interface{})
-	if !ok {
-		return ""
+	if content == "" {
+		delete(delta, "content")
+	} else {
+		delta["content"] = content
 	}
-
-	content, _ := delta["content"].(string)
-	return content
+	choice["delta"] = delta
+	return len(delta) > 0
 }
 
-// setDeltaContent sets the first choice.delta.content value in an SSE event payload.
-func setDeltaContent(event map[string]interface{}, content string) {
-	choicesRaw, ok := event["choices"].([]interface{})
-	if !ok || len(choicesRaw) == 0 {
-		return
+// choiceEvent builds a chunk for a single choice, copying id/model/... from template.
+// For a legacy completion stream ("text_completion"), delta.content becomes the choice text.
+func choiceEvent(template map[string]interface{}, idx int, delta map[string]interface{}, finishReason interface{}) map[string]interface{} {
+	event := make(map[string]interface{}, len(template)+1)
+	for k, v := range template {
+		if k != "choices" && k != "usage" {
+			event[k] = v
+		}
 	}
-
-	choiceMap, ok := choicesRaw[0].(map[string]interface{})
-	if !ok {
-		return
+	if _, ok := event["object"]; !ok {
+		event["object"] = "chat.completion.chunk"
 	}
-
-	delta, ok := choiceMap["delta"].(map[string]interface{})
-	if !ok {
-		delta = make(map[string]interface{})
+	if event["object"] == "text_completion" {
+		text, _ := delta["content"].(string)
+		event["choices"] = []interface{}{map[string]interface{}{
+			"index":         idx,
+			"text":          text,
+			"logprobs":      nil,
+			"finish_reason": finishReason,
+		}}
+		return event
 	}
+	event["choices"] = []interface{}{map[string]interface{}{
+		"index":         idx,
+		"delta":         delta,
+		"finish_reason": finishReason,
+	}}
+	return event
+}
 
-	delta["content"] = content
-	choiceMap["delta"] = delta
-	choicesRaw[0] = choiceMap
-	event["choices"] = choicesRaw
+// writeSSEEvent writes event as a single "data:" SSE event.
+func writeSSEEvent(w http.ResponseWriter, event map[string]interface{}) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("data: ")); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	_, err = w.Write([]byte("\n\n"))
+	return err
 }
 
 // writeStreamErrorEvent sends an OpenAI-style error payload over an existing SSE stream
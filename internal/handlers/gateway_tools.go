@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"thyris-sz/internal/models"
+)
+
+// ToolPolicy restricts which tools a model may call through the gateway.
+//
+// Allow, when non-empty, lists the only tool names that may be declared or called;
+// Deny lists tool names that are never permitted. RequiredGuardrails are validators
+// that must pass on the arguments of every tool call before it is returned to the client.
+type ToolPolicy struct {
+	Allow              []string
+	Deny               []string
+	RequiredGuardrails []string
+}
+
+// WithToolPolicy sets the tool allow/deny lists and the validators required on tool calls.
+func WithToolPolicy(policy ToolPolicy) GatewayOption {
+	return func(o *gatewayOptions) {
+		o.tools = policy
+	}
+}
+
+// permits reports whether the policy allows calling the named tool
+func (p ToolPolicy) permits(name string) bool {
+	for _, d := range p.Deny {
+		if strings.EqualFold(d, name) {
+			return false
+		}
+	}
+	if len(p.Allow) == 0 {
+		return true
+	}
+	for _, a := range p.Allow {
+		if strings.EqualFold(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// active reports whether the policy restricts tools or requires validators on tool calls
+func (p ToolPolicy) active() bool {
+	return len(p.Allow) > 0 || len(p.Deny) > 0 || len(p.RequiredGuardrails) > 0
+}
+
+// errToolPolicyStreamMode is returned for stream-async requests offering tools under an
+// active tool policy: tool calls are proxied as they arrive there, so they cannot be checked.
+const errToolPolicyStreamMode = "Tool calls cannot be checked against the TSZ tool policy in stream-async mode; use final-only or stream-sync"
+
+// declaresTools reports whether the request offers the model any tools
+func declaresTools(payload map[string]interface{}) bool {
+	tools, ok := payload["tools"].([]interface{})
+	return ok && len(tools) > 0
+}
+
+// filterDeclaredTools removes tools the policy does not permit from the request's
+// "tools" array, so the model is never offered them. When no tool is left, "tools"
+// and "tool_choice" are dropped to keep the request valid upstream; a "tool_choice"
+// forcing a removed tool is dropped as well.
+func filterDeclaredTools(payload map[string]interface{}, policy ToolPolicy) []string {
+	tools, ok := payload["tools"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var removed []string
+	kept := make([]interface{}, 0, len(tools))
+	for _, t := range tools {
+		name := declaredToolName(t)
+		if name != "" && !policy.permits(name) {
+			removed = append(removed, name)
+			continue
+		}
+		kept = append(kept, t)
+	}
+
+	if len(kept) == 0 {
+		delete(payload, "tools")
+		delete(payload, "tool_choice")
+	} else {
+		payload["tools"] = kept
+		if name := toolChoiceName(payload["tool_choice"]); name != "" && !policy.permits(name) {
+			delete(payload, "tool_choice")
+		}
+	}
+	return removed
+}
+
+// toolChoiceName returns the tool a "tool_choice" forces: function.name in the OpenAI
+// format, or the top-level name in the Anthropic format. Modes such as "auto" name none.
+func toolChoiceName(choice interface{}) string {
+	if _, ok := choice.(map[string]interface{}); !ok {
+		return ""
+	}
+	return declaredToolName(choice)
+}
+
+// declaredToolName returns the name of a "tools" entry: function.name in the OpenAI
+// format, or the top-level name in the Anthropic format
+func declaredToolName(tool interface{}) string {
+	toolMap, ok := tool.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if fn, ok := toolMap["function"].(map[string]interface{}); ok {
+		name, _ := fn["name"].(string)
+		return name
+	}
+	name, _ := toolMap["name"].(string)
+	return name
+}
+
+// toolCallFunction returns the function object of a tool call along with its name and arguments
+func toolCallFunction(call interface{}) (map[string]interface{}, string, string) {
+	callMap, ok := call.(map[string]interface{})
+	if !ok {
+		return nil, "", ""
+	}
+	fn, ok := callMap["function"].(map[string]interface{})
+	if !ok {
+		return nil, "", ""
+	}
+	name, _ := fn["name"].(string)
+	args, _ := fn["arguments"].(string)
+	return fn, name, args
+}
+
+// scanToolArguments runs detection on tool-call arguments. Arguments that are a JSON
+// document are scanned leaf by leaf so that masking keeps them valid JSON; anything
+// else is scanned as plain text. It returns the arguments to forward.
+func scanToolArguments(detect detectFunc, args string, req models.DetectRequest) (string, models.DetectResponse) {
+	if json.Valid([]byte(args)) {
+		req.JSON = json.RawMessage(args)
+		resp := detect(req)
+		if len(resp.RedactedJSON) > 0 {
+			return string(resp.RedactedJSON), resp
+		}
+		return args, resp
+	}
+
+	req.Text = args
+	resp := detect(req)
+	if resp.RedactedText != "" {
+		return resp.RedactedText, resp
+	}
+	return args, resp
+}
+
+// failedRequiredGuardrails lists the required validators that did not pass
+func failedRequiredGuardrails(resp models.DetectResponse, required []string) []string {
+	passed := make(map[string]bool, len(resp.ValidatorResults))
+	for _, v := range resp.ValidatorResults {
+		passed[v.Name] = v.Passed
+	}
+	var failed []string
+	for _, name := range required {
+		if !passed[name] {
+			failed = append(failed, name)
+		}
+	}
+	return failed
+}
+
+// mergeGuardrails returns the union of two validator lists, keeping order
+func mergeGuardrails(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var out []string
+	for _, list := range [][]string{a, b} {
+		for _, g := range list {
+			if !seen[g] {
+				seen[g] = true
+				out = append(out, g)
+			}
+		}
+	}
+	return out
+}
+
+// blockedToolCall records a tool call withheld from the client
+type blockedToolCall struct {
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// applyToolCallGuardrails scans the tool calls of an assistant message: denied tools and
+// calls failing a required validator are blocked, and arguments are masked in place.
+// Blocked calls are removed from the message; when none remain, tool_calls is dropped.
+func applyToolCallGuardrails(detect detectFunc, msg map[string]interface{}, rid string, guardrailsList []string, policy ToolPolicy) ([]models.DetectResponse, []blockedToolCall) {
+	calls, ok := msg["tool_calls"].([]interface{})
+	if !ok || len(calls) == 0 {
+		return nil, nil
+	}
+
+	var detects []models.DetectResponse
+	var blocked []blockedToolCall
+	kept := make([]interface{}, 0, len(calls))
+
+	for _, call := range calls {
+		fn, name, args := toolCallFunction(call)
+		if fn == nil {
+			kept = append(kept, call)
+			continue
+		}
+		id, _ := call.(map[string]interface{})["id"].(string)
+
+		sanitized, resp, withheld := checkToolCall(detect, rid, guardrailsList, policy, id, name, args)
+		if resp != nil {
+			detects = append(detects, *resp)
+		}
+		if withheld != nil {
+			blocked = append(blocked, *withheld)
+			continue
+		}
+		if resp != nil {
+			fn["arguments"] = sanitized
+		}
+		kept = append(kept, call)
+	}
+
+	if len(blocked) > 0 {
+		log.Printf("[gateway] RID=%s withheld %d tool call(s)", rid, len(blocked))
+	}
+	if len(kept) == 0 {
+		delete(msg, "tool_calls")
+	} else {
+		msg["tool_calls"] = kept
+	}
+	return detects, blocked
+}
+
+// checkToolCall applies the tool policy to one tool call returned by the model. It returns
+// the masked arguments and the detection response when the arguments were scanned, and
+// the reason the call is withheld when it is denied or fails a required validator.
+func checkToolCall(detect detectFunc, rid string, guardrailsList []string, policy ToolPolicy, id, name, args string) (string, *models.DetectResponse, *blockedToolCall) {
+	if !policy.permits(name) {
+		return args, nil, &blockedToolCall{ID: id, Name: name, Reason: fmt.Sprintf("Tool '%s' is not permitted by TSZ tool policy", name)}
+	}
+	if args == "" && len(policy.RequiredGuardrails) == 0 {
+		return args, nil, nil
+	}
+
+	sanitized, resp := scanToolArguments(detect, args, models.DetectRequest{
+		RID:        rid + "-OUT",
+		Guardrails: mergeGuardrails(guardrailsList, policy.RequiredGuardrails),
+	})
+	logGatewayDetectSummary("output-tool-call", rid, resp)
+
+	if failed := failedRequiredGuardrails(resp, policy.RequiredGuardrails); len(failed) > 0 {
+		return args, &resp, &blockedToolCall{ID: id, Name: name, Reason: fmt.Sprintf("Tool call '%s' failed required guardrail(s): %s", name, strings.Join(failed, ", "))}
+	}
+	if resp.Blocked {
+		reason := resp.Message
+		if reason == "" {
+			reason = "Tool call blocked by TSZ security policy"
+		}
+		return args, &resp, &blockedToolCall{ID: id, Name: name, Reason: reason}
+	}
+	return sanitized, &resp, nil
+}
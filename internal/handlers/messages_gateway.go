@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/models"
+)
+
+// NewAnthropicMessagesGateway returns an HTTP handler that exposes an Anthropic Messages
+// API-compatible /v1/messages endpoint, for clients built on the Anthropic SDK.
+//
+// It applies the same guardrails as NewOpenAIChatGateway and accepts the same options
+// and X-TSZ-* headers:
+//  1. Parse the incoming Messages API request (model, system, messages, tools, stream, ...)
+//  2. Run input guardrails on the system prompt, text and tool_result blocks of roles in
+//     scope, and mask the input of earlier tool_use blocks
+//  3. Optionally block or redact the request
+//  4. Forward the sanitized request through a provider that speaks the Messages API
+//  5. For non-streaming calls, apply output guardrails and the tool policy to the content blocks
+//  6. For streaming calls, proxy the upstream event stream; in stream-sync mode the
+//     Anthropic SSE events are rewritten with sanitized output (see streamMessagesWithGuards).
+//
+// Errors use the Messages API error format ({"type": "error", "error": {...}}) with
+// tsz_meta attached, as on the chat completions gateway.
+func NewAnthropicMessagesGateway(detector *guardrails.Detector, opts ...GatewayOption) http.HandlerFunc {
+	return newMessagesGateway(detector.DetectContext, opts...)
+}
+
+// newMessagesGateway implements NewAnthropicMessagesGateway with an explicit detection function
+func newMessagesGateway(detectContext contextDetectFunc, opts ...GatewayOption) http.HandlerFunc {
+	options := gatewayOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAnthropicError(w, http.StatusMethodNotAllowed, "Method not allowed", "method_not_allowed")
+			return
+		}
+
+		// Detection (and its AI scoring) stops when the client goes away
+		detect := detectContext.bind(r.Context())
+
+		// 1) Parse payload and stream flag
+		payload, stream, err := parseChatGatewayPayload(r)
+		if err != nil {
+			writeAnthropicError(w, http.StatusBadRequest, err.Error(), "invalid_request_error")
+			return
+		}
+
+		messages, ok := payload["messages"].([]interface{})
+		if !ok || len(messages) == 0 {
+			writeAnthropicError(w, http.StatusBadRequest, "'messages' array is required", "invalid_request_error")
+			return
+		}
+
+		// 2) Extract metadata (RID, guardrails list, streaming options)
+		rid, guardrailsList := extractGatewayMetadata(r)
+		mode, onFail := extractGatewayStreamOptions(r)
+		scope := extractGatewayScanScope(r, options)
+		log.Printf("[gateway-messages] RID=%s stream=%v mode=%s onFail=%s guardrails=%v gateway_block_mode=%s", rid, stream, mode, onFail, guardrailsList, config.AppConfig.GatewayBlockMode)
+
+		// Calls to tools removed below can still come back, so the offer made by the client counts
+		checkStreamedTools := stream && options.tools.active() && declaresTools(payload)
+		if removed := filterDeclaredTools(payload, options.tools); len(removed) > 0 {
+			log.Printf("[gateway-messages] RID=%s removed tools not permitted by tool policy: %v", rid, removed)
+		}
+		if checkStreamedTools && mode == "stream-async" {
+			writeAnthropicErrorWithMeta(w, http.StatusBadRequest, errToolPolicyStreamMode, "tsz_tool_policy_stream_mode", map[string]interface{}{"rid": rid})
+			return
+		}
+
+		// 3) Apply the non-text part policy and input guardrails
+		if err := applyNonTextPartPolicy(messages, scope.roles, options.nonTextParts); err != nil {
+			log.Printf("[gateway-messages] RID=%s rejected: %v", rid, err)
+			writeAnthropicErrorWithMeta(w, http.StatusBadRequest, err.Error(), "tsz_non_text_content", map[string]interface{}{"rid": rid})
+			return
+		}
+
+		blocked, blockMessage, inputDetects := applyMessagesInputGuardrails(detect, payload, messages, rid, guardrailsList, scope, options.tokenVault)
+		if blocked {
+			triggeredGuardrails := computeTriggeredGuardrails(inputDetects, nil)
+			log.Printf("[gateway-messages] RID=%s blocked on input guardrails: %s (gateway_block_mode=%s, guardrails=%v)", rid, blockMessage, config.AppConfig.GatewayBlockMode, triggeredGuardrails)
+
+			// BLOCK mode: hard fail with HTTP error
+			if config.AppConfig.GatewayBlockMode == "BLOCK" {
+				meta := map[string]interface{}{
+					"rid":        rid,
+					"guardrails": triggeredGuardrails,
+					"input":      inputDetects,
+				}
+
+				writeAnthropicErrorWithMeta(w, http.StatusBadRequest, blockMessage, "tsz_content_blocked", meta)
+				return
+			}
+		}
+
+		// 4) Forward request to the Messages API provider
+		forwarder := ai.GetMessagesForwarder()
+		if forwarder == nil {
+			writeAnthropicError(w, http.StatusInternalServerError, "No Messages API provider is configured", "provider_not_configured")
+			return
+		}
+
+		upstreamResp, err := forwarder.ForwardMessages(r.Context(), payload)
+		if err != nil {
+			log.Printf("[gateway-messages] RID=%s provider forward failed: %v", rid, err)
+			writeAnthropicError(w, http.StatusBadGateway, "Failed to reach upstream LLM service", "upstream_unreachable")
+			return
+		}
+		defer upstreamResp.Body.Close()
+
+		log.Printf("[gateway-messages] RID=%s upstream_status=%d stream=%v", rid, upstreamResp.StatusCode, stream)
+
+		if stream {
+			// Upstream errors are plain JSON, not an event stream
+			if upstreamResp.StatusCode != http.StatusOK {
+				proxyStreamResponse(w, upstreamResp)
+				return
+			}
+
+			switch mode {
+			case "stream-sync":
+				newGuard := func() *streamGuard {
+					return newStreamGuardWithDetect(detect, rid, guardrailsList, onFail)
+				}
+				streamMessagesWithGuards(newGuard, detect, rid, guardrailsList, options.tools, upstreamResp, w, onFail)
+			case "stream-async":
+				proxyStreamWithAsyncValidation(detectContext.bind(context.WithoutCancel(r.Context())), rid, guardrailsList, upstreamResp, w)
+			default: // "final-only" or unknown
+				if checkStreamedTools {
+					// Text passes through unchanged; tool_use blocks are still checked
+					passThrough := func() *streamGuard { return newStreamGuardWithDetect(detect, rid, nil, onFail) }
+					streamMessagesWithGuards(passThrough, detect, rid, guardrailsList, options.tools, upstreamResp, w, onFail)
+					return
+				}
+				proxyStreamResponse(w, upstreamResp)
+			}
+			return
+		}
+
+		// Non-streaming: apply output guardrails on the content blocks
+		detokenize := options.tokenVault && isVaultAuthorized(r)
+		processMessagesResponse(detect, rid, guardrailsList, upstreamResp, w, inputDetects, detokenize, options.tools)
+		log.Printf("[gateway-messages] RID=%s non-stream response completed with status=%d", rid, upstreamResp.StatusCode)
+	}
+}
+
+// applyMessagesInputGuardrails runs input guardrails on a Messages API request in place.
+// The top-level system prompt is scanned when "system" is in scope, text blocks when the
+// message role is in scope, and tool_result blocks when "tool" is in scope. The input of
+// earlier tool_use blocks is always masked, leaf by leaf so that it stays a JSON object.
+// With a conversation window, the recent text blocks are then scanned as a whole.
+func applyMessagesInputGuardrails(detect detectFunc, payload map[string]interface{}, messages []interface{}, rid string, guardrailsList []string, scope scanScope, tokenize bool) (bool, string, []models.DetectResponse) {
+	scanner := &inputScanner{detect: detect, rid: rid, guardrailsList: guardrailsList, tokenize: tokenize}
+
+	if scope.roles["system"] {
+		switch system := payload["system"].(type) {
+		case string:
+			if system != "" {
+				payload["system"] = scanner.text(system)
+			}
+		case []interface{}:
+			scanner.textParts(system)
+		}
+	}
+
+	for _, rm := range messages {
+		if scanner.blocked {
+			break
+		}
+
+		msgMap, ok := rm.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		role, _ := msgMap["role"].(string)
+
+		switch content := msgMap["content"].(type) {
+		case string:
+			if content != "" && scope.roles[role] {
+				msgMap["content"] = scanner.text(content)
+			}
+		case []interface{}:
+			for _, block := range content {
+				if scanner.blocked {
+					break
+				}
+				blockMap, ok := block.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				switch contentPartType(blockMap) {
+				case "text":
+					if text, _ := blockMap["text"].(string); text != "" && scope.roles[role] {
+						blockMap["text"] = scanner.text(text)
+					}
+				case "tool_use":
+					scanner.toolUseInput(blockMap)
+				case "tool_result":
+					if !scope.roles["tool"] {
+						continue
+					}
+					switch result := blockMap["content"].(type) {
+					case string:
+						if result != "" {
+							blockMap["content"] = scanner.text(result)
+						}
+					case []interface{}:
+						scanner.textParts(result)
+					}
+				}
+			}
+		}
+	}
+
+	if !scanner.blocked && scope.window > 0 {
+		if resp := scanConversationWindow(detect, messages, scope, rid, tokenize); resp != nil {
+			scanner.record(*resp)
+		}
+	}
+
+	return scanner.blocked, scanner.blockMessage, scanner.responses
+}
+
+// toolUseInput masks the input object of a tool_use block in place
+func (s *inputScanner) toolUseInput(block map[string]interface{}) {
+	args := toolUseArguments(block)
+	if args == "" || args == "{}" {
+		return
+	}
+	setToolUseInput(block, s.toolArguments(args))
+}
+
+// toolUseArguments returns the input of a tool_use block as JSON text
+func toolUseArguments(block map[string]interface{}) string {
+	input, ok := block["input"]
+	if !ok {
+		return ""
+	}
+	raw, err := json.Marshal(input)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
+
+// setToolUseInput replaces the input of a tool_use block with the decoded args;
+// args that do not decode leave the block unchanged
+func setToolUseInput(block map[string]interface{}, args string) {
+	var input interface{}
+	if err := json.Unmarshal([]byte(args), &input); err == nil {
+		block["input"] = input
+	}
+}
+
+// processMessagesResponse reads the upstream Messages API response and applies output
+// guardrails to its text blocks and the tool policy to its tool_use blocks. Denied tool
+// calls or calls failing a required validator are removed (or fail the request in BLOCK
+// mode); when no tool_use block is left, a stop_reason of "tool_use" becomes "refusal".
+// When detokenize is set, vault placeholders echoed by the model are swapped back to originals.
+func processMessagesResponse(detect detectFunc, rid string, guardrailsList []string, upstreamResp *http.Response, w http.ResponseWriter, inputDetects []models.DetectResponse, detokenize bool, tools ToolPolicy) {
+	upstreamBody, err := io.ReadAll(upstreamResp.Body)
+	if err != nil {
+		log.Printf("Failed to read upstream response body: %v", err)
+		writeAnthropicError(w, http.StatusBadGateway, "Failed to read upstream LLM response", "upstream_read_error")
+		return
+	}
+
+	var upstreamPayload map[string]interface{}
+	if upstreamResp.StatusCode == http.StatusOK && json.Unmarshal(upstreamBody, &upstreamPayload) == nil {
+		if blocks, ok := upstreamPayload["content"].([]interface{}); ok {
+			var outputDetects []models.DetectResponse
+			var withheldToolCalls []blockedToolCall
+			toolUses := 0
+			kept := make([]interface{}, 0, len(blocks))
+
+			for _, block := range blocks {
+				blockMap, ok := block.(map[string]interface{})
+				if !ok {
+					kept = append(kept, block)
+					continue
+				}
+
+				switch contentPartType(blockMap) {
+				case "text":
+					text, _ := blockMap["text"].(string)
+					if text == "" {
+						break
+					}
+
+					// Output guardrails
+					outResp := detect(models.DetectRequest{
+						Text:       text,
+						RID:        rid + "-OUT",
+						Guardrails: guardrailsList,
+					})
+					outputDetects = append(outputDetects, outResp)
+					logGatewayDetectSummary("output-nonstream", rid, outResp)
+
+					if outResp.Blocked {
+						msgText := outResp.Message
+						if msgText == "" {
+							msgText = "Assistant response blocked by TSZ security policy"
+						}
+
+						triggeredGuardrails := computeTriggeredGuardrails(inputDetects, outputDetects)
+						log.Printf("[gateway-messages] RID=%s blocked on output guardrails: %s (gateway_block_mode=%s, guardrails=%v)", rid, msgText, config.AppConfig.GatewayBlockMode, triggeredGuardrails)
+
+						if config.AppConfig.GatewayBlockMode == "BLOCK" {
+							meta := map[string]interface{}{
+								"rid":        rid,
+								"guardrails": triggeredGuardrails,
+								"input":      inputDetects,
+								"output":     outputDetects,
+							}
+
+							writeAnthropicErrorWithMeta(w, http.StatusBadRequest, msgText, "tsz_output_blocked", meta)
+							return
+						}
+					}
+
+					if outResp.RedactedText != "" {
+						blockMap["text"] = outResp.RedactedText
+					}
+
+					if detokenize {
+						outText, _ := blockMap["text"].(string)
+						if rehydrated, replaced, err := guardrails.Detokenize(rid, outText); err != nil {
+							log.Printf("[gateway-messages] RID=%s detokenization failed: %v", rid, err)
+						} else if replaced > 0 {
+							log.Printf("[gateway-messages] RID=%s detokenized %d placeholder(s) in output", rid, replaced)
+							blockMap["text"] = rehydrated
+						}
+					}
+
+				case "tool_use":
+					// Tool calls: enforce the tool policy and mask the input
+					id, _ := blockMap["id"].(string)
+					name, _ := blockMap["name"].(string)
+					sanitized, resp, withheld := checkToolCall(detect, rid, guardrailsList, tools, id, name, toolUseArguments(blockMap))
+					if resp != nil {
+						outputDetects = append(outputDetects, *resp)
+					}
+					if withheld != nil {
+						withheldToolCalls = append(withheldToolCalls, *withheld)
+
+						if config.AppConfig.GatewayBlockMode == "BLOCK" {
+							meta := map[string]interface{}{
+								"rid":                rid,
+								"guardrails":         computeTriggeredGuardrails(inputDetects, outputDetects),
+								"input":              inputDetects,
+								"output":             outputDetects,
+								"blocked_tool_calls": withheldToolCalls,
+							}
+
+							writeAnthropicErrorWithMeta(w, http.StatusBadRequest, withheld.Reason, "tsz_tool_call_blocked", meta)
+							return
+						}
+						continue
+					}
+					if resp != nil {
+						setToolUseInput(blockMap, sanitized)
+					}
+					toolUses++
+				}
+
+				kept = append(kept, blockMap)
+			}
+
+			upstreamPayload["content"] = kept
+			if len(withheldToolCalls) > 0 {
+				log.Printf("[gateway-messages] RID=%s withheld %d tool call(s)", rid, len(withheldToolCalls))
+				if toolUses == 0 && upstreamPayload["stop_reason"] == "tool_use" {
+					upstreamPayload["stop_reason"] = "refusal"
+				}
+			}
+
+			meta := map[string]interface{}{
+				"rid":        rid,
+				"guardrails": computeTriggeredGuardrails(inputDetects, outputDetects),
+				"input":      inputDetects,
+				"output":     outputDetects,
+			}
+			if len(withheldToolCalls) > 0 {
+				meta["blocked_tool_calls"] = withheldToolCalls
+			}
+			upstreamPayload["tsz_meta"] = withAIStatus(meta)
+
+			if sanitizedBody, err := json.Marshal(upstreamPayload); err == nil {
+				upstreamBody = sanitizedBody
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(upstreamResp.StatusCode)
+	if _, err := w.Write(upstreamBody); err != nil {
+		log.Printf("Failed to write gateway response body: %v", err)
+	}
+}
+
+// writeAnthropicError writes an error in Anthropic Messages API format.
+func writeAnthropicError(w http.ResponseWriter, status int, message string, code string) {
+	writeAnthropicErrorWithMeta(w, status, message, code, nil)
+}
+
+// writeAnthropicErrorWithMeta writes an error in Anthropic Messages API format and optionally
+// attaches TSZ metadata. The TSZ error code is carried in error.code.
+func writeAnthropicErrorWithMeta(w http.ResponseWriter, status int, message string, code string, meta map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	errType := "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		errType = "api_error"
+	}
+
+	body := map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    errType,
+			"message": message,
+			"code":    code,
+		},
+	}
+
+	if meta != nil {
+		body["tsz_meta"] = withAIStatus(meta)
+	}
+
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"thyris-sz/internal/config"
+)
+
+// messageBlock is the output guardrail state of one streamed content block
+type messageBlock struct {
+	kind  string       // content block type: text, tool_use, ...
+	out   int          // index of the block in the stream sent to the client
+	guard *streamGuard // text blocks only
+	done  bool         // content_block_stop handled
+
+	// tool_use blocks are buffered until they stop
+	start map[string]interface{}
+	input strings.Builder
+}
+
+// streamMessagesWithGuards proxies a Messages API event stream while applying output
+// guardrails incrementally (see streamGuard) and streaming only the sanitized output.
+//
+// Every text content block has its own guard; text it holds back is released before the
+// block's content_block_stop, or at the end of the stream. tool_use blocks are buffered
+// until they stop, checked against the tool policy and sent as a single input_json_delta
+// with masked input. Withheld tool_use blocks are dropped and later blocks renumbered;
+// when no tool_use block is left, a stop_reason of "tool_use" becomes "refusal". With
+// onFail "halt", a blocked text block ends the stream with an error event.
+func streamMessagesWithGuards(
+	newGuard func() *streamGuard,
+	detect detectFunc,
+	rid string,
+	guardrailsList []string,
+	tools ToolPolicy,
+	upstreamResp *http.Response,
+	w http.ResponseWriter,
+	onFail string,
+) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(upstreamResp.StatusCode)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		// Fallback: if flusher is not available, proxy as-is.
+		log.Printf("[gateway-messages] http.Flusher not supported by response writer; falling back to raw proxy")
+		proxyStreamResponse(w, upstreamResp)
+		return
+	}
+
+	failMode := strings.ToUpper(config.AppConfig.StreamFailMode)
+
+	blocks := make(map[int]*messageBlock)
+	nextOut := 0
+	var withheldToolCalls []blockedToolCall
+	toolUses := 0
+
+	// writeEvent writes an event and flushes it; it returns false when the client is gone
+	writeEvent := func(event map[string]interface{}) bool {
+		if err := writeNamedSSEEvent(w, event); err != nil {
+			log.Printf("[gateway-messages] Failed to write SSE event RID=%s: %v", rid, err)
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	// writeRaw forwards an upstream event unchanged
+	writeRaw := func(raw string) bool {
+		if _, err := w.Write([]byte(raw)); err != nil {
+			log.Printf("[gateway-messages] Failed to write SSE event RID=%s: %v", rid, err)
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	// halt ends the stream after a block was blocked by the guardrails
+	halt := func(errMsg string) bool {
+		log.Printf("[gateway-messages] RID=%s output blocked by guardrails: %s", rid, errMsg)
+		writeEvent(map[string]interface{}{
+			"type": "error",
+			"error": map[string]interface{}{
+				"type":    "invalid_request_error",
+				"message": errMsg,
+				"code":    "tsz_output_blocked",
+			},
+		})
+		return false
+	}
+
+	textDelta := func(out int, text string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": out,
+			"delta": map[string]interface{}{"type": "text_delta", "text": text},
+		}
+	}
+
+	// finishToolUse checks a buffered tool_use block and sends it unless it is withheld
+	finishToolUse := func(b *messageBlock, stop map[string]interface{}) bool {
+		block, _ := b.start["content_block"].(map[string]interface{})
+		id, _ := block["id"].(string)
+		name, _ := block["name"].(string)
+
+		args := b.input.String()
+		sanitized, _, withheld := checkToolCall(detect, rid, guardrailsList, tools, id, name, args)
+		if withheld != nil {
+			log.Printf("[gateway-messages] RID=%s withheld tool call %s: %s", rid, name, withheld.Reason)
+			withheldToolCalls = append(withheldToolCalls, *withheld)
+			return true
+		}
+
+		toolUses++
+		b.out = nextOut
+		nextOut++
+		b.start["index"] = b.out
+		if !writeEvent(b.start) {
+			return false
+		}
+		if sanitized != "" {
+			delta := map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": b.out,
+				"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": sanitized},
+			}
+			if !writeEvent(delta) {
+				return false
+			}
+		}
+		stop["index"] = b.out
+		return writeEvent(stop)
+	}
+
+	// handle processes one upstream event; it returns false when the stream must stop
+	handle := func(raw, data string) bool {
+		if data == "" {
+			return writeRaw(raw)
+		}
+
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			msg := "Failed to parse upstream SSE JSON"
+			log.Printf("[gateway-messages] %s RID=%s error=%v", msg, rid, err)
+			if failMode == "STRICT" {
+				return halt(msg)
+			}
+			// LENIENT: forward raw event.
+			return writeRaw(raw)
+		}
+
+		eventType, _ := event["type"].(string)
+		idxRaw, hasIndex := event["index"].(float64)
+		idx := int(idxRaw)
+
+		switch eventType {
+		case "content_block_start":
+			block, _ := event["content_block"].(map[string]interface{})
+			b := &messageBlock{kind: contentPartType(block)}
+			blocks[idx] = b
+
+			if b.kind == "tool_use" {
+				b.start = event
+				return true
+			}
+
+			b.out = nextOut
+			nextOut++
+			event["index"] = b.out
+			if b.kind != "text" {
+				return writeEvent(event)
+			}
+
+			b.guard = newGuard()
+			initial, _ := block["text"].(string)
+			block["text"] = ""
+			if !writeEvent(event) {
+				return false
+			}
+			if initial == "" {
+				return true
+			}
+			out, blocked, errMsg := b.guard.push(initial)
+			if blocked {
+				return halt(errMsg)
+			}
+			return out == "" || writeEvent(textDelta(b.out, out))
+
+		case "content_block_delta":
+			b, ok := blocks[idx]
+			if !ok || !hasIndex {
+				return writeRaw(raw)
+			}
+			delta, _ := event["delta"].(map[string]interface{})
+
+			switch {
+			case b.kind == "tool_use":
+				partial, _ := delta["partial_json"].(string)
+				b.input.WriteString(partial)
+				return true
+			case b.kind == "text" && delta["type"] == "text_delta":
+				text, _ := delta["text"].(string)
+				out, blocked, errMsg := b.guard.push(text)
+				if blocked {
+					return halt(errMsg)
+				}
+				if out == "" {
+					// Everything received for this block is held back by its guard.
+					return true
+				}
+				delta["text"] = out
+			}
+			event["index"] = b.out
+			return writeEvent(event)
+
+		case "content_block_stop":
+			b, ok := blocks[idx]
+			if !ok || !hasIndex {
+				return writeRaw(raw)
+			}
+			b.done = true
+
+			switch b.kind {
+			case "tool_use":
+				return finishToolUse(b, event)
+			case "text":
+				rest, blocked, errMsg := b.guard.flush()
+				if blocked {
+					return halt(errMsg)
+				}
+				if rest != "" && !writeEvent(textDelta(b.out, rest)) {
+					return false
+				}
+			}
+			event["index"] = b.out
+			return writeEvent(event)
+
+		case "message_delta":
+			delta, _ := event["delta"].(map[string]interface{})
+			if len(withheldToolCalls) > 0 && toolUses == 0 && delta["stop_reason"] == "tool_use" {
+				delta["stop_reason"] = "refusal"
+				return writeEvent(event)
+			}
+			return writeRaw(raw)
+
+		default: // message_start, ping, message_stop, error, ...
+			return writeRaw(raw)
+		}
+	}
+
+	// release flushes held-back text of blocks the upstream never stopped
+	release := func() {
+		indices := make([]int, 0, len(blocks))
+		for idx := range blocks {
+			indices = append(indices, idx)
+		}
+		sort.Ints(indices)
+
+		for _, idx := range indices {
+			b := blocks[idx]
+			if b.done || b.kind != "text" {
+				continue
+			}
+			b.done = true
+			rest, blocked, errMsg := b.guard.flush()
+			if blocked {
+				halt(errMsg)
+				return
+			}
+			if rest != "" && !writeEvent(textDelta(b.out, rest)) {
+				return
+			}
+		}
+	}
+
+	reader := bufio.NewReader(upstreamResp.Body)
+
+	log.Printf("[gateway-messages] RID=%s mode=stream-sync guardrails=%v onFail=%s failMode=%s", rid, guardrailsList, onFail, failMode)
+
+	// An SSE event is a group of lines ended by an empty line; raw keeps it for forwarding
+	var raw, data strings.Builder
+	for {
+		select {
+		case <-upstreamResp.Request.Context().Done():
+			log.Printf("[gateway-messages] upstream context canceled for RID=%s: %v", rid, upstreamResp.Request.Context().Err())
+			return
+		default:
+		}
+
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			raw.WriteString(line)
+			trimmed := strings.TrimRight(line, "\r\n")
+			if strings.HasPrefix(trimmed, "data:") {
+				data.WriteString(strings.TrimSpace(strings.TrimPrefix(trimmed, "data:")))
+			}
+		}
+
+		if strings.TrimRight(line, "\r\n") == "" || err != nil {
+			if raw.Len() > 0 {
+				if !handle(raw.String(), data.String()) {
+					return
+				}
+				raw.Reset()
+				data.Reset()
+			}
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("[gateway-messages] Error reading streaming response body with guardrails RID=%s: %v", rid, err)
+			}
+			release()
+			break
+		}
+	}
+
+	scans, detections := 0, 0
+	for _, b := range blocks {
+		if b.guard != nil {
+			scans += b.guard.scans
+			detections += len(b.guard.detections)
+		}
+	}
+	log.Printf("[gateway-messages] RID=%s stream-sync completed (blocks=%d, withheld_tool_calls=%d, scans=%d, detections=%d)", rid, len(blocks), len(withheldToolCalls), scans, detections)
+}
+
+// writeNamedSSEEvent writes event as an SSE event named after its "type", as the
+// Messages API streams them.
+func writeNamedSSEEvent(w http.ResponseWriter, event map[string]interface{}) error {
+	eventType, _ := event["type"].(string)
+	if _, err := w.Write([]byte("event: " + eventType + "\n")); err != nil {
+		return err
+	}
+	return writeSSEEvent(w, event)
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"thyris-sz/internal/cache"
 	"thyris-sz/internal/database"
+	"thyris-sz/internal/guardrails"
 	"thyris-sz/internal/models"
 )
 
@@ -21,6 +22,15 @@ func CreatePattern(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !guardrails.IsValidRedactionStrategy(pattern.RedactionStrategy) {
+		http.Error(w, "Unknown redaction strategy", http.StatusBadRequest)
+		return
+	}
+	if !guardrails.IsValidVerifier(pattern.Verifier) {
+		http.Error(w, "Unknown verifier", http.StatusBadRequest)
+		return
+	}
+
 	if result := database.DB.Create(&pattern); result.Error != nil {
 		http.Error(w, result.Error.Error(), http.StatusInternalServerError)
 		return
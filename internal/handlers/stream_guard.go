@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/models"
+)
+
+// Stream guard defaults, used when no configuration is loaded
+const (
+	defaultStreamGuardWindowBytes   = 256
+	defaultStreamGuardHoldBackBytes = 128
+)
+
+// streamGuard applies output guardrails to streamed assistant text incrementally.
+//
+// Text is committed (sanitized and released to the client) once it is at least
+// holdBack bytes behind the end of what has been received, so that no pattern can
+// still extend across it. Each scan covers only the uncommitted tail plus a bounded
+// look-behind of committed text, which gives patterns their left context; the cost
+// per received byte is therefore bounded and the total cost is linear in the response
+// length. Committed text and its placeholders are never revised, so the client sees
+// each placeholder exactly once.
+type streamGuard struct {
+	detect     detectFunc
+	rid        string
+	guardrails []string
+	onFail     string
+
+	lookBehind int // committed bytes kept as left context for the next scan
+	holdBack   int // trailing bytes never committed until more text (or the end) arrives
+	maxPending int // force a commit once this much text is uncommitted (0 = unbounded)
+
+	context   string // tail of the committed raw text
+	pending   string // raw text received but not yet committed
+	committed int    // bytes of raw text committed so far
+
+	// detections of committed text, with offsets in the raw stream
+	detections []models.DetectionResult
+	scans      int
+}
+
+// detectFunc runs detection; outside of tests it is Detector.DetectContext bound to the
+// HTTP request context
+type detectFunc func(models.DetectRequest) models.DetectResponse
+
+// contextDetectFunc runs detection under a context; it is Detector.DetectContext outside of tests
+type contextDetectFunc func(context.Context, models.DetectRequest) models.DetectResponse
+
+// bind returns a detectFunc whose AI scoring is canceled with ctx
+func (f contextDetectFunc) bind(ctx context.Context) detectFunc {
+	return func(req models.DetectRequest) models.DetectResponse {
+		return f(ctx, req)
+	}
+}
+
+// newStreamGuardWithDetect returns a guard running detect, configured from STREAM_GUARD_* settings
+func newStreamGuardWithDetect(detect detectFunc, rid string, guardrailsList []string, onFail string) *streamGuard {
+	g := &streamGuard{
+		detect:     detect,
+		rid:        rid,
+		guardrails: guardrailsList,
+		onFail:     onFail,
+		lookBehind: defaultStreamGuardWindowBytes,
+		holdBack:   defaultStreamGuardHoldBackBytes,
+	}
+	if c := config.AppConfig; c != nil {
+		if c.StreamGuardWindowBytes > 0 {
+			g.lookBehind = c.StreamGuardWindowBytes
+		}
+		if c.StreamGuardHoldBackBytes > 0 {
+			g.holdBack = c.StreamGuardHoldBackBytes
+		}
+		g.maxPending = c.StreamMaxBufferBytes
+	}
+	return g
+}
+
+// push adds a content delta and returns the sanitized text that became safe to
+// release, which may be empty. blocked is set when onFail is "halt" and the
+// guardrails blocked the output.
+func (g *streamGuard) push(delta string) (out string, blocked bool, msg string) {
+	// Without guardrails the stream is passed through unchanged
+	if len(g.guardrails) == 0 {
+		return delta, false, ""
+	}
+
+	g.pending += delta
+
+	// Scan once a full hold-back of new text is available beyond the hold-back,
+	// so that every scan commits a meaningful chunk
+	if len(g.pending) < 2*g.holdBack && (g.maxPending <= 0 || len(g.pending) <= g.maxPending) {
+		return "", false, ""
+	}
+	return g.commit(false)
+}
+
+// flush commits all remaining text at the end of the stream
+func (g *streamGuard) flush() (out string, blocked bool, msg string) {
+	if len(g.guardrails) == 0 || g.pending == "" {
+		return "", false, ""
+	}
+	return g.commit(true)
+}
+
+// commit scans look-behind + pending text and releases the safe prefix of pending
+func (g *streamGuard) commit(final bool) (string, bool, string) {
+	ctxLen := len(g.context)
+	base := g.committed - ctxLen // raw stream offset of the scanned text
+
+	resp := g.detect(models.DetectRequest{
+		Text:       g.context + g.pending,
+		RID:        g.rid + "-OUT-STREAM",
+		Guardrails: g.guardrails,
+	})
+	g.scans++
+
+	if resp.Blocked && g.onFail == "halt" {
+		msg := resp.Message
+		if msg == "" {
+			msg = "Assistant response blocked by TSZ security policy"
+		}
+		return "", true, msg
+	}
+
+	cut := len(g.pending)
+	if !final {
+		forced := g.maxPending > 0 && len(g.pending) > g.maxPending
+		cut = safeCut(g.pending, len(g.pending)-g.holdBack)
+
+		// Never commit part of a detection: it may still grow with more text
+		for _, d := range resp.Detections {
+			start, end := d.Start-ctxLen, d.End-ctxLen
+			if start >= cut {
+				break
+			}
+			if end <= cut {
+				continue
+			}
+			switch {
+			case start > 0:
+				cut = start
+			case forced:
+				cut = end
+			default:
+				cut = 0
+			}
+		}
+	}
+	if cut <= 0 {
+		return "", false, ""
+	}
+
+	var out strings.Builder
+	pos := 0
+	for _, d := range resp.Detections {
+		start, end := d.Start-ctxLen, d.End-ctxLen
+		if end <= 0 {
+			continue // committed earlier
+		}
+		if start >= cut {
+			break
+		}
+		if start < 0 {
+			// The match reaches back into text already released; mask what is left of it
+			log.Printf("[gateway-stream] RID=%s detection %s extends into committed output; masking its remainder", g.rid, d.Type)
+			start = 0
+		}
+		out.WriteString(g.pending[pos:start])
+		out.WriteString(d.Placeholder)
+		pos = end
+
+		d.Start += base
+		d.End += base
+		g.detections = append(g.detections, d)
+	}
+	out.WriteString(g.pending[pos:cut])
+
+	g.committed += cut
+	g.context = tailOnRuneBoundary(g.context+g.pending[:cut], g.lookBehind)
+	g.pending = g.pending[cut:]
+
+	return out.String(), false, ""
+}
+
+// safeCut returns a commit boundary at or before n: after the last whitespace in the
+// second half of s[:n] when there is one, otherwise on a rune boundary
+func safeCut(s string, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if n >= len(s) {
+		return len(s)
+	}
+	if i := strings.LastIndexFunc(s[:n], unicode.IsSpace); i >= n/2 {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		return i + size
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return n
+}
+
+// tailOnRuneBoundary returns at most the last n bytes of s, starting on a rune boundary
+func tailOnRuneBoundary(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	i := len(s) - n
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return s[i:]
+}
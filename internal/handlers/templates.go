@@ -3,7 +3,9 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 	"thyris-sz/internal/database"
+	"thyris-sz/internal/guardrails"
 	"thyris-sz/internal/models"
 	"thyris-sz/internal/repository"
 )
@@ -20,6 +22,24 @@ func ImportTemplateHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	for _, p := range req.Template.Patterns {
+		if !guardrails.IsValidRedactionStrategy(p.RedactionStrategy) {
+			http.Error(w, "Pattern "+p.Name+": Unknown redaction strategy", http.StatusBadRequest)
+			return
+		}
+		if !guardrails.IsValidVerifier(p.Verifier) {
+			http.Error(w, "Pattern "+p.Name+": Unknown verifier", http.StatusBadRequest)
+			return
+		}
+	}
+	for i := range req.Template.Validators {
+		v := &req.Template.Validators[i]
+		v.DegradedMode = strings.ToUpper(v.DegradedMode)
+		if err := guardrails.ValidateDegradedMode(*v); err != nil {
+			http.Error(w, "Validator "+v.Name+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
 	db := database.DB
 	tx := db.Begin()
@@ -34,6 +54,14 @@ func ImportTemplateHandler(w http.ResponseWriter, r *http.Request) {
 			existing.Description = p.Description
 			existing.Category = p.Category
 			existing.IsActive = p.IsActive
+			existing.Verifier = p.Verifier
+			existing.VerifierPolicy = p.VerifierPolicy
+			existing.ContextKeywords = p.ContextKeywords
+			existing.NegativeContextKeywords = p.NegativeContextKeywords
+			existing.ContextWindow = p.ContextWindow
+			existing.RedactionStrategy = p.RedactionStrategy
+			existing.RedactionLabel = p.RedactionLabel
+			existing.RedactionKeepLast = p.RedactionKeepLast
 			tx.Save(&existing)
 		} else {
 			// Create new
@@ -50,6 +78,8 @@ func ImportTemplateHandler(w http.ResponseWriter, r *http.Request) {
 			existing.Type = v.Type
 			existing.Rule = v.Rule
 			existing.Description = v.Description
+			existing.DegradedMode = v.DegradedMode
+			existing.FallbackValidator = v.FallbackValidator
 			tx.Save(&existing)
 		} else {
 			// Create new
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/models"
+)
+
+// This file exposes a minimal set of helpers intended ONLY for unit tests
+// living under the top-level tests/ tree.
+
+// TestDetectBatchHandlerForUnit returns the /detect/batch handler running against
+// the given patterns.
+func TestDetectBatchHandlerForUnit(patterns []models.Pattern) http.HandlerFunc {
+	return newDetectBatchHandler(func(_ context.Context, reqs []models.DetectRequest, workers int) ([]models.BatchDetectResult, error) {
+		return guardrails.TestDetectBatchWithPatternsForUnit(reqs, patterns, workers), nil
+	})
+}
+
+func TestApplyNonTextPartPolicyForUnit(messages []interface{}, policy string) error {
+	return applyNonTextPartPolicy(messages, parseScanRoles(defaultScanRoles), policy)
+}
+
+// TestApplyInputGuardrailsForUnit runs input guardrails over messages with detection
+// backed by detect, scanning the given roles (nil: defaults) and window
+func TestApplyInputGuardrailsForUnit(detect func(models.DetectRequest) models.DetectResponse, messages []interface{}, roles []string, window int) ([]interface{}, bool, []models.DetectResponse) {
+	if roles == nil {
+		roles = defaultScanRoles
+	}
+	scope := scanScope{roles: parseScanRoles(roles), window: window}
+	messages, blocked, _, responses := applyInputGuardrails(detect, messages, "RID-TEST", []string{"PII"}, scope, false)
+	return messages, blocked, responses
+}
+
+func TestToolPolicyPermitsForUnit(policy ToolPolicy, name string) bool {
+	return policy.permits(name)
+}
+
+func TestFilterDeclaredToolsForUnit(payload map[string]interface{}, policy ToolPolicy) []string {
+	return filterDeclaredTools(payload, policy)
+}
+
+// TestApplyToolCallGuardrailsForUnit applies the tool policy to the tool calls of an
+// assistant message, returning the withheld calls as name -> reason
+func TestApplyToolCallGuardrailsForUnit(detect func(models.DetectRequest) models.DetectResponse, msg map[string]interface{}, policy ToolPolicy) ([]models.DetectResponse, map[string]string) {
+	detects, blocked := applyToolCallGuardrails(detect, msg, "RID-TEST", []string{"PII"}, policy)
+	withheld := make(map[string]string, len(blocked))
+	for _, b := range blocked {
+		withheld[b.Name] = b.Reason
+	}
+	return detects, withheld
+}
+
+func TestExtractGatewayScanScopeForUnit(r *http.Request, roles []string, window int) (map[string]bool, int) {
+	options := gatewayOptions{}
+	WithScanRoles(roles)(&options)
+	WithConversationWindow(window)(&options)
+	scope := extractGatewayScanScope(r, options)
+	return scope.roles, scope.window
+}
+
+// TestScanConversationWindowForUnit runs the conversation window scan over messages,
+// which are edited in place
+func TestScanConversationWindowForUnit(detect func(models.DetectRequest) models.DetectResponse, messages []interface{}, roles []string, window int) *models.DetectResponse {
+	return scanConversationWindow(detect, messages, scanScope{roles: parseScanRoles(roles), window: window}, "RID-TEST", false)
+}
+
+// TestConversationSegmentsForUnit returns the path and text of each window segment
+func TestConversationSegmentsForUnit(messages []interface{}, roles []string, window int) ([]string, []string) {
+	var paths, texts []string
+	for _, seg := range conversationSegments(messages, parseScanRoles(roles), window) {
+		paths = append(paths, seg.path())
+		texts = append(texts, seg.text)
+	}
+	return paths, texts
+}
+
+func TestSafeCutForUnit(s string, n int) int {
+	return safeCut(s, n)
+}
+
+func TestTailOnRuneBoundaryForUnit(s string, n int) string {
+	return tailOnRuneBoundary(s, n)
+}
+
+// TestStreamGuardForUnit pushes deltas through a stream guard backed by detect and
+// returns the released chunks (the last one from the final flush) and the number of scans
+func TestStreamGuardForUnit(detect func(models.DetectRequest) models.DetectResponse, guardrailsList []string, window, holdBack int, deltas []string) ([]string, int) {
+	g := &streamGuard{
+		detect:     detect,
+		rid:        "RID-TEST",
+		guardrails: guardrailsList,
+		onFail:     "filter",
+		lookBehind: window,
+		holdBack:   holdBack,
+	}
+	var chunks []string
+	for _, d := range deltas {
+		if released, _, _ := g.push(d); released != "" {
+			chunks = append(chunks, released)
+		}
+	}
+	rest, _, _ := g.flush()
+	return append(chunks, rest), g.scans
+}
+
+// TestStreamChoicesForUnit runs the stream-sync proxy over an upstream SSE body with
+// guards backed by detect, and returns the body sent to the client
+func TestStreamChoicesForUnit(detect func(models.DetectRequest) models.DetectResponse, upstreamBody, onFail string, choices, holdBack int) string {
+	newGuard := func() *streamGuard {
+		return &streamGuard{
+			detect:     detect,
+			rid:        "RID-TEST",
+			guardrails: []string{"PII"},
+			onFail:     onFail,
+			lookBehind: 2 * holdBack,
+			holdBack:   holdBack,
+		}
+	}
+	upstream := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(upstreamBody)),
+		Request:    httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil),
+	}
+	rec := httptest.NewRecorder()
+	streamChoicesWithGuards(newGuard, detect, "RID-TEST", []string{"PII"}, ToolPolicy{}, upstream, rec, onFail, choices)
+	return rec.Body.String()
+}
+
+// TestChatGatewayForUnit returns the /v1/chat/completions handler with detection backed by detect
+func TestChatGatewayForUnit(detect func(models.DetectRequest) models.DetectResponse, opts ...GatewayOption) http.HandlerFunc {
+	return newOpenAIChatGateway(ignoringContext(detect), opts...)
+}
+
+// TestChatGatewayWithContextForUnit returns the /v1/chat/completions handler with
+// detection backed by detect, which also receives the context it runs under
+func TestChatGatewayWithContextForUnit(detect func(context.Context, models.DetectRequest) models.DetectResponse, opts ...GatewayOption) http.HandlerFunc {
+	return newOpenAIChatGateway(detect, opts...)
+}
+
+// TestMessagesGatewayForUnit returns the /v1/messages handler with detection backed by detect
+func TestMessagesGatewayForUnit(detect func(models.DetectRequest) models.DetectResponse, opts ...GatewayOption) http.HandlerFunc {
+	return newMessagesGateway(ignoringContext(detect), opts...)
+}
+
+// TestInputGatewayForUnit returns the /v1/embeddings ("embeddings") or /v1/completions
+// handler with detection backed by detect, run one request at a time
+func TestInputGatewayForUnit(name string, detect func(models.DetectRequest) models.DetectResponse, opts ...GatewayOption) http.HandlerFunc {
+	gw := embeddingsGateway
+	if name == "completions" {
+		gw = completionsGateway
+	}
+	detectBatch := func(_ context.Context, reqs []models.DetectRequest) ([]models.BatchDetectResult, error) {
+		results := make([]models.BatchDetectResult, len(reqs))
+		for i, req := range reqs {
+			resp := detect(req)
+			results[i] = models.BatchDetectResult{Index: i, Response: &resp}
+		}
+		return results, nil
+	}
+	return newInputGateway(gw, detectBatch, ignoringContext(detect), opts...)
+}
+
+func TestWithAIStatusForUnit(meta map[string]interface{}) map[string]interface{} {
+	return withAIStatus(meta)
+}
+
+// ignoringContext adapts a detection function that does not take a context
+func ignoringContext(detect func(models.DetectRequest) models.DetectResponse) contextDetectFunc {
+	return func(_ context.Context, req models.DetectRequest) models.DetectResponse {
+		return detect(req)
+	}
+}
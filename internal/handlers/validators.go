@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
+	"thyris-sz/internal/guardrails"
 	"thyris-sz/internal/models"
 	"thyris-sz/internal/repository"
 )
@@ -16,6 +18,12 @@ func CreateValidator(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	validator.DegradedMode = strings.ToUpper(validator.DegradedMode)
+	if err := guardrails.ValidateDegradedMode(validator); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if err := repository.CreateFormatValidator(&validator); err != nil {
 		http.Error(w, "Failed to create validator: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -11,12 +11,30 @@ type ConfidenceExplanation struct {
 	RegexHitCount int        `json:"regex_hit_count,omitempty"`
 	PatternActive bool       `json:"pattern_active,omitempty"`
 
+	// Post-match verification (checksums, reserved ranges)
+	Verifier       string `json:"verifier,omitempty"`
+	VerifierPassed *bool  `json:"verifier_passed,omitempty"`
+
+	// Context keywords found around the match
+	ContextKeywords         []string `json:"context_keywords,omitempty"`
+	NegativeContextKeywords []string `json:"negative_context_keywords,omitempty"`
+
+	// Entropy detector signals (Source "ENTROPY")
+	Entropy        float64 `json:"entropy,omitempty"`         // Shannon entropy in bits per character
+	EntropyCharset string  `json:"entropy_charset,omitempty"` // HEX or BASE64
+
+	// Text the pattern matched after normalization, when it differs from the original
+	NormalizedValue string `json:"normalized_value,omitempty"`
+
 	// Policy resolution
 	BlockThreshold  *float64 `json:"block_threshold,omitempty"`
 	AllowThreshold  *float64 `json:"allow_threshold,omitempty"`
-	ThresholdSource string   `json:"threshold_source,omitempty"` // PATTERN / ENV / DEFAULT
+	ThresholdSource string   `json:"threshold_source,omitempty"` // PATTERN / CATEGORY / ENV / DEFAULT
 
-	// Fusion
+	// Fusion: HybridApplied is set when an AI score refined the regex score; AIFallback
+	// tells why a candidate kept its regex-only score (BUDGET_EXCEEDED, CANCELED,
+	// CIRCUIT_OPEN, AI_NOT_CONFIGURED, AI_ERROR)
 	HybridApplied bool       `json:"hybrid_applied"`
+	AIFallback    string     `json:"ai_fallback,omitempty"`
 	FinalScore    Confidence `json:"final_score"`
 }
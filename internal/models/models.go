@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
 
 // DetectRequest represents the incoming request payload for PII detection
 type DetectRequest struct {
@@ -9,6 +13,17 @@ type DetectRequest struct {
 	RID            string   `json:"rid,omitempty"`
 	ExpectedFormat string   `json:"expected_format,omitempty"`
 	Guardrails     []string `json:"guardrails,omitempty"`
+	// Tokenize stores placeholder -> original mappings in the tokenization vault (requires RID)
+	Tokenize bool `json:"tokenize,omitempty"`
+	// Normalize runs patterns on a de-obfuscated copy of the text as well
+	// (overrides FEATURE_TEXT_NORMALIZATION when set)
+	Normalize *bool `json:"normalize,omitempty"`
+
+	// JSON switches to structured mode: every string leaf of the document is scanned
+	// (optionally narrowed by JSONPath include/exclude expressions) instead of Text
+	JSON         json.RawMessage `json:"json,omitempty"`
+	IncludePaths []string        `json:"include_paths,omitempty"`
+	ExcludePaths []string        `json:"exclude_paths,omitempty"`
 }
 
 // DetectionResult represents a single detected PII entity
@@ -18,6 +33,7 @@ type DetectionResult struct {
 	Placeholder           string                 `json:"placeholder"`
 	Start                 int                    `json:"start"`
 	End                   int                    `json:"end"`
+	Path                  string                 `json:"path,omitempty"` // JSON path of the leaf in structured mode
 	ConfidenceScore       Confidence             `json:"confidence_score"`
 	ConfidenceExplanation *ConfidenceExplanation `json:"confidence_explanation,omitempty"`
 }
@@ -25,6 +41,7 @@ type DetectionResult struct {
 // DetectResponse represents the response payload containing redacted text and detections
 type DetectResponse struct {
 	RedactedText      string            `json:"redacted_text,omitempty"`
+	RedactedJSON      json.RawMessage   `json:"redacted_json,omitempty"` // structured mode only
 	Detections        []DetectionResult `json:"detections,omitempty"`
 	ValidatorResults  []ValidatorResult `json:"validator_results,omitempty"`
 	Breakdown         map[string]int    `json:"breakdown"`
@@ -34,12 +51,37 @@ type DetectResponse struct {
 	Message           string            `json:"message,omitempty"`
 }
 
+// BatchDetectRequest represents the payload for POST /detect/batch
+type BatchDetectRequest struct {
+	Items []DetectRequest `json:"items"`
+}
+
+// BatchDetectResult is the outcome of one batch item; exactly one of Response or Error is set
+type BatchDetectResult struct {
+	Index    int             `json:"index"`
+	Response *DetectResponse `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// BatchDetectResponse represents the response of POST /detect/batch, in request order
+type BatchDetectResponse struct {
+	Results []BatchDetectResult `json:"results"`
+	Failed  int                 `json:"failed"`
+}
+
 // ValidatorResult represents confidence-scored validator outcome
 type ValidatorResult struct {
 	Name            string     `json:"name"`
 	Type            string     `json:"type"`
 	Passed          bool       `json:"passed"`
 	ConfidenceScore Confidence `json:"confidence_score"`
+	// Degraded policy applied because the AI judge was unavailable:
+	// FAIL_OPEN, FAIL_CLOSED or FALLBACK:<validator>
+	Degraded string `json:"degraded,omitempty"`
+	// AI_PROMPT verdict: the judge's label, its reasoning and the risk categories it found
+	Label      string   `json:"label,omitempty"`
+	Rationale  string   `json:"rationale,omitempty"`
+	Categories []string `json:"categories,omitempty"`
 }
 
 // Pattern represents a regex pattern stored in the database
@@ -54,6 +96,20 @@ type Pattern struct {
 	// Enterprise policy overrides (optional)
 	BlockThreshold *float64
 	AllowThreshold *float64
+
+	// Optional post-match verifier (LUHN, TCKN, VKN, IBAN, UK_NINO, US_SSN)
+	Verifier       string
+	VerifierPolicy string `gorm:"default:'DROP'"` // DROP, DOWNSCORE
+
+	// Optional context keywords looked up around each match (case-insensitive)
+	ContextKeywords         []string `gorm:"serializer:json"` // raise confidence when nearby
+	NegativeContextKeywords []string `gorm:"serializer:json"` // lower confidence when nearby
+	ContextWindow           int      // characters inspected on each side (default 50)
+
+	// Redaction applied in MASK mode: RANDOM (default), PARTIAL, LABEL, HMAC, FORMAT_PRESERVING, PSEUDONYM
+	RedactionStrategy string
+	RedactionLabel    string // LABEL replacement (default [PATTERN_NAME])
+	RedactionKeepLast int    // PARTIAL visible trailing characters (default 4)
 }
 
 // FormatValidator represents a dynamic validation rule
@@ -64,6 +120,11 @@ type FormatValidator struct {
 	Rule             string `json:"rule"`                 // Regex, Prompt text, or JSON Schema
 	Description      string `json:"description"`
 	ExpectedResponse string `json:"expected_response"` // Dynamic expectation (e.g. "YES", "SAFE", "1")
+
+	// Behaviour of an AI_PROMPT validator while the AI judge is unavailable:
+	// FAIL_CLOSED (default), FAIL_OPEN, or FALLBACK to the REGEX validator FallbackValidator
+	DegradedMode      string `json:"degraded_mode,omitempty"`
+	FallbackValidator string `json:"fallback_validator,omitempty"`
 }
 
 // GuardrailTemplate represents a portable collection of rules
@@ -91,6 +152,12 @@ type BlacklistItem struct {
 	gorm.Model
 	Value       string `gorm:"uniqueIndex:idx_blocklist_value;not null" json:"value"`
 	Description string `json:"description"`
+
+	// Match options; the zero value keeps exact, case-sensitive substring matching
+	MatchType       string `gorm:"default:'LITERAL'" json:"match_type,omitempty"` // LITERAL, REGEX
+	CaseInsensitive bool   `json:"case_insensitive,omitempty"`
+	WholeWord       bool   `json:"whole_word,omitempty"`
+	Normalize       bool   `json:"normalize,omitempty"` // Unicode NFKC before matching
 }
 
 // TableName overrides the table name used by BlacklistItem to `blocklist`
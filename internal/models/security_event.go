@@ -3,11 +3,15 @@ package models
 // SecurityEvent represents an auditable security decision/event
 // Suitable for SIEM / webhook / audit log export
 type SecurityEvent struct {
-	Type            string  `json:"type"`     // BLOCK, MASK, ALLOW
-	Category        string  `json:"category"` // PII, SECRET, etc.
-	Pattern         string  `json:"pattern"`  // pattern name
+	Type     string `json:"type"`     // BLOCK, MASK, ALLOW
+	Category string `json:"category"` // detection type: the pattern name, BLOCKLIST, ...
+	Pattern  string `json:"pattern"`  // pattern name
+	// PatternCategory is the category of the pattern behind the detection (PII, SECRET, ...)
+	PatternCategory string  `json:"pattern_category,omitempty"`
 	ConfidenceScore float64 `json:"confidence_score"`
-	Threshold       float64 `json:"threshold"`
+	Threshold       float64 `json:"threshold"` // block threshold applied
+	AllowThreshold  float64 `json:"allow_threshold"`
+	ThresholdSource string  `json:"threshold_source,omitempty"` // PATTERN / CATEGORY / ENV / DEFAULT
 	Action          string  `json:"action"`
 	RequestID       string  `json:"request_id,omitempty"`
 	Timestamp       int64   `json:"timestamp"`
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"fmt"
 	"log"
 	"thyris-sz/internal/cache"
 	"thyris-sz/internal/database"
@@ -78,31 +79,42 @@ func GetAllowlistMap() (map[string]bool, error) {
 	return allowlistMap, nil
 }
 
-// GetBlocklistMap retrieves all blocklist items with caching
-func GetBlocklistMap() (map[string]bool, error) {
+// GetBlocklistRules retrieves all blocklist items with their match options and
+// the version they are cached under. When Redis is unavailable the version is
+// derived from the table contents so callers can still detect changes.
+func GetBlocklistRules() ([]models.BlacklistItem, string, error) {
 	// Try cache first
-	blocklistMap, err := cache.GetBlocklist()
-	if err == nil && len(blocklistMap) > 0 {
-		return blocklistMap, nil
+	items, version, err := cache.GetBlocklistRules()
+	if err == nil {
+		return items, version, nil
 	}
 
-	var items []models.BlacklistItem
 	result := database.DB.Find(&items)
 	if result.Error != nil {
-		return nil, result.Error
-	}
-
-	blocklistMap = make(map[string]bool)
-	for _, item := range items {
-		blocklistMap[item.Value] = true
+		return nil, "", result.Error
 	}
 
 	// Update cache
-	if err := cache.SetBlocklist(blocklistMap); err != nil {
-		log.Printf("Failed to cache blocklist: %v", err)
+	version, err = cache.SetBlocklistRules(items)
+	if err != nil {
+		log.Printf("Failed to cache blocklist rules: %v", err)
+		version = blocklistFingerprint(items)
 	}
 
-	return blocklistMap, nil
+	return items, version, nil
+}
+
+// blocklistFingerprint summarizes the blocklist table for change detection without Redis
+func blocklistFingerprint(items []models.BlacklistItem) string {
+	var latest int64
+	var idSum uint
+	for _, item := range items {
+		idSum += item.ID
+		if ts := item.UpdatedAt.UnixNano(); ts > latest {
+			latest = ts
+		}
+	}
+	return fmt.Sprintf("db:%d:%d:%d", len(items), idSum, latest)
 }
 
 // GetPatternByID retrieves a pattern by its primary key ID
@@ -3,12 +3,10 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"thyris-sz/internal/ai"
 	"thyris-sz/internal/cache"
@@ -60,8 +58,10 @@ func main() {
 			http.Error(w, "Redis not ready", http.StatusServiceUnavailable)
 			return
 		}
+		// An open AI breaker degrades AI checks per validator policy; it does not make
+		// the service unready
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("READY"))
+		w.Write([]byte("READY\nai_breaker: " + ai.JudgeBreaker().State))
 	})
 
 	mux.HandleFunc("POST /detect", func(w http.ResponseWriter, r *http.Request) {
@@ -72,60 +72,46 @@ func main() {
 		}
 
 		// Validation
-		if req.Text == "" {
+		if err := guardrails.ValidateDetectRequest(req); err != nil {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Text field is required"})
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 			return
 		}
 
-		if req.Mode != "" {
-			validModes := map[string]bool{
-				"MASK":   true,
-				"BLOCK":  true,
-				"DETECT": true,
-			}
-			if !validModes[req.Mode] {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusBadRequest)
-				json.NewEncoder(w).Encode(map[string]string{"error": "Invalid mode"})
-				return
-			}
-		}
-
 		startTime := time.Now()
-		result := detector.Detect(req)
+		result := detector.DetectContext(r.Context(), req)
 
-		var breakdownParts []string
-		totalDetections := 0
-		for typeName, count := range result.Breakdown {
-			breakdownParts = append(breakdownParts, fmt.Sprintf("%s: %d", typeName, count))
-			totalDetections += count
-		}
-		breakdownStr := strings.Join(breakdownParts, ", ")
-		if breakdownStr == "" {
-			breakdownStr = "None"
-		}
-
-		rid := req.RID
-		if rid == "" {
-			rid = "NO-RID"
-		}
-
-		log.Printf("[AUDIT] Request ID: %s | Time: %s | Duration: %v | Total Found: %d | Breakdown: {%s}",
-			rid,
-			startTime.Format(time.RFC3339),
-			time.Since(startTime),
-			totalDetections,
-			breakdownStr,
-		)
+		handlers.LogDetectAudit(req.RID, startTime, result)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(result)
 	})
 
-	// OpenAI-compatible LLM gateway (chat completions)
-	mux.HandleFunc("POST /v1/chat/completions", handlers.NewOpenAIChatGateway(detector))
+	// Batch detection: rules loaded once, items processed concurrently
+	mux.HandleFunc("POST /detect/batch", handlers.NewDetectBatchHandler(detector))
+
+	// LLM gateways: OpenAI-compatible chat completions, legacy completions and embeddings,
+	// and Anthropic-compatible messages
+	gatewayOpts := []handlers.GatewayOption{
+		handlers.WithTokenVault(config.AppConfig.TokenVaultEnabled),
+		handlers.WithNonTextPartPolicy(config.AppConfig.GatewayNonTextParts),
+		handlers.WithTokenInputPolicy(config.AppConfig.GatewayTokenInputs),
+		handlers.WithToolPolicy(handlers.ToolPolicy{
+			Allow:              config.AppConfig.GatewayToolAllowlist,
+			Deny:               config.AppConfig.GatewayToolDenylist,
+			RequiredGuardrails: config.AppConfig.GatewayToolGuardrails,
+		}),
+		handlers.WithScanRoles(config.AppConfig.GatewayScanRoles),
+		handlers.WithConversationWindow(config.AppConfig.GatewayConversationWindow),
+	}
+	mux.HandleFunc("POST /v1/chat/completions", handlers.NewOpenAIChatGateway(detector, gatewayOpts...))
+	mux.HandleFunc("POST /v1/messages", handlers.NewAnthropicMessagesGateway(detector, gatewayOpts...))
+	mux.HandleFunc("POST /v1/completions", handlers.NewOpenAICompletionsGateway(detector, gatewayOpts...))
+	mux.HandleFunc("POST /v1/embeddings", handlers.NewOpenAIEmbeddingsGateway(detector, gatewayOpts...))
+
+	// Tokenization vault: rehydrate masked placeholders for authorized callers
+	mux.HandleFunc("POST /detokenize", handlers.Detokenize)
 
 	mux.HandleFunc("POST /patterns", handlers.CreatePattern)
 	mux.HandleFunc("GET /patterns", handlers.ListPatterns)
@@ -148,6 +134,8 @@ func main() {
 
 	// Admin Endpoints
 	mux.HandleFunc("POST /admin/reload", handlers.ReloadCache)
+	mux.HandleFunc("POST /admin/patterns/policy", handlers.UpdatePatternPolicy)
+	mux.HandleFunc("GET /admin/ai-cache/stats", handlers.AICacheStats)
 
 	server := &http.Server{
 		Addr:    ":" + config.AppConfig.ServerPort,
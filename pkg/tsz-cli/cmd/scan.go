@@ -1,25 +1,33 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/thyrisAI/safe-zone/pkg/tszclient-go"
 )
 
 var (
-	scanText string
-	scanFile string
-	scanRID  string
+	scanText      string
+	scanFile      string
+	scanRID       string
+	scanBatch     string
+	scanBatchSize int
 )
 
 var scanCmd = &cobra.Command{
 	Use:   "scan",
 	Short: "Scan text or file for PII",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if scanBatch != "" {
+			return runBatchScan(scanBatch)
+		}
+
 		var text string
 		if scanFile != "" {
 			b, err := os.ReadFile(scanFile)
@@ -30,7 +38,7 @@ var scanCmd = &cobra.Command{
 		} else if scanText != "" {
 			text = scanText
 		} else {
-			return fmt.Errorf("either --text or --file must be provided")
+			return fmt.Errorf("either --text, --file or --batch must be provided")
 		}
 
 		ctx := context.Background()
@@ -50,9 +58,76 @@ var scanCmd = &cobra.Command{
 	},
 }
 
+// runBatchScan reads one item per line from path and sends them through /detect/batch.
+// A line is either a JSON detect request ({"text": ..., "rid": ...}) or plain text.
+func runBatchScan(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open batch file: %w", err)
+	}
+	defer f.Close()
+
+	var reqs []tszclient.DetectRequest
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		req := tszclient.DetectRequest{Text: line}
+		if strings.HasPrefix(line, "{") {
+			if err := json.Unmarshal([]byte(line), &req); err != nil {
+				return fmt.Errorf("invalid JSON on line %d: %w", lineNo, err)
+			}
+		}
+		if req.RID == "" && scanRID != "" {
+			req.RID = fmt.Sprintf("%s-%d", scanRID, lineNo)
+		}
+		reqs = append(reqs, req)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read batch file: %w", err)
+	}
+	if len(reqs) == 0 {
+		return fmt.Errorf("batch file %s contains no items", path)
+	}
+
+	size := scanBatchSize
+	if size <= 0 {
+		size = len(reqs)
+	}
+
+	ctx := context.Background()
+	combined := tszclient.BatchDetectResponse{}
+	for offset := 0; offset < len(reqs); offset += size {
+		end := offset + size
+		if end > len(reqs) {
+			end = len(reqs)
+		}
+
+		resp, err := client.DetectBatch(ctx, reqs[offset:end])
+		if err != nil {
+			return fmt.Errorf("batch detection failed: %w", err)
+		}
+		for _, r := range resp.Results {
+			r.Index += offset
+			combined.Results = append(combined.Results, r)
+		}
+		combined.Failed += resp.Failed
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(combined)
+}
+
 func init() {
 	rootCmd.AddCommand(scanCmd)
 	scanCmd.Flags().StringVarP(&scanText, "text", "t", "", "Text content to scan")
 	scanCmd.Flags().StringVarP(&scanFile, "file", "f", "", "File path to scan")
-	scanCmd.Flags().StringVar(&scanRID, "rid", "", "Request ID for audit logs")
+	scanCmd.Flags().StringVar(&scanRID, "rid", "", "Request ID for audit logs (suffixed with the line number in batch mode)")
+	scanCmd.Flags().StringVar(&scanBatch, "batch", "", "Scan a file with one item per line (plain text or JSON detect request)")
+	scanCmd.Flags().IntVar(&scanBatchSize, "batch-size", 500, "Maximum items sent per /detect/batch call")
 }
@@ -62,6 +62,12 @@ type DetectRequest struct {
 	RID            string   `json:"rid,omitempty"`
 	ExpectedFormat string   `json:"expected_format,omitempty"`
 	Guardrails     []string `json:"guardrails,omitempty"`
+
+	// JSON enables structured mode: every string leaf of the document is scanned
+	// instead of Text. IncludePaths / ExcludePaths narrow the scan with JSONPath.
+	JSON         json.RawMessage `json:"json,omitempty"`
+	IncludePaths []string        `json:"include_paths,omitempty"`
+	ExcludePaths []string        `json:"exclude_paths,omitempty"`
 }
 
 // DetectionResult is a single detection in the TSZ response.
@@ -71,6 +77,7 @@ type DetectionResult struct {
 	Placeholder           string                 `json:"placeholder"`
 	Start                 int                    `json:"start"`
 	End                   int                    `json:"end"`
+	Path                  string                 `json:"path,omitempty"`
 	ConfidenceScore       string                 `json:"confidence_score"`
 	ConfidenceExplanation map[string]interface{} `json:"confidence_explanation,omitempty"`
 }
@@ -86,6 +93,7 @@ type ValidatorResult struct {
 // DetectResponse mirrors the TSZ /detect response payload.
 type DetectResponse struct {
 	RedactedText      string            `json:"redacted_text,omitempty"`
+	RedactedJSON      json.RawMessage   `json:"redacted_json,omitempty"`
 	Detections        []DetectionResult `json:"detections,omitempty"`
 	ValidatorResults  []ValidatorResult `json:"validator_results,omitempty"`
 	Breakdown         map[string]int    `json:"breakdown"`
@@ -145,6 +153,34 @@ func (c *Client) Detect(ctx context.Context, req DetectRequest) (*DetectResponse
 	return postJSON[DetectResponse](ctx, c, "/detect", req, nil)
 }
 
+// BatchDetectResult is the outcome of one item of a batch detection.
+// Exactly one of Response or Error is set.
+type BatchDetectResult struct {
+	Index    int             `json:"index"`
+	Response *DetectResponse `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// BatchDetectResponse mirrors the TSZ /detect/batch response payload.
+// Results are in the same order as the submitted requests.
+type BatchDetectResponse struct {
+	Results []BatchDetectResult `json:"results"`
+	Failed  int                 `json:"failed"`
+}
+
+// DetectBatch calls the /detect/batch endpoint of TSZ.
+//
+// The server loads its rule sets once for the whole batch and processes
+// items concurrently. Invalid items are reported per item; the call itself
+// only fails on transport errors or when the batch is rejected as a whole
+// (e.g. exceeding the server's DETECT_BATCH_MAX_ITEMS).
+func (c *Client) DetectBatch(ctx context.Context, reqs []DetectRequest) (*BatchDetectResponse, error) {
+	body := struct {
+		Items []DetectRequest `json:"items"`
+	}{Items: reqs}
+	return postJSON[BatchDetectResponse](ctx, c, "/detect/batch", body, nil)
+}
+
 // DetectOption configures a DetectRequest for helper methods such as DetectText.
 type DetectOption func(*DetectRequest)
 
@@ -17,8 +17,22 @@ type Pattern struct {
 	IsActive       bool    `json:"IsActive"`
 	BlockThreshold float64 `json:"BlockThreshold,omitempty"`
 	AllowThreshold float64 `json:"AllowThreshold,omitempty"`
+	Verifier       string  `json:"Verifier,omitempty"`       // LUHN, TCKN, VKN, IBAN, UK_NINO, US_SSN
+	VerifierPolicy string  `json:"VerifierPolicy,omitempty"` // DROP (default), DOWNSCORE
 	CreatedAt      string  `json:"CreatedAt,omitempty"`
 	UpdatedAt      string  `json:"UpdatedAt,omitempty"`
+
+	// Context keywords raise (ContextKeywords) or lower (NegativeContextKeywords) confidence
+	// when found within ContextWindow characters of a match.
+	ContextKeywords         []string `json:"ContextKeywords,omitempty"`
+	NegativeContextKeywords []string `json:"NegativeContextKeywords,omitempty"`
+	ContextWindow           int      `json:"ContextWindow,omitempty"`
+
+	// Redaction applied in MASK mode: RANDOM (default), PARTIAL, LABEL, HMAC,
+	// FORMAT_PRESERVING, PSEUDONYM.
+	RedactionStrategy string `json:"RedactionStrategy,omitempty"`
+	RedactionLabel    string `json:"RedactionLabel,omitempty"`
+	RedactionKeepLast int    `json:"RedactionKeepLast,omitempty"`
 }
 
 // AllowlistItem represents a value that should be ignored during detection.
@@ -33,6 +47,12 @@ type BlacklistItem struct {
 	ID          int    `json:"ID,omitempty"`
 	Value       string `json:"value"`
 	Description string `json:"description,omitempty"`
+
+	// Match options; zero values keep exact, case-sensitive substring matching.
+	MatchType       string `json:"match_type,omitempty"` // LITERAL or REGEX
+	CaseInsensitive bool   `json:"case_insensitive,omitempty"`
+	WholeWord       bool   `json:"whole_word,omitempty"`
+	Normalize       bool   `json:"normalize,omitempty"`
 }
 
 // FormatValidator represents a dynamic validation rule (Regex, AI Prompt, JSON Schema).
@@ -0,0 +1,159 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/handlers"
+	"thyris-sz/internal/models"
+)
+
+// withBreaker runs the test against a failing judge behind a breaker opening after
+// threshold failures
+func withBreaker(t *testing.T, threshold int) *countingJudge {
+	t.Helper()
+	judge := &countingJudge{err: errors.New("upstream down")}
+	withAICache(t, judge, 0)
+	config.AppConfig.AIBreakerFailureThreshold = threshold
+	config.AppConfig.AIBreakerCooldownSeconds = 1
+	config.AppConfig.Features.SemanticAnalysisEnabled = true
+	return judge
+}
+
+func TestJudgeBreaker_OpensAndRecovers(t *testing.T) {
+	judge := withBreaker(t, 2)
+
+	for i := 0; i < 2; i++ {
+		if _, err := ai.JudgeVerdict(context.Background(), "text", "Respond YES if ok"); err == nil || errors.Is(err, ai.ErrCircuitOpen) {
+			t.Fatalf("call %d: expected the judge error, got %v", i, err)
+		}
+	}
+	if s := ai.JudgeBreaker(); s.State != ai.BreakerOpen || s.OpenUntil.IsZero() {
+		t.Fatalf("expected an open breaker, got %+v", s)
+	}
+	if _, err := ai.JudgeVerdict(context.Background(), "text", "Respond YES if ok"); !errors.Is(err, ai.ErrCircuitOpen) {
+		t.Fatalf("expected the breaker to refuse the call, got %v", err)
+	}
+	if calls := judge.calls.Load(); calls != 2 {
+		t.Fatalf("an open breaker must not call the judge, got %d calls", calls)
+	}
+
+	// After the cooldown a successful trial call closes the breaker
+	time.Sleep(1100 * time.Millisecond)
+	judge.err, judge.reply = nil, "YES"
+	if v, err := ai.JudgeVerdict(context.Background(), "text", "Respond YES if ok"); err != nil || !v.Matches("YES") {
+		t.Fatalf("expected the trial call to succeed, got %v %v", v, err)
+	}
+	if s := ai.JudgeBreaker(); s.State != ai.BreakerClosed || s.ConsecutiveFailures != 0 {
+		t.Fatalf("expected a closed breaker, got %+v", s)
+	}
+}
+
+func TestJudgeBreaker_FailedTrialReopens(t *testing.T) {
+	judge := withBreaker(t, 1)
+
+	_, _ = ai.JudgeVerdict(context.Background(), "text", "Respond YES if ok")
+	time.Sleep(1100 * time.Millisecond)
+	_, _ = ai.JudgeVerdict(context.Background(), "text", "Respond YES if ok")
+	if s := ai.JudgeBreaker(); s.State != ai.BreakerOpen || judge.calls.Load() != 2 {
+		t.Fatalf("expected the failed trial to reopen the breaker, got %+v after %d calls", s, judge.calls.Load())
+	}
+}
+
+func TestJudgeBreaker_IgnoresCallerCancellation(t *testing.T) {
+	judge := withBreaker(t, 1)
+	judge.release = make(chan struct{}) // never answers
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, _ = ai.JudgeVerdict(ctx, "text", "Respond YES if ok")
+	if s := ai.JudgeBreaker(); s.State != ai.BreakerClosed {
+		t.Fatalf("a caller giving up must not trip the breaker, got %+v", s)
+	}
+}
+
+func TestJudgeBreaker_DisabledByZeroThreshold(t *testing.T) {
+	judge := withBreaker(t, 0)
+
+	for i := 0; i < 10; i++ {
+		_, _ = ai.JudgeVerdict(context.Background(), "text", "Respond YES if ok")
+	}
+	if s := ai.JudgeBreaker(); s.State != ai.BreakerClosed || judge.calls.Load() != 10 {
+		t.Fatalf("expected no breaker, got %+v after %d calls", s, judge.calls.Load())
+	}
+}
+
+func TestJudgeBreaker_ReportedInMetaAndScoring(t *testing.T) {
+	withBreaker(t, 1)
+
+	if meta := handlers.TestWithAIStatusForUnit(map[string]interface{}{"rid": "r"}); meta["ai_breaker"] != nil {
+		t.Fatalf("a closed breaker must not be reported, got %v", meta)
+	}
+	_, _ = ai.JudgeVerdict(context.Background(), "text", "Respond YES if ok")
+
+	meta := handlers.TestWithAIStatusForUnit(map[string]interface{}{"rid": "r"})
+	if s, ok := meta["ai_breaker"].(ai.BreakerStatus); !ok || s.State != ai.BreakerOpen {
+		t.Fatalf("expected the open breaker in tsz_meta, got %v", meta)
+	}
+
+	resp := detectEmails(context.Background(), scoringText(1))
+	if e := resp.Detections[0].ConfidenceExplanation; e.HybridApplied || e.AIFallback != guardrails.AIFallbackCircuitOpen {
+		t.Fatalf("expected a circuit-open fallback, got %+v", e)
+	}
+}
+
+func TestDegradedValidators(t *testing.T) {
+	withBreaker(t, 1)
+	noSSN := models.FormatValidator{Name: "NO_SSN", Type: "REGEX", Rule: `^[^0-9]*$`}
+	schema := models.FormatValidator{Name: "SCHEMA_V", Type: "SCHEMA", Rule: `{}`}
+	aiValidator := func(mode, fallback string) models.FormatValidator {
+		return models.FormatValidator{Name: "TOXICITY", Type: "AI_PROMPT", Rule: "Respond SAFE if ok", ExpectedResponse: "SAFE", DegradedMode: mode, FallbackValidator: fallback}
+	}
+	others := []models.FormatValidator{noSSN, schema}
+
+	valid, degraded, _, _, err := guardrails.TestRunValidatorForUnit("hello", aiValidator("", ""), others)
+	if valid || err == nil || degraded != guardrails.DegradedFailClosed {
+		t.Fatalf("expected fail-closed by default, got %v %q %v", valid, degraded, err)
+	}
+
+	valid, degraded, _, _, err = guardrails.TestRunValidatorForUnit("hello", aiValidator("FAIL_OPEN", ""), others)
+	if !valid || err != nil || degraded != guardrails.DegradedFailOpen {
+		t.Fatalf("expected fail-open, got %v %q %v", valid, degraded, err)
+	}
+
+	for text, want := range map[string]bool{"hello": true, "ssn 123-45-6789": false} {
+		valid, degraded, _, _, err = guardrails.TestRunValidatorForUnit(text, aiValidator("FALLBACK", "NO_SSN"), others)
+		if valid != want || err != nil || degraded != "FALLBACK:NO_SSN" {
+			t.Fatalf("%q: expected the regex fallback to decide %v, got %v %q %v", text, want, valid, degraded, err)
+		}
+	}
+
+	for _, fallback := range []string{"SCHEMA_V", "MISSING"} {
+		if valid, _, _, _, err = guardrails.TestRunValidatorForUnit("hello", aiValidator("FALLBACK", fallback), others); valid || err == nil {
+			t.Fatalf("expected fallback %s to fail closed, got %v %v", fallback, valid, err)
+		}
+	}
+}
+
+func TestValidateDegradedMode(t *testing.T) {
+	cases := []struct {
+		v  models.FormatValidator
+		ok bool
+	}{
+		{models.FormatValidator{}, true},
+		{models.FormatValidator{DegradedMode: "FAIL_OPEN"}, true},
+		{models.FormatValidator{DegradedMode: "fallback", FallbackValidator: "NO_SSN"}, true},
+		{models.FormatValidator{DegradedMode: "FALLBACK"}, false},
+		{models.FormatValidator{DegradedMode: "IGNORE"}, false},
+	}
+	for _, c := range cases {
+		if err := guardrails.ValidateDegradedMode(c.v); (err == nil) != c.ok {
+			t.Fatalf("%+v: expected ok=%v, got %v", c.v, c.ok, err)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/cache"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/handlers"
+)
+
+// countingJudge answers every call with reply after release is closed (if set), counting
+// calls; safe for concurrent use
+type countingJudge struct {
+	reply   string
+	err     error
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (j *countingJudge) Name() string            { return "counting" }
+func (j *countingJudge) SupportsStreaming() bool { return false }
+
+func (j *countingJudge) Chat(ctx context.Context, req ai.ChatRequest) (*ai.ChatResponse, error) {
+	j.calls.Add(1)
+	if j.release != nil {
+		select {
+		case <-j.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if j.err != nil {
+		return nil, j.err
+	}
+	return &ai.ChatResponse{Choices: []ai.ChatChoice{{Message: ai.ChatMessage{Role: "assistant", Content: j.reply}}}}, nil
+}
+
+func (j *countingJudge) ChatStream(ctx context.Context, req ai.ChatRequest) (<-chan ai.StreamEvent, <-chan error) {
+	events := make(chan ai.StreamEvent)
+	errs := make(chan error, 1)
+	close(events)
+	errs <- ai.ErrStreamingNotSupported
+	close(errs)
+	return events, errs
+}
+
+// withAICache runs the test with an in-process LRU and no Redis
+func withAICache(t *testing.T, judge ai.ChatProvider, lruSize int) {
+	t.Helper()
+	originalRDB := cache.RDB
+	cache.RDB = nil
+	t.Cleanup(func() { cache.RDB = originalRDB })
+	withJudge(t, nil, judge, &config.Config{AICacheLRUSize: lruSize})
+}
+
+func TestAICache_ConfidenceReadThrough(t *testing.T) {
+	judge := &countingJudge{reply: "0.9"}
+	withAICache(t, judge, 100)
+
+	for i := 0; i < 3; i++ {
+		if v, err := ai.ConfidenceWithAI("john@example.com", "EMAIL"); err != nil || v != 0.9 {
+			t.Fatalf("lookup %d: expected 0.9, got %v %v", i, v, err)
+		}
+	}
+	if calls := judge.calls.Load(); calls != 1 {
+		t.Fatalf("expected a single judge call, got %d", calls)
+	}
+	if v, ok := ai.GetCachedConfidence("EMAIL", "john@example.com"); !ok || v != 0.9 {
+		t.Fatalf("expected the score to be cached, got %v %v", v, ok)
+	}
+
+	stats := ai.AICacheStats().Confidence
+	if stats.Lookups != 3 || stats.LocalHits != 2 || stats.Calls != 1 || stats.HitRatio < 0.66 || stats.HitRatio > 0.67 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestAICache_SetCachedConfidenceIsRead(t *testing.T) {
+	judge := &countingJudge{reply: "0.1"}
+	withAICache(t, judge, 100)
+
+	ai.SetCachedConfidence("IBAN", "DE89370400440532013000", 0.75, time.Minute)
+	if v, err := ai.ConfidenceWithAI("DE89370400440532013000", "IBAN"); err != nil || v != 0.75 {
+		t.Fatalf("expected the cached 0.75, got %v %v", v, err)
+	}
+	if judge.calls.Load() != 0 {
+		t.Fatalf("a cached score must not call the judge")
+	}
+}
+
+func TestAICache_CollapsesConcurrentLookups(t *testing.T) {
+	judge := &countingJudge{reply: "YES", release: make(chan struct{})}
+	withAICache(t, judge, 100)
+
+	const callers = 8
+	var wg sync.WaitGroup
+	results := make(chan bool, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := ai.JudgeVerdict(context.Background(), "same text", "Respond YES if ok")
+			results <- err == nil && v.Matches("YES")
+		}()
+	}
+
+	// Let every caller join the in-flight call before the judge answers
+	deadline := time.Now().Add(2 * time.Second)
+	for ai.AICacheStats().Verdict.Deduplicated < callers-1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(judge.release)
+	wg.Wait()
+	close(results)
+
+	for ok := range results {
+		if !ok {
+			t.Fatalf("expected every caller to get the verdict")
+		}
+	}
+	if calls := judge.calls.Load(); calls != 1 {
+		t.Fatalf("expected concurrent lookups to share one judge call, got %d", calls)
+	}
+	if stats := ai.AICacheStats().Verdict; stats.Deduplicated != callers-1 {
+		t.Fatalf("expected %d deduplicated lookups, got %+v", callers-1, stats)
+	}
+}
+
+func TestAICache_SharedFetchOutlivesTheLeadersBudget(t *testing.T) {
+	judge := &countingJudge{reply: "0.8", release: make(chan struct{})}
+	withAICache(t, judge, 100)
+
+	leaderCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := ai.ConfidenceWithAIContext(leaderCtx, "4111111111111111", "CREDIT_CARD")
+		leaderErr <- err
+	}()
+	for judge.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	follower := make(chan float64, 1)
+	go func() {
+		v, _ := ai.ConfidenceWithAIContext(context.Background(), "4111111111111111", "CREDIT_CARD")
+		follower <- v
+	}()
+	for ai.AICacheStats().Confidence.Lookups < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The leader's budget runs out while the judge is still thinking
+	if err := <-leaderErr; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the leader to give up on its own budget, got %v", err)
+	}
+	close(judge.release)
+	if v := <-follower; v != 0.8 {
+		t.Fatalf("expected the follower to get the shared score, got %v", v)
+	}
+	if calls := judge.calls.Load(); calls != 1 {
+		t.Fatalf("expected a single judge call, got %d", calls)
+	}
+	if v, ok := ai.GetCachedConfidence("CREDIT_CARD", "4111111111111111"); !ok || v != 0.8 {
+		t.Fatalf("expected the shared score to be cached, got %v %v", v, ok)
+	}
+}
+
+func TestAICache_ConfidenceKeyedByJudgeModel(t *testing.T) {
+	judge := &countingJudge{reply: "0.6"}
+	withAICache(t, judge, 100)
+
+	config.AppConfig.AIJudgeModel = "judge-a"
+	ai.SetCachedConfidence("EMAIL", "john@example.com", 0.9, time.Minute)
+
+	config.AppConfig.AIJudgeModel = "judge-b"
+	if _, ok := ai.GetCachedConfidence("EMAIL", "john@example.com"); ok {
+		t.Fatalf("expected a score from another judge model not to be served")
+	}
+	if v, err := ai.ConfidenceWithAI("john@example.com", "EMAIL"); err != nil || v != 0.6 {
+		t.Fatalf("expected judge-b to be asked, got %v %v", v, err)
+	}
+
+	config.AppConfig.AIJudgeModel = "judge-a"
+	if v, ok := ai.GetCachedConfidence("EMAIL", "john@example.com"); !ok || v != 0.9 {
+		t.Fatalf("expected judge-a's score to stay cached, got %v %v", v, ok)
+	}
+}
+
+func TestAICache_DoesNotCacheErrors(t *testing.T) {
+	judge := &countingJudge{err: errors.New("upstream down")}
+	withAICache(t, judge, 100)
+
+	for i := 0; i < 2; i++ {
+		if _, err := ai.JudgeVerdict(context.Background(), "text", "Respond YES if ok"); err == nil {
+			t.Fatalf("expected the judge error")
+		}
+	}
+	judge.err, judge.reply = nil, "not a number"
+	if _, err := ai.ConfidenceWithAI("text", "EMAIL"); err == nil {
+		t.Fatalf("expected a parse error")
+	}
+	if _, ok := ai.GetCachedConfidence("EMAIL", "text"); ok {
+		t.Fatalf("an unparsable score must not be cached")
+	}
+	if calls := judge.calls.Load(); calls != 3 {
+		t.Fatalf("expected every failed lookup to call the judge, got %d", calls)
+	}
+	if stats := ai.AICacheStats().Verdict; stats.Errors != 2 || stats.HitRatio != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestAICache_VerdictKeyedByPrompt(t *testing.T) {
+	judge := &countingJudge{reply: "YES"}
+	withAICache(t, judge, 100)
+
+	_, _ = ai.JudgeVerdict(context.Background(), "text", "Respond YES if ok")
+	_, _ = ai.JudgeVerdict(context.Background(), "other text", "Respond YES if ok")
+	v, err := ai.JudgeVerdict(context.Background(), "text", "Respond YES if ok")
+	if err != nil || v.Matches("NO") {
+		t.Fatalf("expected the cached verdict to be evaluated against the new expectation, got %v %v", v, err)
+	}
+	if calls := judge.calls.Load(); calls != 2 {
+		t.Fatalf("expected distinct prompts to be judged separately and repeats to be cached, got %d calls", calls)
+	}
+}
+
+func TestAICache_LRUEvictsAndCanBeDisabled(t *testing.T) {
+	judge := &countingJudge{reply: "0.5"}
+	withAICache(t, judge, 2)
+
+	for _, text := range []string{"a", "b", "c", "a"} {
+		_, _ = ai.ConfidenceWithAI(text, "EMAIL")
+	}
+	if calls := judge.calls.Load(); calls != 4 {
+		t.Fatalf("expected the oldest entry to be evicted, got %d calls", calls)
+	}
+	if stats := ai.AICacheStats(); stats.LocalEntries != 2 || stats.LocalCapacity != 2 {
+		t.Fatalf("expected a full LRU of 2, got %+v", stats)
+	}
+
+	config.AppConfig.AICacheLRUSize = 0
+	ai.ResetAICache()
+	_, _ = ai.ConfidenceWithAI("a", "EMAIL")
+	_, _ = ai.ConfidenceWithAI("a", "EMAIL")
+	if calls := judge.calls.Load(); calls != 6 {
+		t.Fatalf("expected no caching without an LRU or Redis, got %d calls", calls)
+	}
+}
+
+func TestAdminAICacheStats(t *testing.T) {
+	withAICache(t, &countingJudge{reply: "0.5"}, 100)
+	_, _ = ai.ConfidenceWithAI("a", "EMAIL")
+
+	t.Setenv("ADMIN_API_KEY", "secret")
+	rec := httptest.NewRecorder()
+	handlers.AICacheStats(rec, httptest.NewRequest(http.MethodGet, "/admin/ai-cache/stats", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the admin key, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/ai-cache/stats", nil)
+	req.Header.Set("X-ADMIN-KEY", os.Getenv("ADMIN_API_KEY"))
+	rec = httptest.NewRecorder()
+	handlers.AICacheStats(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"confidence":{"lookups":1`) {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+}
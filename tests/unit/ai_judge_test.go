@@ -0,0 +1,161 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/config"
+)
+
+// fakeChatProvider answers Chat with a fixed reply, or blocks until the context ends
+// when block is set, and records the last request
+type fakeChatProvider struct {
+	name    string
+	reply   string
+	block   bool
+	lastReq ai.ChatRequest
+	calls   int
+}
+
+func (f *fakeChatProvider) Name() string            { return f.name }
+func (f *fakeChatProvider) SupportsStreaming() bool { return false }
+
+func (f *fakeChatProvider) Chat(ctx context.Context, req ai.ChatRequest) (*ai.ChatResponse, error) {
+	f.calls++
+	f.lastReq = req
+	if f.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &ai.ChatResponse{Choices: []ai.ChatChoice{{Message: ai.ChatMessage{Role: "assistant", Content: f.reply}}}}, nil
+}
+
+func (f *fakeChatProvider) ChatStream(ctx context.Context, req ai.ChatRequest) (<-chan ai.StreamEvent, <-chan error) {
+	events := make(chan ai.StreamEvent)
+	errs := make(chan error, 1)
+	close(events)
+	errs <- ai.ErrStreamingNotSupported
+	close(errs)
+	return events, errs
+}
+
+// withJudge installs gateway and judge providers and a config for the test, starting
+// from an empty AI cache and a closed circuit breaker
+func withJudge(t *testing.T, gateway, judge ai.ChatProvider, cfg *config.Config) {
+	t.Helper()
+	originalProvider := ai.GetProvider()
+	originalConfig := config.AppConfig
+	ai.SetProvider(gateway)
+	ai.SetJudge(judge)
+	config.AppConfig = cfg
+	ai.ResetAICache()
+	ai.ResetJudgeBreaker()
+	t.Cleanup(func() {
+		ai.SetProvider(originalProvider)
+		ai.SetJudge(nil)
+		config.AppConfig = originalConfig
+		ai.ResetAICache()
+		ai.ResetJudgeBreaker()
+	})
+}
+
+func TestCheckWithAI_UsesGatewayProvider(t *testing.T) {
+	gateway := &fakeChatProvider{name: "bedrock", reply: "YES"}
+	withJudge(t, gateway, nil, &config.Config{AIJudgeModel: "judge-model"})
+
+	ok, err := ai.CheckWithAI("some text", "Is this fine? {{TEXT}}", "YES")
+	if err != nil || !ok {
+		t.Fatalf("expected ok, got %v %v", ok, err)
+	}
+	if gateway.lastReq.Model != "judge-model" || !strings.HasPrefix(gateway.lastReq.Messages[0].Content, "Is this fine? some text\n") {
+		t.Fatalf("unexpected judge request: %+v", gateway.lastReq)
+	}
+}
+
+func TestCheckWithAI_PrefersJudgeProvider(t *testing.T) {
+	gateway := &fakeChatProvider{name: "frontier", reply: "YES"}
+	judge := &fakeChatProvider{name: "classifier", reply: "NO"}
+	withJudge(t, gateway, judge, &config.Config{})
+
+	ok, err := ai.CheckWithAI("some text", "Respond YES if ok", "YES")
+	if err != nil || ok {
+		t.Fatalf("expected the judge's NO, got %v %v", ok, err)
+	}
+	if gateway.calls != 0 || judge.calls != 1 {
+		t.Fatalf("expected only the judge to be asked, got gateway=%d judge=%d", gateway.calls, judge.calls)
+	}
+}
+
+func TestCheckWithAI_HonoursJudgeTimeout(t *testing.T) {
+	withJudge(t, nil, &fakeChatProvider{block: true}, &config.Config{AIJudgeTimeoutMs: 50})
+
+	start := time.Now()
+	ok, err := ai.CheckWithAI("text", "Respond YES if ok", "YES")
+	if ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v %v", ok, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected the call to stop at the judge timeout, took %s", elapsed)
+	}
+
+	// A caller deadline shorter than the judge timeout wins
+	config.AppConfig.AIJudgeTimeoutMs = 60000
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := ai.CheckWithAIContext(ctx, "text", "Respond YES if ok", "YES"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the caller deadline to apply, got %v", err)
+	}
+}
+
+func TestConfidenceWithAI_ParsesAndClamps(t *testing.T) {
+	judge := &fakeChatProvider{reply: " 0.82\n"}
+	withJudge(t, nil, judge, &config.Config{})
+
+	if v, err := ai.ConfidenceWithAI("john@example.com", "EMAIL"); err != nil || v != 0.82 {
+		t.Fatalf("expected 0.82, got %v %v", v, err)
+	}
+	if !strings.Contains(judge.lastReq.Messages[0].Content, "EMAIL") {
+		t.Fatalf("expected the label in the prompt, got %q", judge.lastReq.Messages[0].Content)
+	}
+
+	judge.reply = "1.7"
+	if v, _ := ai.ConfidenceWithAI("x", "EMAIL"); v != 1 {
+		t.Fatalf("expected a clamped 1, got %v", v)
+	}
+	judge.reply = "probably"
+	if _, err := ai.ConfidenceWithAI("x", "EMAIL"); err == nil {
+		t.Fatalf("expected a parse error")
+	}
+}
+
+func TestInitProvider_SeparateJudge(t *testing.T) {
+	judgeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"0.4"}}]}`)
+	}))
+	defer judgeServer.Close()
+
+	withJudge(t, nil, nil, &config.Config{
+		AIProvider:      "OPENAI_COMPATIBLE",
+		AIModelURL:      "http://127.0.0.1:1/v1",
+		AIJudgeProvider: "OPENAI_COMPATIBLE",
+		AIJudgeURL:      judgeServer.URL,
+		AIJudgeModel:    "classifier",
+	})
+	if err := ai.InitProvider(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ai.GetJudge() == ai.GetProvider() {
+		t.Fatalf("expected a judge distinct from the gateway provider")
+	}
+	if v, err := ai.ConfidenceWithAI("x", "EMAIL"); err != nil || v != 0.4 {
+		t.Fatalf("expected the judge's 0.4, got %v %v", v, err)
+	}
+}
@@ -7,9 +7,13 @@ import (
 )
 
 func TestInitProvider_InvalidConfig(t *testing.T) {
-	// Save original config
+	// Save original config and provider
 	originalConfig := config.AppConfig
-	defer func() { config.AppConfig = originalConfig }()
+	originalProvider := ai.GetProvider()
+	defer func() {
+		config.AppConfig = originalConfig
+		ai.SetProvider(originalProvider)
+	}()
 
 	// Test with empty config
 	config.AppConfig = &config.Config{}
@@ -37,38 +41,6 @@ func TestSetProvider_NilProvider(t *testing.T) {
 	}
 }
 
-func TestHybridConfidence_EdgeCases(t *testing.T) {
-	tests := []struct {
-		name       string
-		regexScore float64
-		aiScore    float64
-		expected   float64
-	}{
-		{"Both zero", 0.0, 0.0, 0.0},
-		{"Regex high, AI low", 0.9, 0.1, 0.9},
-		{"Regex low, AI high", 0.1, 0.9, 0.9},
-		{"Both high", 0.8, 0.9, 0.9},
-		{"Both medium", 0.5, 0.6, 0.6},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := ai.HybridConfidence(tt.regexScore, tt.aiScore)
-			if result < 0 || result > 1 {
-				t.Fatalf("HybridConfidence should return value between 0 and 1, got %v", result)
-			}
-			// Should never be below the strongest signal
-			maxInput := tt.regexScore
-			if tt.aiScore > maxInput {
-				maxInput = tt.aiScore
-			}
-			if result < maxInput {
-				t.Fatalf("HybridConfidence should not be below strongest signal. Got %v, max input was %v", result, maxInput)
-			}
-		})
-	}
-}
-
 func TestAIConfidenceCacheKey_Generation(t *testing.T) {
 	// Test cache key generation with different inputs
 	tests := []struct {
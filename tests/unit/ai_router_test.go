@@ -0,0 +1,327 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/handlers"
+)
+
+// routedUpstream is an OpenAI-compatible upstream answering with a fixed status and
+// recording the models it was asked for
+type routedUpstream struct {
+	name   string
+	status int
+	delay  time.Duration
+
+	mu     sync.Mutex
+	models []string
+	url    string
+}
+
+func newRoutedUpstream(t *testing.T, name string, status int) *routedUpstream {
+	t.Helper()
+	u := &routedUpstream{name: name, status: status}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		model, _ := body["model"].(string)
+		u.mu.Lock()
+		u.models = append(u.models, model)
+		delay := u.delay
+		u.mu.Unlock()
+
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(u.status)
+		_, _ = io.WriteString(w, `{"id":"`+u.name+`","object":"chat.completion","model":"`+model+`",
+			"choices":[{"index":0,"message":{"role":"assistant","content":"from `+u.name+`"},"finish_reason":"stop"}]}`)
+	}))
+	t.Cleanup(server.Close)
+	u.url = server.URL
+	return u
+}
+
+func (u *routedUpstream) hits() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.models...)
+}
+
+func (u *routedUpstream) spec() ai.ProviderSpec {
+	return ai.ProviderSpec{Name: u.name, Type: "OPENAI_COMPATIBLE", BaseURL: u.url}
+}
+
+func forwardModel(t *testing.T, router *ai.Router, model string) (*http.Response, string) {
+	t.Helper()
+	resp, err := router.ForwardRequest(context.Background(), map[string]interface{}{
+		"model":    model,
+		"messages": []interface{}{map[string]interface{}{"role": "user", "content": "Hi"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	var out struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(body, &out)
+	return resp, out.ID
+}
+
+func TestRouter_DispatchesByModelGlob(t *testing.T) {
+	ollama := newRoutedUpstream(t, "ollama", http.StatusOK)
+	openai := newRoutedUpstream(t, "openai", http.StatusOK)
+
+	router, err := ai.NewRouter(ai.RoutingConfig{
+		Providers: []ai.ProviderSpec{ollama.spec(), openai.spec()},
+		Routes: []ai.RouteSpec{
+			{Model: "gpt-4*", Provider: "openai"},
+			{Model: "meta-llama/*:8b", Provider: "ollama"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build router: %v", err)
+	}
+
+	for model, want := range map[string]string{
+		"gpt-4o-mini":            "openai",
+		"meta-llama/llama3.1:8b": "ollama",
+		"mistral":                "ollama", // no route: first provider
+	} {
+		if _, got := forwardModel(t, router, model); got != want {
+			t.Fatalf("model %s: expected %s, got %s", model, want, got)
+		}
+	}
+}
+
+func TestRouter_FailsOverOn5xxWithTargetModel(t *testing.T) {
+	primary := newRoutedUpstream(t, "primary", http.StatusServiceUnavailable)
+	fallback := newRoutedUpstream(t, "fallback", http.StatusOK)
+
+	router, _ := ai.NewRouter(ai.RoutingConfig{
+		Providers: []ai.ProviderSpec{primary.spec(), fallback.spec()},
+		Routes: []ai.RouteSpec{{
+			Model:     "gpt-4o",
+			Provider:  "primary",
+			Fallbacks: []ai.RouteTarget{{Provider: "fallback", Model: "llama3"}},
+		}},
+	})
+
+	resp, got := forwardModel(t, router, "gpt-4o")
+	if resp.StatusCode != http.StatusOK || got != "fallback" {
+		t.Fatalf("expected the fallback to answer, got %d from %s", resp.StatusCode, got)
+	}
+	if hits := fallback.hits(); len(hits) != 1 || hits[0] != "llama3" {
+		t.Fatalf("expected the fallback to be asked for llama3, got %v", hits)
+	}
+}
+
+func TestRouter_DoesNotFailOverOn4xx(t *testing.T) {
+	primary := newRoutedUpstream(t, "primary", http.StatusBadRequest)
+	fallback := newRoutedUpstream(t, "fallback", http.StatusOK)
+
+	router, _ := ai.NewRouter(ai.RoutingConfig{
+		Providers: []ai.ProviderSpec{primary.spec(), fallback.spec()},
+		Routes:    []ai.RouteSpec{{Model: "*", Provider: "primary", Fallbacks: []ai.RouteTarget{{Provider: "fallback"}}}},
+	})
+
+	if resp, _ := forwardModel(t, router, "gpt-4o"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected the client error to be returned, got %d", resp.StatusCode)
+	}
+	if len(fallback.hits()) != 0 {
+		t.Fatalf("a 4xx must not trigger failover")
+	}
+}
+
+func TestRouter_FailsOverOnTimeout(t *testing.T) {
+	primary := newRoutedUpstream(t, "primary", http.StatusOK)
+	primary.delay = 2 * time.Second
+	fallback := newRoutedUpstream(t, "fallback", http.StatusOK)
+
+	router, _ := ai.NewRouter(ai.RoutingConfig{
+		Providers: []ai.ProviderSpec{primary.spec(), fallback.spec()},
+		Routes: []ai.RouteSpec{{
+			Model:          "*",
+			Provider:       "primary",
+			Fallbacks:      []ai.RouteTarget{{Provider: "fallback"}},
+			TimeoutSeconds: 0.1,
+		}},
+	})
+
+	start := time.Now()
+	if _, got := forwardModel(t, router, "gpt-4o"); got != "fallback" {
+		t.Fatalf("expected the fallback to answer, got %s", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected failover after the route timeout, took %s", elapsed)
+	}
+}
+
+func TestRouter_EjectsUnhealthyProvider(t *testing.T) {
+	primary := newRoutedUpstream(t, "primary", http.StatusBadGateway)
+	fallback := newRoutedUpstream(t, "fallback", http.StatusOK)
+
+	router, _ := ai.NewRouter(ai.RoutingConfig{
+		Providers: []ai.ProviderSpec{primary.spec(), fallback.spec()},
+		Routes:    []ai.RouteSpec{{Model: "*", Provider: "primary", Fallbacks: []ai.RouteTarget{{Provider: "fallback"}}}},
+		Health:    ai.HealthSpec{FailureThreshold: 2, EjectSeconds: 60},
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, got := forwardModel(t, router, "gpt-4o"); got != "fallback" {
+			t.Fatalf("request %d: expected the fallback to answer, got %s", i, got)
+		}
+	}
+	if hits := len(primary.hits()); hits != 2 {
+		t.Fatalf("expected the primary to be skipped once ejected, got %d hits", hits)
+	}
+	health := router.Health()
+	if !health[0].Ejected || health[1].Ejected {
+		t.Fatalf("expected only the primary to be ejected, got %+v", health)
+	}
+}
+
+func TestRouter_ReturnsLastFailure(t *testing.T) {
+	primary := newRoutedUpstream(t, "primary", http.StatusInternalServerError)
+	fallback := newRoutedUpstream(t, "fallback", http.StatusServiceUnavailable)
+
+	router, _ := ai.NewRouter(ai.RoutingConfig{
+		Providers: []ai.ProviderSpec{primary.spec(), fallback.spec()},
+		Routes:    []ai.RouteSpec{{Model: "*", Provider: "primary", Fallbacks: []ai.RouteTarget{{Provider: "fallback"}}}},
+	})
+
+	resp, got := forwardModel(t, router, "gpt-4o")
+	if resp.StatusCode != http.StatusServiceUnavailable || got != "fallback" {
+		t.Fatalf("expected the last provider's 503, got %d from %s", resp.StatusCode, got)
+	}
+}
+
+func TestRouter_ForwardEndpointNotSupportedByAnyProvider(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	openai := newRoutedUpstream(t, "openai", http.StatusOK)
+	bedrock := ai.ProviderSpec{Name: "bedrock", Type: "BEDROCK", Region: "us-east-1", Model: "amazon.titan-text-express-v1"}
+
+	router, err := ai.NewRouter(ai.RoutingConfig{
+		Providers: []ai.ProviderSpec{bedrock, openai.spec()},
+		Routes: []ai.RouteSpec{
+			{Model: "titan*", Provider: "bedrock"},
+			{Model: "*", Provider: "bedrock", Fallbacks: []ai.RouteTarget{{Provider: "openai"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to build router: %v", err)
+	}
+
+	_, err = router.ForwardEndpoint(context.Background(), ai.EndpointEmbeddings, map[string]interface{}{"model": "titan-embed", "input": "Hi"})
+	if !errors.Is(err, ai.ErrForwardingNotSupported) || errors.Is(err, ai.ErrNoRoute) {
+		t.Fatalf("expected ErrForwardingNotSupported, got %v", err)
+	}
+
+	originalProvider := ai.GetProvider()
+	originalConfig := config.AppConfig
+	t.Cleanup(func() {
+		ai.SetProvider(originalProvider)
+		config.AppConfig = originalConfig
+	})
+	ai.SetProvider(router)
+	config.AppConfig = &config.Config{}
+	rec := httptest.NewRecorder()
+	handlers.TestInputGatewayForUnit("embeddings", messagesDetect)(rec, httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(`{"model": "titan-embed", "input": "Hi"}`)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "endpoint_not_supported") {
+		t.Fatalf("expected a 400 endpoint_not_supported, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	resp, err := router.ForwardEndpoint(context.Background(), ai.EndpointEmbeddings, map[string]interface{}{"model": "text-embedding-3-small", "input": "Hi"})
+	if err != nil {
+		t.Fatalf("expected the fallback to serve the endpoint, got %v", err)
+	}
+	resp.Body.Close()
+	if hits := openai.hits(); len(hits) != 1 {
+		t.Fatalf("expected the openai provider to be asked once, got %v", hits)
+	}
+}
+
+func TestRouter_ChatFailsOver(t *testing.T) {
+	primary := newRoutedUpstream(t, "primary", http.StatusInternalServerError)
+	fallback := newRoutedUpstream(t, "fallback", http.StatusOK)
+
+	router, _ := ai.NewRouter(ai.RoutingConfig{
+		Providers: []ai.ProviderSpec{primary.spec(), fallback.spec()},
+		Routes:    []ai.RouteSpec{{Model: "*", Provider: "primary", Fallbacks: []ai.RouteTarget{{Provider: "fallback"}}}},
+	})
+
+	resp, err := router.Chat(context.Background(), ai.ChatRequest{
+		Model:    "gpt-4o",
+		Messages: []ai.ChatMessage{{Role: "user", Content: "Hi"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "from fallback" {
+		t.Fatalf("expected the fallback to answer, got %+v", resp)
+	}
+}
+
+func TestRouter_RejectsInvalidConfig(t *testing.T) {
+	_, err := ai.NewRouter(ai.RoutingConfig{
+		Providers: []ai.ProviderSpec{{Name: "a", BaseURL: "http://localhost"}},
+		Routes:    []ai.RouteSpec{{Model: "*", Provider: "b"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "unknown provider") {
+		t.Fatalf("expected an unknown provider error, got %v", err)
+	}
+	if _, err := ai.NewRouter(ai.RoutingConfig{}); err == nil {
+		t.Fatalf("expected an error for an empty registry")
+	}
+}
+
+func TestInitProvider_RoutingFile(t *testing.T) {
+	upstream := newRoutedUpstream(t, "ollama", http.StatusOK)
+	path := filepath.Join(t.TempDir(), "routing.json")
+	routing := `{"providers":[{"name":"ollama","base_url":"` + upstream.url + `"}],"routes":[{"model":"*","provider":"ollama"}]}`
+	if err := os.WriteFile(path, []byte(routing), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	originalProvider := ai.GetProvider()
+	originalConfig := config.AppConfig
+	t.Cleanup(func() {
+		ai.SetProvider(originalProvider)
+		config.AppConfig = originalConfig
+	})
+
+	config.AppConfig = &config.Config{AIProvider: "OPENAI_COMPATIBLE", AIRoutingFile: path}
+	if err := ai.InitProvider(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name := ai.GetProvider().Name(); name != "router" {
+		t.Fatalf("expected the router, got %s", name)
+	}
+
+	config.AppConfig = &config.Config{AIRoutingFile: filepath.Join(t.TempDir(), "missing.json")}
+	if err := ai.InitProvider(); err == nil || errors.Is(err, ai.ErrNoRoute) {
+		t.Fatalf("expected a load error for a missing routing file, got %v", err)
+	}
+}
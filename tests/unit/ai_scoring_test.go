@@ -0,0 +1,120 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/models"
+)
+
+var scoringEmailPattern = models.Pattern{
+	Name:     "EMAIL",
+	Regex:    `\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`,
+	Category: "PII",
+	IsActive: true,
+}
+
+func scoringText(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "user%d@example.com ", i)
+	}
+	return b.String()
+}
+
+func detectEmails(ctx context.Context, text string) models.DetectResponse {
+	return guardrails.TestDetectWithPatternsForUnit(ctx, models.DetectRequest{Text: text, Mode: "DETECT"}, []models.Pattern{scoringEmailPattern})
+}
+
+func TestAIScoring_FansOutAcrossCandidates(t *testing.T) {
+	judge := &countingJudge{reply: "0.9", release: make(chan struct{})}
+	withAICache(t, judge, 100)
+	config.AppConfig.AIScoringConcurrency = 4
+
+	// The judge answers only once four calls are in flight at the same time
+	go func() {
+		deadline := time.Now().Add(2 * time.Second)
+		for judge.calls.Load() < 4 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		close(judge.release)
+	}()
+
+	resp := detectEmails(context.Background(), scoringText(6))
+	if len(resp.Detections) != 6 {
+		t.Fatalf("expected 6 detections, got %d", len(resp.Detections))
+	}
+	for _, d := range resp.Detections {
+		e := d.ConfidenceExplanation
+		if !e.HybridApplied || e.AIScore != 0.9 || e.AIFallback != "" {
+			t.Fatalf("expected a hybrid score for %s, got %+v", d.Value, e)
+		}
+		if want := models.Confidence(guardrails.TestRoundConfidenceForUnit((float64(e.RegexScore) + 0.9) / 2)); d.ConfidenceScore != want {
+			t.Fatalf("expected fused score %v, got %v", want, d.ConfidenceScore)
+		}
+	}
+	if calls := judge.calls.Load(); calls != 6 {
+		t.Fatalf("expected one judge call per candidate, got %d", calls)
+	}
+}
+
+func TestAIScoring_BudgetFallsBackToRegex(t *testing.T) {
+	judge := &countingJudge{reply: "0.9", release: make(chan struct{})} // never answers
+	withAICache(t, judge, 100)
+	config.AppConfig.AIScoringBudgetMs = 50
+
+	start := time.Now()
+	resp := detectEmails(context.Background(), scoringText(20))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected detection to stop at the budget, took %s", elapsed)
+	}
+	if len(resp.Detections) != 20 {
+		t.Fatalf("expected 20 detections, got %d", len(resp.Detections))
+	}
+	for _, d := range resp.Detections {
+		e := d.ConfidenceExplanation
+		if e.HybridApplied || e.AIFallback != guardrails.AIFallbackBudgetExceeded {
+			t.Fatalf("expected a budget fallback, got %+v", e)
+		}
+		if d.ConfidenceScore != e.RegexScore || e.FinalScore != e.RegexScore {
+			t.Fatalf("expected the regex-only score, got %v (regex %v)", d.ConfidenceScore, e.RegexScore)
+		}
+	}
+}
+
+func TestAIScoring_CachedScoresOutliveBudget(t *testing.T) {
+	judge := &countingJudge{reply: "0.2"}
+	withAICache(t, judge, 100)
+	ai.SetCachedConfidence("EMAIL", "user0@example.com", 0.8, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resp := detectEmails(ctx, scoringText(2))
+
+	scored, skipped := resp.Detections[0].ConfidenceExplanation, resp.Detections[1].ConfidenceExplanation
+	if !scored.HybridApplied || scored.AIScore != 0.8 {
+		t.Fatalf("expected the cached score to apply, got %+v", scored)
+	}
+	if skipped.HybridApplied || skipped.AIFallback != guardrails.AIFallbackCanceled {
+		t.Fatalf("expected the uncached candidate to fall back, got %+v", skipped)
+	}
+	if judge.calls.Load() != 0 {
+		t.Fatalf("a spent budget must not call the judge")
+	}
+}
+
+func TestAIScoring_ErrorsKeepRegexScoreWithFallbackReason(t *testing.T) {
+	withAICache(t, &countingJudge{reply: "not a number"}, 100)
+
+	resp := detectEmails(context.Background(), scoringText(1))
+	e := resp.Detections[0].ConfidenceExplanation
+	if e.HybridApplied || e.AIFallback != guardrails.AIFallbackError || resp.Detections[0].ConfidenceScore != e.RegexScore {
+		t.Fatalf("expected a regex score with an AI_ERROR fallback, got %+v", e)
+	}
+}
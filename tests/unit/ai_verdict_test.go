@@ -0,0 +1,166 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/models"
+)
+
+// scriptedJudge answers successive calls with the given replies (repeating the last)
+// and records every request
+type scriptedJudge struct {
+	replies  []string
+	requests []ai.ChatRequest
+}
+
+func (j *scriptedJudge) Name() string            { return "scripted" }
+func (j *scriptedJudge) SupportsStreaming() bool { return false }
+
+func (j *scriptedJudge) Chat(ctx context.Context, req ai.ChatRequest) (*ai.ChatResponse, error) {
+	j.requests = append(j.requests, req)
+	reply := j.replies[len(j.replies)-1]
+	if len(j.requests) <= len(j.replies) {
+		reply = j.replies[len(j.requests)-1]
+	}
+	return &ai.ChatResponse{Choices: []ai.ChatChoice{{Message: ai.ChatMessage{Role: "assistant", Content: reply}}}}, nil
+}
+
+func (j *scriptedJudge) ChatStream(ctx context.Context, req ai.ChatRequest) (<-chan ai.StreamEvent, <-chan error) {
+	events := make(chan ai.StreamEvent)
+	errs := make(chan error, 1)
+	close(events)
+	errs <- ai.ErrStreamingNotSupported
+	close(errs)
+	return events, errs
+}
+
+func withScriptedJudge(t *testing.T, retries int, replies ...string) *scriptedJudge {
+	t.Helper()
+	judge := &scriptedJudge{replies: replies}
+	withAICache(t, judge, 0)
+	config.AppConfig.AIVerdictMaxRetries = retries
+	config.AppConfig.Features.SemanticAnalysisEnabled = true
+	return judge
+}
+
+func TestJudgeVerdict_ParsesStructuredReplies(t *testing.T) {
+	cases := []struct {
+		reply string
+		want  ai.Verdict
+	}{
+		{`{"label":"safe","score":0.93,"rationale":"Benign greeting.","categories":[]}`, ai.Verdict{Label: "SAFE", Rationale: "Benign greeting."}},
+		{"```json\n{\"label\": \"UNSAFE\", \"score\": \"0.8\", \"rationale\": \"Insult\", \"categories\": [\"TOXICITY\"]}\n```", ai.Verdict{Label: "UNSAFE", Rationale: "Insult", Categories: []string{"TOXICITY"}}},
+		{`Sure! {"label": true, "score": 1, "rationale": "ok", "categories": []}`, ai.Verdict{Label: "YES", Rationale: "ok"}},
+		{"No.", ai.Verdict{Label: "NO"}},
+	}
+	for _, c := range cases {
+		reply, want := c.reply, c.want
+		withScriptedJudge(t, 0, reply)
+		v, err := ai.JudgeVerdict(context.Background(), "hello", "Is this safe? {{TEXT}}")
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", reply, err)
+		}
+		if v.Label != want.Label || v.Rationale != want.Rationale || strings.Join(v.Categories, ",") != strings.Join(want.Categories, ",") {
+			t.Fatalf("%q: expected %+v, got %+v", reply, want, v)
+		}
+	}
+}
+
+func TestJudgeVerdict_MatchesWholeLabel(t *testing.T) {
+	withScriptedJudge(t, 0, "YESTERDAY")
+	v, err := ai.JudgeVerdict(context.Background(), "hello", "Respond YES if ok")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.Matches("YES") {
+		t.Fatalf("YESTERDAY must not match YES")
+	}
+	if !(&ai.Verdict{Label: "YES"}).Matches("") || !(&ai.Verdict{Label: "SAFE"}).Matches(" safe ") {
+		t.Fatalf("expected whole labels to match case-insensitively, defaulting to YES")
+	}
+}
+
+func TestJudgeVerdict_RetriesMalformedReplies(t *testing.T) {
+	judge := withScriptedJudge(t, 2, "I think this looks fine to me.", `{"label":"SAFE","score":1.7}`, `{"label":"SAFE","score":0.9,"rationale":"fine","categories":[]}`)
+
+	v, err := ai.JudgeVerdict(context.Background(), "hello", "Is this safe?")
+	if err != nil || v.Label != "SAFE" || v.Score == nil || *v.Score != 0.9 {
+		t.Fatalf("expected the third reply's verdict, got %+v %v", v, err)
+	}
+	if len(judge.requests) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(judge.requests))
+	}
+	// Each retry carries the malformed reply and what was wrong with it
+	retry := judge.requests[2].Messages
+	if len(retry) != 5 || retry[3].Role != "assistant" || !strings.Contains(retry[4].Content, "outside [0, 1]") {
+		t.Fatalf("unexpected retry conversation: %+v", retry)
+	}
+}
+
+func TestJudgeVerdict_GivesUpAfterRetries(t *testing.T) {
+	judge := withScriptedJudge(t, 1, "maybe, hard to say")
+
+	if _, err := ai.JudgeVerdict(context.Background(), "hello", "Is this safe?"); !errors.Is(err, ai.ErrMalformedVerdict) {
+		t.Fatalf("expected a malformed verdict error, got %v", err)
+	}
+	if len(judge.requests) != 2 {
+		t.Fatalf("expected 1 retry, got %d attempts", len(judge.requests))
+	}
+}
+
+func TestJudgeVerdict_RequestsJSONSchemaFromOpenAICompatibleJudges(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"choices":[{"message":{"role":"assistant","content":"{\"label\":\"SAFE\",\"score\":0.9,\"rationale\":\"ok\",\"categories\":[]}"}}]}`)
+	}))
+	defer server.Close()
+
+	withAICache(t, ai.NewOpenAIProvider(ai.OpenAIConfig{BaseURL: server.URL, Model: "judge"}), 0)
+	config.AppConfig.AIJudgeJSONSchema = true
+	if _, err := ai.JudgeVerdict(context.Background(), "hello", "Is this safe?"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	format, _ := body["response_format"].(map[string]interface{})
+	if format["type"] != "json_schema" {
+		t.Fatalf("expected a json_schema response format, got %v", body["response_format"])
+	}
+
+	// Other providers rely on the prompt alone
+	judge := withScriptedJudge(t, 0, "SAFE")
+	config.AppConfig.AIJudgeJSONSchema = true
+	_, _ = ai.JudgeVerdict(context.Background(), "hello", "Is this safe?")
+	if judge.requests[0].Extra != nil {
+		t.Fatalf("expected no response format for a non-OpenAI judge, got %v", judge.requests[0].Extra)
+	}
+}
+
+func TestAIPromptValidator_UsesVerdict(t *testing.T) {
+	withScriptedJudge(t, 0, `{"label":"UNSAFE","score":0.97,"rationale":"Contains a threat.","categories":["VIOLENCE"]}`)
+	validator := models.FormatValidator{Name: "TOXICITY", Type: "AI_PROMPT", Rule: "Answer SAFE or UNSAFE: {{TEXT}}", ExpectedResponse: "SAFE"}
+
+	valid, _, verdict, confidence, err := guardrails.TestRunValidatorForUnit("I will hurt you", validator, nil)
+	if err != nil || valid {
+		t.Fatalf("expected the validator to fail, got %v %v", valid, err)
+	}
+	if confidence != 0.97 || verdict.Rationale != "Contains a threat." || verdict.Categories[0] != "VIOLENCE" {
+		t.Fatalf("expected the judge's score and rationale, got %v %+v", confidence, verdict)
+	}
+
+	// Without a score, the fixed confidence of the outcome applies
+	withScriptedJudge(t, 0, "SAFE")
+	if valid, _, _, confidence, _ = guardrails.TestRunValidatorForUnit("hello", validator, nil); !valid || confidence != 0.7 {
+		t.Fatalf("expected a pass with the default confidence, got %v %v", valid, confidence)
+	}
+}
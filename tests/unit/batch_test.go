@@ -0,0 +1,174 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tszclient "github.com/thyrisAI/safe-zone/pkg/tszclient-go"
+
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/handlers"
+	"thyris-sz/internal/models"
+)
+
+func TestValidateDetectRequest(t *testing.T) {
+	if err := guardrails.ValidateDetectRequest(models.DetectRequest{Text: "hello", Mode: "MASK"}); err != nil {
+		t.Fatalf("expected valid request, got %v", err)
+	}
+	if err := guardrails.ValidateDetectRequest(models.DetectRequest{}); err != guardrails.ErrTextRequired {
+		t.Fatalf("expected ErrTextRequired, got %v", err)
+	}
+	if err := guardrails.ValidateDetectRequest(models.DetectRequest{Text: "x", Mode: "SHRED"}); err != guardrails.ErrInvalidMode {
+		t.Fatalf("expected ErrInvalidMode, got %v", err)
+	}
+}
+
+// TestDetectBatch_Client verifies that DetectBatch posts all items in one call
+// and decodes per-item responses and errors.
+func TestDetectBatch_Client(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/detect/batch" || r.Method != http.MethodPost {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+
+		var body struct {
+			Items []tszclient.DetectRequest `json:"items"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode request body: %v", err)
+		}
+		if len(body.Items) != 2 || body.Items[0].RID != "etl-1" {
+			t.Fatalf("unexpected items: %+v", body.Items)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]interface{}{
+				{"index": 0, "response": map[string]interface{}{"redacted_text": "mail [EMAIL]", "contains_pii": true}},
+				{"index": 1, "error": "Text field is required"},
+			},
+			"failed": 1,
+		})
+	}))
+	defer server.Close()
+
+	client, err := tszclient.New(tszclient.Config{BaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	resp, err := client.DetectBatch(context.Background(), []tszclient.DetectRequest{
+		{Text: "mail john@example.com", RID: "etl-1"},
+		{Text: ""},
+	})
+	if err != nil {
+		t.Fatalf("DetectBatch returned error: %v", err)
+	}
+
+	if resp.Failed != 1 || len(resp.Results) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if resp.Results[0].Response == nil || !resp.Results[0].Response.ContainsPII {
+		t.Fatalf("expected first item to carry a response, got %+v", resp.Results[0])
+	}
+	if resp.Results[1].Error == "" || resp.Results[1].Response != nil {
+		t.Fatalf("expected second item to carry an error, got %+v", resp.Results[1])
+	}
+}
+
+// TestDetectBatchHandler_OrderAndItemErrors verifies that results keep the order of
+// the items across the worker pool and that invalid items fail on their own.
+func TestDetectBatchHandler_OrderAndItemErrors(t *testing.T) {
+	pattern := models.Pattern{Name: "EMAIL", Regex: `[a-z0-9]+@example\.com`, Category: "CONTACT", IsActive: true}
+
+	var items []models.DetectRequest
+	for i := 0; i < 20; i++ {
+		switch {
+		case i%7 == 3:
+			items = append(items, models.DetectRequest{Text: ""})
+		case i%7 == 5:
+			items = append(items, models.DetectRequest{Text: "x", Mode: "SHRED"})
+		default:
+			items = append(items, models.DetectRequest{Text: fmt.Sprintf("mail user%d@example.com", i), Mode: "MASK"})
+		}
+	}
+	body, _ := json.Marshal(models.BatchDetectRequest{Items: items})
+
+	rr := httptest.NewRecorder()
+	handlers.TestDetectBatchHandlerForUnit([]models.Pattern{pattern})(rr, httptest.NewRequest(http.MethodPost, "/detect/batch", bytes.NewReader(body)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp struct {
+		Results []struct {
+			Index    int    `json:"index"`
+			Error    string `json:"error"`
+			Response *struct {
+				RedactedText string `json:"redacted_text"`
+				Detections   []struct {
+					Value string `json:"value"`
+				} `json:"detections"`
+			} `json:"response"`
+		} `json:"results"`
+		Failed int `json:"failed"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Results) != len(items) {
+		t.Fatalf("expected %d results, got %d", len(items), len(resp.Results))
+	}
+
+	failed := 0
+	for i, res := range resp.Results {
+		if res.Index != i {
+			t.Fatalf("result %d carries index %d", i, res.Index)
+		}
+		switch {
+		case i%7 == 3:
+			failed++
+			if res.Error != guardrails.ErrTextRequired.Error() || res.Response != nil {
+				t.Fatalf("item %d: expected a text-required error, got %+v", i, res)
+			}
+		case i%7 == 5:
+			failed++
+			if res.Error != guardrails.ErrInvalidMode.Error() || res.Response != nil {
+				t.Fatalf("item %d: expected an invalid-mode error, got %+v", i, res)
+			}
+		default:
+			value := fmt.Sprintf("user%d@example.com", i)
+			if res.Error != "" || res.Response == nil || len(res.Response.Detections) != 1 || res.Response.Detections[0].Value != value {
+				t.Fatalf("item %d: expected a single detection of %s, got %+v", i, value, res)
+			}
+			if strings.Contains(res.Response.RedactedText, value) {
+				t.Fatalf("item %d: expected %s to be masked, got %q", i, value, res.Response.RedactedText)
+			}
+		}
+	}
+	if resp.Failed != failed {
+		t.Fatalf("expected %d failed items, got %d", failed, resp.Failed)
+	}
+}
+
+func TestDetectBatchHandler_InvalidBodyIsJSON(t *testing.T) {
+	rr := httptest.NewRecorder()
+	handlers.TestDetectBatchHandlerForUnit(nil)(rr, httptest.NewRequest(http.MethodPost, "/detect/batch", strings.NewReader("{")))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("expected a JSON error, got Content-Type %q", ct)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body["error"] == "" {
+		t.Fatalf("expected an error field, got %v (%v)", body, err)
+	}
+}
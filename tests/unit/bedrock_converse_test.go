@@ -0,0 +1,267 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"thyris-sz/internal/ai"
+)
+
+const converseModel = "anthropic.claude-3-5-sonnet-20240620-v1:0"
+
+// converseFrame is one ConverseStream event
+type converseFrame struct {
+	eventType string
+	payload   string
+}
+
+// mockConverseUpstream serves Converse with a fixed body and ConverseStream with fixed
+// frames, and records the last request path and body
+type mockConverseUpstream struct {
+	body        string
+	frames      []converseFrame
+	lastPath    string
+	lastRequest map[string]interface{}
+}
+
+func (m *mockConverseUpstream) start(t *testing.T, converseModels ...string) *ai.BedrockProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.lastPath = r.URL.Path
+		m.lastRequest = nil
+		_ = json.NewDecoder(r.Body).Decode(&m.lastRequest)
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/converse"):
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, m.body)
+		case strings.HasSuffix(r.URL.Path, "/converse-stream"):
+			w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+			for _, f := range m.frames {
+				writeEventStreamFrame(t, w, f.eventType, []byte(f.payload))
+			}
+		default:
+			writeBedrockError(w, "unexpected operation")
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return newStubBedrockProvider(t, server.URL, converseModel, converseModels...)
+}
+
+func converseToolPayload() map[string]interface{} {
+	var payload map[string]interface{}
+	_ = json.Unmarshal([]byte(`{
+		"messages": [
+			{"role": "system", "content": "You are a weather bot."},
+			{"role": "user", "content": "Weather in Paris?"},
+			{"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}
+			]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "18C and sunny"},
+			{"role": "user", "content": [{"type": "text", "text": "And in Rome?"}]}
+		],
+		"tools": [{"type": "function", "function": {
+			"name": "get_weather",
+			"description": "Current weather for a city",
+			"parameters": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}
+		}}],
+		"tool_choice": "required",
+		"stop": ["END"],
+		"max_tokens": 256
+	}`), &payload)
+	return payload
+}
+
+func TestBedrockConverse_MapsToolsAndHistory(t *testing.T) {
+	upstream := &mockConverseUpstream{body: `{
+		"output": {"message": {"role": "assistant", "content": [
+			{"text": "Checking Rome."},
+			{"toolUse": {"toolUseId": "tooluse_2", "name": "get_weather", "input": {"city": "Rome"}}}
+		]}},
+		"stopReason": "tool_use",
+		"usage": {"inputTokens": 40, "outputTokens": 12, "totalTokens": 52},
+		"metrics": {"latencyMs": 10}
+	}`}
+	provider := upstream.start(t, "anthropic.*")
+
+	resp, err := provider.ForwardRequest(context.Background(), converseToolPayload())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, raw)
+	}
+
+	if !strings.HasSuffix(upstream.lastPath, "/converse") {
+		t.Fatalf("expected the Converse API, got %s", upstream.lastPath)
+	}
+	req, _ := json.Marshal(upstream.lastRequest)
+	for _, want := range []string{
+		`"system":[{"text":"You are a weather bot."}]`,
+		`"toolUse":{"input":{"city":"Paris"},"name":"get_weather","toolUseId":"call_1"}`,
+		`"toolResult":{"content":[{"text":"18C and sunny"}],"toolUseId":"call_1"}`,
+		`"stopSequences":["END"]`,
+		`"maxTokens":256`,
+		`"toolChoice":{"any":{}}`,
+		`"inputSchema":{"json":{"properties":{"city":{"type":"string"}},"required":["city"],"type":"object"}}`,
+	} {
+		if !strings.Contains(string(req), want) {
+			t.Fatalf("expected %s in the Converse request, got %s", want, req)
+		}
+	}
+	// The tool result and the next user message share one user turn
+	if messages := upstream.lastRequest["messages"].([]interface{}); len(messages) != 3 {
+		t.Fatalf("expected user/assistant/user turns, got %d: %s", len(messages), req)
+	}
+
+	var body struct {
+		Choices []struct {
+			Message struct {
+				Content   string `json:"content"`
+				ToolCalls []struct {
+					ID       string `json:"id"`
+					Type     string `json:"type"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage ai.ChatUsage `json:"usage"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	choice := body.Choices[0]
+	if choice.FinishReason != "tool_calls" || choice.Message.Content != "Checking Rome." {
+		t.Fatalf("unexpected choice: %s", raw)
+	}
+	call := choice.Message.ToolCalls[0]
+	if call.ID != "tooluse_2" || call.Type != "function" || call.Function.Name != "get_weather" || call.Function.Arguments != `{"city":"Rome"}` {
+		t.Fatalf("unexpected tool call: %+v", call)
+	}
+	if body.Usage.PromptTokens != 40 || body.Usage.CompletionTokens != 12 || body.Usage.TotalTokens != 52 {
+		t.Fatalf("unexpected usage: %+v", body.Usage)
+	}
+}
+
+func TestBedrockConverse_StreamsToolCalls(t *testing.T) {
+	upstream := &mockConverseUpstream{frames: []converseFrame{
+		{"messageStart", `{"role":"assistant"}`},
+		{"contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Checking "}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":0,"delta":{"text":"Rome."}}`},
+		{"contentBlockStop", `{"contentBlockIndex":0}`},
+		{"contentBlockStart", `{"contentBlockIndex":1,"start":{"toolUse":{"toolUseId":"tooluse_2","name":"get_weather"}}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"{\"city\":"}}}`},
+		{"contentBlockDelta", `{"contentBlockIndex":1,"delta":{"toolUse":{"input":"\"Rome\"}"}}}`},
+		{"contentBlockStop", `{"contentBlockIndex":1}`},
+		{"messageStop", `{"stopReason":"tool_use"}`},
+		{"metadata", `{"usage":{"inputTokens":40,"outputTokens":12,"totalTokens":52},"metrics":{"latencyMs":10}}`},
+	}}
+	provider := upstream.start(t, converseModel)
+
+	payload := converseToolPayload()
+	payload["model"] = converseModel
+	payload["stream"] = true
+	payload["stream_options"] = map[string]interface{}{"include_usage": true}
+	resp, err := provider.ForwardRequest(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.HasSuffix(upstream.lastPath, "/converse-stream") {
+		t.Fatalf("expected a ConverseStream response, got %d via %s: %s", resp.StatusCode, upstream.lastPath, raw)
+	}
+
+	var content, arguments, name, finish string
+	var usage map[string]interface{}
+	for _, line := range strings.Split(string(raw), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content   string `json:"content"`
+					ToolCalls []struct {
+						Index    int `json:"index"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage map[string]interface{} `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid chunk %s: %v", data, err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, c := range chunk.Choices {
+			content += c.Delta.Content
+			for _, tc := range c.Delta.ToolCalls {
+				if tc.Index != 0 {
+					t.Fatalf("expected tool call index 0, got %d", tc.Index)
+				}
+				name += tc.Function.Name
+				arguments += tc.Function.Arguments
+			}
+			if c.FinishReason != nil {
+				finish = *c.FinishReason
+			}
+		}
+	}
+
+	if content != "Checking Rome." || name != "get_weather" || arguments != `{"city":"Rome"}` || finish != "tool_calls" {
+		t.Fatalf("unexpected stream: content=%q name=%q arguments=%q finish=%q", content, name, arguments, finish)
+	}
+	if usage["total_tokens"] != float64(52) {
+		t.Fatalf("expected a usage chunk, got %v", usage)
+	}
+	if !strings.HasSuffix(string(raw), "data: [DONE]\n\n") {
+		t.Fatalf("expected the stream to end with [DONE]")
+	}
+}
+
+func TestBedrockConverse_ChatUsesConverseOnlyForListedModels(t *testing.T) {
+	upstream := &mockConverseUpstream{body: `{
+		"output": {"message": {"role": "assistant", "content": [{"text": "Hello there"}]}},
+		"stopReason": "max_tokens",
+		"usage": {"inputTokens": 3, "outputTokens": 2, "totalTokens": 5},
+		"metrics": {"latencyMs": 1}
+	}`}
+	provider := upstream.start(t, converseModel)
+
+	resp, err := provider.Chat(context.Background(), ai.ChatRequest{
+		Messages: []ai.ChatMessage{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "Hi"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "Hello there" || resp.Choices[0].FinishReason != "length" || resp.Usage.TotalTokens != 5 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	// Models not listed keep the InvokeModel path
+	_, err = provider.Chat(context.Background(), ai.ChatRequest{
+		Model:    "amazon.titan-text-express-v1",
+		Messages: []ai.ChatMessage{{Role: "user", Content: "Hi"}},
+	})
+	if err == nil || !strings.HasSuffix(upstream.lastPath, "/invoke") {
+		t.Fatalf("expected an InvokeModel call for an unlisted model, got %s (%v)", upstream.lastPath, err)
+	}
+}
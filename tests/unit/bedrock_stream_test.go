@@ -0,0 +1,241 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws/protocol/eventstream"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/handlers"
+)
+
+// newStubBedrockProvider returns a Bedrock provider pointed at a local stub
+func newStubBedrockProvider(t *testing.T, url, modelID string, converseModels ...string) *ai.BedrockProvider {
+	t.Helper()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	provider, err := ai.NewBedrockProvider(ai.BedrockConfig{
+		Region:           "us-east-1",
+		EndpointOverride: url,
+		ModelID:          modelID,
+		ConverseModels:   converseModels,
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	return provider
+}
+
+// writeEventStreamFrame writes one event-stream event frame with a JSON payload
+func writeEventStreamFrame(t *testing.T, w io.Writer, eventType string, payload []byte) {
+	t.Helper()
+	msg := eventstream.Message{Payload: payload}
+	msg.Headers.Set(":event-type", eventstream.StringValue(eventType))
+	msg.Headers.Set(":message-type", eventstream.StringValue("event"))
+	msg.Headers.Set(":content-type", eventstream.StringValue("application/json"))
+	var frame bytes.Buffer
+	if err := eventstream.NewEncoder().Encode(&frame, msg); err != nil {
+		t.Errorf("encode frame: %v", err)
+		return
+	}
+	_, _ = w.Write(frame.Bytes())
+}
+
+// writeBedrockError writes a Bedrock validation error
+func writeBedrockError(w http.ResponseWriter, message string) {
+	w.Header().Set("X-Amzn-Errortype", "ValidationException")
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = io.WriteString(w, `{"message":"`+message+`"}`)
+}
+
+// startBedrockStreamStub serves InvokeModelWithResponseStream with the given chunks as
+// event-stream frames and returns a Bedrock provider pointed at it
+func startBedrockStreamStub(t *testing.T, modelID string, chunks []string) *ai.BedrockProvider {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/invoke-with-response-stream") {
+			writeBedrockError(w, "unexpected operation")
+			return
+		}
+		if chunks == nil {
+			writeBedrockError(w, "model not enabled")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.amazon.eventstream")
+		for _, chunk := range chunks {
+			payload, _ := json.Marshal(map[string]string{"bytes": base64.StdEncoding.EncodeToString([]byte(chunk))})
+			writeEventStreamFrame(t, w, "chunk", payload)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return newStubBedrockProvider(t, server.URL, modelID)
+}
+
+func TestBedrockChatStream_DecodesEveryFamily(t *testing.T) {
+	tests := []struct {
+		modelID string
+		chunks  []string
+		finish  string
+	}{
+		{"anthropic.claude-3-haiku-20240307-v1:0", []string{
+			`{"type":"message_start","message":{"role":"assistant"}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"world"}}`,
+			`{"type":"message_delta","delta":{"stop_reason":"max_tokens"}}`,
+			`{"type":"message_stop"}`,
+		}, "length"},
+		{"amazon.titan-text-express-v1", []string{
+			`{"outputText":"Hello ","index":0}`,
+			`{"outputText":"world","index":0,"completionReason":"FINISH"}`,
+		}, "stop"},
+		{"meta.llama3-8b-instruct-v1:0", []string{
+			`{"generation":"Hello ","stop_reason":null}`,
+			`{"generation":"world","stop_reason":"stop"}`,
+		}, "stop"},
+		{"mistral.mistral-7b-instruct-v0:2", []string{
+			`{"outputs":[{"text":"Hello ","stop_reason":null}]}`,
+			`{"outputs":[{"text":"world","stop_reason":"length"}]}`,
+		}, "length"},
+		{"cohere.command-text-v14", []string{
+			`{"text":"Hello ","is_finished":false}`,
+			`{"text":"world","is_finished":false}`,
+			`{"is_finished":true,"finish_reason":"COMPLETE"}`,
+		}, "stop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.modelID, func(t *testing.T) {
+			provider := startBedrockStreamStub(t, tt.modelID, tt.chunks)
+			if !provider.SupportsStreaming() {
+				t.Fatalf("expected streaming support")
+			}
+
+			eventCh, errCh := provider.ChatStream(context.Background(), ai.ChatRequest{
+				Messages: []ai.ChatMessage{{Role: "user", Content: "Hi"}},
+				Stream:   true,
+			})
+
+			var content, finish string
+			var events []ai.StreamEvent
+			for event := range eventCh {
+				events = append(events, event)
+				content += event.Choices[0].Delta.Content
+				if event.Choices[0].FinishReason != nil {
+					finish = *event.Choices[0].FinishReason
+				}
+			}
+			if err := <-errCh; err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if content != "Hello world" {
+				t.Fatalf("expected %q, got %q", "Hello world", content)
+			}
+			if finish != tt.finish {
+				t.Fatalf("expected finish_reason %q, got %q", tt.finish, finish)
+			}
+			if events[0].Choices[0].Delta.Role != "assistant" || events[0].Object != "chat.completion.chunk" {
+				t.Fatalf("expected the first chunk to carry the assistant role, got %+v", events[0])
+			}
+		})
+	}
+}
+
+func TestBedrockForwardRequest_StreamsThroughOutputGuardrails(t *testing.T) {
+	withStreamConfig(t)
+
+	provider := startBedrockStreamStub(t, "anthropic.claude-3-haiku-20240307-v1:0", []string{
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Your card is 41111111"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"11111111, keep it safe and do not share it with anyone."}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"}}`,
+	})
+
+	resp, err := provider.ForwardRequest(context.Background(), map[string]interface{}{
+		"messages": []interface{}{map[string]interface{}{"role": "user", "content": "Hi"}},
+		"stream":   true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected a 200 event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	upstream, _ := io.ReadAll(resp.Body)
+	if !strings.HasSuffix(string(upstream), "data: [DONE]\n\n") {
+		t.Fatalf("expected the stream to end with [DONE], got %s", upstream)
+	}
+
+	body := handlers.TestStreamChoicesForUnit(blockingDetect, string(upstream), "halt", 1, 16)
+	contents, finishes, errored := collectChoices(t, body)
+	if errored {
+		t.Fatalf("unexpected error event: %s", body)
+	}
+	want := "Your card is [CARD], keep it safe and do not share it with anyone."
+	if contents[0] != want || finishes[0] != "stop" {
+		t.Fatalf("expected %q (stop), got %q (%q)", want, contents[0], finishes[0])
+	}
+}
+
+func TestBedrockForwardRequest_StreamInvokeErrorIsBadGateway(t *testing.T) {
+	provider := startBedrockStreamStub(t, "anthropic.claude-3-haiku-20240307-v1:0", nil)
+
+	resp, err := provider.ForwardRequest(context.Background(), map[string]interface{}{
+		"messages": []interface{}{map[string]interface{}{"role": "user", "content": "Hi"}},
+		"stream":   true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(body), "bedrock_error") {
+		t.Fatalf("expected a 502 bedrock_error, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestChatGateway_StreamsBedrockResponseInEveryMode(t *testing.T) {
+	withStreamConfig(t)
+	originalProvider := ai.GetProvider()
+	t.Cleanup(func() { ai.SetProvider(originalProvider) })
+
+	ai.SetProvider(startBedrockStreamStub(t, "anthropic.claude-3-haiku-20240307-v1:0", []string{
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Your card is 41111111"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"11111111, keep it safe."}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"}}`,
+	}))
+	handler := handlers.TestChatGatewayForUnit(blockingDetect)
+
+	for _, mode := range []string{"final-only", "stream-sync", "stream-async"} {
+		t.Run(mode, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"messages": [{"role": "user", "content": "Hi"}], "stream": true}`))
+			req.Header.Set("X-TSZ-Guardrails", "PII")
+			req.Header.Set("X-TSZ-Guardrails-Mode", mode)
+			rec := httptest.NewRecorder()
+
+			handler(rec, req)
+
+			body := rec.Body.String()
+			if rec.Code != http.StatusOK || !strings.Contains(body, "data: [DONE]") {
+				t.Fatalf("expected a completed 200 event stream, got %d: %s", rec.Code, body)
+			}
+			if mode != "stream-sync" {
+				return
+			}
+			contents, finishes, _ := collectChoices(t, body)
+			if contents[0] != "Your card is [CARD], keep it safe." || finishes[0] != "stop" {
+				t.Fatalf("expected the card number to be masked, got %q (%q)", contents[0], finishes[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package unit
+
+import (
+	"testing"
+
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/models"
+)
+
+func TestBlocklistScan_MatchOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		item  models.BlacklistItem
+		text  string
+		spans [][2]int
+	}{
+		{"literal substring is case-sensitive by default", models.BlacklistItem{Value: "secret"}, "Secret secret", [][2]int{{7, 13}}},
+		{"case-insensitive", models.BlacklistItem{Value: "secret", CaseInsensitive: true}, "SECRET and Secret", [][2]int{{0, 6}, {11, 17}}},
+		{"substring matches inside words", models.BlacklistItem{Value: "cunt"}, "Scunthorpe", [][2]int{{1, 5}}},
+		{"whole word skips embedded matches", models.BlacklistItem{Value: "cunt", WholeWord: true}, "Scunthorpe", nil},
+		{"whole word at punctuation", models.BlacklistItem{Value: "acme", WholeWord: true}, "(acme), acmes", [][2]int{{1, 5}}},
+		{"normalize full-width letters", models.BlacklistItem{Value: "acme", Normalize: true}, "ａｃｍｅ corp", [][2]int{{0, 12}}},
+		{"full-width ignored without normalize", models.BlacklistItem{Value: "acme"}, "ａｃｍｅ corp", nil},
+		{"regex", models.BlacklistItem{Value: `proj-\d+`, MatchType: "REGEX", CaseInsensitive: true}, "see PROJ-42", [][2]int{{4, 11}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := guardrails.TestBlocklistScanForUnit([]models.BlacklistItem{tt.item}, tt.text)
+			if len(got) != len(tt.spans) {
+				t.Fatalf("expected %d matches, got %d: %+v", len(tt.spans), len(got), got)
+			}
+			for i, d := range got {
+				if d.Start != tt.spans[i][0] || d.End != tt.spans[i][1] {
+					t.Errorf("match %d: expected [%d,%d), got [%d,%d)", i, tt.spans[i][0], tt.spans[i][1], d.Start, d.End)
+				}
+				if d.Value != tt.text[d.Start:d.End] || d.Placeholder != "[BLOCKED]" {
+					t.Errorf("unexpected detection %+v", d)
+				}
+			}
+		})
+	}
+}
+
+func TestBlocklistScan_ManyTermsSinglePass(t *testing.T) {
+	items := []models.BlacklistItem{
+		{Value: "he"}, {Value: "she"}, {Value: "his"}, {Value: "hers"},
+	}
+
+	got := guardrails.TestBlocklistScanForUnit(items, "ushers")
+	want := map[string]bool{"she": true, "he": true, "hers": true}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d overlapping matches, got %+v", len(want), got)
+	}
+	for _, d := range got {
+		if !want[d.Value] {
+			t.Errorf("unexpected match %q", d.Value)
+		}
+	}
+}
+
+func TestValidateBlacklistItem(t *testing.T) {
+	item := models.BlacklistItem{Value: "acme"}
+	if err := guardrails.ValidateBlacklistItem(&item); err != nil || item.MatchType != "LITERAL" {
+		t.Fatalf("expected LITERAL default, got %q (err %v)", item.MatchType, err)
+	}
+
+	bad := models.BlacklistItem{Value: "(", MatchType: "regex"}
+	if err := guardrails.ValidateBlacklistItem(&bad); err == nil {
+		t.Fatal("expected invalid regex to be rejected")
+	}
+
+	unknown := models.BlacklistItem{Value: "acme", MatchType: "FUZZY"}
+	if err := guardrails.ValidateBlacklistItem(&unknown); err == nil {
+		t.Fatal("expected unknown match type to be rejected")
+	}
+}
@@ -135,40 +135,43 @@ func TestCacheOperations_Allowlist(t *testing.T) {
 	}
 }
 
-func TestCacheOperations_Blocklist(t *testing.T) {
+func TestCacheOperations_BlocklistRules(t *testing.T) {
 	defer func() {
 		if r := recover(); r != nil {
 			t.Logf("Cache operation panicked (Redis might not be available): %v", r)
 		}
 	}()
 
-	testBlocklist := map[string]bool{
-		"blocked@spam.com":    true,
-		"malicious@evil.org":  true,
-		"banned@blackhat.net": true,
+	testItems := []models.BlacklistItem{
+		{Value: "blocked@spam.com", MatchType: "LITERAL"},
+		{Value: "malicious@evil.org", MatchType: "LITERAL", CaseInsensitive: true},
+		{Value: `banned-\d+`, MatchType: "REGEX"},
 	}
 
-	// Test setting blocklist
-	err := cache.SetBlocklist(testBlocklist)
+	// Test setting blocklist rules
+	version, err := cache.SetBlocklistRules(testItems)
 	if err != nil {
-		t.Logf("SetBlocklist failed (Redis might not be available): %v", err)
+		t.Logf("SetBlocklistRules failed (Redis might not be available): %v", err)
 		return
 	}
 
-	// Test getting blocklist
-	retrievedBlocklist, err := cache.GetBlocklist()
+	// Test getting blocklist rules
+	retrieved, retrievedVersion, err := cache.GetBlocklistRules()
 	if err != nil {
-		t.Logf("GetBlocklist failed: %v", err)
+		t.Logf("GetBlocklistRules failed: %v", err)
 		return
 	}
 
-	if len(retrievedBlocklist) != len(testBlocklist) {
-		t.Fatalf("Expected %d blocklist items, got %d", len(testBlocklist), len(retrievedBlocklist))
+	if retrievedVersion != version {
+		t.Fatalf("Expected version %q, got %q", version, retrievedVersion)
 	}
-
-	for key, value := range testBlocklist {
-		if retrievedBlocklist[key] != value {
-			t.Fatalf("Expected blocklist[%s] = %v, got %v", key, value, retrievedBlocklist[key])
+	if len(retrieved) != len(testItems) {
+		t.Fatalf("Expected %d blocklist items, got %d", len(testItems), len(retrieved))
+	}
+	for i, item := range testItems {
+		got := retrieved[i]
+		if got.Value != item.Value || got.MatchType != item.MatchType || got.CaseInsensitive != item.CaseInsensitive {
+			t.Fatalf("Expected blocklist item %d = %+v, got %+v", i, item, got)
 		}
 	}
 }
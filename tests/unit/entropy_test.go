@@ -0,0 +1,69 @@
+package unit
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/models"
+)
+
+const (
+	randomKey = "q8Zr2LmX7vT4pN9cW1sK5yB3hF6dJ0gA" // 32 chars, base64-like
+	randomHex = "9f86d081884c7d659a2feaa0c55ad015"
+)
+
+func TestShannonEntropy(t *testing.T) {
+	if got := guardrails.TestShannonEntropyForUnit("aaaaaaaa"); got != 0 {
+		t.Fatalf("expected 0 bits for a repeated char, got %v", got)
+	}
+	if got := guardrails.TestShannonEntropyForUnit("abcd"); math.Abs(got-2) > 1e-9 {
+		t.Fatalf("expected 2 bits for 4 distinct chars, got %v", got)
+	}
+}
+
+func TestScanEntropy_FlagsRandomTokens(t *testing.T) {
+	text := "digest " + randomHex + strings.Repeat(" padding", 8) + " export TOKEN=" + randomKey
+	got := guardrails.TestScanEntropyForUnit(text, 20, 3.0, 4.0, []string{"token"}, false, nil)
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entropy detections, got %+v", got)
+	}
+
+	digest, key := got[0], got[1]
+	if key.Type != guardrails.EntropySecretType || key.Value != randomKey || text[key.Start:key.End] != randomKey {
+		t.Fatalf("unexpected detection: %+v", key)
+	}
+	e := key.ConfidenceExplanation
+	if e == nil || e.Source != "ENTROPY" || e.Category != "SECRET" || e.EntropyCharset != "BASE64" || len(e.ContextKeywords) != 1 {
+		t.Fatalf("unexpected explanation: %+v", e)
+	}
+	if digest.ConfidenceExplanation.EntropyCharset != "HEX" {
+		t.Fatalf("expected hex charset for digest, got %+v", digest.ConfidenceExplanation)
+	}
+
+	// The keyword raises confidence over the bare digest
+	if key.ConfidenceScore <= digest.ConfidenceScore {
+		t.Fatalf("expected keyword context to score higher: %v vs %v", key.ConfidenceScore, digest.ConfidenceScore)
+	}
+}
+
+func TestScanEntropy_IgnoresLowEntropyAndWords(t *testing.T) {
+	text := "internationalization_and_localization aaaaaaaaaaaaaaaaaaaaaaaa1 github.com/thyrisAI/safe-zone/pkg/tszclient-go"
+	if got := guardrails.TestScanEntropyForUnit(text, 20, 3.0, 4.0, nil, false, nil); len(got) != 0 {
+		t.Fatalf("expected no detections, got %+v", got)
+	}
+}
+
+func TestScanEntropy_KeywordRequirementAndOverlap(t *testing.T) {
+	text := "value " + randomKey
+	if got := guardrails.TestScanEntropyForUnit(text, 20, 3.0, 4.0, []string{"secret"}, true, nil); len(got) != 0 {
+		t.Fatalf("expected token without keyword to be ignored, got %+v", got)
+	}
+
+	existing := []models.DetectionResult{{Type: "AWS_SECRET_KEY", Start: 6, End: 20}}
+	if got := guardrails.TestScanEntropyForUnit(text, 20, 3.0, 4.0, nil, false, existing); len(got) != 0 {
+		t.Fatalf("expected token overlapping a pattern match to be skipped, got %+v", got)
+	}
+}
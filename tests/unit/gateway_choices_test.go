@@ -0,0 +1,174 @@
+package unit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/handlers"
+	"thyris-sz/internal/models"
+)
+
+// sseChunk renders one upstream chat.completion.chunk for a choice
+func sseChunk(index int, content string, finish string) string {
+	choice := map[string]interface{}{"index": index, "delta": map[string]interface{}{}, "finish_reason": nil}
+	if content != "" {
+		choice["delta"] = map[string]interface{}{"content": content}
+	}
+	if finish != "" {
+		choice["finish_reason"] = finish
+	}
+	b, _ := json.Marshal(map[string]interface{}{
+		"id":      "chatcmpl-1",
+		"object":  "chat.completion.chunk",
+		"model":   "test",
+		"choices": []interface{}{choice},
+	})
+	return "data: " + string(b) + "\n\n"
+}
+
+// interleavedStream streams each text as choice i, one word per chunk, round-robin
+func interleavedStream(texts []string) string {
+	var b strings.Builder
+	words := make([][]string, len(texts))
+	for i, t := range texts {
+		words[i] = strings.SplitAfter(t, " ")
+	}
+	for step := 0; ; step++ {
+		more := false
+		for i := range words {
+			if step < len(words[i]) {
+				b.WriteString(sseChunk(i, words[i][step], ""))
+				more = true
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	for i := range texts {
+		b.WriteString(sseChunk(i, "", "stop"))
+	}
+	b.WriteString("data: [DONE]\n\n")
+	return b.String()
+}
+
+// collectChoices reassembles the client stream per choice index
+func collectChoices(t *testing.T, body string) (map[int]string, map[int]string, bool) {
+	t.Helper()
+	contents := make(map[int]string)
+	finishes := make(map[int]string)
+	errored := false
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, "data: ") || line == "data: [DONE]" {
+			continue
+		}
+		var event struct {
+			Error   map[string]interface{} `json:"error"`
+			Choices []struct {
+				Index        int               `json:"index"`
+				Delta        map[string]string `json:"delta"`
+				FinishReason *string           `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		if event.Error != nil {
+			errored = true
+		}
+		for _, c := range event.Choices {
+			contents[c.Index] += c.Delta["content"]
+			if c.FinishReason != nil {
+				if prev, ok := finishes[c.Index]; ok {
+					t.Fatalf("choice %d finished twice (%s, %s)", c.Index, prev, *c.FinishReason)
+				}
+				finishes[c.Index] = *c.FinishReason
+			}
+		}
+	}
+	return contents, finishes, errored
+}
+
+// blockingDetect masks digit runs like fakeCardDetect and blocks text containing "forbidden"
+func blockingDetect(req models.DetectRequest) models.DetectResponse {
+	scanned := 0
+	resp := fakeCardDetect(&scanned)(req)
+	if strings.Contains(req.Text, "forbidden") {
+		resp.Blocked = true
+		resp.Message = "Content blocked by security policy: TOXIC_LANGUAGE"
+	}
+	return resp
+}
+
+func withStreamConfig(t *testing.T) {
+	t.Helper()
+	original := config.AppConfig
+	config.AppConfig = &config.Config{StreamFailMode: "LENIENT"}
+	t.Cleanup(func() { config.AppConfig = original })
+}
+
+func TestStreamSync_GuardsEveryChoice(t *testing.T) {
+	withStreamConfig(t)
+
+	var texts []string
+	for i := 0; i < 4; i++ {
+		texts = append(texts, fmt.Sprintf("Sample %d uses card 411111111111111%d in the reply and nothing else of note here.", i, i))
+	}
+
+	body := handlers.TestStreamChoicesForUnit(blockingDetect, interleavedStream(texts), "halt", 4, 16)
+	contents, finishes, errored := collectChoices(t, body)
+	if errored {
+		t.Fatalf("unexpected error event: %s", body)
+	}
+	for i, text := range texts {
+		want := fakeCardRe.ReplaceAllString(text, "[CARD]")
+		if contents[i] != want {
+			t.Fatalf("choice %d:\n got: %q\nwant: %q", i, contents[i], want)
+		}
+		if finishes[i] != "stop" {
+			t.Fatalf("choice %d: expected finish_reason stop, got %q", i, finishes[i])
+		}
+	}
+}
+
+func TestStreamSync_HaltsOnlyTheBlockedChoice(t *testing.T) {
+	withStreamConfig(t)
+
+	texts := []string{
+		"A perfectly fine answer that goes on for a while without any trouble at all.",
+		"This answer contains forbidden words and must never reach the client in full.",
+	}
+	body := handlers.TestStreamChoicesForUnit(blockingDetect, interleavedStream(texts), "halt", 2, 16)
+	contents, finishes, errored := collectChoices(t, body)
+	if errored {
+		t.Fatalf("expected the stream to continue for the other choice: %s", body)
+	}
+	if contents[0] != texts[0] || finishes[0] != "stop" {
+		t.Fatalf("expected choice 0 to complete, got %q (%q)", contents[0], finishes[0])
+	}
+	if finishes[1] != "content_filter" {
+		t.Fatalf("expected choice 1 to finish with content_filter, got %q", finishes[1])
+	}
+	if strings.Contains(contents[1], "forbidden") {
+		t.Fatalf("blocked text leaked: %q", contents[1])
+	}
+	if !strings.Contains(body, "tsz_output_blocked") {
+		t.Fatalf("expected the halted choice to carry tsz_error")
+	}
+}
+
+func TestStreamSync_HaltsStreamWhenAllChoicesBlocked(t *testing.T) {
+	withStreamConfig(t)
+
+	texts := []string{"Only forbidden content is produced by this single sampled choice here."}
+	body := handlers.TestStreamChoicesForUnit(blockingDetect, interleavedStream(texts), "halt", 1, 16)
+	if _, _, errored := collectChoices(t, body); !errored {
+		t.Fatalf("expected an error event, got %s", body)
+	}
+	if !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Fatalf("expected the stream to end with [DONE]")
+	}
+}
@@ -0,0 +1,113 @@
+package unit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"thyris-sz/internal/handlers"
+)
+
+const multimodalMessages = `[
+	{"role": "system", "content": [{"type": "image_url", "image_url": {"url": "https://example.com/logo.png"}}]},
+	{"role": "user", "content": [
+		{"type": "text", "text": "What is in this picture?"},
+		{"type": "image_url", "image_url": {"url": "data:image/png;base64,iVBORw0KGgo="}}
+	]},
+	{"role": "user", "content": [{"type": "input_audio", "input_audio": {"data": "UklGRg==", "format": "wav"}}]}
+]`
+
+func decodeMessages(t *testing.T) []interface{} {
+	t.Helper()
+	var messages []interface{}
+	if err := json.Unmarshal([]byte(multimodalMessages), &messages); err != nil {
+		t.Fatalf("failed to decode messages: %v", err)
+	}
+	return messages
+}
+
+func TestNonTextPartPolicy_Allow(t *testing.T) {
+	messages := decodeMessages(t)
+	if err := handlers.TestApplyNonTextPartPolicyForUnit(messages, handlers.NonTextPartsAllow); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parts := messages[1].(map[string]interface{})["content"].([]interface{})
+	if len(parts) != 2 {
+		t.Fatalf("expected parts to be kept, got %d", len(parts))
+	}
+}
+
+func TestNonTextPartPolicy_Strip(t *testing.T) {
+	messages := decodeMessages(t)
+	if err := handlers.TestApplyNonTextPartPolicyForUnit(messages, handlers.NonTextPartsStrip); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parts := messages[1].(map[string]interface{})["content"].([]interface{})
+	if len(parts) != 1 || parts[0].(map[string]interface{})["type"] != "text" {
+		t.Fatalf("expected only the text part to remain, got %+v", parts)
+	}
+	if content := messages[2].(map[string]interface{})["content"]; content != "" {
+		t.Fatalf("expected empty content for a message without text parts, got %+v", content)
+	}
+	// Non-user messages are not under input guardrails
+	if sys := messages[0].(map[string]interface{})["content"].([]interface{}); len(sys) != 1 {
+		t.Fatalf("expected system message to be untouched, got %+v", sys)
+	}
+}
+
+func TestNonTextPartPolicy_Reject(t *testing.T) {
+	messages := decodeMessages(t)
+	if err := handlers.TestApplyNonTextPartPolicyForUnit(messages, handlers.NonTextPartsReject); err == nil {
+		t.Fatalf("expected non-text part to be rejected")
+	}
+
+	textOnly := []interface{}{map[string]interface{}{
+		"role":    "user",
+		"content": []interface{}{map[string]interface{}{"type": "text", "text": "hello"}},
+	}}
+	if err := handlers.TestApplyNonTextPartPolicyForUnit(textOnly, handlers.NonTextPartsReject); err != nil {
+		t.Fatalf("expected text-only message to pass, got %v", err)
+	}
+}
+
+func TestApplyInputGuardrails_MasksTextParts(t *testing.T) {
+	var messages []interface{}
+	_ = json.Unmarshal([]byte(`[
+		{"role": "user", "content": [
+			{"type": "text", "text": "my card is 4111111111111111"},
+			{"type": "image_url", "image_url": {"url": "https://example.com/a.png"}},
+			{"type": "text", "text": "and 5500000000000004 too"}
+		]}
+	]`), &messages)
+
+	out, blocked, responses := handlers.TestApplyInputGuardrailsForUnit(messagesDetect, messages, nil, 0)
+	if blocked {
+		t.Fatalf("did not expect the request to be blocked")
+	}
+	if len(responses) != 2 {
+		t.Fatalf("expected both text parts to be scanned, got %d scans", len(responses))
+	}
+
+	parts := out[0].(map[string]interface{})["content"].([]interface{})
+	if got := parts[0].(map[string]interface{})["text"]; got != "my card is [CARD]" {
+		t.Fatalf("expected the first text part to be masked, got %q", got)
+	}
+	if got := parts[2].(map[string]interface{})["text"]; got != "and [CARD] too" {
+		t.Fatalf("expected the second text part to be masked, got %q", got)
+	}
+	if parts[1].(map[string]interface{})["type"] != "image_url" {
+		t.Fatalf("expected the image part to stay in place, got %v", parts[1])
+	}
+}
+
+func TestApplyInputGuardrails_BlocksTextParts(t *testing.T) {
+	var messages []interface{}
+	_ = json.Unmarshal([]byte(`[
+		{"role": "user", "content": [{"type": "text", "text": "something forbidden"}]}
+	]`), &messages)
+
+	_, blocked, _ := handlers.TestApplyInputGuardrailsForUnit(messagesDetect, messages, nil, 0)
+	if !blocked {
+		t.Fatalf("expected a blocked text part to block the request")
+	}
+}
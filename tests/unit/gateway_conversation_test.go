@@ -0,0 +1,162 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"thyris-sz/internal/handlers"
+	"thyris-sz/internal/models"
+)
+
+func TestGatewayScanScope_Defaults(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	roles, window := handlers.TestExtractGatewayScanScopeForUnit(r, nil, 0)
+	if !reflect.DeepEqual(roles, map[string]bool{"user": true}) {
+		t.Fatalf("expected default role user, got %v", roles)
+	}
+	if window != 0 {
+		t.Fatalf("expected window disabled by default, got %d", window)
+	}
+}
+
+func TestGatewayScanScope_ConfigAndHeaders(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	roles, window := handlers.TestExtractGatewayScanScopeForUnit(r, []string{"System", "user", "narrator"}, 4)
+	if !reflect.DeepEqual(roles, map[string]bool{"system": true, "user": true}) {
+		t.Fatalf("expected configured roles without unknown ones, got %v", roles)
+	}
+	if window != 4 {
+		t.Fatalf("expected configured window 4, got %d", window)
+	}
+
+	r.Header.Set("X-TSZ-Scan-Roles", "assistant, developer")
+	r.Header.Set("X-TSZ-Conversation-Window", "8")
+	roles, window = handlers.TestExtractGatewayScanScopeForUnit(r, []string{"user"}, 4)
+	if !reflect.DeepEqual(roles, map[string]bool{"user": true, "assistant": true, "developer": true}) {
+		t.Fatalf("expected header roles to be added to the configured ones, got %v", roles)
+	}
+	if window != 8 {
+		t.Fatalf("expected header to raise the window to 8, got %d", window)
+	}
+}
+
+func TestGatewayScanScope_HeadersCannotNarrow(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	r.Header.Set("X-TSZ-Scan-Roles", "assistant")
+	r.Header.Set("X-TSZ-Conversation-Window", "0")
+
+	roles, window := handlers.TestExtractGatewayScanScopeForUnit(r, nil, 4)
+	if !reflect.DeepEqual(roles, map[string]bool{"user": true, "assistant": true}) {
+		t.Fatalf("expected default roles to stay scanned, got %v", roles)
+	}
+	if window != 4 {
+		t.Fatalf("expected the configured window to be a minimum, got %d", window)
+	}
+
+	r.Header.Set("X-TSZ-Scan-Roles", "narrator")
+	r.Header.Set("X-TSZ-Conversation-Window", "-3")
+	roles, window = handlers.TestExtractGatewayScanScopeForUnit(r, []string{"system"}, 0)
+	if !reflect.DeepEqual(roles, map[string]bool{"system": true}) || window != 0 {
+		t.Fatalf("expected invalid headers to be ignored, got %v and window %d", roles, window)
+	}
+}
+
+func TestConversationSegments(t *testing.T) {
+	var messages []interface{}
+	body := `[
+		{"role": "system", "content": "You are helpful"},
+		{"role": "user", "content": "my card is 4111 1111"},
+		{"role": "assistant", "content": "go on"},
+		{"role": "user", "content": [
+			{"type": "text", "text": "1111 1111"},
+			{"type": "image_url", "image_url": {"url": "https://example.com/a.png"}},
+			{"type": "text", "text": "thanks"}
+		]}
+	]`
+	if err := json.Unmarshal([]byte(body), &messages); err != nil {
+		t.Fatalf("failed to decode messages: %v", err)
+	}
+
+	paths, texts := handlers.TestConversationSegmentsForUnit(messages, []string{"user"}, 2)
+	wantPaths := []string{"$.messages[1].content", "$.messages[3].content[0].text", "$.messages[3].content[2].text"}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Fatalf("unexpected segment paths: %v", paths)
+	}
+	if texts[0] != "my card is 4111 1111" || texts[1] != "1111 1111" {
+		t.Fatalf("unexpected segment texts: %v", texts)
+	}
+
+	// The window counts scanned messages only, most recent first
+	paths, _ = handlers.TestConversationSegmentsForUnit(messages, []string{"user", "assistant"}, 2)
+	if paths[0] != "$.messages[2].content" {
+		t.Fatalf("expected window to start at the assistant message, got %v", paths)
+	}
+}
+
+var spacedCardRe = regexp.MustCompile(`\d{4}(?: \d{4}){3}`)
+
+// spacedCardDetect finds space-separated card numbers, which can span window segments
+func spacedCardDetect(req models.DetectRequest) models.DetectResponse {
+	resp := models.DetectResponse{}
+	for _, loc := range spacedCardRe.FindAllStringIndex(req.Text, -1) {
+		resp.Detections = append(resp.Detections, models.DetectionResult{
+			Type:        "CREDIT_CARD",
+			Value:       req.Text[loc[0]:loc[1]],
+			Placeholder: "[CARD]",
+			Start:       loc[0],
+			End:         loc[1],
+		})
+	}
+	return resp
+}
+
+func TestScanConversationWindow_MasksValuesAcrossMessages(t *testing.T) {
+	var messages []interface{}
+	body := `[
+		{"role": "user", "content": "my card is 4111 1111"},
+		{"role": "assistant", "content": "go on"},
+		{"role": "user", "content": [{"type": "text", "text": "1111 1111 thanks"}]},
+		{"role": "user", "content": "also 4222 2222 2222 2222 alone"}
+	]`
+	if err := json.Unmarshal([]byte(body), &messages); err != nil {
+		t.Fatalf("failed to decode messages: %v", err)
+	}
+
+	resp := handlers.TestScanConversationWindowForUnit(spacedCardDetect, messages, []string{"user"}, 3)
+	if resp == nil || len(resp.Detections) != 1 {
+		t.Fatalf("expected only the split card number to be reported, got %+v", resp)
+	}
+	d := resp.Detections[0]
+	if d.Path != "$.messages[0].content" || d.Start != len("my card is ") || d.End != d.Start+len("4111 1111 1111 1111") {
+		t.Fatalf("expected the detection to point at the first message, got %+v", d)
+	}
+
+	if got := messages[0].(map[string]interface{})["content"]; got != "my card is [CARD]" {
+		t.Fatalf("expected the first part to become the placeholder, got %q", got)
+	}
+	parts := messages[2].(map[string]interface{})["content"].([]interface{})
+	if got := parts[0].(map[string]interface{})["text"]; got != " thanks" {
+		t.Fatalf("expected the rest of the value to be removed, got %q", got)
+	}
+	if got := messages[3].(map[string]interface{})["content"]; got != "also 4222 2222 2222 2222 alone" {
+		t.Fatalf("expected values within one message to be left to the per-message scan, got %q", got)
+	}
+}
+
+func TestScanConversationWindow_NothingCrossing(t *testing.T) {
+	var messages []interface{}
+	_ = json.Unmarshal([]byte(`[
+		{"role": "user", "content": "hello"},
+		{"role": "user", "content": "4111 1111 1111 1111"}
+	]`), &messages)
+
+	if resp := handlers.TestScanConversationWindowForUnit(spacedCardDetect, messages, []string{"user"}, 2); resp != nil {
+		t.Fatalf("expected nil when nothing crosses a message boundary, got %+v", resp)
+	}
+	if resp := handlers.TestScanConversationWindowForUnit(spacedCardDetect, messages, []string{"user"}, 1); resp != nil {
+		t.Fatalf("expected nil for a single-segment window, got %+v", resp)
+	}
+}
@@ -0,0 +1,252 @@
+package unit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/handlers"
+)
+
+// mockOpenAIUpstream serves a fixed body (JSON unless contentType is set) and records the
+// last request path and body
+type mockOpenAIUpstream struct {
+	contentType string
+	body        string
+	lastPath    string
+	lastRequest map[string]interface{}
+}
+
+func (m *mockOpenAIUpstream) start(t *testing.T, blockMode string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.lastPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&m.lastRequest)
+		contentType := m.contentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = io.WriteString(w, m.body)
+	}))
+	t.Cleanup(server.Close)
+
+	originalProvider := ai.GetProvider()
+	originalConfig := config.AppConfig
+	ai.SetProvider(ai.NewOpenAIProvider(ai.OpenAIConfig{BaseURL: server.URL + "/v1"}))
+	config.AppConfig = &config.Config{GatewayBlockMode: blockMode, StreamFailMode: "LENIENT"}
+	t.Cleanup(func() {
+		ai.SetProvider(originalProvider)
+		config.AppConfig = originalConfig
+	})
+}
+
+func callInputGateway(t *testing.T, handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestEmbeddingsGateway_MasksEveryInputString(t *testing.T) {
+	upstream := &mockOpenAIUpstream{body: `{"object":"list","data":[{"embedding":[0.1]},{"embedding":[0.2]},{"embedding":[0.3]}]}`}
+	upstream.start(t, "MASK")
+
+	handler := handlers.TestInputGatewayForUnit("embeddings", messagesDetect)
+	rec := callInputGateway(t, handler, `{"model":"text-embedding-3-small","input":["chunk one 4111111111111111","","chunk three 5500005555555559"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if upstream.lastPath != "/v1/embeddings" {
+		t.Fatalf("expected the embeddings endpoint upstream, got %s", upstream.lastPath)
+	}
+	want := []interface{}{"chunk one [CARD]", "", "chunk three [CARD]"}
+	got := upstream.lastRequest["input"].([]interface{})
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("input %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+
+	var body map[string]interface{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &body)
+	meta, _ := body["tsz_meta"].(map[string]interface{})
+	if inputs, _ := meta["input"].([]interface{}); len(inputs) != 2 {
+		t.Fatalf("expected tsz_meta.input for the two non-empty strings, got %v", meta)
+	}
+}
+
+func TestEmbeddingsGateway_BlockModeFailsRequest(t *testing.T) {
+	upstream := &mockOpenAIUpstream{body: `{}`}
+	upstream.start(t, "BLOCK")
+
+	handler := handlers.TestInputGatewayForUnit("embeddings", messagesDetect)
+	rec := callInputGateway(t, handler, `{"input":["fine text","forbidden text"]}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "tsz_content_blocked") {
+		t.Fatalf("expected 400 tsz_content_blocked, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if upstream.lastRequest != nil {
+		t.Fatalf("blocked request must not reach the upstream")
+	}
+}
+
+func TestEmbeddingsGateway_TokenInputs(t *testing.T) {
+	upstream := &mockOpenAIUpstream{body: `{"object":"list","data":[]}`}
+	upstream.start(t, "MASK")
+
+	// Rejected by default, even when the chat gateway forwards non-text parts
+	strict := handlers.TestInputGatewayForUnit("embeddings", messagesDetect, handlers.WithNonTextPartPolicy("allow"))
+	rec := callInputGateway(t, strict, `{"input":[101,2023,102]}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "tsz_non_text_content") {
+		t.Fatalf("expected token inputs to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if upstream.lastRequest != nil {
+		t.Fatalf("token inputs must not reach the upstream unscanned by default")
+	}
+
+	handler := handlers.TestInputGatewayForUnit("embeddings", messagesDetect, handlers.WithTokenInputPolicy("allow"))
+	rec = callInputGateway(t, handler, `{"input":[[101,2023,102]]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected token inputs to be forwarded, got %d", rec.Code)
+	}
+	var resp struct {
+		Meta struct {
+			Unscanned bool `json:"unscanned_input"`
+		} `json:"tsz_meta"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || !resp.Meta.Unscanned {
+		t.Fatalf("expected tsz_meta.unscanned_input, got %s", rec.Body.String())
+	}
+}
+
+func TestEmbeddingsGateway_StripsTokenInputs(t *testing.T) {
+	upstream := &mockOpenAIUpstream{body: `{"object":"list","data":[]}`}
+	upstream.start(t, "MASK")
+
+	handler := handlers.TestInputGatewayForUnit("embeddings", messagesDetect, handlers.WithTokenInputPolicy("strip"))
+	rec := callInputGateway(t, handler, `{"input":["card 4111111111111111",[101,2023,102],"plain"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	got := upstream.lastRequest["input"].([]interface{})
+	if len(got) != 2 || got[0] != "card [CARD]" || got[1] != "plain" {
+		t.Fatalf("expected token arrays to be stripped and strings scanned, got %v", got)
+	}
+
+	upstream.lastRequest = nil
+	rec = callInputGateway(t, handler, `{"input":[101,2023,102]}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "tsz_non_text_content") {
+		t.Fatalf("expected a token-only input to be refused, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if upstream.lastRequest != nil {
+		t.Fatalf("a token-only input must not reach the upstream unscanned")
+	}
+}
+
+func TestEmbeddingsGateway_RejectsInvalidInput(t *testing.T) {
+	upstream := &mockOpenAIUpstream{body: `{}`}
+	upstream.start(t, "MASK")
+
+	handler := handlers.TestInputGatewayForUnit("embeddings", messagesDetect)
+	if rec := callInputGateway(t, handler, `{"model":"m"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a missing input, got %d", rec.Code)
+	}
+}
+
+func TestCompletionsGateway_GuardsPromptAndOutput(t *testing.T) {
+	upstream := &mockOpenAIUpstream{body: `{"object":"text_completion","choices":[
+		{"index":0,"text":"Use card 4111111111111111","finish_reason":"stop"},
+		{"index":1,"text":"this one is forbidden","finish_reason":"stop"}
+	]}`}
+	upstream.start(t, "BLOCK")
+
+	handler := handlers.TestInputGatewayForUnit("completions", messagesDetect)
+	rec := callInputGateway(t, handler, `{"model":"m","prompt":"Complete for 5500005555555559","n":2}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if upstream.lastPath != "/v1/completions" || upstream.lastRequest["prompt"] != "Complete for [CARD]" {
+		t.Fatalf("expected a masked prompt on /v1/completions, got %s %v", upstream.lastPath, upstream.lastRequest["prompt"])
+	}
+
+	var body struct {
+		Choices []map[string]interface{} `json:"choices"`
+		Meta    map[string]interface{}   `json:"tsz_meta"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if body.Choices[0]["text"] != "Use card [CARD]" {
+		t.Fatalf("expected masked output, got %v", body.Choices[0]["text"])
+	}
+	if body.Choices[1]["text"] != "" || body.Choices[1]["finish_reason"] != "content_filter" {
+		t.Fatalf("expected the blocked choice to be withheld, got %v", body.Choices[1])
+	}
+	if body.Meta["blocked_choices"] == nil {
+		t.Fatalf("expected blocked_choices in tsz_meta, got %v", body.Meta)
+	}
+}
+
+func TestCompletionsGateway_StreamSyncGuardsText(t *testing.T) {
+	upstream := &mockOpenAIUpstream{contentType: "text/event-stream", body: strings.Join([]string{
+		`data: {"id":"cmpl-1","object":"text_completion","choices":[{"index":0,"text":"Use card 4111","logprobs":null,"finish_reason":null}]}`,
+		`data: {"id":"cmpl-1","object":"text_completion","choices":[{"index":0,"text":"111111111111 now","logprobs":null,"finish_reason":null}]}`,
+		`data: {"id":"cmpl-1","object":"text_completion","choices":[{"index":0,"text":"","logprobs":null,"finish_reason":"stop"}]}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"}
+	upstream.start(t, "MASK")
+
+	handler := handlers.TestInputGatewayForUnit("completions", messagesDetect)
+	req := httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"model":"m","prompt":"hi","stream":true}`))
+	req.Header.Set("X-TSZ-Guardrails", "PII")
+	req.Header.Set("X-TSZ-Guardrails-Mode", "stream-sync")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	var text strings.Builder
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		data := strings.TrimPrefix(line, "data: ")
+		if data == line || data == "[DONE]" {
+			continue
+		}
+		var event struct {
+			Choices []struct {
+				Text string `json:"text"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatalf("invalid SSE event %q: %v", data, err)
+		}
+		for _, ch := range event.Choices {
+			text.WriteString(ch.Text)
+		}
+	}
+	if got := text.String(); got != "Use card [CARD] now" {
+		t.Fatalf("expected the streamed text to be masked, got %q", got)
+	}
+	if strings.Contains(rec.Body.String(), "4111") {
+		t.Fatalf("raw card digits leaked into the stream: %s", rec.Body.String())
+	}
+}
+
+func TestCompletionsGateway_StreamFinalOnlyIsProxied(t *testing.T) {
+	raw := `data: {"object":"text_completion","choices":[{"index":0,"text":"4111111111111111","finish_reason":"stop"}]}` + "\n\ndata: [DONE]\n\n"
+	upstream := &mockOpenAIUpstream{contentType: "text/event-stream", body: raw}
+	upstream.start(t, "MASK")
+
+	handler := handlers.TestInputGatewayForUnit("completions", messagesDetect)
+	req := httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"model":"m","prompt":"hi","stream":true}`))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Body.String() != raw {
+		t.Fatalf("expected final-only streams to be proxied as-is, got %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,366 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"thyris-sz/internal/handlers"
+	"thyris-sz/internal/models"
+)
+
+func TestToolPolicy_Permits(t *testing.T) {
+	open := handlers.ToolPolicy{}
+	if !handlers.TestToolPolicyPermitsForUnit(open, "anything") {
+		t.Fatalf("expected an empty policy to permit every tool")
+	}
+
+	deny := handlers.ToolPolicy{Deny: []string{"send_email"}}
+	if handlers.TestToolPolicyPermitsForUnit(deny, "Send_Email") {
+		t.Fatalf("expected denied tool to be rejected case-insensitively")
+	}
+	if !handlers.TestToolPolicyPermitsForUnit(deny, "get_weather") {
+		t.Fatalf("expected other tools to be permitted")
+	}
+
+	allow := handlers.ToolPolicy{Allow: []string{"get_weather", "send_email"}, Deny: []string{"send_email"}}
+	if !handlers.TestToolPolicyPermitsForUnit(allow, "get_weather") {
+		t.Fatalf("expected allowlisted tool to be permitted")
+	}
+	if handlers.TestToolPolicyPermitsForUnit(allow, "search") {
+		t.Fatalf("expected tool outside the allowlist to be rejected")
+	}
+	if handlers.TestToolPolicyPermitsForUnit(allow, "send_email") {
+		t.Fatalf("expected deny to take precedence over allow")
+	}
+}
+
+func TestFilterDeclaredTools(t *testing.T) {
+	var payload map[string]interface{}
+	body := `{
+		"model": "gpt-4o",
+		"tools": [
+			{"type": "function", "function": {"name": "get_weather"}},
+			{"type": "function", "function": {"name": "send_email"}}
+		],
+		"tool_choice": "auto"
+	}`
+	if err := json.Unmarshal([]byte(body), &payload); err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+
+	removed := handlers.TestFilterDeclaredToolsForUnit(payload, handlers.ToolPolicy{Deny: []string{"send_email"}})
+	if len(removed) != 1 || removed[0] != "send_email" {
+		t.Fatalf("expected send_email to be removed, got %v", removed)
+	}
+	if tools := payload["tools"].([]interface{}); len(tools) != 1 {
+		t.Fatalf("expected one remaining tool, got %d", len(tools))
+	}
+
+	handlers.TestFilterDeclaredToolsForUnit(payload, handlers.ToolPolicy{Allow: []string{"search"}})
+	if _, ok := payload["tools"]; ok {
+		t.Fatalf("expected tools to be dropped when none remain")
+	}
+	if _, ok := payload["tool_choice"]; ok {
+		t.Fatalf("expected tool_choice to be dropped with the tools")
+	}
+}
+
+func TestFilterDeclaredTools_DropsToolChoiceForRemovedTool(t *testing.T) {
+	cases := []struct {
+		name       string
+		toolChoice string
+		keep       bool
+	}{
+		{"openai forcing a removed tool", `{"type": "function", "function": {"name": "send_email"}}`, false},
+		{"anthropic forcing a removed tool", `{"type": "tool", "name": "send_email"}`, false},
+		{"forcing a kept tool", `{"type": "function", "function": {"name": "get_weather"}}`, true},
+		{"mode", `"required"`, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var payload map[string]interface{}
+			body := `{
+				"tools": [
+					{"type": "function", "function": {"name": "get_weather"}},
+					{"type": "function", "function": {"name": "send_email"}}
+				],
+				"tool_choice": ` + tc.toolChoice + `
+			}`
+			if err := json.Unmarshal([]byte(body), &payload); err != nil {
+				t.Fatalf("failed to decode payload: %v", err)
+			}
+
+			handlers.TestFilterDeclaredToolsForUnit(payload, handlers.ToolPolicy{Deny: []string{"send_email"}})
+			if _, ok := payload["tool_choice"]; ok != tc.keep {
+				t.Fatalf("expected tool_choice kept=%v, got %v", tc.keep, payload["tool_choice"])
+			}
+		})
+	}
+}
+
+// toolCallMessage decodes an assistant message with the given tool calls
+func toolCallMessage(t *testing.T, calls string) map[string]interface{} {
+	t.Helper()
+	var msg map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"role": "assistant", "content": null, "tool_calls": `+calls+`}`), &msg); err != nil {
+		t.Fatalf("failed to decode message: %v", err)
+	}
+	return msg
+}
+
+func TestApplyToolCallGuardrails_MasksJSONArguments(t *testing.T) {
+	msg := toolCallMessage(t, `[
+		{"id": "call_1", "type": "function", "function": {"name": "charge", "arguments": "{\"card\": \"4111111111111111\", \"amount\": 10}"}}
+	]`)
+
+	detects, withheld := handlers.TestApplyToolCallGuardrailsForUnit(messagesDetect, msg, handlers.ToolPolicy{})
+	if len(withheld) != 0 || len(detects) != 1 {
+		t.Fatalf("expected one scanned call and none withheld, got %d scans, withheld %v", len(detects), withheld)
+	}
+
+	args := msg["tool_calls"].([]interface{})[0].(map[string]interface{})["function"].(map[string]interface{})["arguments"].(string)
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(args), &parsed); err != nil {
+		t.Fatalf("expected masked arguments to stay valid JSON, got %q: %v", args, err)
+	}
+	if parsed["card"] != "[CARD]" || parsed["amount"] != float64(10) {
+		t.Fatalf("expected the card number to be masked in place, got %v", parsed)
+	}
+}
+
+func TestApplyToolCallGuardrails_WithholdsDeniedAndFailingCalls(t *testing.T) {
+	msg := toolCallMessage(t, `[
+		{"id": "call_1", "type": "function", "function": {"name": "send_email", "arguments": "{}"}},
+		{"id": "call_2", "type": "function", "function": {"name": "search", "arguments": "{\"q\": \"rm -rf\"}"}},
+		{"id": "call_3", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\": \"Paris\"}"}}
+	]`)
+	detect := func(req models.DetectRequest) models.DetectResponse {
+		resp := messagesDetect(req)
+		resp.ValidatorResults = []models.ValidatorResult{{Name: "SAFE_ARGS", Passed: !strings.Contains(string(req.JSON), "rm -rf")}}
+		return resp
+	}
+	policy := handlers.ToolPolicy{Deny: []string{"send_email"}, RequiredGuardrails: []string{"SAFE_ARGS"}}
+
+	_, withheld := handlers.TestApplyToolCallGuardrailsForUnit(detect, msg, policy)
+	if len(withheld) != 2 || withheld["send_email"] == "" || !strings.Contains(withheld["search"], "SAFE_ARGS") {
+		t.Fatalf("expected send_email to be denied and search to fail SAFE_ARGS, got %v", withheld)
+	}
+
+	calls := msg["tool_calls"].([]interface{})
+	if len(calls) != 1 || calls[0].(map[string]interface{})["id"] != "call_3" {
+		t.Fatalf("expected only call_3 to remain, got %v", calls)
+	}
+
+	msg = toolCallMessage(t, `[{"id": "call_1", "type": "function", "function": {"name": "send_email", "arguments": "{}"}}]`)
+	handlers.TestApplyToolCallGuardrailsForUnit(detect, msg, policy)
+	if _, ok := msg["tool_calls"]; ok {
+		t.Fatalf("expected tool_calls to be dropped when every call is withheld")
+	}
+}
+
+func TestApplyInputGuardrails_MasksJSONToolResults(t *testing.T) {
+	var messages []interface{}
+	_ = json.Unmarshal([]byte(`[
+		{"role": "tool", "tool_call_id": "call_1", "content": "{\"customer\": {\"card\": \"4111111111111111\"}}"},
+		{"role": "tool", "tool_call_id": "call_2", "content": "card 5500000000000004 on file"}
+	]`), &messages)
+
+	// Tool results are scanned only when the tool role is opted in
+	out, _, _ := handlers.TestApplyInputGuardrailsForUnit(messagesDetect, messages, nil, 0)
+	if got := out[1].(map[string]interface{})["content"]; got != "card 5500000000000004 on file" {
+		t.Fatalf("expected tool results to be outside the default scan roles, got %q", got)
+	}
+
+	out, blocked, _ := handlers.TestApplyInputGuardrailsForUnit(messagesDetect, messages, []string{"user", "tool"}, 0)
+	if blocked {
+		t.Fatalf("did not expect the request to be blocked")
+	}
+
+	content := out[0].(map[string]interface{})["content"].(string)
+	var parsed map[string]map[string]string
+	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
+		t.Fatalf("expected the JSON tool result to stay valid JSON, got %q: %v", content, err)
+	}
+	if parsed["customer"]["card"] != "[CARD]" {
+		t.Fatalf("expected the card number to be masked inside the JSON, got %q", content)
+	}
+	if got := out[1].(map[string]interface{})["content"]; got != "card [CARD] on file" {
+		t.Fatalf("expected the plain tool result to be masked as text, got %q", got)
+	}
+}
+
+// toolCallStream streams the tool calls of one choice in small argument pieces, ending with
+// finish_reason "tool_calls"
+func toolCallStream(calls ...[2]string) string {
+	var b strings.Builder
+	chunk := func(delta map[string]interface{}, finish interface{}) {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion.chunk",
+			"choices": []interface{}{map[string]interface{}{"index": 0, "delta": delta, "finish_reason": finish}},
+		})
+		b.WriteString("data: " + string(payload) + "\n\n")
+	}
+	chunk(map[string]interface{}{"role": "assistant", "content": nil}, nil)
+	for i, call := range calls {
+		chunk(map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+			"index": i, "id": "call_" + call[0], "type": "function",
+			"function": map[string]interface{}{"name": call[0], "arguments": ""},
+		}}}, nil)
+		for args := call[1]; args != ""; {
+			n := 5
+			if n > len(args) {
+				n = len(args)
+			}
+			chunk(map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+				"index": i, "function": map[string]interface{}{"arguments": args[:n]},
+			}}}, nil)
+			args = args[n:]
+		}
+	}
+	chunk(map[string]interface{}{}, "tool_calls")
+	b.WriteString("data: [DONE]\n\n")
+	return b.String()
+}
+
+// streamedToolCalls collects the tool calls, withheld calls and finish_reason sent to the client
+func streamedToolCalls(t *testing.T, body string) (map[string]string, []string, string) {
+	t.Helper()
+	calls := make(map[string]string)
+	var withheld []string
+	finish := ""
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, "data: {") {
+			continue
+		}
+		var event struct {
+			Choices []struct {
+				Delta struct {
+					ToolCalls []struct {
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"delta"`
+				FinishReason string `json:"finish_reason"`
+				Blocked      []struct {
+					Name string `json:"name"`
+				} `json:"tsz_blocked_tool_calls"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		for _, c := range event.Choices {
+			for _, tc := range c.Delta.ToolCalls {
+				calls[tc.Function.Name] += tc.Function.Arguments
+			}
+			for _, b := range c.Blocked {
+				withheld = append(withheld, b.Name)
+			}
+			if c.FinishReason != "" {
+				finish = c.FinishReason
+			}
+		}
+	}
+	return calls, withheld, finish
+}
+
+func callToolStream(t *testing.T, handler http.HandlerFunc, mode string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{
+		"model": "gpt-4o", "stream": true,
+		"messages": [{"role": "user", "content": "Hi"}],
+		"tools": [{"type": "function", "function": {"name": "charge"}}, {"type": "function", "function": {"name": "send_email"}}]
+	}`))
+	if mode != "" {
+		req.Header.Set("X-TSZ-Guardrails-Mode", mode)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+func TestChatGateway_StreamedToolCallsFollowToolPolicy(t *testing.T) {
+	for _, mode := range []string{"", "stream-sync"} {
+		t.Run("mode="+mode, func(t *testing.T) {
+			upstream := &mockOpenAIUpstream{contentType: "text/event-stream", body: toolCallStream(
+				[2]string{"send_email", `{"to": "a@example.com"}`},
+				[2]string{"charge", `{"card": "4111111111111111", "amount": 10}`},
+			)}
+			upstream.start(t, "MASK")
+			handler := handlers.TestChatGatewayForUnit(messagesDetect, handlers.WithToolPolicy(handlers.ToolPolicy{Deny: []string{"send_email"}}))
+
+			rec := callToolStream(t, handler, mode)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			calls, withheld, finish := streamedToolCalls(t, rec.Body.String())
+			if _, ok := calls["send_email"]; ok || len(withheld) != 1 || withheld[0] != "send_email" {
+				t.Fatalf("expected send_email to be withheld, got calls %v withheld %v", calls, withheld)
+			}
+			if calls["charge"] != `{"card": "[CARD]", "amount": 10}` || finish != "tool_calls" {
+				t.Fatalf("expected the charge call with masked arguments, got %q (%s)", calls["charge"], finish)
+			}
+		})
+	}
+}
+
+func TestChatGateway_StreamedToolCallsAllWithheld(t *testing.T) {
+	upstream := &mockOpenAIUpstream{contentType: "text/event-stream", body: toolCallStream([2]string{"send_email", `{}`})}
+	upstream.start(t, "MASK")
+	handler := handlers.TestChatGatewayForUnit(messagesDetect, handlers.WithToolPolicy(handlers.ToolPolicy{Deny: []string{"send_email"}}))
+
+	calls, withheld, finish := streamedToolCalls(t, callToolStream(t, handler, "stream-sync").Body.String())
+	if len(calls) != 0 || len(withheld) != 1 || finish != "content_filter" {
+		t.Fatalf("expected every call withheld and a content_filter finish, got %v %v %s", calls, withheld, finish)
+	}
+}
+
+func TestChatGateway_StreamAsyncRejectedUnderToolPolicy(t *testing.T) {
+	upstream := &mockOpenAIUpstream{contentType: "text/event-stream", body: toolCallStream([2]string{"charge", `{}`})}
+	upstream.start(t, "MASK")
+	handler := handlers.TestChatGatewayForUnit(messagesDetect, handlers.WithToolPolicy(handlers.ToolPolicy{RequiredGuardrails: []string{"SAFE_ARGS"}}))
+
+	rec := callToolStream(t, handler, "stream-async")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "tsz_tool_policy_stream_mode") {
+		t.Fatalf("expected a 400 tsz_tool_policy_stream_mode, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if upstream.lastRequest != nil {
+		t.Fatalf("expected the request not to be forwarded")
+	}
+}
+
+type requestMarker struct{}
+
+func TestChatGateway_DetectsUnderRequestContext(t *testing.T) {
+	upstream := &mockOpenAIUpstream{body: `{"choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`}
+	upstream.start(t, "MASK")
+
+	var seen, total int
+	detect := func(ctx context.Context, req models.DetectRequest) models.DetectResponse {
+		total++
+		if ctx.Value(requestMarker{}) == "RID-CTX" {
+			seen++
+		}
+		return messagesDetect(req)
+	}
+	handler := handlers.TestChatGatewayWithContextForUnit(detect)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"card 4111111111111111"}]}`))
+	req = req.WithContext(context.WithValue(req.Context(), requestMarker{}, "RID-CTX"))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if total == 0 || seen != total {
+		t.Fatalf("expected every detection to run under the request context, got %d of %d", seen, total)
+	}
+}
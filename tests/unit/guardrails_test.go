@@ -6,7 +6,10 @@ import (
 	"strings"
 	"testing"
 
+	"thyris-sz/internal/cache"
+	"thyris-sz/internal/config"
 	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/models"
 )
 
 // --- resolveAction tests ---
@@ -83,6 +86,40 @@ func TestGetCategoryThreshold_UsesCategorySpecificEnv(t *testing.T) {
 	}
 }
 
+func TestResolveThresholds_Chain(t *testing.T) {
+	os.Unsetenv("CONFIDENCE_ALLOW_THRESHOLD")
+	os.Unsetenv("CONFIDENCE_BLOCK_THRESHOLD")
+	os.Unsetenv("CONFIDENCE_SECRET_THRESHOLD")
+
+	// Defaults
+	allow, block, source := guardrails.TestResolveThresholdsForUnit(nil, "SECRET")
+	if allow != 0.30 || block != 0.85 || source != "DEFAULT" {
+		t.Fatalf("expected defaults, got allow=%v block=%v source=%s", allow, block, source)
+	}
+
+	// Global env
+	_ = os.Setenv("CONFIDENCE_BLOCK_THRESHOLD", "0.9")
+	defer os.Unsetenv("CONFIDENCE_BLOCK_THRESHOLD")
+	if _, block, source = guardrails.TestResolveThresholdsForUnit(nil, "SECRET"); block != 0.9 || source != "ENV" {
+		t.Fatalf("expected global env block threshold, got block=%v source=%s", block, source)
+	}
+
+	// Category env beats global env
+	_ = os.Setenv("CONFIDENCE_SECRET_THRESHOLD", "0.6")
+	defer os.Unsetenv("CONFIDENCE_SECRET_THRESHOLD")
+	if _, block, source = guardrails.TestResolveThresholdsForUnit(nil, "SECRET"); block != 0.6 || source != "CATEGORY" {
+		t.Fatalf("expected category block threshold, got block=%v source=%s", block, source)
+	}
+
+	// Pattern override beats everything
+	pb, pa := 0.95, 0.1
+	p := &models.Pattern{Category: "SECRET", BlockThreshold: &pb, AllowThreshold: &pa}
+	allow, block, source = guardrails.TestResolveThresholdsForUnit(p, p.Category)
+	if allow != 0.1 || block != 0.95 || source != "PATTERN" {
+		t.Fatalf("expected pattern overrides, got allow=%v block=%v source=%s", allow, block, source)
+	}
+}
+
 // --- utils tests ---
 
 func TestApplyRegexHitWeight_IncreasesWithHits(t *testing.T) {
@@ -399,3 +436,111 @@ func TestValidators_ExtensiveXML(t *testing.T) {
 		})
 	}
 }
+
+// --- tokenization vault tests ---
+
+func TestRehydrate_SwapsKnownPlaceholders(t *testing.T) {
+	entries := map[string]string{
+		"[RID-1_EMAIL_ab12cd34ef56ab78]":    "alice@example.com",
+		"[RID-1_PHONE_TR_0011223344556677]": "0532 123 45 67",
+	}
+	text := "Reply to [RID-1_EMAIL_ab12cd34ef56ab78] or call [RID-1_PHONE_TR_0011223344556677]. Cc [RID-1_EMAIL_ab12cd34ef56ab78]."
+
+	got, count := guardrails.TestRehydrateForUnit(text, entries)
+	want := "Reply to alice@example.com or call 0532 123 45 67. Cc alice@example.com."
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if count != 3 {
+		t.Fatalf("expected 3 replacements, got %d", count)
+	}
+}
+
+func TestRehydrate_LeavesUnknownPlaceholders(t *testing.T) {
+	entries := map[string]string{"[RID-1_EMAIL_ab12cd34ef56ab78]": "alice@example.com"}
+	text := "Unknown token [RID-2_EMAIL_ffffffffffffffff] stays"
+
+	got, count := guardrails.TestRehydrateForUnit(text, entries)
+	if got != text || count != 0 {
+		t.Fatalf("expected text unchanged with 0 replacements, got %q (%d)", got, count)
+	}
+}
+
+func TestStoreTokens_SkippedWhenVaultDisabled(t *testing.T) {
+	origCfg, origRDB := config.AppConfig, cache.RDB
+	defer func() { config.AppConfig, cache.RDB = origCfg, origRDB }()
+
+	// A nil Redis client would panic if storeTokens reached the vault
+	config.AppConfig = &config.Config{TokenVaultEnabled: false}
+	cache.RDB = nil
+
+	guardrails.TestStoreTokensForUnit("rid-1", []models.DetectionResult{
+		{Type: "EMAIL", Value: "alice@example.com", Placeholder: "[RID-1_EMAIL_ab12cd34ef56ab78]"},
+	})
+}
+
+// --- context keyword tests ---
+
+func TestScanContextKeywords_FindsKeywordsInsideWindow(t *testing.T) {
+	p := models.Pattern{
+		ContextKeywords:         []string{"vergi", "tax id"},
+		NegativeContextKeywords: []string{"order"},
+		ContextWindow:           20,
+	}
+
+	text := "Şirketin Vergi numarası 1234567890 olarak kayıtlı"
+	start := strings.Index(text, "1234567890")
+	pos, neg := guardrails.TestScanContextKeywordsForUnit(text, start, start+10, p)
+	if len(pos) != 1 || pos[0] != "vergi" {
+		t.Fatalf("expected positive hit 'vergi', got %v", pos)
+	}
+	if len(neg) != 0 {
+		t.Fatalf("expected no negative hits, got %v", neg)
+	}
+
+	far := "order 1234567890" + strings.Repeat(" filler", 10) + " tax id"
+	start = strings.Index(far, "1234567890")
+	pos, neg = guardrails.TestScanContextKeywordsForUnit(far, start, start+10, p)
+	if len(pos) != 0 {
+		t.Fatalf("expected keyword outside window to be ignored, got %v", pos)
+	}
+	if len(neg) != 1 {
+		t.Fatalf("expected negative hit 'order', got %v", neg)
+	}
+}
+
+func TestScanContextKeywords_MatchesWholeWords(t *testing.T) {
+	p := models.Pattern{
+		ContextKeywords:         []string{"vkn", "tax id"},
+		NegativeContextKeywords: []string{"order"},
+	}
+
+	text := "reorder ref 1234567890 (vknx, tax ids)"
+	start := strings.Index(text, "1234567890")
+	if pos, neg := guardrails.TestScanContextKeywordsForUnit(text, start, start+10, p); len(pos) != 0 || len(neg) != 0 {
+		t.Fatalf("expected keywords inside longer words to be ignored, got %v / %v", pos, neg)
+	}
+
+	text = "VKN: 1234567890, tax id (order #7)"
+	start = strings.Index(text, "1234567890")
+	pos, neg := guardrails.TestScanContextKeywordsForUnit(text, start, start+10, p)
+	if len(pos) != 2 || len(neg) != 1 {
+		t.Fatalf("expected whole-word hits, got %v / %v", pos, neg)
+	}
+}
+
+func TestComputeConfidence_ContextKeywords(t *testing.T) {
+	base := guardrails.ConfidenceContext{Source: "REGEX", PatternCategory: "PII", PatternActive: true, ContextExpected: true}
+	boosted := base
+	boosted.ContextKeywordHits = 1
+	suppressed := base
+	suppressed.NegativeKeywordHits = 1
+
+	b := guardrails.ComputeConfidence(base)
+	if guardrails.ComputeConfidence(boosted) <= b {
+		t.Fatalf("expected positive context to raise confidence")
+	}
+	if guardrails.ComputeConfidence(suppressed) >= b {
+		t.Fatalf("expected negative context to lower confidence")
+	}
+}
@@ -0,0 +1,380 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"thyris-sz/internal/ai"
+	"thyris-sz/internal/config"
+	"thyris-sz/internal/handlers"
+	"thyris-sz/internal/models"
+)
+
+// messagesDetect masks digit runs in text and JSON and blocks text containing "forbidden"
+func messagesDetect(req models.DetectRequest) models.DetectResponse {
+	if len(req.JSON) > 0 {
+		masked := fakeCardRe.ReplaceAllString(string(req.JSON), "[CARD]")
+		return models.DetectResponse{RedactedJSON: json.RawMessage(masked), ContainsPII: masked != string(req.JSON)}
+	}
+	resp := blockingDetect(req)
+	resp.RedactedText = fakeCardRe.ReplaceAllString(req.Text, "[CARD]")
+	return resp
+}
+
+// mockMessagesUpstream serves /v1/messages with a fixed body and records the last request
+type mockMessagesUpstream struct {
+	contentType string
+	body        string
+	lastRequest map[string]interface{}
+	lastHeader  http.Header
+}
+
+func (m *mockMessagesUpstream) start(t *testing.T) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected upstream path %s", r.URL.Path)
+		}
+		m.lastHeader = r.Header.Clone()
+		_ = json.NewDecoder(r.Body).Decode(&m.lastRequest)
+		w.Header().Set("Content-Type", m.contentType)
+		_, _ = io.WriteString(w, m.body)
+	}))
+	t.Cleanup(server.Close)
+
+	originalProvider := ai.GetProvider()
+	originalConfig := config.AppConfig
+	ai.SetProvider(nil)
+	ai.SetMessagesForwarder(ai.NewAnthropicProvider(ai.AnthropicConfig{BaseURL: server.URL, APIKey: "test-key"}))
+	config.AppConfig = &config.Config{StreamFailMode: "LENIENT", GatewayBlockMode: "MASK"}
+	t.Cleanup(func() {
+		ai.SetProvider(originalProvider)
+		ai.SetMessagesForwarder(nil)
+		config.AppConfig = originalConfig
+	})
+}
+
+func callMessagesGateway(t *testing.T, handler http.HandlerFunc, body string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	req.Header.Set("X-TSZ-Guardrails", "PII")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+const messagesRequest = `{
+	"model": "claude-test",
+	"max_tokens": 256,
+	"system": "Support agent for account 4000123412341234",
+	"tools": [
+		{"name": "lookup_order", "input_schema": {"type": "object"}},
+		{"name": "delete_account", "input_schema": {"type": "object"}}
+	],
+	"messages": [
+		{"role": "user", "content": "My card is 4111111111111111"},
+		{"role": "assistant", "content": [
+			{"type": "tool_use", "id": "toolu_1", "name": "lookup_order", "input": {"card": "4111111111111111"}}
+		]},
+		{"role": "user", "content": [
+			{"type": "tool_result", "tool_use_id": "toolu_1", "content": "Order paid with 5500005555555559"},
+			{"type": "text", "text": "Anything else on 4111111111111111?"}
+		]}
+	]
+}`
+
+func TestAnthropicProvider_ForwardsWithMessagesHeaders(t *testing.T) {
+	upstream := &mockMessagesUpstream{contentType: "application/json", body: `{"type":"message","content":[]}`}
+	upstream.start(t)
+
+	resp, err := ai.GetMessagesForwarder().ForwardMessages(context.Background(), map[string]interface{}{"model": "claude-test"})
+	if err != nil {
+		t.Fatalf("forward failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := upstream.lastHeader.Get("x-api-key"); got != "test-key" {
+		t.Fatalf("expected x-api-key to be forwarded, got %q", got)
+	}
+	if got := upstream.lastHeader.Get("anthropic-version"); got != ai.DefaultAnthropicVersion {
+		t.Fatalf("expected default anthropic-version, got %q", got)
+	}
+}
+
+func TestAnthropicProvider_ChatConvertsMessages(t *testing.T) {
+	upstream := &mockMessagesUpstream{
+		contentType: "application/json",
+		body:        `{"id":"msg_1","model":"claude-test","content":[{"type":"text","text":"Hi "},{"type":"text","text":"there"}],"stop_reason":"max_tokens","usage":{"input_tokens":3,"output_tokens":2}}`,
+	}
+	upstream.start(t)
+
+	provider := ai.GetMessagesForwarder().(ai.ChatProvider)
+	resp, err := provider.Chat(context.Background(), ai.ChatRequest{Messages: []ai.ChatMessage{
+		{Role: "system", Content: "Be brief"},
+		{Role: "user", Content: "Hello"},
+	}})
+	if err != nil {
+		t.Fatalf("chat failed: %v", err)
+	}
+
+	if upstream.lastRequest["system"] != "Be brief" {
+		t.Fatalf("expected the system message to move to the top-level field, got %v", upstream.lastRequest["system"])
+	}
+	if msgs := upstream.lastRequest["messages"].([]interface{}); len(msgs) != 1 {
+		t.Fatalf("expected only the user message in messages, got %v", msgs)
+	}
+	if resp.Choices[0].Message.Content != "Hi there" || resp.Choices[0].FinishReason != "length" {
+		t.Fatalf("unexpected conversion: %+v", resp.Choices[0])
+	}
+	if resp.Usage.TotalTokens != 5 {
+		t.Fatalf("expected usage to be summed, got %+v", resp.Usage)
+	}
+}
+
+func TestMessagesGateway_MasksInputBlocks(t *testing.T) {
+	upstream := &mockMessagesUpstream{contentType: "application/json", body: `{"type":"message","content":[],"stop_reason":"end_turn"}`}
+	upstream.start(t)
+
+	handler := handlers.TestMessagesGatewayForUnit(messagesDetect,
+		handlers.WithToolPolicy(handlers.ToolPolicy{Deny: []string{"delete_account"}}),
+		handlers.WithScanRoles([]string{"user", "tool"}))
+	rec := callMessagesGateway(t, handler, messagesRequest, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	sent, _ := json.Marshal(upstream.lastRequest)
+	for _, raw := range []string{"4111111111111111", "5500005555555559"} {
+		if strings.Contains(string(sent), raw) {
+			t.Fatalf("raw value %s reached the upstream: %s", raw, sent)
+		}
+	}
+	// system is outside the default scan roles
+	if upstream.lastRequest["system"] != "Support agent for account 4000123412341234" {
+		t.Fatalf("expected system to be forwarded unchanged, got %v", upstream.lastRequest["system"])
+	}
+	if tools := upstream.lastRequest["tools"].([]interface{}); len(tools) != 1 {
+		t.Fatalf("expected the denied tool to be removed, got %v", tools)
+	}
+}
+
+func TestMessagesGateway_ScansSystemWhenInScope(t *testing.T) {
+	upstream := &mockMessagesUpstream{contentType: "application/json", body: `{"type":"message","content":[]}`}
+	upstream.start(t)
+
+	handler := handlers.TestMessagesGatewayForUnit(messagesDetect, handlers.WithScanRoles([]string{"system", "user"}))
+	callMessagesGateway(t, handler, messagesRequest, nil)
+
+	if upstream.lastRequest["system"] != "Support agent for account [CARD]" {
+		t.Fatalf("expected system to be masked, got %v", upstream.lastRequest["system"])
+	}
+}
+
+func TestMessagesGateway_BlockModeReturnsMessagesError(t *testing.T) {
+	upstream := &mockMessagesUpstream{contentType: "application/json", body: `{}`}
+	upstream.start(t)
+	config.AppConfig.GatewayBlockMode = "BLOCK"
+
+	handler := handlers.TestMessagesGatewayForUnit(messagesDetect)
+	rec := callMessagesGateway(t, handler, `{"messages":[{"role":"user","content":"say something forbidden"}]}`, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+
+	var body struct {
+		Type  string            `json:"type"`
+		Error map[string]string `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid error body: %v", err)
+	}
+	if body.Type != "error" || body.Error["type"] != "invalid_request_error" || body.Error["code"] != "tsz_content_blocked" {
+		t.Fatalf("unexpected error body: %s", rec.Body.String())
+	}
+	if upstream.lastRequest != nil {
+		t.Fatalf("blocked request must not reach the upstream")
+	}
+}
+
+func TestMessagesGateway_GuardsOutputBlocks(t *testing.T) {
+	upstream := &mockMessagesUpstream{
+		contentType: "application/json",
+		body: `{"type":"message","role":"assistant","stop_reason":"tool_use","content":[
+			{"type":"text","text":"Card on file: 4111111111111111"},
+			{"type":"tool_use","id":"toolu_2","name":"delete_account","input":{"id":"42"}}
+		]}`,
+	}
+	upstream.start(t)
+
+	handler := handlers.TestMessagesGatewayForUnit(messagesDetect, handlers.WithToolPolicy(handlers.ToolPolicy{Deny: []string{"delete_account"}}))
+	rec := callMessagesGateway(t, handler, `{"messages":[{"role":"user","content":"hi"}]}`, nil)
+
+	var body struct {
+		Content    []map[string]interface{} `json:"content"`
+		StopReason string                   `json:"stop_reason"`
+		Meta       map[string]interface{}   `json:"tsz_meta"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if len(body.Content) != 1 || body.Content[0]["text"] != "Card on file: [CARD]" {
+		t.Fatalf("expected only the masked text block, got %v", body.Content)
+	}
+	if body.StopReason != "refusal" {
+		t.Fatalf("expected stop_reason refusal once the tool call is withheld, got %q", body.StopReason)
+	}
+	if body.Meta["blocked_tool_calls"] == nil {
+		t.Fatalf("expected blocked_tool_calls in tsz_meta, got %v", body.Meta)
+	}
+}
+
+// messagesEvent renders one named Messages API SSE event
+func messagesEvent(event map[string]interface{}) string {
+	b, _ := json.Marshal(event)
+	return "event: " + event["type"].(string) + "\ndata: " + string(b) + "\n\n"
+}
+
+// messagesStream streams a text block word by word followed by a tool_use block whose
+// input arrives in two partial_json deltas
+func messagesStream(text, tool, toolInput string) string {
+	var b strings.Builder
+	b.WriteString(messagesEvent(map[string]interface{}{"type": "message_start", "message": map[string]interface{}{"id": "msg_1", "content": []interface{}{}}}))
+	b.WriteString(messagesEvent(map[string]interface{}{"type": "content_block_start", "index": 0, "content_block": map[string]interface{}{"type": "text", "text": ""}}))
+	for _, word := range strings.SplitAfter(text, " ") {
+		b.WriteString(messagesEvent(map[string]interface{}{"type": "content_block_delta", "index": 0, "delta": map[string]interface{}{"type": "text_delta", "text": word}}))
+	}
+	b.WriteString(messagesEvent(map[string]interface{}{"type": "content_block_stop", "index": 0}))
+	b.WriteString(messagesEvent(map[string]interface{}{"type": "content_block_start", "index": 1, "content_block": map[string]interface{}{"type": "tool_use", "id": "toolu_1", "name": tool, "input": map[string]interface{}{}}}))
+	half := len(toolInput) / 2
+	for _, part := range []string{toolInput[:half], toolInput[half:]} {
+		b.WriteString(messagesEvent(map[string]interface{}{"type": "content_block_delta", "index": 1, "delta": map[string]interface{}{"type": "input_json_delta", "partial_json": part}}))
+	}
+	b.WriteString(messagesEvent(map[string]interface{}{"type": "content_block_stop", "index": 1}))
+	b.WriteString(messagesEvent(map[string]interface{}{"type": "message_delta", "delta": map[string]interface{}{"stop_reason": "tool_use"}}))
+	b.WriteString(messagesEvent(map[string]interface{}{"type": "message_stop"}))
+	return b.String()
+}
+
+// collectMessagesStream reassembles the client stream: text per block index, tool input
+// JSON per block index, the stop_reason and whether an error event was sent
+func collectMessagesStream(t *testing.T, body string) (map[int]string, map[int]string, string, bool) {
+	t.Helper()
+	texts := make(map[int]string)
+	inputs := make(map[int]string)
+	stopReason := ""
+	errored := false
+	for _, line := range strings.Split(body, "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event struct {
+			Type  string `json:"type"`
+			Index int    `json:"index"`
+			Delta struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		switch event.Type {
+		case "content_block_delta":
+			texts[event.Index] += event.Delta.Text
+			inputs[event.Index] += event.Delta.PartialJSON
+		case "message_delta":
+			stopReason = event.Delta.StopReason
+		case "error":
+			errored = true
+		}
+	}
+	return texts, inputs, stopReason, errored
+}
+
+func TestMessagesGateway_StreamSyncMasksTextAndToolInput(t *testing.T) {
+	text := "Sure, the card 4111111111111111 was charged and the refund goes back to that same card shortly."
+	upstream := &mockMessagesUpstream{contentType: "text/event-stream", body: messagesStream(text, "lookup_order", `{"card":"5500005555555559"}`)}
+	upstream.start(t)
+
+	handler := handlers.TestMessagesGatewayForUnit(messagesDetect)
+	rec := callMessagesGateway(t, handler, `{"stream":true,"messages":[{"role":"user","content":"hi"}]}`, map[string]string{"X-TSZ-Guardrails-Mode": "stream-sync"})
+
+	texts, inputs, stopReason, errored := collectMessagesStream(t, rec.Body.String())
+	if errored {
+		t.Fatalf("unexpected error event: %s", rec.Body.String())
+	}
+	if want := fakeCardRe.ReplaceAllString(text, "[CARD]"); texts[0] != want {
+		t.Fatalf("text block:\n got: %q\nwant: %q", texts[0], want)
+	}
+	if inputs[1] != `{"card":"[CARD]"}` {
+		t.Fatalf("expected masked tool input in one delta, got %q", inputs[1])
+	}
+	if stopReason != "tool_use" {
+		t.Fatalf("expected stop_reason tool_use, got %q", stopReason)
+	}
+	if !strings.Contains(rec.Body.String(), "event: message_stop") {
+		t.Fatalf("expected message_stop to be forwarded")
+	}
+}
+
+func TestMessagesGateway_StreamSyncWithholdsDeniedToolUse(t *testing.T) {
+	upstream := &mockMessagesUpstream{contentType: "text/event-stream", body: messagesStream("Deleting it now.", "delete_account", `{"id":"42"}`)}
+	upstream.start(t)
+
+	handler := handlers.TestMessagesGatewayForUnit(messagesDetect, handlers.WithToolPolicy(handlers.ToolPolicy{Deny: []string{"delete_account"}}))
+	rec := callMessagesGateway(t, handler, `{"stream":true,"messages":[{"role":"user","content":"hi"}]}`, map[string]string{"X-TSZ-Guardrails-Mode": "stream-sync"})
+
+	body := rec.Body.String()
+	if strings.Contains(body, "delete_account") || strings.Contains(body, `"index":1`) {
+		t.Fatalf("expected the tool_use block to be withheld: %s", body)
+	}
+	if _, _, stopReason, _ := collectMessagesStream(t, body); stopReason != "refusal" {
+		t.Fatalf("expected stop_reason refusal, got %q", stopReason)
+	}
+}
+
+func TestMessagesGateway_StreamSyncHaltsWithErrorEvent(t *testing.T) {
+	upstream := &mockMessagesUpstream{contentType: "text/event-stream", body: messagesStream("This reply has forbidden words.", "lookup_order", `{}`)}
+	upstream.start(t)
+
+	handler := handlers.TestMessagesGatewayForUnit(messagesDetect)
+	rec := callMessagesGateway(t, handler, `{"stream":true,"messages":[{"role":"user","content":"hi"}]}`, map[string]string{
+		"X-TSZ-Guardrails-Mode":   "stream-sync",
+		"X-TSZ-Guardrails-OnFail": "halt",
+	})
+
+	body := rec.Body.String()
+	texts, _, _, errored := collectMessagesStream(t, body)
+	if !errored || !strings.Contains(body, "tsz_output_blocked") {
+		t.Fatalf("expected an error event, got %s", body)
+	}
+	if strings.Contains(texts[0], "forbidden") || strings.Contains(body, "message_stop") {
+		t.Fatalf("expected the stream to end at the block: %s", body)
+	}
+}
+
+func TestMessagesGateway_FinalOnlyStreamChecksToolUse(t *testing.T) {
+	upstream := &mockMessagesUpstream{contentType: "text/event-stream", body: messagesStream("Deleting it now.", "delete_account", `{"id":"42"}`)}
+	upstream.start(t)
+
+	handler := handlers.TestMessagesGatewayForUnit(messagesDetect, handlers.WithToolPolicy(handlers.ToolPolicy{Deny: []string{"delete_account"}}))
+	rec := callMessagesGateway(t, handler, `{"stream":true,"tools":[{"name":"delete_account"}],"messages":[{"role":"user","content":"hi"}]}`, nil)
+
+	body := rec.Body.String()
+	if strings.Contains(body, "delete_account") {
+		t.Fatalf("expected the tool_use block to be withheld in final-only mode: %s", body)
+	}
+	if texts, _, stopReason, _ := collectMessagesStream(t, body); texts[0] != "Deleting it now." || stopReason != "refusal" {
+		t.Fatalf("expected text unchanged and stop_reason refusal, got %q %q", texts[0], stopReason)
+	}
+}
@@ -0,0 +1,170 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/handlers"
+	"thyris-sz/internal/models"
+)
+
+func TestRedact_PartialMask(t *testing.T) {
+	p := models.Pattern{Name: "CREDIT_CARD", RedactionStrategy: "PARTIAL"}
+	if got := guardrails.TestRedactForUnit(p, "4111-1111-1111-1234", ""); got != "****-****-****-1234" {
+		t.Fatalf("unexpected partial mask: %s", got)
+	}
+
+	p.RedactionKeepLast = 2
+	if got := guardrails.TestRedactForUnit(p, "TR12 3456", ""); got != "**** **56" {
+		t.Fatalf("unexpected partial mask with keep=2: %s", got)
+	}
+}
+
+func TestRedact_PartialMasksShortValuesEntirely(t *testing.T) {
+	p := models.Pattern{Name: "PIN", RedactionStrategy: "PARTIAL"}
+	if got := guardrails.TestRedactForUnit(p, "12-34", ""); got != "**-**" {
+		t.Fatalf("expected a value with keep alphanumerics to be fully masked, got %s", got)
+	}
+	if got := guardrails.TestRedactForUnit(p, "123", ""); got != "***" {
+		t.Fatalf("expected a value shorter than keep to be fully masked, got %s", got)
+	}
+}
+
+func TestRedact_Label(t *testing.T) {
+	p := models.Pattern{Name: "EMAIL", RedactionStrategy: "LABEL"}
+	if got := guardrails.TestRedactForUnit(p, "a@b.com", "rid-1"); got != "[EMAIL]" {
+		t.Fatalf("expected default label, got %s", got)
+	}
+
+	p.RedactionLabel = "<email>"
+	if got := guardrails.TestRedactForUnit(p, "a@b.com", "rid-1"); got != "<email>" {
+		t.Fatalf("expected custom label, got %s", got)
+	}
+}
+
+func TestRedact_HMACIsStableAcrossRequests(t *testing.T) {
+	p := models.Pattern{Name: "EMAIL", RedactionStrategy: "HMAC"}
+	a := guardrails.TestRedactForUnit(p, "john@example.com", "rid-1")
+	b := guardrails.TestRedactForUnit(p, "john@example.com", "rid-2")
+	c := guardrails.TestRedactForUnit(p, "jane@example.com", "rid-1")
+
+	if a != b {
+		t.Fatalf("expected identical tokens for identical values, got %s and %s", a, b)
+	}
+	if a == c {
+		t.Fatalf("expected different tokens for different values")
+	}
+	if !regexp.MustCompile(`^\[EMAIL_[0-9a-f]{16}\]$`).MatchString(a) {
+		t.Fatalf("unexpected HMAC token format: %s", a)
+	}
+}
+
+func TestRedact_PseudonymIsScopedToRID(t *testing.T) {
+	p := models.Pattern{Name: "EMAIL", RedactionStrategy: "PSEUDONYM"}
+	first := guardrails.TestRedactForUnit(p, "john@example.com", "conv-1")
+	again := guardrails.TestRedactForUnit(p, "john@example.com", "conv-1")
+	other := guardrails.TestRedactForUnit(p, "john@example.com", "conv-2")
+
+	if first != again {
+		t.Fatalf("expected same pseudonym within a RID, got %s and %s", first, again)
+	}
+	if first == other || strings.TrimPrefix(first, "[conv-1_") == strings.TrimPrefix(other, "[conv-2_") {
+		t.Fatalf("expected pseudonyms to differ across RIDs: %s vs %s", first, other)
+	}
+}
+
+func TestRedact_FormatPreserving(t *testing.T) {
+	p := models.Pattern{Name: "EMAIL", RedactionStrategy: "FORMAT_PRESERVING"}
+	value := "John.Doe42@example.com"
+	got := guardrails.TestRedactForUnit(p, value, "")
+
+	if got == value || len(got) != len(value) {
+		t.Fatalf("expected a different value of the same length, got %s", got)
+	}
+	if got != guardrails.TestRedactForUnit(p, value, "") {
+		t.Fatalf("expected deterministic output")
+	}
+	shape := regexp.MustCompile(`^[A-Z][a-z]{3}\.[A-Z][a-z]{2}[0-9]{2}@[a-z]{7}\.[a-z]{3}$`)
+	if !shape.MatchString(got) {
+		t.Fatalf("expected format to be preserved, got %s", got)
+	}
+}
+
+func TestRedact_DefaultIsRandomPlaceholder(t *testing.T) {
+	p := models.Pattern{Name: "EMAIL"}
+	a := guardrails.TestRedactForUnit(p, "john@example.com", "")
+	b := guardrails.TestRedactForUnit(p, "john@example.com", "")
+	if a == b || !strings.HasPrefix(a, "[EMAIL_") {
+		t.Fatalf("expected unique random placeholders, got %s and %s", a, b)
+	}
+}
+
+func TestIsValidRedactionStrategy(t *testing.T) {
+	for _, s := range []string{"", "partial", "LABEL", "HMAC", "FORMAT_PRESERVING", "PSEUDONYM", "RANDOM"} {
+		if !guardrails.IsValidRedactionStrategy(s) {
+			t.Errorf("expected %q to be valid", s)
+		}
+	}
+	if guardrails.IsValidRedactionStrategy("SHRED") {
+		t.Error("expected unknown strategy to be rejected")
+	}
+}
+
+func TestIsVaultableStrategy(t *testing.T) {
+	for _, name := range []string{"", "random", "HMAC", "PSEUDONYM"} {
+		if !guardrails.TestIsVaultableStrategyForUnit(name) {
+			t.Fatalf("expected %q placeholders to be stored in the vault", name)
+		}
+	}
+	for _, name := range []string{"LABEL", "PARTIAL", "FORMAT_PRESERVING"} {
+		if guardrails.TestIsVaultableStrategyForUnit(name) {
+			t.Fatalf("expected shared %q placeholders to stay out of the vault", name)
+		}
+	}
+}
+
+func TestVault_FormatPreservingLeavesCoincidentalOutputAlone(t *testing.T) {
+	p := models.Pattern{Name: "PHONE", RedactionStrategy: "FORMAT_PRESERVING"}
+	placeholder := guardrails.TestRedactForUnit(p, "555-0100", "RID-1")
+	detections := []models.DetectionResult{{Type: "PHONE", Value: "555-0100", Placeholder: placeholder}}
+
+	vaultable := map[string]bool{}
+	if guardrails.TestIsVaultableStrategyForUnit(p.RedactionStrategy) {
+		vaultable[placeholder] = true
+	}
+	entries := guardrails.TestVaultEntriesForUnit(detections, vaultable)
+
+	// The model quotes a number that happens to equal the placeholder
+	output := "Our support line is " + placeholder + "."
+	if got, n := guardrails.TestRehydrateForUnit(output, entries); got != output || n != 0 {
+		t.Fatalf("expected output to be left alone, got %q (%d replacements)", got, n)
+	}
+}
+
+func TestVaultEntries_SkipsSharedPlaceholders(t *testing.T) {
+	detections := []models.DetectionResult{
+		{Type: "EMAIL", Value: "alice@example.com", Placeholder: "[EMAIL]"},
+		{Type: "SSN", Value: "123-45-6789", Placeholder: "[RID-1_SSN_ab12cd34ef56ab78]"},
+		{Type: "BLOCKLIST", Value: "secret", Placeholder: "[BLOCKED]"},
+	}
+	vaultable := map[string]bool{"[RID-1_SSN_ab12cd34ef56ab78]": true, "[BLOCKED]": true}
+
+	entries := guardrails.TestVaultEntriesForUnit(detections, vaultable)
+	if len(entries) != 1 || entries["[RID-1_SSN_ab12cd34ef56ab78]"] != "123-45-6789" {
+		t.Fatalf("expected only the unique placeholder to be stored, got %v", entries)
+	}
+}
+
+func TestImportTemplate_RejectsUnknownRedactionStrategy(t *testing.T) {
+	body := `{"template":{"name":"t","patterns":[{"Name":"EMAIL","Regex":"x","RedactionStrategy":"SCRAMBLE"}]}}`
+	rr := httptest.NewRecorder()
+	handlers.ImportTemplateHandler(rr, httptest.NewRequest(http.MethodPost, "/templates/import", strings.NewReader(body)))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown redaction strategy, got %d", rr.Code)
+	}
+}
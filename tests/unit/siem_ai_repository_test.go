@@ -1,7 +1,9 @@
 package unit
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -79,6 +81,30 @@ func TestPublishSecurityEvent_RespectsEnvAndSendsJSON(t *testing.T) {
 	}
 }
 
+func TestDetect_SecurityEventKeepsPatternNameAsCategory(t *testing.T) {
+	_ = os.Setenv("SIEM_WEBHOOK_URL", "http://siem.local/webhook")
+	defer os.Unsetenv("SIEM_WEBHOOK_URL")
+
+	origTransport := http.DefaultTransport
+	fake := &fakeRoundTripper{}
+	http.DefaultTransport = fake
+	defer func() { http.DefaultTransport = origTransport }()
+
+	pattern := models.Pattern{Name: "API_KEY", Regex: `sk-[a-z0-9]{8}`, Category: "SECRET", IsActive: true}
+	guardrails.TestDetectWithPatternsForUnit(context.Background(), models.DetectRequest{Text: "key sk-abcd1234", RID: "RID-UNIT-2"}, []models.Pattern{pattern})
+
+	if fake.req == nil {
+		t.Fatalf("expected a security event to be published")
+	}
+	var got models.SecurityEvent
+	if err := json.NewDecoder(fake.req.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode SIEM payload: %v", err)
+	}
+	if got.Category != "API_KEY" || got.Pattern != "API_KEY" || got.PatternCategory != "SECRET" {
+		t.Fatalf("expected category to stay the pattern name and pattern_category to carry SECRET, got %+v", got)
+	}
+}
+
 // --- AI client tests ---
 
 func TestCheckWithAI_PropagatesNon200Status(t *testing.T) {
@@ -103,11 +129,16 @@ func TestCheckWithAI_PropagatesNon200Status(t *testing.T) {
 }
 
 func TestCheckWithAI_SuccessfulYESResponse(t *testing.T) {
-	// Fake upstream AI server that returns a YES-like content
+	// Fake upstream AI server that returns a YES verdict, or free text when unstructured is set
+	unstructured := false
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content := `{\"label\": \"YES\", \"score\": 0.9, \"rationale\": \"looks fine\", \"categories\": []}`
+		if unstructured {
+			content = "YES, looks fine"
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"choices":[{"message":{"content":"YES, looks fine"}}]}`))
+		w.Write([]byte(`{"choices":[{"message":{"content":"` + content + `"}}]}`))
 	}))
 	defer ts.Close()
 
@@ -124,6 +155,13 @@ func TestCheckWithAI_SuccessfulYESResponse(t *testing.T) {
 	if !ok {
 		t.Fatalf("expected ok=true for YES response")
 	}
+
+	// A reply merely starting with the expected label is not a verdict
+	unstructured = true
+	ok, err = ai.CheckWithAI("other text", "Respond YES if ok", "YES")
+	if !errors.Is(err, ai.ErrMalformedVerdict) || ok {
+		t.Fatalf("expected a malformed verdict for free text, got ok=%v err=%v", ok, err)
+	}
 }
 
 // --- Repository + cache tests ---
@@ -0,0 +1,124 @@
+package unit
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"thyris-sz/internal/handlers"
+	"thyris-sz/internal/models"
+)
+
+var fakeCardRe = regexp.MustCompile(`\d{12,19}`)
+
+// fakeCardDetect masks digit runs like a card pattern and counts scanned bytes
+func fakeCardDetect(scanned *int) func(models.DetectRequest) models.DetectResponse {
+	return func(req models.DetectRequest) models.DetectResponse {
+		*scanned += len(req.Text)
+		resp := models.DetectResponse{}
+		for _, loc := range fakeCardRe.FindAllStringIndex(req.Text, -1) {
+			resp.Detections = append(resp.Detections, models.DetectionResult{
+				Type:        "CREDIT_CARD",
+				Value:       req.Text[loc[0]:loc[1]],
+				Placeholder: "[CARD]",
+				Start:       loc[0],
+				End:         loc[1],
+			})
+		}
+		return resp
+	}
+}
+
+// splitEvery cuts s into chunks of n bytes, like token deltas
+func splitEvery(s string, n int) []string {
+	var out []string
+	for len(s) > n {
+		out = append(out, s[:n])
+		s = s[n:]
+	}
+	return append(out, s)
+}
+
+func TestSafeCut_PrefersWhitespace(t *testing.T) {
+	s := "the card number is 4111111111111111 ok"
+	cut := handlers.TestSafeCutForUnit(s, 30)
+	if cut != len("the card number is ") {
+		t.Fatalf("expected cut after the last space, got %d (%q)", cut, s[:cut])
+	}
+
+	if handlers.TestSafeCutForUnit(s, 0) != 0 || handlers.TestSafeCutForUnit(s, 100) != len(s) {
+		t.Fatalf("expected cut to be clamped to the text")
+	}
+}
+
+func TestSafeCut_RuneBoundary(t *testing.T) {
+	s := "ğüşçöıİĞÜŞÇÖ"
+	for n := 1; n < len(s); n++ {
+		cut := handlers.TestSafeCutForUnit(s, n)
+		if cut > n || !utf8.ValidString(s[:cut]) {
+			t.Fatalf("cut %d for n=%d splits a rune", cut, n)
+		}
+	}
+}
+
+func TestTailOnRuneBoundary(t *testing.T) {
+	if got := handlers.TestTailOnRuneBoundaryForUnit("short", 10); got != "short" {
+		t.Fatalf("expected short text unchanged, got %q", got)
+	}
+	got := handlers.TestTailOnRuneBoundaryForUnit("abcğüş", 5)
+	if !utf8.ValidString(got) || len(got) > 5 || got != "üş" {
+		t.Fatalf("unexpected tail %q", got)
+	}
+}
+
+func TestStreamGuard_PassThroughWithoutGuardrails(t *testing.T) {
+	scanned := 0
+	chunks, scans := handlers.TestStreamGuardForUnit(fakeCardDetect(&scanned), nil, 32, 16, []string{"Hello", ", ", "world"})
+	if got := strings.Join(chunks, ""); got != "Hello, world" {
+		t.Fatalf("expected text to pass through unchanged, got %q", got)
+	}
+	if scans != 0 {
+		t.Fatalf("expected no scans without guardrails, got %d", scans)
+	}
+}
+
+func TestStreamGuard_MasksValueSplitAcrossDeltas(t *testing.T) {
+	text := "Your card is 4111111111111111 and the backup card is 5500000000000004, keep them safe. " +
+		strings.Repeat("Some more harmless text follows here. ", 5)
+
+	scanned := 0
+	chunks, _ := handlers.TestStreamGuardForUnit(fakeCardDetect(&scanned), []string{"PII"}, 32, 24, splitEvery(text, 3))
+
+	got := strings.Join(chunks, "")
+	want := fakeCardRe.ReplaceAllString(text, "[CARD]")
+	if got != want {
+		t.Fatalf("unexpected output\n got: %q\nwant: %q", got, want)
+	}
+	for _, c := range chunks {
+		if fakeCardRe.MatchString(c) || strings.Contains(c, "4111") {
+			t.Fatalf("chunk leaked card digits: %q", c)
+		}
+	}
+	if strings.Count(got, "[CARD]") != 2 {
+		t.Fatalf("expected each placeholder exactly once, got %q", got)
+	}
+}
+
+func TestStreamGuard_LinearScanCost(t *testing.T) {
+	text := strings.Repeat("lorem ipsum dolor sit amet ", 400) // ~10 KB
+
+	scanned := 0
+	chunks, scans := handlers.TestStreamGuardForUnit(fakeCardDetect(&scanned), []string{"PII"}, 64, 32, splitEvery(text, 4))
+
+	if got := strings.Join(chunks, ""); got != text {
+		t.Fatalf("expected clean text to be released unchanged")
+	}
+	// Each scan covers at most window + 2*holdBack (+ one delta) bytes
+	if scanned > scans*(64+2*32+4) {
+		t.Fatalf("scan exceeded its bound: %d bytes over %d scans", scanned, scans)
+	}
+	if scanned > 6*len(text) {
+		t.Fatalf("expected roughly linear cost, scanned %d bytes for %d bytes of text", scanned, len(text))
+	}
+}
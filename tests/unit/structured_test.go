@@ -0,0 +1,80 @@
+package unit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/models"
+)
+
+const structuredDoc = `{
+  "user": {"name": "John \"JD\" Doe", "emails": ["john@example.com", "jd@example.com"], "age": 42},
+  "notes": "call +1 555 0100",
+  "odd key": "x\\y",
+  "items": [{"sku": "A-1", "secret": "token"}]
+}`
+
+func TestJSONStringLeaves_PathsAndRawTokens(t *testing.T) {
+	paths, values, raws, err := guardrails.TestJSONStringLeavesForUnit(structuredDoc, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantPaths := []string{
+		"$.user.name", "$.user.emails[0]", "$.user.emails[1]", "$.notes", "$['odd key']", "$.items[0].sku", "$.items[0].secret",
+	}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Fatalf("unexpected paths:\n got %v\nwant %v", paths, wantPaths)
+	}
+
+	for i, raw := range raws {
+		var decoded string
+		if err := json.Unmarshal([]byte(raw), &decoded); err != nil || decoded != values[i] {
+			t.Errorf("raw token %q does not decode to %q (err %v)", raw, values[i], err)
+		}
+	}
+}
+
+func TestJSONStringLeaves_IncludeExclude(t *testing.T) {
+	tests := []struct {
+		name             string
+		include, exclude []string
+		want             []string
+	}{
+		{"include subtree", []string{"$.user"}, nil, []string{"$.user.name", "$.user.emails[0]", "$.user.emails[1]"}},
+		{"include index", []string{"$.user.emails[1]"}, nil, []string{"$.user.emails[1]"}},
+		{"exclude wildcard", nil, []string{"$.user", "$.items[*].sku", "$['odd key']"}, []string{"$.notes", "$.items[0].secret"}},
+		{"descendant", []string{"$..secret"}, nil, []string{"$.items[0].secret"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, _, _, err := guardrails.TestJSONStringLeavesForUnit(structuredDoc, tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(paths, tt.want) {
+				t.Fatalf("got %v, want %v", paths, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDetectRequest_Structured(t *testing.T) {
+	ok := models.DetectRequest{JSON: json.RawMessage(`{"a":"b"}`), IncludePaths: []string{"$.a"}}
+	if err := guardrails.ValidateDetectRequest(ok); err != nil {
+		t.Fatalf("expected structured request without text to be valid, got %v", err)
+	}
+
+	badJSON := models.DetectRequest{JSON: json.RawMessage(`{"a":`)}
+	if err := guardrails.ValidateDetectRequest(badJSON); err != guardrails.ErrInvalidJSON {
+		t.Fatalf("expected ErrInvalidJSON, got %v", err)
+	}
+
+	badPath := models.DetectRequest{JSON: json.RawMessage(`{}`), ExcludePaths: []string{"user.name"}}
+	if err := guardrails.ValidateDetectRequest(badPath); err == nil {
+		t.Fatal("expected JSONPath without $ to be rejected")
+	}
+}
@@ -0,0 +1,102 @@
+package unit
+
+import (
+	"context"
+	"testing"
+
+	"thyris-sz/internal/guardrails"
+	"thyris-sz/internal/models"
+)
+
+func TestVerifiers_ChecksumAndRangeRules(t *testing.T) {
+	tests := []struct {
+		verifier string
+		value    string
+		valid    bool
+	}{
+		{"LUHN", "4111 1111 1111 1111", true},
+		{"LUHN", "4111-1111-1111-1112", false},
+		{"LUHN", "20240115123045", false}, // timestamp-like run of digits
+		{"TCKN", "10000000146", true},
+		{"TCKN", "10000000147", false},
+		{"TCKN", "01234567890", false}, // leading zero
+		{"VKN", "1234567890", true},
+		{"VKN", "1234567891", false},
+		{"IBAN", "TR33 0006 1005 1978 6457 8413 26", true},
+		{"IBAN", "GB82WEST12345698765432", true},
+		{"IBAN", "TR33 0006 1005 1978 6457 8413 27", false},
+		{"UK_NINO", "AB123456C", true},
+		{"UK_NINO", "GB123456A", false}, // reserved prefix
+		{"UK_NINO", "DA123456A", false}, // invalid first letter
+		{"US_SSN", "123-45-6789", true},
+		{"US_SSN", "666-45-6789", false},
+		{"US_SSN", "912-45-6789", false},
+		{"US_SSN", "123-00-6789", false},
+		{"US_SSN", "123-45-0000", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.verifier+"/"+tt.value, func(t *testing.T) {
+			passed, known := guardrails.TestRunVerifierForUnit(tt.verifier, tt.value)
+			if !known {
+				t.Fatalf("expected verifier %s to be registered", tt.verifier)
+			}
+			if passed != tt.valid {
+				t.Fatalf("expected %v for %s(%q), got %v", tt.valid, tt.verifier, tt.value, passed)
+			}
+		})
+	}
+}
+
+func TestVerifiers_UnknownNameIsNotKnown(t *testing.T) {
+	if _, known := guardrails.TestRunVerifierForUnit("NOPE", "123"); known {
+		t.Fatalf("expected unknown verifier to report known=false")
+	}
+}
+
+func TestIsValidVerifier(t *testing.T) {
+	for _, name := range []string{"", "luhn", "TCKN", "VKN", "IBAN", "UK_NINO", "US_SSN"} {
+		if !guardrails.IsValidVerifier(name) {
+			t.Errorf("expected %q to be valid", name)
+		}
+	}
+	if guardrails.IsValidVerifier("LUHNN") {
+		t.Error("expected unknown verifier to be rejected")
+	}
+}
+
+func TestComputeConfidence_VerifiedMatchScoresHigher(t *testing.T) {
+	base := guardrails.ConfidenceContext{Source: "REGEX", PatternCategory: "PII", PatternActive: true}
+	verified := base
+	verified.Verified = true
+
+	if guardrails.ComputeConfidence(verified) <= guardrails.ComputeConfidence(base) {
+		t.Fatalf("expected verified match to score higher than unverified")
+	}
+}
+
+func TestDetect_VerifiedVKNWithKeywordsIsMaskedNotBlocked(t *testing.T) {
+	vkn := models.Pattern{
+		Name:            "VKN",
+		Regex:           `\b\d{10}\b`,
+		Category:        "PII",
+		IsActive:        true,
+		Verifier:        "VKN",
+		ContextKeywords: []string{"vergi", "vkn", "tax id", "tax number", "vergi no"},
+	}
+
+	resp := guardrails.TestDetectWithPatternsForUnit(context.Background(), models.DetectRequest{Text: "Vergi no: 1234567890, VKN kayıtlı", Mode: "MASK"}, []models.Pattern{vkn})
+	if len(resp.Detections) != 1 {
+		t.Fatalf("expected one VKN detection, got %+v", resp.Detections)
+	}
+	d := resp.Detections[0]
+	if hits := d.ConfidenceExplanation.ContextKeywords; len(hits) != 2 {
+		t.Fatalf("expected \"vergi\" to be counted once inside \"vergi no\", got %v", hits)
+	}
+	if resp.Blocked || float64(d.ConfidenceExplanation.RegexScore) >= guardrails.TestGetBlockThresholdForUnit() {
+		t.Fatalf("expected a corroborated VKN to stay below the block threshold, got %v (blocked=%v)", d.ConfidenceExplanation.RegexScore, resp.Blocked)
+	}
+	if resp.RedactedText != "Vergi no: "+d.Placeholder+", VKN kayıtlı" {
+		t.Fatalf("expected the VKN to be masked, got %q", resp.RedactedText)
+	}
+}